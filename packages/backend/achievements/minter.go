@@ -0,0 +1,360 @@
+// Package achievements mints an NFT of the AuraAchievements contract to a
+// user's wallet when they complete a habit
+package achievements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/outbox"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/achievements")
+
+var (
+	mintSelector       = starknet.SelectorFromName("mint")
+	tokenForHabit      = starknet.SelectorFromName("token_for_habit")
+	mintedEventKey     = starknet.SelectorFromName("AchievementMinted")
+	errInvalidAddress  = errors.New("wallet address is not a felt")
+	errMissingTokenLog = errors.New("receipt has no AchievementMinted event")
+)
+
+// batchSize bounds the achievements handled per poll
+const batchSize = 20
+
+// Config configures the minting of achievements
+type Config struct {
+	ContractAddress string
+	PollInterval    time.Duration
+	MaxAttempts     int           // Submissions tried before an achievement fails
+	ResubmitAfter   time.Duration // Unknown transactions older than this are sent again
+}
+
+// Node is the subset of the Starknet RPC used to follow mints
+type Node interface {
+	CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Minter submits the mints of queued achievements from the operator account
+// and follows their transactions until the token is minted. The contract
+// mints once per habit and reverts any later mint, so before a mint is sent
+// again or given up on, the token of the habit is read from the contract.
+// Achievements queued with a mint in the transaction outbox are sent by the
+// outbox worker, which reports their progress to TransactionUpdated.
+type Minter struct {
+	Store  store.AchievementStore
+	Sender starknet.Sender
+	Chain  Node
+	Config Config
+
+	Minted *metrics.Counter // Counts minted achievements, optional
+}
+
+// NewMinter creates the achievement minter
+func NewMinter(s store.AchievementStore, sender starknet.Sender, chain Node, config Config) *Minter {
+	return &Minter{Store: s, Sender: sender, Chain: chain, Config: config}
+}
+
+// Run processes queued achievements every poll interval until the context is cancelled
+func (m *Minter) Run(ctx context.Context) {
+	slog.Info("Achievement minter started", "contract", m.Config.ContractAddress)
+
+	ticker := time.NewTicker(m.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process achievements", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process submits queued mints and checks the receipts of submitted ones
+func (m *Minter) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "achievements.process")
+	defer func() { tracing.End(span, err) }()
+
+	pending, err := m.Store.PendingAchievements(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		a := &pending[i]
+		switch a.Status {
+		case store.AchievementQueued:
+			err = m.submit(ctx, a)
+		case store.AchievementSubmitted:
+			err = m.confirm(ctx, a)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit sends the mint transaction of a queued achievement
+func (m *Minter) submit(ctx context.Context, a *store.Achievement) error {
+	calldata, err := MintCalldata(a)
+	if err != nil {
+		return m.fail(ctx, a, err.Error())
+	}
+
+	txHash, err := m.Sender.Invoke(ctx, []starknet.FunctionCall{{
+		ContractAddress:    m.Config.ContractAddress,
+		EntryPointSelector: mintSelector,
+		Calldata:           calldata,
+	}})
+	a.Attempts++
+	if err != nil {
+		slog.Warn("Failed to submit achievement mint", "achievement_id", a.ID, "attempt", a.Attempts, logging.Err(err))
+		a.LastError = err.Error()
+		if a.Attempts >= m.Config.MaxAttempts {
+			return m.failUnlessMinted(ctx, a, a.LastError)
+		}
+		a.UpdatedAt = time.Now()
+		return m.Store.UpdateAchievement(ctx, a)
+	}
+
+	a.Status = store.AchievementSubmitted
+	a.TransactionHash = &txHash
+	a.LastError = ""
+	a.UpdatedAt = time.Now()
+	return m.Store.UpdateAchievement(ctx, a)
+}
+
+// confirm checks the receipt of a submitted mint
+func (m *Minter) confirm(ctx context.Context, a *store.Achievement) error {
+	receipt, err := m.Chain.GetTransactionReceipt(ctx, *a.TransactionHash)
+	if starknet.IsNotFound(err) {
+		// The transaction may have been dropped from the mempool
+		if time.Since(a.UpdatedAt) > m.Config.ResubmitAfter {
+			if minted, err := m.closeIfMinted(ctx, a); err != nil || minted {
+				return err
+			}
+			a.Status = store.AchievementQueued
+			a.LastError = "transaction not found"
+			a.UpdatedAt = time.Now()
+			return m.Store.UpdateAchievement(ctx, a)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return m.failUnlessMinted(ctx, a, "reverted: "+receipt.RevertReason)
+	}
+
+	tokenID, err := TokenFromReceipt(receipt, m.Config.ContractAddress)
+	if err != nil {
+		return m.fail(ctx, a, err.Error())
+	}
+	return m.minted(ctx, a, tokenID)
+}
+
+// closeIfMinted marks an achievement minted when the contract already holds
+// a token for its habit, minted by an earlier transaction
+func (m *Minter) closeIfMinted(ctx context.Context, a *store.Achievement) (bool, error) {
+	habitID, err := HabitFelt(a.HabitID)
+	if err != nil {
+		return false, err
+	}
+	result, err := m.Chain.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    m.Config.ContractAddress,
+		EntryPointSelector: tokenForHabit,
+		Calldata:           []string{habitID},
+	}, starknet.LatestBlock)
+	if err != nil {
+		return false, err
+	}
+	if len(result) != 2 {
+		return false, fmt.Errorf("token_for_habit: got %d felts, want a u256", len(result))
+	}
+	tokenID, err := starknet.U256FromFelts(result[0], result[1])
+	if err != nil {
+		return false, err
+	}
+	// Token ids start at 1, 0 is a habit without a token
+	if tokenID.Sign() == 0 {
+		return false, nil
+	}
+	return true, m.minted(ctx, a, tokenID.String())
+}
+
+// failUnlessMinted gives up on an achievement whose habit has no token
+func (m *Minter) failUnlessMinted(ctx context.Context, a *store.Achievement, reason string) error {
+	if minted, err := m.closeIfMinted(ctx, a); err != nil || minted {
+		return err
+	}
+	return m.fail(ctx, a, reason)
+}
+
+// minted marks an achievement minted as tokenID
+func (m *Minter) minted(ctx context.Context, a *store.Achievement, tokenID string) error {
+	a.Status = store.AchievementMinted
+	a.TokenID = &tokenID
+	a.LastError = ""
+	a.UpdatedAt = time.Now()
+	if err := m.Store.UpdateAchievement(ctx, a); err != nil {
+		return err
+	}
+	m.Minted.Inc()
+	slog.Info("Achievement minted", "achievement_id", a.ID, "token_id", tokenID)
+	return nil
+}
+
+// TransactionUpdated applies the progress of a mint sent through the outbox
+// to its achievement
+func (m *Minter) TransactionUpdated(ctx context.Context, tx *store.OutboxTransaction, receipt *starknet.Receipt) error {
+	a, err := m.Store.GetAchievement(ctx, tx.Reference)
+	if err != nil {
+		return err
+	}
+	wasMinted := a.Status == store.AchievementMinted
+
+	switch tx.Status {
+	case store.OutboxSubmitted:
+		a.Status = store.AchievementSubmitted
+		a.LastError = ""
+	case store.OutboxConfirmed:
+		tokenID, err := TokenFromReceipt(receipt, m.Config.ContractAddress)
+		if err != nil {
+			a.Status = store.AchievementFailed
+			a.LastError = err.Error()
+			break
+		}
+		a.Status = store.AchievementMinted
+		a.TokenID = &tokenID
+		a.LastError = ""
+	case store.OutboxReverted, store.OutboxFailed:
+		a.Status = store.AchievementFailed
+		a.LastError = tx.LastError
+	default:
+		return nil
+	}
+	a.TransactionHash = tx.TransactionHash
+	a.Attempts = tx.Attempts
+	a.UpdatedAt = time.Now()
+	if err := m.Store.UpdateAchievement(ctx, a); err != nil {
+		return err
+	}
+
+	if a.Status == store.AchievementMinted && !wasMinted {
+		m.Minted.Inc()
+		slog.Info("Achievement minted", "achievement_id", a.ID, "token_id", *a.TokenID)
+	}
+	return nil
+}
+
+// fail gives up on an achievement
+func (m *Minter) fail(ctx context.Context, a *store.Achievement, reason string) error {
+	slog.Error("Achievement mint failed", "achievement_id", a.ID, "reason", reason)
+
+	a.Status = store.AchievementFailed
+	a.LastError = reason
+	a.UpdatedAt = time.Now()
+	return m.Store.UpdateAchievement(ctx, a)
+}
+
+// MintCalldata encodes the arguments of the contract's mint function:
+// recipient, habit id, name, goal days and the start and completion times
+func MintCalldata(a *store.Achievement) ([]string, error) {
+	to, err := starknet.ParseFelt(a.WalletAddress)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidAddress, a.WalletAddress)
+	}
+	habitID, err := HabitFelt(a.HabitID)
+	if err != nil {
+		return nil, err
+	}
+
+	calldata := []string{starknet.FeltToHex(to), habitID}
+	calldata = append(calldata, starknet.EncodeByteArray(a.HabitName)...)
+	return append(calldata,
+		starknet.FeltToHex(big.NewInt(int64(a.GoalDays))),
+		starknet.FeltToHex(big.NewInt(a.StartedAt.Unix())),
+		starknet.FeltToHex(big.NewInt(a.CompletedAt.Unix())),
+	), nil
+}
+
+// MintTransaction builds the outbox transaction minting an achievement
+func MintTransaction(a *store.Achievement, contractAddress string, now time.Time) (*store.OutboxTransaction, error) {
+	calldata, err := MintCalldata(a)
+	if err != nil {
+		return nil, err
+	}
+	return outbox.NewTransaction(a.UserID, store.OutboxAchievementMint, a.ID, []starknet.FunctionCall{{
+		ContractAddress:    contractAddress,
+		EntryPointSelector: mintSelector,
+		Calldata:           calldata,
+	}}, now)
+}
+
+// HabitFelt packs the 128 bits of a habit UUID in a felt
+func HabitFelt(habitID string) (string, error) {
+	id, err := uuid.Parse(habitID)
+	if err != nil {
+		return "", fmt.Errorf("invalid habit id %q: %w", habitID, err)
+	}
+	return starknet.FeltToHex(new(big.Int).SetBytes(id[:])), nil
+}
+
+// TokenFromReceipt returns the id of the token minted by a transaction,
+// read from its AchievementMinted event, whose keys are the selector, the
+// recipient and the two halves of the u256 token id
+func TokenFromReceipt(receipt *starknet.Receipt, contractAddress string) (string, error) {
+	contract := starknet.NormalizeAddress(contractAddress)
+	for _, event := range receipt.Events {
+		if starknet.NormalizeAddress(event.FromAddress) != contract || len(event.Keys) < 4 {
+			continue
+		}
+		if starknet.NormalizeAddress(event.Keys[0]) != mintedEventKey {
+			continue
+		}
+
+		tokenID, err := starknet.U256FromFelts(event.Keys[2], event.Keys[3])
+		if err != nil {
+			return "", err
+		}
+		return tokenID.String(), nil
+	}
+	return "", errMissingTokenLog
+}
+
+// NewAchievement builds the queued achievement of a completed habit
+func NewAchievement(habit *store.Habit, walletAddress string, completedAt time.Time) *store.Achievement {
+	return &store.Achievement{
+		ID:            uuid.New().String(),
+		UserID:        habit.UserID,
+		HabitID:       habit.ID,
+		HabitName:     habit.Name,
+		GoalDays:      habit.GoalDays,
+		StartedAt:     habit.CreatedAt,
+		CompletedAt:   completedAt,
+		WalletAddress: walletAddress,
+		Status:        store.AchievementQueued,
+		CreatedAt:     completedAt,
+		UpdatedAt:     completedAt,
+	}
+}
@@ -0,0 +1,281 @@
+package achievements
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/starknet/starknettest"
+	"aura-backend/store"
+)
+
+const (
+	contractAddress = "0x0abc"
+	habitID         = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+)
+
+func queue(t *testing.T, s *store.Memory) *store.Achievement {
+	t.Helper()
+
+	habit := &store.Habit{ID: habitID, UserID: "user-1", Name: "Read", GoalDays: 7, CreatedAt: time.Unix(1735689600, 0)}
+	achievement := NewAchievement(habit, "0x123", time.Unix(1736294400, 0))
+	if err := s.CreateAchievement(context.Background(), achievement); err != nil {
+		t.Fatal(err)
+	}
+	return achievement
+}
+
+func newTestMinter(s *store.Memory, sender *starknettest.Sender, chain Node) *Minter {
+	return NewMinter(s, sender, chain, Config{
+		ContractAddress: contractAddress,
+		PollInterval:    time.Second,
+		MaxAttempts:     2,
+		ResubmitAfter:   time.Minute,
+	})
+}
+
+func TestMintCalldata(t *testing.T) {
+	habit := &store.Habit{ID: habitID, UserID: "user-1", Name: "Read", GoalDays: 7, CreatedAt: time.Unix(1735689600, 0)}
+	calldata, err := MintCalldata(NewAchievement(habit, "0x0123", time.Unix(1736294400, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"0x123",
+		"0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f",
+		"0x0", "0x52656164", "0x4", // "Read" as a ByteArray
+		"0x7",
+		"0x67748580",
+		"0x677dc000",
+	}
+	if !reflect.DeepEqual(calldata, want) {
+		t.Errorf("calldata = %v, want %v", calldata, want)
+	}
+
+	if _, err := MintCalldata(NewAchievement(habit, "not-an-address", time.Now())); !errors.Is(err, errInvalidAddress) {
+		t.Errorf("invalid address: %v", err)
+	}
+}
+
+func TestMintPipeline(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	achievement := queue(t, s)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xfeed": map[string]interface{}{
+			"transaction_hash": "0xfeed",
+			"execution_status": starknet.ExecutionSucceeded,
+			"finality_status":  starknet.FinalityAcceptedL2,
+			"events": []map[string]interface{}{{
+				"from_address": "0xabc",
+				"keys":         []string{starknet.SelectorFromName("AchievementMinted"), "0x123", "0x2a", "0x0"},
+				"data":         []string{"0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f"},
+			}},
+		},
+	})
+	sender := &starknettest.Sender{TxHash: "0xfeed"}
+	minter := newTestMinter(s, sender, chain)
+
+	// The first pass submits the mint
+	if err := minter.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls) != 1 || sender.Calls[0][0].EntryPointSelector != starknet.SelectorFromName("mint") {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementSubmitted || *list[0].TransactionHash != "0xfeed" {
+		t.Fatalf("after submit: %+v", list[0])
+	}
+
+	// The second reads the token id from the receipt
+	if err := minter.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = s.ListAchievements(ctx, "user-1")
+	if list[0].ID != achievement.ID || list[0].Status != store.AchievementMinted || list[0].TokenID == nil || *list[0].TokenID != "42" {
+		t.Fatalf("after receipt: %+v", list[0])
+	}
+	if len(sender.Calls) != 1 {
+		t.Errorf("mint sent %d times", len(sender.Calls))
+	}
+}
+
+func TestMintRetriesThenFails(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	queue(t, s)
+
+	sender := &starknettest.Sender{Err: errors.New("insufficient fee")}
+	chain := starknettest.NewNode(t, nil)
+	chain.SetResult("token_for_habit", "0x0", "0x0")
+	minter := newTestMinter(s, sender, chain)
+
+	minter.Process(ctx)
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementQueued || list[0].Attempts != 1 {
+		t.Fatalf("after first failure: %+v", list[0])
+	}
+
+	minter.Process(ctx)
+	list, _ = s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementFailed || list[0].LastError != "insufficient fee" {
+		t.Fatalf("after max attempts: %+v", list[0])
+	}
+}
+
+func TestMintReverted(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	queue(t, s)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xbad": map[string]interface{}{
+			"transaction_hash": "0xbad",
+			"execution_status": starknet.ExecutionReverted,
+			"finality_status":  starknet.FinalityAcceptedL2,
+			"revert_reason":    "Caller is not the minter",
+		},
+	})
+	chain.SetResult("token_for_habit", "0x0", "0x0")
+	minter := newTestMinter(s, &starknettest.Sender{TxHash: "0xbad"}, chain)
+
+	minter.Process(ctx)
+	minter.Process(ctx)
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementFailed {
+		t.Fatalf("reverted mint: %+v", list[0])
+	}
+}
+
+func TestMintResubmitsDroppedTransaction(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	achievement := queue(t, s)
+
+	hash := "0xlost"
+	achievement.Status = store.AchievementSubmitted
+	achievement.TransactionHash = &hash
+	achievement.UpdatedAt = time.Now().Add(-time.Hour)
+	s.UpdateAchievement(ctx, achievement)
+
+	chain := starknettest.NewNode(t, nil)
+	chain.SetResult("token_for_habit", "0x0", "0x0")
+	minter := newTestMinter(s, &starknettest.Sender{TxHash: "0xnew"}, chain)
+	minter.Process(ctx)
+
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementQueued {
+		t.Fatalf("dropped transaction: %+v", list[0])
+	}
+}
+
+func TestMintLandedAfterResubmitDelay(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	achievement := queue(t, s)
+
+	hash := "0xslow"
+	achievement.Status = store.AchievementSubmitted
+	achievement.TransactionHash = &hash
+	achievement.UpdatedAt = time.Now().Add(-time.Hour)
+	s.UpdateAchievement(ctx, achievement)
+
+	// The node lost the receipt, but the contract holds the habit's token
+	chain := starknettest.NewNode(t, nil)
+	chain.SetResult("token_for_habit", "0x2a", "0x0")
+	sender := &starknettest.Sender{TxHash: "0xnew"}
+	minter := newTestMinter(s, sender, chain)
+	minter.Process(ctx)
+	minter.Process(ctx)
+
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementMinted || list[0].TokenID == nil || *list[0].TokenID != "42" {
+		t.Fatalf("minted transaction: %+v", list[0])
+	}
+	if len(sender.Calls) != 0 {
+		t.Errorf("mint sent again %d times", len(sender.Calls))
+	}
+}
+
+func TestMintRevertedAlreadyMinted(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	queue(t, s)
+
+	// An earlier send landed: the one confirmed reverted
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xagain": map[string]interface{}{
+			"transaction_hash": "0xagain",
+			"execution_status": starknet.ExecutionReverted,
+			"finality_status":  starknet.FinalityAcceptedL2,
+			"revert_reason":    "ALREADY_MINTED",
+		},
+	})
+	chain.SetResult("token_for_habit", "0x2a", "0x0")
+	minter := newTestMinter(s, &starknettest.Sender{TxHash: "0xagain"}, chain)
+
+	minter.Process(ctx)
+	minter.Process(ctx)
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementMinted || *list[0].TokenID != "42" {
+		t.Fatalf("reverted mint of a minted habit: %+v", list[0])
+	}
+}
+
+func TestMintThroughOutbox(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	achievement := queue(t, s)
+	minter := newTestMinter(s, &starknettest.Sender{}, starknettest.NewNode(t, nil))
+
+	tx, err := MintTransaction(achievement, contractAddress, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Kind != store.OutboxAchievementMint || tx.Reference != achievement.ID || tx.UserID != "user-1" {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+
+	hash := "0xfeed"
+	tx.Status = store.OutboxSubmitted
+	tx.TransactionHash = &hash
+	tx.Attempts = 1
+	if err := minter.TransactionUpdated(ctx, tx, nil); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementSubmitted || *list[0].TransactionHash != "0xfeed" || list[0].Attempts != 1 {
+		t.Fatalf("after submit: %+v", list[0])
+	}
+
+	tx.Status = store.OutboxConfirmed
+	receipt := &starknet.Receipt{
+		TransactionHash: "0xfeed",
+		ExecutionStatus: starknet.ExecutionSucceeded,
+		Events: []starknet.ReceiptEvent{{
+			FromAddress: "0xabc",
+			Keys:        []string{starknet.SelectorFromName("AchievementMinted"), "0x123", "0x2a", "0x0"},
+		}},
+	}
+	if err := minter.TransactionUpdated(ctx, tx, receipt); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementMinted || list[0].TokenID == nil || *list[0].TokenID != "42" {
+		t.Fatalf("after receipt: %+v", list[0])
+	}
+
+	tx.Status = store.OutboxReverted
+	tx.LastError = "reverted: out of gas"
+	minter.TransactionUpdated(ctx, tx, nil)
+	list, _ = s.ListAchievements(ctx, "user-1")
+	if list[0].Status != store.AchievementFailed || list[0].LastError != tx.LastError {
+		t.Errorf("after revert: %+v", list[0])
+	}
+}
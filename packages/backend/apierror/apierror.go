@@ -0,0 +1,221 @@
+// Package apierror defines the errors returned by the API, their machine
+// readable codes and HTTP statuses, and writes them as a JSON envelope or an
+// RFC 7807 problem document
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"aura-backend/logging"
+)
+
+// Code identifies an error for clients, which should branch on it rather
+// than on the message
+type Code string
+
+// Error codes. The status each one is returned with is in statuses.
+const (
+	CodeInvalidRequest         Code = "INVALID_REQUEST"
+	CodeValidationFailed       Code = "VALIDATION_FAILED"
+	CodePayloadTooLarge        Code = "PAYLOAD_TOO_LARGE"
+	CodeUnauthorized           Code = "UNAUTHORIZED"
+	CodeTokenExpired           Code = "TOKEN_EXPIRED"
+	CodeTokenInvalid           Code = "TOKEN_INVALID"
+	CodeForbidden              Code = "FORBIDDEN"
+	CodeNotFound               Code = "NOT_FOUND"
+	CodeHabitNotFound          Code = "HABIT_NOT_FOUND"
+	CodeHabitLimitReached      Code = "HABIT_LIMIT_REACHED"
+	CodeGoalTooLong            Code = "GOAL_TOO_LONG"
+	CodeAlreadyTrackedToday    Code = "ALREADY_TRACKED_TODAY"
+	CodeInvalidPlan            Code = "INVALID_PLAN"
+	CodePlanNotPurchasable     Code = "PLAN_NOT_PURCHASABLE"
+	CodePlanNotSelfService     Code = "PLAN_NOT_SELF_SERVICE"
+	CodePaymentNotFound        Code = "PAYMENT_NOT_FOUND"
+	CodeTrialAlreadyUsed       Code = "TRIAL_ALREADY_USED"
+	CodePromoCodeNotFound      Code = "PROMO_CODE_NOT_FOUND"
+	CodePromoCodeExpired       Code = "PROMO_CODE_EXPIRED"
+	CodePromoCodeExhausted     Code = "PROMO_CODE_EXHAUSTED"
+	CodePromoAlreadyRedeemed   Code = "PROMO_CODE_ALREADY_REDEEMED"
+	CodePromoNotApplicable     Code = "PROMO_CODE_NOT_APPLICABLE"
+	CodeReferralNotFound       Code = "REFERRAL_NOT_FOUND"
+	CodeReferralAlreadyClaimed Code = "REFERRAL_ALREADY_CLAIMED"
+	CodeSelfReferral           Code = "SELF_REFERRAL"
+	CodeStakeNotFound          Code = "STAKE_NOT_FOUND"
+	CodeAlreadyStaked          Code = "ALREADY_STAKED"
+	CodeHabitAlreadyCompleted  Code = "HABIT_ALREADY_COMPLETED"
+	CodeHabitInProgress        Code = "HABIT_IN_PROGRESS"
+	CodeWalletNotFound         Code = "WALLET_NOT_FOUND"
+	CodeAttestationNotFound    Code = "ATTESTATION_NOT_FOUND"
+	CodeRateLimited            Code = "RATE_LIMITED"
+	CodeFeatureDisabled        Code = "FEATURE_DISABLED"
+	CodeChainUnavailable       Code = "CHAIN_UNAVAILABLE"
+	CodeReauthRequired         Code = "REAUTHENTICATION_REQUIRED"
+	CodePINNotSet              Code = "PIN_NOT_SET"
+	CodeInvalidPIN             Code = "INVALID_PIN"
+	CodePINLocked              Code = "PIN_LOCKED"
+	CodeWalletNotCustodial     Code = "WALLET_NOT_CUSTODIAL"
+	CodeWalletNotDeployed      Code = "WALLET_NOT_DEPLOYED"
+	CodeWalletAlreadyExported  Code = "WALLET_ALREADY_EXPORTED"
+	CodeRecoveryInProgress     Code = "RECOVERY_IN_PROGRESS"
+	CodeRecoveryNotFound       Code = "RECOVERY_NOT_FOUND"
+	CodeInternal               Code = "INTERNAL_ERROR"
+)
+
+var statuses = map[Code]int{
+	CodeInvalidRequest:         http.StatusBadRequest,
+	CodeValidationFailed:       http.StatusUnprocessableEntity,
+	CodePayloadTooLarge:        http.StatusRequestEntityTooLarge,
+	CodeUnauthorized:           http.StatusUnauthorized,
+	CodeTokenExpired:           http.StatusUnauthorized,
+	CodeTokenInvalid:           http.StatusUnauthorized,
+	CodeForbidden:              http.StatusForbidden,
+	CodeNotFound:               http.StatusNotFound,
+	CodeHabitNotFound:          http.StatusNotFound,
+	CodeHabitLimitReached:      http.StatusForbidden,
+	CodeGoalTooLong:            http.StatusForbidden,
+	CodeAlreadyTrackedToday:    http.StatusConflict,
+	CodeInvalidPlan:            http.StatusBadRequest,
+	CodePlanNotPurchasable:     http.StatusBadRequest,
+	CodePlanNotSelfService:     http.StatusForbidden,
+	CodePaymentNotFound:        http.StatusNotFound,
+	CodeTrialAlreadyUsed:       http.StatusConflict,
+	CodePromoCodeNotFound:      http.StatusNotFound,
+	CodePromoCodeExpired:       http.StatusGone,
+	CodePromoCodeExhausted:     http.StatusGone,
+	CodePromoAlreadyRedeemed:   http.StatusConflict,
+	CodePromoNotApplicable:     http.StatusBadRequest,
+	CodeReferralNotFound:       http.StatusNotFound,
+	CodeReferralAlreadyClaimed: http.StatusConflict,
+	CodeSelfReferral:           http.StatusBadRequest,
+	CodeStakeNotFound:          http.StatusNotFound,
+	CodeAlreadyStaked:          http.StatusConflict,
+	CodeHabitAlreadyCompleted:  http.StatusConflict,
+	CodeHabitInProgress:        http.StatusConflict,
+	CodeWalletNotFound:         http.StatusNotFound,
+	CodeAttestationNotFound:    http.StatusNotFound,
+	CodeRateLimited:            http.StatusTooManyRequests,
+	CodeFeatureDisabled:        http.StatusServiceUnavailable,
+	CodeChainUnavailable:       http.StatusBadGateway,
+	CodeReauthRequired:         http.StatusForbidden,
+	CodePINNotSet:              http.StatusConflict,
+	CodeInvalidPIN:             http.StatusForbidden,
+	CodePINLocked:              http.StatusLocked,
+	CodeWalletNotCustodial:     http.StatusConflict,
+	CodeWalletNotDeployed:      http.StatusConflict,
+	CodeWalletAlreadyExported:  http.StatusConflict,
+	CodeRecoveryInProgress:     http.StatusConflict,
+	CodeRecoveryNotFound:       http.StatusNotFound,
+	CodeInternal:               http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status a code is returned with
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error safe to show to the client
+type Error struct {
+	Code    Code
+	Message string
+	Fields  map[string]string // Problems with individual fields, keyed by JSON name
+}
+
+// New creates an error with a message for the client
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Invalid creates a validation error listing the problem with each field
+func Invalid(fields map[string]string) *Error {
+	return &Error{Code: CodeValidationFailed, Message: "Some fields are invalid", Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Status returns the HTTP status of the error
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// ErrInternal is returned for unexpected failures, whose details are logged
+// but never shown to the client
+var ErrInternal = New(CodeInternal, "Something went wrong, please try again")
+
+// envelope is the default JSON error body
+type envelope struct {
+	Error body `json:"error"`
+}
+
+type body struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// problem is an RFC 7807 problem document, with the code and request ID as
+// extension members
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      Code              `json:"code"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// Write writes err for the client. Errors that are not an *Error are logged
+// and written as ErrInternal. Clients accepting application/problem+json get
+// an RFC 7807 document, others the JSON envelope.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		logging.FromRequest(r).Error("Unexpected error", logging.Err(err))
+		apiErr = ErrInternal
+	}
+
+	status := apiErr.Status()
+	requestID := logging.RequestID(r.Context())
+
+	var document any
+	if acceptsProblem(r) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		document = problem{
+			Type:      "urn:aura:error:" + strings.ToLower(strings.ReplaceAll(string(apiErr.Code), "_", "-")),
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    apiErr.Message,
+			Instance:  r.URL.Path,
+			Code:      apiErr.Code,
+			Fields:    apiErr.Fields,
+			RequestID: requestID,
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		document = envelope{Error: body{Code: apiErr.Code, Message: apiErr.Message, Fields: apiErr.Fields, RequestID: requestID}}
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(document)
+}
+
+func acceptsProblem(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accepted, ";")
+		if strings.TrimSpace(mediaType) == "application/problem+json" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWriteEnvelope(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodPost, "/api/habits", nil), New(CodeHabitLimitReached, "Limit reached"))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var got envelope
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Error.Code != CodeHabitLimitReached || got.Error.Message != "Limit reached" {
+		t.Errorf("unexpected envelope %+v", got)
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/api/habits/1/progress", nil)
+	req.Header.Set("Accept", "application/json, application/problem+json;q=0.9")
+	rec := httptest.NewRecorder()
+	Write(rec, req, New(CodeAlreadyTrackedToday, "Already tracked"))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var got problem
+	json.NewDecoder(rec.Body).Decode(&got)
+	want := problem{
+		Type:     "urn:aura:error:already-tracked-today",
+		Title:    "Conflict",
+		Status:   http.StatusConflict,
+		Detail:   "Already tracked",
+		Instance: "/api/habits/1/progress",
+		Code:     CodeAlreadyTrackedToday,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problem = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteHidesUnexpectedErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodGet, "/api/habits", nil), errors.New("pq: connection refused to db.internal"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	var got envelope
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Error.Code != CodeInternal || got.Error.Message != ErrInternal.Message {
+		t.Errorf("unexpected envelope %+v", got)
+	}
+}
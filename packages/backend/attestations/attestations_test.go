@@ -0,0 +1,131 @@
+package attestations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aura-backend/merkle"
+	"aura-backend/starknet"
+	"aura-backend/starknet/starknettest"
+	"aura-backend/store"
+)
+
+const (
+	contractAddress = "0x0def"
+	habitID         = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+	otherHabitID    = "00000000-0000-4000-8000-000000000000"
+)
+
+func checkIn(t *testing.T, s *store.Memory, userID, wallet, habitID string, day time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	s.CreateWallet(ctx, userID, &store.Wallet{Address: wallet})
+	if err := s.RecordCheckIn(ctx, &store.CheckIn{UserID: userID, HabitID: habitID, Day: day, CreatedAt: day}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDayNumber(t *testing.T) {
+	day := time.Date(2025, 3, 10, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	if got := DayNumber(day); got != 20250311 {
+		t.Errorf("DayNumber = %d, want the UTC date 20250311", got)
+	}
+	if got := Day(day); !got.Equal(time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Day = %v", got)
+	}
+}
+
+func TestProve(t *testing.T) {
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	leaves := []store.CheckInLeaf{
+		{UserID: "user-1", HabitID: habitID, WalletAddress: "0x123"},
+		{UserID: "user-2", HabitID: otherHabitID, WalletAddress: "0x456"},
+		{UserID: "user-3", HabitID: otherHabitID, WalletAddress: "0x789"},
+	}
+
+	proof, err := Prove(leaves, "0x0123", habitID, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proof verifies with nothing but the public inputs
+	leaf, _ := Leaf("0x123", habitID, day)
+	root, _ := parseHash(proof.Root)
+	siblings := make([]merkle.Hash, len(proof.Proof))
+	for i, sibling := range proof.Proof {
+		siblings[i], _ = parseHash(sibling)
+	}
+	if HashToHex(leaf) != proof.Leaf || !merkle.Verify(root, leaf, siblings) {
+		t.Errorf("proof does not verify: %+v", proof)
+	}
+
+	if _, err := Prove(leaves, "0x456", habitID, day); err != merkle.ErrUnknownLeaf {
+		t.Errorf("habit of another wallet: %v", err)
+	}
+}
+
+func TestPostRootCalldata(t *testing.T) {
+	root := "0x" + "11111111111111111111111111111111" + "22222222222222222222222222222222"
+	calldata, err := PostRootCalldata(&store.Attestation{Day: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), Root: root, Leaves: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"0x134fec6", "0x22222222222222222222222222222222", "0x11111111111111111111111111111111", "0x3"}
+	for i := range want {
+		if calldata[i] != want[i] {
+			t.Fatalf("calldata = %v, want %v", calldata, want)
+		}
+	}
+}
+
+func TestAttestationPipeline(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	today := Day(time.Now())
+	yesterday := today.AddDate(0, 0, -1)
+	checkIn(t, s, "user-1", "0x123", habitID, yesterday)
+	checkIn(t, s, "user-2", "0x456", otherHabitID, yesterday)
+	checkIn(t, s, "user-1", "0x123", habitID, today)
+
+	sender := &starknettest.Sender{TxHash: "0xroot"}
+	attester := NewAttester(s, sender, starknettest.NewNode(t, map[string]interface{}{
+		"0xroot": map[string]interface{}{
+			"transaction_hash": "0xroot",
+			"execution_status": starknet.ExecutionSucceeded,
+			"finality_status":  starknet.FinalityAcceptedL2,
+		},
+	}), Config{ContractAddress: contractAddress, PollInterval: time.Second, MaxAttempts: 2, ResubmitAfter: time.Minute})
+
+	// The first pass queues and submits the root of yesterday only
+	if err := attester.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls) != 1 || sender.Calls[0][0].EntryPointSelector != starknet.SelectorFromName("post_root") {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	if _, err := s.GetAttestation(ctx, today); err != store.ErrNotFound {
+		t.Errorf("today attested before it ended: %v", err)
+	}
+
+	// The second confirms it
+	if err := attester.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	attestation, err := s.GetAttestation(ctx, yesterday)
+	if err != nil || attestation.Status != store.AttestationConfirmed || attestation.Leaves != 2 {
+		t.Fatalf("attestation = %+v, %v", attestation, err)
+	}
+
+	// The leaves the root was computed from are saved with it
+	leaves, _ := s.AttestationLeaves(ctx, yesterday)
+	proof, err := Prove(leaves, "0x123", habitID, yesterday)
+	if err != nil || proof.Root != attestation.Root {
+		t.Errorf("proof root = %+v, attested root = %s, err = %v", proof, attestation.Root, err)
+	}
+	if len(sender.Calls) != 1 {
+		t.Errorf("root posted %d times", len(sender.Calls))
+	}
+}
@@ -0,0 +1,221 @@
+// Package attestations proves habit progress without putting personal data
+// on-chain: every day, the check-ins of the previous days are hashed into a
+// Merkle tree whose root is posted to the registry contract. A user can then
+// hand anyone the proof that a check-in is part of an attested root.
+package attestations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/attestations")
+
+var postRootSelector = starknet.SelectorFromName("post_root")
+
+// backfillDays bounds the past days attested per poll
+const backfillDays = 7
+
+// Config configures the posting of attestations
+type Config struct {
+	ContractAddress string
+	PollInterval    time.Duration
+	MaxAttempts     int           // Submissions tried before giving up on a day
+	ResubmitAfter   time.Duration // Unknown transactions older than this are submitted again
+}
+
+// ReceiptReader is the subset of the Starknet RPC used to follow attestations
+type ReceiptReader interface {
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Attester computes the root of every finished UTC day with check-ins and
+// posts it to the registry. The registry accepts a day's root once and
+// ignores the same root posted again, so resubmitting is safe.
+type Attester struct {
+	Store  store.AttestationStore
+	Sender starknet.Sender
+	Chain  ReceiptReader
+	Config Config
+
+	now func() time.Time
+}
+
+// NewAttester creates the attestation worker
+func NewAttester(s store.AttestationStore, sender starknet.Sender, chain ReceiptReader, config Config) *Attester {
+	return &Attester{Store: s, Sender: sender, Chain: chain, Config: config, now: time.Now}
+}
+
+// Run processes attestations every poll interval until the context is cancelled
+func (a *Attester) Run(ctx context.Context) {
+	slog.Info("Attester started", "contract", a.Config.ContractAddress)
+
+	ticker := time.NewTicker(a.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process attestations", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process queues the roots of the finished days, submits the queued ones and
+// checks the receipts of the submitted ones
+func (a *Attester) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "attestations.process")
+	defer func() { tracing.End(span, err) }()
+
+	days, err := a.Store.UnattestedDays(ctx, Day(a.now()), backfillDays)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if err := a.queue(ctx, day); err != nil {
+			return err
+		}
+	}
+
+	pending, err := a.Store.PendingAttestations(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range pending {
+		attestation := &pending[i]
+		switch attestation.Status {
+		case store.AttestationQueued:
+			err = a.submit(ctx, attestation)
+		case store.AttestationSubmitted:
+			err = a.confirm(ctx, attestation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queue stores the root of a day's check-ins and the leaves it was computed
+// from, which proofs are built from
+func (a *Attester) queue(ctx context.Context, day time.Time) error {
+	leaves, err := a.Store.CheckInLeaves(ctx, day)
+	if err != nil {
+		return err
+	}
+	tree, err := Build(leaves, day)
+	if err != nil {
+		return err
+	}
+
+	now := a.now()
+	err = a.Store.CreateAttestation(ctx, &store.Attestation{
+		Day:       day,
+		Root:      HashToHex(tree.Root()),
+		Leaves:    tree.Len(),
+		Status:    store.AttestationQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, leaves)
+	if errors.Is(err, store.ErrConflict) {
+		return nil
+	}
+	return err
+}
+
+func (a *Attester) submit(ctx context.Context, attestation *store.Attestation) error {
+	calldata, err := PostRootCalldata(attestation)
+	if err != nil {
+		return err
+	}
+
+	txHash, err := a.Sender.Invoke(ctx, []starknet.FunctionCall{{
+		ContractAddress:    a.Config.ContractAddress,
+		EntryPointSelector: postRootSelector,
+		Calldata:           calldata,
+	}})
+	attestation.Attempts++
+	if err != nil {
+		slog.Warn("Failed to submit attestation", "day", DayNumber(attestation.Day), "attempt", attestation.Attempts, logging.Err(err))
+		if attestation.Attempts >= a.Config.MaxAttempts {
+			return a.fail(ctx, attestation, err.Error())
+		}
+		attestation.LastError = err.Error()
+		attestation.UpdatedAt = a.now()
+		return a.Store.UpdateAttestation(ctx, attestation)
+	}
+
+	attestation.Status = store.AttestationSubmitted
+	attestation.TransactionHash = &txHash
+	attestation.LastError = ""
+	attestation.UpdatedAt = a.now()
+	return a.Store.UpdateAttestation(ctx, attestation)
+}
+
+func (a *Attester) confirm(ctx context.Context, attestation *store.Attestation) error {
+	receipt, err := a.Chain.GetTransactionReceipt(ctx, *attestation.TransactionHash)
+	if starknet.IsNotFound(err) {
+		// Dropped transactions are submitted again
+		if a.now().Sub(attestation.UpdatedAt) > a.Config.ResubmitAfter {
+			attestation.Status = store.AttestationQueued
+			attestation.UpdatedAt = a.now()
+			return a.Store.UpdateAttestation(ctx, attestation)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return a.fail(ctx, attestation, "reverted: "+receipt.RevertReason)
+	}
+
+	attestation.Status = store.AttestationConfirmed
+	attestation.LastError = ""
+	attestation.UpdatedAt = a.now()
+	if err := a.Store.UpdateAttestation(ctx, attestation); err != nil {
+		return err
+	}
+	slog.Info("Attestation posted", "day", DayNumber(attestation.Day), "leaves", attestation.Leaves)
+	return nil
+}
+
+func (a *Attester) fail(ctx context.Context, attestation *store.Attestation, reason string) error {
+	slog.Error("Giving up on attestation", "day", DayNumber(attestation.Day), "reason", reason)
+	attestation.Status = store.AttestationFailed
+	attestation.LastError = reason
+	attestation.UpdatedAt = a.now()
+	return a.Store.UpdateAttestation(ctx, attestation)
+}
+
+// PostRootCalldata encodes the arguments of the registry's post_root
+// function: the day number, the two halves of the u256 root and the number
+// of leaves
+func PostRootCalldata(attestation *store.Attestation) ([]string, error) {
+	root, err := parseHash(attestation.Root)
+	if err != nil {
+		return nil, err
+	}
+	low, high := starknet.U256ToFelts(new(big.Int).SetBytes(root[:]))
+	return []string{
+		starknet.FeltToHex(big.NewInt(int64(DayNumber(attestation.Day)))),
+		low,
+		high,
+		starknet.FeltToHex(big.NewInt(int64(attestation.Leaves))),
+	}, nil
+}
@@ -0,0 +1,107 @@
+package attestations
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"aura-backend/achievements"
+	"aura-backend/merkle"
+	"aura-backend/starknet"
+	"aura-backend/store"
+)
+
+// Proof shows that a check-in is a leaf of a day's attested root. Anyone can
+// recompute the leaf from the wallet, habit and day, hash it up the proof
+// and compare the result with root_of(day) on the registry.
+type Proof struct {
+	Leaf  string   `json:"leaf"`
+	Proof []string `json:"proof"` // Siblings from the leaf up, hashed in ascending order
+	Root  string   `json:"root"`
+}
+
+// Prove builds the proof of a check-in from the day's check-ins
+func Prove(leaves []store.CheckInLeaf, walletAddress, habitID string, day time.Time) (*Proof, error) {
+	tree, err := Build(leaves, day)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := Leaf(walletAddress, habitID, day)
+	if err != nil {
+		return nil, err
+	}
+	siblings, err := tree.Proof(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &Proof{Leaf: HashToHex(leaf), Proof: make([]string, len(siblings)), Root: HashToHex(tree.Root())}
+	for i, sibling := range siblings {
+		proof.Proof[i] = HashToHex(sibling)
+	}
+	return proof, nil
+}
+
+// Day returns the UTC date of a time, the days check-ins are grouped by
+func Day(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// DayNumber encodes a day as the registry stores it, e.g. 20250310
+func DayNumber(day time.Time) uint32 {
+	year, month, d := day.UTC().Date()
+	return uint32(year*10000 + int(month)*100 + d)
+}
+
+// Leaf hashes a check-in: keccak-256 of the wallet address, the habit id
+// packed in a felt and the day number, each as a 32-byte big-endian word
+func Leaf(walletAddress, habitID string, day time.Time) (merkle.Hash, error) {
+	wallet, err := starknet.ParseFelt(walletAddress)
+	if err != nil {
+		return merkle.Hash{}, fmt.Errorf("invalid wallet address %q: %w", walletAddress, err)
+	}
+	habitFelt, err := achievements.HabitFelt(habitID)
+	if err != nil {
+		return merkle.Hash{}, err
+	}
+	habit, _ := starknet.ParseFelt(habitFelt)
+
+	return merkle.Keccak(word(wallet), word(habit), word(big.NewInt(int64(DayNumber(day))))), nil
+}
+
+// Build returns the Merkle tree of a day's check-ins
+func Build(leaves []store.CheckInLeaf, day time.Time) (*merkle.Tree, error) {
+	hashes := make([]merkle.Hash, 0, len(leaves))
+	for _, l := range leaves {
+		leaf, err := Leaf(l.WalletAddress, l.HabitID, day)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, leaf)
+	}
+	return merkle.New(hashes), nil
+}
+
+// HashToHex formats a hash as a 0x-prefixed 64-digit hex string
+func HashToHex(h merkle.Hash) string {
+	return fmt.Sprintf("0x%x", h[:])
+}
+
+// parseHash parses a hash formatted by HashToHex
+func parseHash(s string) (merkle.Hash, error) {
+	var h merkle.Hash
+	data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(data) != len(h) {
+		return h, fmt.Errorf("invalid hash %q", s)
+	}
+	copy(h[:], data)
+	return h, nil
+}
+
+// word encodes a value as a 32-byte big-endian word
+func word(value *big.Int) []byte {
+	return value.FillBytes(make([]byte, 32))
+}
@@ -0,0 +1,371 @@
+package billing
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	database "aura-backend/db"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/plans"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Sources of subscriptions granted without payment
+const (
+	SourceTrial    = "trial"
+	SourcePromo    = "promo"
+	SourceReferral = "referral"
+)
+
+var (
+	ErrTrialAlreadyUsed       = errors.New("trial already used")
+	ErrPromoNotFound          = errors.New("promo code not found")
+	ErrPromoExpired           = errors.New("promo code expired")
+	ErrPromoExhausted         = errors.New("promo code has no redemptions left")
+	ErrPromoAlreadyRedeemed   = errors.New("promo code already redeemed")
+	ErrPromoNotApplicable     = errors.New("promo code does not apply")
+	ErrReferralNotFound       = errors.New("referral code not found")
+	ErrReferralAlreadyClaimed = errors.New("referral already claimed")
+	ErrSelfReferral           = errors.New("cannot use your own referral code")
+)
+
+// PromotionsConfig configures trials and referral rewards
+type PromotionsConfig struct {
+	TrialPlan          string
+	TrialDays          int
+	ReferralPlan       string
+	ReferralDays       int
+	ReferralMaxRewards int // Referrals a user is credited for, 0 for unlimited
+	ReferralBaseURL    string
+}
+
+// Grant describes free plan time given to a user
+type Grant struct {
+	Plan   string    `json:"plan"`
+	Days   int       `json:"days"`
+	Source string    `json:"source"`
+	EndsAt time.Time `json:"endsAt"`
+}
+
+// PromoCode is a code that grants free days and/or a discount on STRK payments
+type PromoCode struct {
+	Code             string     `json:"code"`
+	Plan             string     `json:"plan"`
+	PercentOff       int        `json:"percentOff"`
+	AmountOff        string     `json:"amountOff"` // In FRI
+	FreeDays         int        `json:"freeDays"`
+	MaxRedemptions   *int       `json:"maxRedemptions,omitempty"`
+	RedemptionsCount int        `json:"redemptionsCount"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+}
+
+// HasDiscount reports whether the code lowers the price of a STRK payment
+func (p PromoCode) HasDiscount() bool {
+	return p.PercentOff > 0 || (p.AmountOff != "" && p.AmountOff != "0")
+}
+
+// Apply returns the price after the code's discount
+func (p PromoCode) Apply(price *big.Int) (*big.Int, error) {
+	discounted := new(big.Int).Set(price)
+
+	if p.PercentOff > 0 {
+		discounted.Mul(discounted, big.NewInt(int64(100-p.PercentOff)))
+		discounted.Div(discounted, big.NewInt(100))
+	}
+	if amountOff, ok := new(big.Int).SetString(p.AmountOff, 10); ok {
+		discounted.Sub(discounted, amountOff)
+	}
+
+	// Free plans are granted through free days, never through a zero-amount payment
+	if discounted.Sign() <= 0 {
+		return nil, ErrPromoNotApplicable
+	}
+	return discounted, nil
+}
+
+// Promotions manages trials, promo codes and referral credits
+type Promotions struct {
+	DB     *pgxpool.Pool
+	Plans  *plans.Catalog
+	Config PromotionsConfig
+
+	Upgrades *metrics.Counter // Counts grants by plan and source, optional
+}
+
+// NewPromotions creates the promotions service
+func NewPromotions(db *pgxpool.Pool, catalog *plans.Catalog, config PromotionsConfig) *Promotions {
+	return &Promotions{DB: db, Plans: catalog, Config: config}
+}
+
+// StartTrial grants the trial plan to a user who never had a trial
+func (p *Promotions) StartTrial(ctx context.Context, userID string) (*Grant, error) {
+	plan, ok := p.Plans.Get(p.Config.TrialPlan)
+	if !ok || p.Config.TrialDays <= 0 {
+		return nil, fmt.Errorf("trial plan %q is not configured", p.Config.TrialPlan)
+	}
+
+	// The unique index on trial subscriptions guarantees a single trial per user
+	var endsAt time.Time
+	err := database.RunInTx(ctx, p.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		endsAt, err = ActivateSubscription(ctx, tx, userID, plan.Name, SourceTrial, "", days(p.Config.TrialDays))
+		return err
+	})
+	if database.IsConflict(err) {
+		return nil, ErrTrialAlreadyUsed
+	} else if err != nil {
+		return nil, err
+	}
+
+	p.Upgrades.Inc(plan.Name, SourceTrial)
+	logging.FromContext(ctx).Info("Trial started", "plan", plan.Name, "days", p.Config.TrialDays)
+	return &Grant{Plan: plan.Name, Days: p.Config.TrialDays, Source: SourceTrial, EndsAt: endsAt}, nil
+}
+
+// RedeemPromoCode redeems a code granting free days. Discount-only codes are
+// applied when creating a STRK payment instead.
+func (p *Promotions) RedeemPromoCode(ctx context.Context, userID, code string) (*Grant, error) {
+	var grant *Grant
+	err := database.RunInTx(ctx, p.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		promo, err := lockPromoCode(ctx, tx, code)
+		if err != nil {
+			return err
+		}
+		if promo.FreeDays <= 0 {
+			return ErrPromoNotApplicable
+		}
+
+		plan, ok := p.Plans.Get(promo.Plan)
+		if !ok {
+			return fmt.Errorf("promo code %s references unknown plan %s", promo.Code, promo.Plan)
+		}
+
+		if err := recordRedemption(ctx, tx, promo, userID, nil); err != nil {
+			return err
+		}
+
+		endsAt, err := ActivateSubscription(ctx, tx, userID, plan.Name, SourcePromo, promo.Code, days(promo.FreeDays))
+		if err != nil {
+			return err
+		}
+
+		grant = &Grant{Plan: plan.Name, Days: promo.FreeDays, Source: SourcePromo, EndsAt: endsAt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.Upgrades.Inc(grant.Plan, SourcePromo)
+	logging.FromContext(ctx).Info("Promo code redeemed", "code", normalizeCode(code), "plan", grant.Plan, "days", grant.Days)
+	return grant, nil
+}
+
+// lockPromoCode loads a promo code, locking it until the end of the transaction,
+// and checks it can still be redeemed
+func lockPromoCode(ctx context.Context, tx pgx.Tx, code string) (*PromoCode, error) {
+	var promo PromoCode
+	err := tx.QueryRow(ctx,
+		`SELECT code, plan, percent_off, amount_off::text, free_days, max_redemptions, redemptions_count, expires_at
+		 FROM promo_codes WHERE code = $1 FOR UPDATE`,
+		normalizeCode(code),
+	).Scan(
+		&promo.Code, &promo.Plan, &promo.PercentOff, &promo.AmountOff, &promo.FreeDays,
+		&promo.MaxRedemptions, &promo.RedemptionsCount, &promo.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromoNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if promo.ExpiresAt != nil && promo.ExpiresAt.Before(time.Now()) {
+		return nil, ErrPromoExpired
+	}
+	if promo.MaxRedemptions != nil && promo.RedemptionsCount >= *promo.MaxRedemptions {
+		return nil, ErrPromoExhausted
+	}
+
+	return &promo, nil
+}
+
+// recordRedemption stores a redemption and consumes one use of the code.
+// The payment is set when the redemption is a discount on a STRK payment.
+func recordRedemption(ctx context.Context, tx pgx.Tx, promo *PromoCode, userID string, paymentID *string) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO promo_redemptions (id, code, user_id, payment_id, redeemed_at) VALUES ($1, $2, $3, $4, NOW())",
+		uuid.New().String(), promo.Code, userID, paymentID,
+	)
+	if database.IsConflict(err) {
+		return ErrPromoAlreadyRedeemed
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE promo_codes SET redemptions_count = redemptions_count + 1 WHERE code = $1",
+		promo.Code,
+	)
+	return err
+}
+
+// Referral describes a user's referral code and how many users used it
+type Referral struct {
+	Code          string `json:"code"`
+	Link          string `json:"link"`
+	ReferredCount int    `json:"referredCount"`
+	RewardedCount int    `json:"rewardedCount"`
+	RewardDays    int    `json:"rewardDays"`
+}
+
+// GetReferral returns the user's referral code, creating it on first use
+func (p *Promotions) GetReferral(ctx context.Context, userID string) (*Referral, error) {
+	// Retry a few times in case a freshly generated code is already taken
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateCode(8)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = p.DB.Exec(ctx,
+			"INSERT INTO referral_codes (user_id, code, created_at) VALUES ($1, $2, NOW()) ON CONFLICT (user_id) DO NOTHING",
+			userID, code,
+		)
+		if database.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	referral := Referral{RewardDays: p.Config.ReferralDays}
+	err := p.DB.QueryRow(ctx,
+		`SELECT rc.code,
+			(SELECT COUNT(*) FROM referrals WHERE referrer_id = rc.user_id),
+			(SELECT COUNT(*) FROM referrals WHERE referrer_id = rc.user_id AND referrer_rewarded)
+		 FROM referral_codes rc WHERE rc.user_id = $1`,
+		userID,
+	).Scan(&referral.Code, &referral.ReferredCount, &referral.RewardedCount)
+	if err != nil {
+		return nil, err
+	}
+
+	referral.Link = strings.TrimRight(p.Config.ReferralBaseURL, "/") + "/?ref=" + referral.Code
+	return &referral, nil
+}
+
+// ClaimReferral credits both the referred user and the referrer with free days
+func (p *Promotions) ClaimReferral(ctx context.Context, userID, code string) (*Grant, error) {
+	plan, ok := p.Plans.Get(p.Config.ReferralPlan)
+	if !ok || p.Config.ReferralDays <= 0 {
+		return nil, fmt.Errorf("referral plan %q is not configured", p.Config.ReferralPlan)
+	}
+
+	var referrerID string
+	var rewardReferrer bool
+	var endsAt time.Time
+	err := database.RunInTx(ctx, p.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		// Lock the referrer's code so concurrent claims count rewards consistently
+		err := tx.QueryRow(ctx,
+			"SELECT user_id FROM referral_codes WHERE code = $1 FOR UPDATE",
+			normalizeCode(code),
+		).Scan(&referrerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrReferralNotFound
+		} else if err != nil {
+			return err
+		}
+		if referrerID == userID {
+			return ErrSelfReferral
+		}
+
+		// Two users cannot refer each other
+		var mutual bool
+		err = tx.QueryRow(ctx,
+			"SELECT EXISTS(SELECT 1 FROM referrals WHERE referrer_id = $1 AND referred_id = $2)",
+			userID, referrerID,
+		).Scan(&mutual)
+		if err != nil {
+			return err
+		}
+		if mutual {
+			return ErrSelfReferral
+		}
+
+		var rewarded int
+		err = tx.QueryRow(ctx,
+			"SELECT COUNT(*) FROM referrals WHERE referrer_id = $1 AND referrer_rewarded",
+			referrerID,
+		).Scan(&rewarded)
+		if err != nil {
+			return err
+		}
+		rewardReferrer = p.Config.ReferralMaxRewards == 0 || rewarded < p.Config.ReferralMaxRewards
+
+		// The unique constraint on referred_id allows a single claim per user
+		referralID := uuid.New().String()
+		_, err = tx.Exec(ctx,
+			`INSERT INTO referrals (id, referrer_id, referred_id, code, referrer_rewarded, created_at)
+			 VALUES ($1, $2, $3, $4, $5, NOW())`,
+			referralID, referrerID, userID, normalizeCode(code), rewardReferrer,
+		)
+		if database.IsConflict(err) {
+			return ErrReferralAlreadyClaimed
+		} else if err != nil {
+			return err
+		}
+
+		endsAt, err = ActivateSubscription(ctx, tx, userID, plan.Name, SourceReferral, referralID, days(p.Config.ReferralDays))
+		if err != nil {
+			return err
+		}
+		if rewardReferrer {
+			_, err = ActivateSubscription(ctx, tx, referrerID, plan.Name, SourceReferral, referralID, days(p.Config.ReferralDays))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.Upgrades.Inc(plan.Name, SourceReferral)
+	if rewardReferrer {
+		p.Upgrades.Inc(plan.Name, SourceReferral)
+	}
+	logging.FromContext(ctx).Info("Referral claimed", "referrer_id", referrerID, "referrer_rewarded", rewardReferrer)
+	return &Grant{Plan: plan.Name, Days: p.Config.ReferralDays, Source: SourceReferral, EndsAt: endsAt}, nil
+}
+
+// codeAlphabet avoids characters that are easy to confuse (0/O, 1/I)
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func generateCode(length int) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
@@ -0,0 +1,211 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"aura-backend/db/dbtest"
+	"aura-backend/plans"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPromoCodeApply(t *testing.T) {
+	price := big.NewInt(1000)
+
+	tests := []struct {
+		name  string
+		promo PromoCode
+		want  int64
+		fails bool
+	}{
+		{name: "percent", promo: PromoCode{PercentOff: 25}, want: 750},
+		{name: "fixed", promo: PromoCode{AmountOff: "300"}, want: 700},
+		{name: "percent and fixed", promo: PromoCode{PercentOff: 50, AmountOff: "100"}, want: 400},
+		{name: "free", promo: PromoCode{PercentOff: 100}, fails: true},
+		{name: "more than price", promo: PromoCode{AmountOff: "5000"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.promo.Apply(price)
+			if tt.fails {
+				if err != ErrPromoNotApplicable {
+					t.Fatalf("expected ErrPromoNotApplicable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Int64() != tt.want {
+				t.Errorf("Apply() = %s, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if price.Int64() != 1000 {
+		t.Error("Apply() modified the original price")
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	if got := normalizeCode("  welcome10 "); got != "WELCOME10" {
+		t.Errorf("normalizeCode() = %q", got)
+	}
+}
+
+func newTestPromotions(db *pgxpool.Pool) *Promotions {
+	return NewPromotions(db, plans.DefaultCatalog(), PromotionsConfig{
+		TrialPlan:       "pro",
+		TrialDays:       7,
+		ReferralPlan:    "pro",
+		ReferralDays:    7,
+		ReferralBaseURL: "https://aura.example",
+	})
+}
+
+func createPromoCode(t *testing.T, db *pgxpool.Pool, code string, percentOff, freeDays, maxRedemptions int) {
+	t.Helper()
+	_, err := db.Exec(context.Background(),
+		"INSERT INTO promo_codes (code, plan, percent_off, free_days, max_redemptions) VALUES ($1, 'pro', $2, $3, $4)",
+		code, percentOff, freeDays, maxRedemptions,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func redemptionsCount(t *testing.T, db *pgxpool.Pool, code string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(context.Background(), "SELECT redemptions_count FROM promo_codes WHERE code = $1", code).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestStartTrialOncePerUser(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	promotions := newTestPromotions(db)
+
+	userID := uuid.NewString()
+	grant, err := promotions.StartTrial(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.Plan != "pro" || grant.Days != 7 {
+		t.Errorf("unexpected grant %+v", grant)
+	}
+	if _, err := promotions.StartTrial(ctx, userID); !errors.Is(err, ErrTrialAlreadyUsed) {
+		t.Errorf("second trial error = %v, want ErrTrialAlreadyUsed", err)
+	}
+	if _, err := promotions.StartTrial(ctx, uuid.NewString()); err != nil {
+		t.Errorf("another user's trial: %v", err)
+	}
+}
+
+func TestPromoCodeMaxRedemptions(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	promotions := newTestPromotions(db)
+	createPromoCode(t, db, "FREEWEEK", 0, 7, 1)
+
+	first := uuid.NewString()
+	if _, err := promotions.RedeemPromoCode(ctx, first, " freeweek "); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := promotions.RedeemPromoCode(ctx, first, "FREEWEEK"); !errors.Is(err, ErrPromoExhausted) {
+		t.Errorf("redeeming an exhausted code again: %v", err)
+	}
+	if _, err := promotions.RedeemPromoCode(ctx, uuid.NewString(), "FREEWEEK"); !errors.Is(err, ErrPromoExhausted) {
+		t.Errorf("redeeming an exhausted code: %v", err)
+	}
+	if count := redemptionsCount(t, db, "FREEWEEK"); count != 1 {
+		t.Errorf("redemptions = %d, want 1", count)
+	}
+}
+
+func TestExpiredDiscountReleasesCode(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	chain := &fakeChain{head: 100}
+	payments := newTestPayments(db, chain)
+	createPromoCode(t, db, "HALF", 50, 0, 1)
+
+	payment, err := payments.CreatePaymentRequest(ctx, uuid.NewString(), "pro", "HALF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := payments.CreatePaymentRequest(ctx, uuid.NewString(), "pro", "HALF"); !errors.Is(err, ErrPromoExhausted) {
+		t.Fatalf("second discounted payment: %v", err)
+	}
+
+	if _, err := db.Exec(ctx, "UPDATE strk_payments SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1", payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusExpired {
+		t.Fatalf("status = %s, want %s", status, StatusExpired)
+	}
+	if count := redemptionsCount(t, db, "HALF"); count != 0 {
+		t.Fatalf("redemptions after expiry = %d, want 0", count)
+	}
+
+	// The code was given back: a late transfer must not confirm the discount
+	chain.transfer("0x300", payment.Amount, 101)
+	chain.head = 101
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusExpired {
+		t.Errorf("late transfer matched a released discount, status = %s", status)
+	}
+
+	if _, err := payments.CreatePaymentRequest(ctx, uuid.NewString(), "pro", "HALF"); err != nil {
+		t.Errorf("released code not redeemable: %v", err)
+	}
+}
+
+func TestClaimReferral(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	promotions := newTestPromotions(db)
+
+	alice, bob := uuid.NewString(), uuid.NewString()
+	aliceReferral, err := promotions.GetReferral(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobReferral, err := promotions.GetReferral(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := promotions.ClaimReferral(ctx, alice, aliceReferral.Code); !errors.Is(err, ErrSelfReferral) {
+		t.Errorf("self referral error = %v, want ErrSelfReferral", err)
+	}
+	if _, err := promotions.ClaimReferral(ctx, bob, aliceReferral.Code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := promotions.ClaimReferral(ctx, alice, bobReferral.Code); !errors.Is(err, ErrSelfReferral) {
+		t.Errorf("mutual referral error = %v, want ErrSelfReferral", err)
+	}
+	if _, err := promotions.ClaimReferral(ctx, bob, aliceReferral.Code); !errors.Is(err, ErrReferralAlreadyClaimed) {
+		t.Errorf("second claim error = %v, want ErrReferralAlreadyClaimed", err)
+	}
+
+	referral, err := promotions.GetReferral(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if referral.ReferredCount != 1 || referral.RewardedCount != 1 {
+		t.Errorf("referral counts = %d referred, %d rewarded", referral.ReferredCount, referral.RewardedCount)
+	}
+}
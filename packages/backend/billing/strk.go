@@ -0,0 +1,600 @@
+package billing
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	database "aura-backend/db"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/plans"
+	"aura-backend/starknet"
+	"aura-backend/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("aura-backend/billing")
+
+// DefaultStrkTokenAddress is the STRK ERC-20 contract, the same one used by YourContract
+const DefaultStrkTokenAddress = "0x04718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d"
+
+// Statuses of an on-chain STRK payment request
+const (
+	StatusPending    = "pending"    // Waiting for a matching transfer
+	StatusConfirming = "confirming" // Transfer seen, waiting for confirmations
+	StatusConfirmed  = "confirmed"  // Subscription activated
+	StatusExpired    = "expired"    // No transfer received before the deadline
+)
+
+// strkDecimals is the number of decimals of the STRK token
+const strkDecimals = 18
+
+// maxReferenceTail bounds the random amount added to every request so that
+// concurrent requests for the same plan can be told apart on-chain
+const maxReferenceTail = 1000000
+
+// lateTransferWindow is how long after expiring a payment still matches a
+// transfer. Its amount is not given to new requests meanwhile, so a late
+// transfer cannot pay for someone else's request.
+const lateTransferWindow = 7 * 24 * time.Hour
+
+var (
+	ErrPlanNotPurchasable = errors.New("plan cannot be purchased with STRK")
+	ErrPaymentNotFound    = errors.New("payment not found")
+)
+
+var transferSelector = starknet.SelectorFromName("Transfer")
+
+// StrkPayment is a request for the user to transfer an exact amount of STRK to the treasury
+type StrkPayment struct {
+	ID                    string     `json:"id"`
+	UserID                string     `json:"userId"`
+	Plan                  string     `json:"plan"`
+	Amount                string     `json:"amount"`     // In FRI, the smallest STRK unit
+	AmountStrk            string     `json:"amountStrk"` // Human readable amount
+	Reference             string     `json:"reference"`
+	TokenAddress          string     `json:"tokenAddress"`
+	TreasuryAddress       string     `json:"treasuryAddress"`
+	Status                string     `json:"status"`
+	TransactionHash       *string    `json:"transactionHash,omitempty"`
+	BlockNumber           *int64     `json:"blockNumber,omitempty"`
+	ConfirmationsRequired uint64     `json:"confirmationsRequired"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	ExpiresAt             time.Time  `json:"expiresAt"`
+	ConfirmedAt           *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// StrkConfig configures on-chain STRK payments
+type StrkConfig struct {
+	TokenAddress    string
+	TreasuryAddress string
+	Confirmations   uint64
+	PaymentTTL      time.Duration
+	PollInterval    time.Duration
+	StartLookback   uint64 // Blocks scanned behind the head when no block was scanned yet
+}
+
+// ChainReader is the subset of the Starknet RPC used to watch payments
+type ChainReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsPage, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// StrkPayments creates STRK payment requests and activates subscriptions
+// once the matching transfer is confirmed on-chain
+type StrkPayments struct {
+	DB     *pgxpool.Pool
+	Chain  ChainReader
+	Plans  *plans.Catalog
+	Config StrkConfig
+
+	Upgrades *metrics.Counter // Counts activations by plan and source, optional
+}
+
+// NewStrkPayments creates the STRK payment service
+func NewStrkPayments(db *pgxpool.Pool, chain ChainReader, catalog *plans.Catalog, config StrkConfig) *StrkPayments {
+	return &StrkPayments{DB: db, Chain: chain, Plans: catalog, Config: config}
+}
+
+// CreatePaymentRequest creates a pending payment for the given plan, applying
+// an optional discount promo code. The amount carries a random tail which
+// doubles as the payment reference.
+func (s *StrkPayments) CreatePaymentRequest(ctx context.Context, userID, planName, promoCode string) (payment *StrkPayment, err error) {
+	ctx, span := tracer.Start(ctx, "strk.create_payment_request", trace.WithAttributes(attribute.String("plan", planName)))
+	defer func() { tracing.End(span, err) }()
+
+	plan, ok := s.Plans.Get(planName)
+	if !ok || !plan.PurchasableWithStrk() {
+		return nil, ErrPlanNotPurchasable
+	}
+
+	price, err := ParseStrk(plan.PriceStrk)
+	if err != nil {
+		return nil, fmt.Errorf("plan %s has an invalid STRK price: %v", plan.Name, err)
+	}
+
+	// Retry a few times in case the random tail collides with another open request
+	for attempt := 0; attempt < 5; attempt++ {
+		payment, err = s.createPayment(ctx, userID, plan, price, promoCode)
+		if database.IsConflict(err) {
+			continue
+		}
+		return payment, err
+	}
+
+	return nil, fmt.Errorf("could not allocate a unique payment amount")
+}
+
+// createPayment inserts a payment request and, when a promo code is given,
+// consumes it in the same transaction
+func (s *StrkPayments) createPayment(ctx context.Context, userID string, plan plans.Plan, price *big.Int, promoCode string) (*StrkPayment, error) {
+	var payment *StrkPayment
+	err := database.RunInTx(ctx, s.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		amount := price
+		var promo *PromoCode
+		var code *string
+		if promoCode != "" {
+			var err error
+			promo, err = lockPromoCode(ctx, tx, promoCode)
+			if err != nil {
+				return err
+			}
+			if !promo.HasDiscount() || promo.Plan != plan.Name {
+				return ErrPromoNotApplicable
+			}
+			if amount, err = promo.Apply(amount); err != nil {
+				return err
+			}
+			code = &promo.Code
+		}
+
+		var err error
+		payment, err = s.insertPayment(ctx, tx, userID, plan, amount, code)
+		if err != nil {
+			return err
+		}
+
+		if promo != nil {
+			return recordRedemption(ctx, tx, promo, userID, &payment.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// insertPayment stores a pending payment for the price plus a random tail,
+// discounted by the promo code if one is given
+func (s *StrkPayments) insertPayment(ctx context.Context, tx pgx.Tx, userID string, plan plans.Plan, price *big.Int, promoCode *string) (*StrkPayment, error) {
+	tail, err := rand.Int(rand.Reader, big.NewInt(maxReferenceTail-1))
+	if err != nil {
+		return nil, err
+	}
+	tail.Add(tail, big.NewInt(1))
+
+	amount := new(big.Int).Add(price, tail)
+	var reserved bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM strk_payments WHERE amount = $1 AND status = $2 AND expires_at > $3)",
+		amount.String(), StatusExpired, time.Now().Add(-lateTransferWindow),
+	).Scan(&reserved)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, database.ErrConflict
+	}
+
+	payment := &StrkPayment{
+		ID:                    uuid.New().String(),
+		UserID:                userID,
+		Plan:                  plan.Name,
+		Amount:                amount.String(),
+		AmountStrk:            FormatStrk(amount),
+		Reference:             fmt.Sprintf("AURA-%06d", tail.Int64()),
+		TokenAddress:          s.Config.TokenAddress,
+		TreasuryAddress:       s.Config.TreasuryAddress,
+		Status:                StatusPending,
+		ConfirmationsRequired: s.Config.Confirmations,
+		CreatedAt:             time.Now(),
+	}
+	payment.ExpiresAt = payment.CreatedAt.Add(s.Config.PaymentTTL)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO strk_payments (id, user_id, plan, amount, reference, status, promo_code, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		payment.ID, payment.UserID, payment.Plan, payment.Amount, payment.Reference, payment.Status,
+		promoCode, payment.CreatedAt, payment.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// GetPayment returns a payment request owned by the user
+func (s *StrkPayments) GetPayment(ctx context.Context, userID, paymentID string) (*StrkPayment, error) {
+	payment := StrkPayment{
+		TokenAddress:          s.Config.TokenAddress,
+		TreasuryAddress:       s.Config.TreasuryAddress,
+		ConfirmationsRequired: s.Config.Confirmations,
+	}
+
+	var amount string
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, user_id, plan, amount::text, reference, status, transaction_hash, block_number, created_at, expires_at, confirmed_at
+		 FROM strk_payments WHERE id = $1 AND user_id = $2`,
+		paymentID, userID,
+	).Scan(
+		&payment.ID, &payment.UserID, &payment.Plan, &amount, &payment.Reference, &payment.Status,
+		&payment.TransactionHash, &payment.BlockNumber, &payment.CreatedAt, &payment.ExpiresAt, &payment.ConfirmedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	payment.Amount = amount
+	if value, ok := new(big.Int).SetString(amount, 10); ok {
+		payment.AmountStrk = FormatStrk(value)
+	}
+
+	return &payment, nil
+}
+
+// Run polls the chain until the context is cancelled
+func (s *StrkPayments) Run(ctx context.Context) {
+	slog.Info("Watching STRK transfers", "treasury", s.Config.TreasuryAddress)
+
+	ticker := time.NewTicker(s.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.poll(ctx); err != nil {
+			slog.Error("Polling STRK payments failed", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll runs one traced watcher iteration, the root of its SQL and RPC spans
+func (s *StrkPayments) poll(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "strk.poll")
+	err := s.Poll(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// Poll runs one watcher iteration: it matches new transfers to pending
+// payments, confirms payments deep enough in the chain and expires stale ones
+func (s *StrkPayments) Poll(ctx context.Context) error {
+	head, err := s.Chain.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get block number: %w", err)
+	}
+
+	cursor, err := s.nextBlock(ctx, head)
+	if err != nil {
+		return err
+	}
+	if cursor <= head {
+		if err := s.scanTransfers(ctx, cursor, head); err != nil {
+			return err
+		}
+		if err := s.saveCheckpoint(ctx, head); err != nil {
+			return err
+		}
+	}
+
+	if err := s.confirmPayments(ctx, head); err != nil {
+		return err
+	}
+
+	return s.expirePayments(ctx)
+}
+
+// nextBlock returns the first block to scan. The checkpoint survives
+// restarts; without one the watcher starts StartLookback blocks behind the head.
+func (s *StrkPayments) nextBlock(ctx context.Context, head uint64) (uint64, error) {
+	var last int64
+	err := s.DB.QueryRow(ctx, "SELECT block_number FROM strk_payment_checkpoint").Scan(&last)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if head > s.Config.StartLookback {
+			return head - s.Config.StartLookback, nil
+		}
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return uint64(last) + 1, nil
+}
+
+// saveCheckpoint records the last block scanned
+func (s *StrkPayments) saveCheckpoint(ctx context.Context, block uint64) error {
+	_, err := s.DB.Exec(ctx,
+		`INSERT INTO strk_payment_checkpoint (id, block_number, updated_at) VALUES (TRUE, $1, NOW())
+		 ON CONFLICT (id) DO UPDATE SET block_number = EXCLUDED.block_number, updated_at = EXCLUDED.updated_at`,
+		int64(block),
+	)
+	return err
+}
+
+// expirePayments expires stale requests and gives back the promo codes they reserved
+func (s *StrkPayments) expirePayments(ctx context.Context) error {
+	_, err := s.DB.Exec(ctx,
+		`WITH expired AS (
+			UPDATE strk_payments SET status = $1
+			WHERE status = $2 AND expires_at < NOW()
+			RETURNING id
+		 ), released AS (
+			DELETE FROM promo_redemptions
+			WHERE payment_id IN (SELECT id FROM expired)
+			RETURNING code
+		 )
+		 UPDATE promo_codes p SET redemptions_count = p.redemptions_count - r.released
+		 FROM (SELECT code, COUNT(*) AS released FROM released GROUP BY code) r
+		 WHERE p.code = r.code`,
+		StatusExpired, StatusPending,
+	)
+	return err
+}
+
+// scanTransfers looks for STRK transfers to the treasury between two blocks
+func (s *StrkPayments) scanTransfers(ctx context.Context, fromBlock, toBlock uint64) error {
+	filter := starknet.EventFilter{
+		FromBlock: starknet.BlockNumberID(fromBlock),
+		ToBlock:   starknet.BlockNumberID(toBlock),
+		Address:   s.Config.TokenAddress,
+		Keys:      [][]string{{transferSelector}},
+		ChunkSize: 100,
+	}
+
+	for {
+		page, err := s.Chain.GetEvents(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("could not get transfer events: %w", err)
+		}
+
+		for _, event := range page.Events {
+			transfer, ok := DecodeTransfer(event)
+			if !ok || transfer.To != s.Config.TreasuryAddress {
+				continue
+			}
+			if err := s.matchTransfer(ctx, transfer); err != nil {
+				return err
+			}
+		}
+
+		if page.ContinuationToken == "" {
+			return nil
+		}
+		filter.ContinuationToken = page.ContinuationToken
+	}
+}
+
+// matchTransfer attaches a transfer to the payment request with the same
+// amount. A transfer already attached to a payment is skipped, as rescans see
+// it again. Expired payments match late transfers while no open payment holds
+// their amount, unless they were discounted: their promo code was given back
+// when they expired.
+func (s *StrkPayments) matchTransfer(ctx context.Context, transfer Transfer) error {
+	result, err := s.DB.Exec(ctx,
+		`UPDATE strk_payments
+		 SET status = $1, transaction_hash = $2, block_number = $3, from_address = $4
+		 WHERE id = (
+			SELECT p.id FROM strk_payments p
+			WHERE p.amount = $5 AND (
+				p.status = $6 OR (
+					p.status = $7 AND p.expires_at > $8 AND p.promo_code IS NULL AND NOT EXISTS (
+						SELECT 1 FROM strk_payments o WHERE o.amount = p.amount AND o.status IN ($6, $1)
+					)
+				)
+			)
+			ORDER BY p.status = $6 DESC, p.created_at DESC
+			LIMIT 1
+		 )
+		 AND NOT EXISTS (SELECT 1 FROM strk_payments WHERE transaction_hash = $2)`,
+		StatusConfirming, transfer.TransactionHash, transfer.BlockNumber, transfer.From,
+		transfer.Amount.String(), StatusPending, StatusExpired, time.Now().Add(-lateTransferWindow),
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() > 0 {
+		slog.Info("Matched STRK transfer to a payment request", "tx_hash", transfer.TransactionHash, "amount_fri", transfer.Amount.String())
+	}
+	return nil
+}
+
+// confirmPayments activates the subscription of every payment whose transfer
+// has enough confirmations and is still part of the canonical chain
+func (s *StrkPayments) confirmPayments(ctx context.Context, head uint64) error {
+	rows, err := s.DB.Query(ctx,
+		"SELECT id, user_id, plan, transaction_hash, block_number FROM strk_payments WHERE status = $1",
+		StatusConfirming,
+	)
+	if err != nil {
+		return err
+	}
+
+	type confirming struct {
+		id, userID, plan, txHash string
+		blockNumber              uint64
+	}
+	var payments []confirming
+	for rows.Next() {
+		var p confirming
+		if err := rows.Scan(&p.id, &p.userID, &p.plan, &p.txHash, &p.blockNumber); err != nil {
+			rows.Close()
+			return err
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range payments {
+		if p.blockNumber+s.Config.Confirmations > head {
+			continue
+		}
+
+		// Re-read the receipt in case the transfer was reorged out or reverted
+		receipt, err := s.Chain.GetTransactionReceipt(ctx, p.txHash)
+		if err != nil && !starknet.IsNotFound(err) {
+			return err
+		}
+		if err != nil || receipt.ExecutionStatus != starknet.ExecutionSucceeded || receipt.BlockNumber == 0 {
+			slog.Warn("STRK transfer is no longer valid, reopening payment", "tx_hash", p.txHash, "payment_id", p.id)
+			_, err := s.DB.Exec(ctx,
+				`UPDATE strk_payments SET status = $1, transaction_hash = NULL, block_number = NULL, from_address = NULL
+				 WHERE id = $2 AND status = $3`,
+				StatusPending, p.id, StatusConfirming,
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if receipt.BlockNumber != p.blockNumber {
+			// The transaction was included again in a different block, wait for it to mature
+			if _, err := s.DB.Exec(ctx, "UPDATE strk_payments SET block_number = $1 WHERE id = $2", receipt.BlockNumber, p.id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.activate(ctx, p.id, p.userID, p.plan); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// activate marks a payment as confirmed and grants its plan in one transaction
+func (s *StrkPayments) activate(ctx context.Context, paymentID, userID, planName string) error {
+	plan, ok := s.Plans.Get(planName)
+	if !ok {
+		return fmt.Errorf("payment %s references unknown plan %s", paymentID, planName)
+	}
+
+	var endsAt time.Time
+	err := database.RunInTx(ctx, s.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		endsAt = time.Time{}
+		result, err := tx.Exec(ctx,
+			"UPDATE strk_payments SET status = $1, confirmed_at = NOW() WHERE id = $2 AND status = $3",
+			StatusConfirmed, paymentID, StatusConfirming,
+		)
+		if err != nil || result.RowsAffected() == 0 {
+			return err
+		}
+
+		endsAt, err = ActivateSubscription(ctx, tx, userID, plan.Name, SourceStrk, paymentID, days(plan.BillingPeriodDays))
+		return err
+	})
+	if err != nil || endsAt.IsZero() {
+		return err
+	}
+
+	s.Upgrades.Inc(plan.Name, SourceStrk)
+	slog.Info("Plan activated", "user_id", userID, "plan", plan.Name, "ends_at", endsAt, "source", SourceStrk, "payment_id", paymentID)
+	return nil
+}
+
+// Transfer is a decoded ERC-20 Transfer event
+type Transfer struct {
+	From            string
+	To              string
+	Amount          *big.Int
+	TransactionHash string
+	BlockNumber     uint64
+}
+
+// DecodeTransfer decodes an ERC-20 Transfer event. Both the legacy layout
+// (from, to and amount in data) and the Cairo 1 layout (from and to as keys)
+// are supported.
+func DecodeTransfer(event starknet.EmittedEvent) (Transfer, bool) {
+	if len(event.Keys) == 0 || starknet.NormalizeAddress(event.Keys[0]) != transferSelector {
+		return Transfer{}, false
+	}
+
+	var from, to, low, high string
+	switch {
+	case len(event.Keys) == 3 && len(event.Data) == 2:
+		from, to, low, high = event.Keys[1], event.Keys[2], event.Data[0], event.Data[1]
+	case len(event.Keys) == 1 && len(event.Data) == 4:
+		from, to, low, high = event.Data[0], event.Data[1], event.Data[2], event.Data[3]
+	default:
+		return Transfer{}, false
+	}
+
+	amount, err := starknet.U256FromFelts(low, high)
+	if err != nil {
+		return Transfer{}, false
+	}
+
+	return Transfer{
+		From:            starknet.NormalizeAddress(from),
+		To:              starknet.NormalizeAddress(to),
+		Amount:          amount,
+		TransactionHash: event.TransactionHash,
+		BlockNumber:     event.BlockNumber,
+	}, true
+}
+
+// ParseStrk converts a decimal STRK amount such as "12.5" to FRI
+func ParseStrk(amount string) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > strkDecimals {
+		return nil, fmt.Errorf("too many decimals in %q", amount)
+	}
+
+	value, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", strkDecimals-len(fraction)), 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid STRK amount %q", amount)
+	}
+	return value, nil
+}
+
+// FormatStrk converts an amount in FRI to a decimal STRK string
+func FormatStrk(fri *big.Int) string {
+	digits := fri.String()
+	if len(digits) <= strkDecimals {
+		digits = strings.Repeat("0", strkDecimals-len(digits)+1) + digits
+	}
+
+	whole, fraction := digits[:len(digits)-strkDecimals], strings.TrimRight(digits[len(digits)-strkDecimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
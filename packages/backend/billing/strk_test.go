@@ -0,0 +1,273 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"aura-backend/db/dbtest"
+	"aura-backend/plans"
+	"aura-backend/starknet"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestDecodeTransfer(t *testing.T) {
+	selector := starknet.SelectorFromName("Transfer")
+
+	tests := []struct {
+		name  string
+		event starknet.EmittedEvent
+	}{
+		{
+			name: "legacy layout",
+			event: starknet.EmittedEvent{
+				Keys: []string{selector},
+				Data: []string{"0x0001", "0x00AB", "0x64", "0x1"},
+			},
+		},
+		{
+			name: "keyed layout",
+			event: starknet.EmittedEvent{
+				Keys: []string{selector, "0x1", "0xab"},
+				Data: []string{"0x64", "0x1"},
+			},
+		},
+	}
+
+	want := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(100))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer, ok := DecodeTransfer(tt.event)
+			if !ok {
+				t.Fatal("event not decoded")
+			}
+			if transfer.From != "0x1" || transfer.To != "0xab" {
+				t.Errorf("unexpected addresses %s -> %s", transfer.From, transfer.To)
+			}
+			if transfer.Amount.Cmp(want) != 0 {
+				t.Errorf("amount = %s, want %s", transfer.Amount, want)
+			}
+		})
+	}
+
+	if _, ok := DecodeTransfer(starknet.EmittedEvent{Keys: []string{"0x1"}, Data: []string{"0x1", "0x2", "0x3", "0x0"}}); ok {
+		t.Error("decoded an event with another selector")
+	}
+}
+
+func TestParseAndFormatStrk(t *testing.T) {
+	tests := []struct {
+		input string
+		fri   string
+		back  string
+	}{
+		{"10", "10000000000000000000", "10"},
+		{"12.5", "12500000000000000000", "12.5"},
+		{"0.000000000000000001", "1", "0.000000000000000001"},
+	}
+
+	for _, tt := range tests {
+		fri, err := ParseStrk(tt.input)
+		if err != nil {
+			t.Fatalf("ParseStrk(%q) error: %v", tt.input, err)
+		}
+		if fri.String() != tt.fri {
+			t.Errorf("ParseStrk(%q) = %s, want %s", tt.input, fri, tt.fri)
+		}
+		if got := FormatStrk(fri); got != tt.back {
+			t.Errorf("FormatStrk(%s) = %s, want %s", fri, got, tt.back)
+		}
+	}
+
+	for _, invalid := range []string{"abc", "-1", "1.0000000000000000001"} {
+		if _, err := ParseStrk(invalid); err == nil {
+			t.Errorf("ParseStrk(%q) should fail", invalid)
+		}
+	}
+}
+
+const testTreasury = "0xabc"
+
+// fakeChain serves STRK transfers to the treasury from memory
+type fakeChain struct {
+	head     uint64
+	events   []starknet.EmittedEvent
+	receipts map[string]*starknet.Receipt
+	scanned  []uint64 // First block of every scan
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	return c.head, nil
+}
+
+func (c *fakeChain) GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsPage, error) {
+	from, to := *filter.FromBlock.Number, *filter.ToBlock.Number
+	c.scanned = append(c.scanned, from)
+
+	page := &starknet.EventsPage{}
+	for _, event := range c.events {
+		if event.BlockNumber >= from && event.BlockNumber <= to {
+			page.Events = append(page.Events, event)
+		}
+	}
+	return page, nil
+}
+
+func (c *fakeChain) GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error) {
+	receipt, ok := c.receipts[txHash]
+	if !ok {
+		return nil, &starknet.RPCError{Code: starknet.ErrCodeTransactionNotFound, Message: "Transaction hash not found"}
+	}
+	return receipt, nil
+}
+
+// transfer adds a successful transfer of amount FRI to the treasury
+func (c *fakeChain) transfer(txHash, amount string, block uint64) {
+	value, _ := new(big.Int).SetString(amount, 10)
+	c.events = append(c.events, starknet.EmittedEvent{
+		Keys:            []string{transferSelector, "0x1", testTreasury},
+		Data:            []string{starknet.FeltToHex(value), "0x0"},
+		BlockNumber:     block,
+		TransactionHash: txHash,
+	})
+	if c.receipts == nil {
+		c.receipts = map[string]*starknet.Receipt{}
+	}
+	c.receipts[txHash] = &starknet.Receipt{TransactionHash: txHash, ExecutionStatus: starknet.ExecutionSucceeded, BlockNumber: block}
+}
+
+func newTestPayments(db *pgxpool.Pool, chain *fakeChain) *StrkPayments {
+	return NewStrkPayments(db, chain, plans.DefaultCatalog(), StrkConfig{
+		TokenAddress:    DefaultStrkTokenAddress,
+		TreasuryAddress: testTreasury,
+		Confirmations:   2,
+		PaymentTTL:      time.Hour,
+		StartLookback:   10,
+	})
+}
+
+// insertTestPayment stores a payment for an exact amount, as a colliding
+// random tail would
+func insertTestPayment(t *testing.T, db *pgxpool.Pool, amount, status string, txHash *string) string {
+	t.Helper()
+	id := uuid.NewString()
+	_, err := db.Exec(context.Background(),
+		`INSERT INTO strk_payments (id, user_id, plan, amount, reference, status, transaction_hash, block_number, expires_at)
+		 VALUES ($1, $2, 'pro', $3, 'AURA-000001', $4, $5, CASE WHEN $5::text IS NULL THEN NULL ELSE 100 END, NOW() + INTERVAL '1 hour')`,
+		id, uuid.NewString(), amount, status, txHash,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func paymentStatus(t *testing.T, db *pgxpool.Pool, id string) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(context.Background(), "SELECT status FROM strk_payments WHERE id = $1", id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestPollConfirmsTransfer(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	chain := &fakeChain{head: 100}
+	payments := newTestPayments(db, chain)
+
+	userID := uuid.NewString()
+	payment, err := payments.CreatePaymentRequest(ctx, userID, "pro", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain.transfer("0x100", payment.Amount, 101)
+	chain.head = 101
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chain.scanned[0] != 91 {
+		t.Errorf("first scan from block %d, want %d", chain.scanned[0], 91)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusConfirming {
+		t.Fatalf("status = %s, want %s", status, StatusConfirming)
+	}
+
+	chain.head = 103
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusConfirmed {
+		t.Fatalf("status = %s, want %s", status, StatusConfirmed)
+	}
+	if plan, err := ActivePlan(ctx, db, userID); err != nil || plan != "pro" {
+		t.Fatalf("ActivePlan() = %q, %v", plan, err)
+	}
+
+	// A restarted watcher resumes after the last block scanned
+	chain.head = 104
+	chain.scanned = nil
+	if err := newTestPayments(db, chain).Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.scanned) != 1 || chain.scanned[0] != 104 {
+		t.Errorf("restarted watcher scanned from %v, want block 104", chain.scanned)
+	}
+
+	// Rescanning the transfer must not pay a new request with the same amount
+	if _, err := db.Exec(ctx, "DELETE FROM strk_payment_checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	again := insertTestPayment(t, db, payment.Amount, StatusPending, nil)
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := paymentStatus(t, db, again); status != StatusPending {
+		t.Errorf("rescanned transfer matched another payment, status = %s", status)
+	}
+}
+
+func TestPollLateTransfer(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	chain := &fakeChain{head: 100}
+	payments := newTestPayments(db, chain)
+
+	payment, err := payments.CreatePaymentRequest(ctx, uuid.NewString(), "pro", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "UPDATE strk_payments SET status = $1, expires_at = NOW() - INTERVAL '1 minute' WHERE id = $2", StatusExpired, payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The amount is held by an open payment: a second transfer of it pays neither
+	hash := "0x200"
+	open := insertTestPayment(t, db, payment.Amount, StatusConfirming, &hash)
+	chain.transfer("0x201", payment.Amount, 101)
+	chain.head = 101
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatalf("Poll() with a taken amount: %v", err)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusExpired {
+		t.Errorf("expired payment status = %s, want %s", status, StatusExpired)
+	}
+
+	// Once the amount is free, a late transfer still pays the expired request
+	if _, err := db.Exec(ctx, "UPDATE strk_payments SET status = $1 WHERE id = $2", StatusConfirmed, open); err != nil {
+		t.Fatal(err)
+	}
+	chain.transfer("0x202", payment.Amount, 102)
+	chain.head = 102
+	if err := payments.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := paymentStatus(t, db, payment.ID); status != StatusConfirming {
+		t.Errorf("late transfer not matched, status = %s", status)
+	}
+}
@@ -0,0 +1,65 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	database "aura-backend/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Subscription sources
+const (
+	SourceStripe = "stripe"
+	SourceStrk   = "strk"
+)
+
+// ActivePlan returns the plan of the user's active subscription, or an empty
+// string if the user has no time-boxed subscription running
+func ActivePlan(ctx context.Context, q database.Querier, userID string) (string, error) {
+	var plan string
+	err := q.QueryRow(ctx,
+		`SELECT plan FROM subscriptions
+		 WHERE user_id = $1 AND starts_at <= NOW() AND ends_at > NOW()
+		 ORDER BY ends_at DESC LIMIT 1`,
+		userID,
+	).Scan(&plan)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return plan, err
+}
+
+// ActivateSubscription grants a plan to the user for the given duration. If the
+// user already has the same plan running, the new period starts when it ends.
+func ActivateSubscription(ctx context.Context, q database.Querier, userID, plan, source, reference string, duration time.Duration) (time.Time, error) {
+	startsAt := time.Now()
+
+	var currentEnd *time.Time
+	err := q.QueryRow(ctx,
+		"SELECT MAX(ends_at) FROM subscriptions WHERE user_id = $1 AND plan = $2 AND ends_at > NOW()",
+		userID, plan,
+	).Scan(&currentEnd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if currentEnd != nil && currentEnd.After(startsAt) {
+		startsAt = *currentEnd
+	}
+
+	endsAt := startsAt.Add(duration)
+	_, err = q.Exec(ctx,
+		`INSERT INTO subscriptions (id, user_id, plan, source, reference, starts_at, ends_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`,
+		uuid.New().String(), userID, plan, source, reference, startsAt, endsAt,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return endsAt, nil
+}
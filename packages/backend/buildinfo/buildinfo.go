@@ -0,0 +1,54 @@
+// Package buildinfo describes the running build. GitSHA and BuildTime are set
+// at link time:
+//
+//	go build -ldflags "-X aura-backend/buildinfo.GitSHA=$(git rev-parse HEAD) \
+//	  -X aura-backend/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	database "aura-backend/db"
+)
+
+// Set with -ldflags -X
+var (
+	GitSHA    string
+	BuildTime string
+)
+
+// Info is reported by GET /version
+type Info struct {
+	GitSHA        string `json:"gitSha"`
+	BuildTime     string `json:"buildTime"`
+	GoVersion     string `json:"goVersion"`
+	SchemaVersion int    `json:"schemaVersion"` // Latest migration embedded in the binary
+}
+
+// Get returns the build information. Without ldflags, the revision recorded
+// by the Go toolchain is used when available.
+func Get() Info {
+	info := Info{
+		GitSHA:        GitSHA,
+		BuildTime:     BuildTime,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: database.SchemaVersion(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok && info.GitSHA == "" {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.GitSHA = setting.Value
+			}
+		}
+	}
+
+	if info.GitSHA == "" {
+		info.GitSHA = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"aura-backend/config"
+)
+
+// runConfigCommand implements `config print [--redacted]` and `config validate`
+func runConfigCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config print [--redacted] | validate")
+	}
+
+	switch args[0] {
+	case "print":
+		flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+		redacted := flags.Bool("redacted", false, "mask secrets")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return cfg.Print(os.Stdout, *redacted)
+
+	case "validate":
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		fmt.Printf("Configuration is valid for %s\n", cfg.Env)
+
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+
+	return nil
+}
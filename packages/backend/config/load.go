@@ -0,0 +1,192 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"aura-backend/logging"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the configuration from the defaults, the optional config file,
+// the environment and the command line flags, in increasing priority. It
+// returns the arguments left after the flags, such as subcommands.
+func Load(args []string) (*Config, []string, error) {
+	// Values from a .env file are loaded like regular environment variables
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Could not load .env file", logging.Err(err))
+	}
+
+	config := Default()
+
+	flags := flag.NewFlagSet("aura-backend", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	env := flags.String("env", "", "environment, development or production")
+	port := flags.String("port", "", "HTTP port")
+	databaseURL := flags.String("database-url", "", "Postgres connection string")
+	autoMigrate := flags.Bool("auto-migrate", false, "apply pending migrations on start")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(&config, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(&config).Elem(), os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			config.Env = *env
+		case "port":
+			config.Server.Port = *port
+		case "database-url":
+			config.Database.URL = *databaseURL
+		case "auto-migrate":
+			config.Database.AutoMigrate = *autoMigrate
+		}
+	})
+
+	config.Env = strings.ToLower(strings.TrimSpace(config.Env))
+	if config.Database.URL == "" && !config.IsProduction() {
+		slog.Warn("DATABASE_URL not set, using the local development database")
+		config.Database.URL = DefaultDatabaseURL
+	}
+
+	return &config, flags.Args(), nil
+}
+
+// loadFile reads a YAML or TOML file, chosen by extension. Unknown keys are
+// rejected so that typos do not silently fall back to defaults.
+func loadFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("could not parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return fmt.Errorf("could not parse config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %s in config file %s", undecoded[0], path)
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// loadEnv sets every field tagged with env from the environment. Empty
+// variables are ignored, as in .env.example where optional values are blank.
+func loadEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field, lookup); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		name := info.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok || strings.TrimSpace(raw) == "" {
+			continue
+		}
+		if err := setField(field, strings.TrimSpace(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setField parses a raw value into a field of a supported kind
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(value))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(value)
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(value)
+	case reflect.Slice:
+		// Lists are comma separated, e.g. CORS_ALLOWED_ORIGINS=https://a.com,https://b.com
+		var values []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in printed configurations
+const redacted = "********"
+
+// Print writes the configuration as YAML, in the format accepted by the
+// config file. With redact set, secrets are masked so the output can be
+// shared; URLs keep their scheme and host.
+func (c *Config) Print(w io.Writer, redact bool) error {
+	printed := *c
+	if redact {
+		redactSecrets(reflect.ValueOf(&printed).Elem())
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(printed); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redactSecrets masks every non-empty string field tagged secret
+func redactSecrets(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field, info := v.Field(i), v.Type().Field(i)
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			redactSecrets(field)
+		case field.Kind() == reflect.String && info.Tag.Get("secret") == "true" && field.String() != "":
+			field.SetString(redactValue(field.String()))
+		}
+	}
+}
+
+// redactValue hides a secret, keeping the scheme and host of URLs since
+// credentials and API keys may be anywhere else in them
+func redactValue(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	database "aura-backend/db"
+	"aura-backend/logging"
+	"aura-backend/starknet"
+)
+
+// Validate checks the configuration. Settings that are only unsafe in
+// production, such as a missing JWT secret, are errors in production mode
+// and warnings otherwise, so that a misconfigured deployment fails on startup
+// instead of at the first request.
+func (c *Config) Validate() error {
+	var errs, production []error
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		errs = append(errs, fmt.Errorf("APP_ENV must be %s or %s, got %q", EnvDevelopment, EnvProduction, c.Env))
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a port number, got %q", c.Server.Port))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 || c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT must be positive"))
+	}
+	if c.Server.MaxHeaderBytes < 4<<10 {
+		errs = append(errs, errors.New("SERVER_MAX_HEADER_BYTES must be at least 4096"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.Features.Metrics && c.Server.MetricsToken == "" {
+		production = append(production, errors.New("METRICS_TOKEN is not set, /metrics is public"))
+	}
+
+	// Logging
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be %s or %s", logging.FormatJSON, logging.FormatText))
+	}
+
+	// Tracing
+	if c.Tracing.Enabled {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL"))
+		}
+		if c.Tracing.ServiceName == "" {
+			errs = append(errs, errors.New("OTEL_SERVICE_NAME is required when tracing is enabled"))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+
+	// Database
+	if c.Database.URL == "" {
+		errs = append(errs, errors.New("DATABASE_URL is required"))
+	}
+	if c.Database.MaxConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_CONNS must be at least 1"))
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		errs = append(errs, errors.New("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS"))
+	}
+	if c.Database.QueryExecMode != "" {
+		if _, err := database.ParseQueryExecMode(c.Database.QueryExecMode); err != nil {
+			errs = append(errs, fmt.Errorf("DB_QUERY_EXEC_MODE: %w", err))
+		}
+	}
+
+	// Auth
+	if c.Auth.JWTSecret == "" {
+		production = append(production, errors.New("SUPABASE_JWT_SECRET is not set, access tokens are not verified"))
+	}
+
+	// CORS
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			production = append(production, errors.New("CORS_ALLOWED_ORIGINS allows every origin"))
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS contains an invalid origin %q", origin))
+		} else if u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" {
+			production = append(production, fmt.Errorf("CORS_ALLOWED_ORIGINS allows the local origin %s", origin))
+		}
+	}
+
+	// Rate limiting
+	if c.RateLimit.Backend != RateLimitMemory && c.RateLimit.Backend != RateLimitPostgres {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BACKEND must be %s or %s, got %q", RateLimitMemory, RateLimitPostgres, c.RateLimit.Backend))
+	}
+	if !c.RateLimit.Enabled {
+		production = append(production, errors.New("RATE_LIMIT_ENABLED is off, clients can flood the API"))
+	}
+
+	// Starknet and STRK payments
+	strk := c.Billing.Strk
+	if strk.TreasuryAddress != "" {
+		if _, err := starknet.ParseFelt(strk.TreasuryAddress); err != nil {
+			errs = append(errs, fmt.Errorf("STRK_TREASURY_ADDRESS: %w", err))
+		}
+		if c.Features.StrkPayments && c.Starknet.RPCURL == "" {
+			production = append(production, errors.New("STRK_TREASURY_ADDRESS is set but STARKNET_RPC_URL is not, STRK payments are disabled"))
+		}
+	}
+	if _, err := starknet.ParseFelt(strk.TokenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("STRK_TOKEN_ADDRESS: %w", err))
+	}
+	if strk.Confirmations < 1 {
+		errs = append(errs, errors.New("STRK_PAYMENT_CONFIRMATIONS must be at least 1"))
+	}
+	if strk.PaymentTTL <= 0 || strk.PollInterval <= 0 {
+		errs = append(errs, errors.New("STRK_PAYMENT_TTL and STRK_PAYMENT_POLL_INTERVAL must be positive"))
+	}
+	if c.Starknet.RPCURL != "" {
+		if u, err := url.Parse(c.Starknet.RPCURL); err != nil || u.Host == "" {
+			errs = append(errs, errors.New("STARKNET_RPC_URL is not a valid URL"))
+		}
+	}
+
+	// Operator account
+	operator := c.Operator
+	if (operator.Address == "") != (operator.PrivateKey == "") {
+		errs = append(errs, errors.New("OPERATOR_ADDRESS and OPERATOR_PRIVATE_KEY must be set together"))
+	}
+	if operator.Address != "" {
+		if _, err := starknet.ParseFelt(operator.Address); err != nil {
+			errs = append(errs, fmt.Errorf("OPERATOR_ADDRESS: %w", err))
+		}
+	}
+	if operator.PrivateKey != "" {
+		if key, err := starknet.ParseFelt(operator.PrivateKey); err != nil || key.Sign() == 0 {
+			// The key is a secret, keep it out of the error
+			errs = append(errs, errors.New("OPERATOR_PRIVATE_KEY is not a valid private key"))
+		}
+	}
+	if operator.FeeAmountMargin < 1 || operator.FeePriceMargin < 1 {
+		errs = append(errs, errors.New("OPERATOR_FEE_AMOUNT_MARGIN and OPERATOR_FEE_PRICE_MARGIN must be at least 1"))
+	}
+
+	// Achievements
+	if c.Achievements.ContractAddress != "" {
+		if _, err := starknet.ParseFelt(c.Achievements.ContractAddress); err != nil {
+			errs = append(errs, fmt.Errorf("ACHIEVEMENTS_CONTRACT_ADDRESS: %w", err))
+		}
+	}
+	if c.Achievements.PollInterval <= 0 || c.Achievements.ResubmitAfter <= 0 {
+		errs = append(errs, errors.New("ACHIEVEMENTS_POLL_INTERVAL and ACHIEVEMENTS_RESUBMIT_AFTER must be positive"))
+	}
+	if c.Achievements.MaxAttempts < 1 {
+		errs = append(errs, errors.New("ACHIEVEMENTS_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	// Staking
+	if c.Staking.ContractAddress != "" {
+		if _, err := starknet.ParseFelt(c.Staking.ContractAddress); err != nil {
+			errs = append(errs, fmt.Errorf("STAKING_CONTRACT_ADDRESS: %w", err))
+		}
+	}
+	if c.Staking.PollInterval <= 0 || c.Staking.ResubmitAfter <= 0 {
+		errs = append(errs, errors.New("STAKING_POLL_INTERVAL and STAKING_RESUBMIT_AFTER must be positive"))
+	}
+	if c.Staking.MaxAttempts < 1 {
+		errs = append(errs, errors.New("STAKING_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	// Rewards
+	if c.Rewards.TokenAddress != "" {
+		if _, err := starknet.ParseFelt(c.Rewards.TokenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("REWARDS_TOKEN_ADDRESS: %w", err))
+		}
+	}
+	if c.Rewards.ClaimInterval <= 0 || c.Rewards.PollInterval <= 0 || c.Rewards.ResubmitAfter <= 0 {
+		errs = append(errs, errors.New("REWARDS_CLAIM_INTERVAL, REWARDS_POLL_INTERVAL and REWARDS_RESUBMIT_AFTER must be positive"))
+	}
+	if c.Rewards.MaxRecipients < 1 || c.Rewards.MaxAttempts < 1 {
+		errs = append(errs, errors.New("REWARDS_MAX_RECIPIENTS and REWARDS_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	// Attestations
+	if c.Attestations.ContractAddress != "" {
+		if _, err := starknet.ParseFelt(c.Attestations.ContractAddress); err != nil {
+			errs = append(errs, fmt.Errorf("ATTESTATIONS_CONTRACT_ADDRESS: %w", err))
+		}
+	}
+	if c.Attestations.PollInterval <= 0 || c.Attestations.ResubmitAfter <= 0 {
+		errs = append(errs, errors.New("ATTESTATIONS_POLL_INTERVAL and ATTESTATIONS_RESUBMIT_AFTER must be positive"))
+	}
+	if c.Attestations.MaxAttempts < 1 {
+		errs = append(errs, errors.New("ATTESTATIONS_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	// Indexer
+	switch c.Indexer.Network {
+	case "devnet", "sepolia", "mainnet":
+	default:
+		errs = append(errs, fmt.Errorf("INDEXER_NETWORK must be devnet, sepolia or mainnet, got %q", c.Indexer.Network))
+	}
+	if c.Indexer.BatchBlocks < 1 || c.Indexer.PollInterval <= 0 {
+		errs = append(errs, errors.New("INDEXER_BATCH_BLOCKS and INDEXER_POLL_INTERVAL must be positive"))
+	}
+
+	// Outbox
+	if c.Outbox.PollInterval <= 0 || c.Outbox.RetryBackoff <= 0 || c.Outbox.ResubmitAfter <= 0 {
+		errs = append(errs, errors.New("OUTBOX_POLL_INTERVAL, OUTBOX_RETRY_BACKOFF and OUTBOX_RESUBMIT_AFTER must be positive"))
+	}
+	if c.Outbox.MaxBackoff < c.Outbox.RetryBackoff {
+		errs = append(errs, errors.New("OUTBOX_MAX_BACKOFF cannot be shorter than OUTBOX_RETRY_BACKOFF"))
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		errs = append(errs, errors.New("OUTBOX_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	// Portfolio
+	if _, err := starknet.ParseFelt(c.Portfolio.EthTokenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("ETH_TOKEN_ADDRESS: %w", err))
+	}
+	if u, err := url.Parse(c.Portfolio.PriceURL); err != nil || u.Host == "" {
+		errs = append(errs, errors.New("PORTFOLIO_PRICE_URL is not a valid URL"))
+	}
+	if c.Portfolio.BalanceTTL <= 0 || c.Portfolio.PriceTTL <= 0 {
+		errs = append(errs, errors.New("PORTFOLIO_BALANCE_TTL and PORTFOLIO_PRICE_TTL must be positive"))
+	}
+
+	// Wallet custody
+	if c.Wallet.EncryptionKey != "" {
+		if key, err := hex.DecodeString(c.Wallet.EncryptionKey); err != nil || len(key) != 32 {
+			// The key is a secret, keep it out of the error
+			errs = append(errs, errors.New("WALLET_ENCRYPTION_KEY must be 32 bytes in hex"))
+		}
+	} else if c.Features.Custody {
+		production = append(production, errors.New("WALLET_ENCRYPTION_KEY is not set, new wallets get simulated keys"))
+	}
+	if c.Wallet.ReauthWindow <= 0 || c.Wallet.PINLockout <= 0 || c.Wallet.RotationPollInterval <= 0 || c.Wallet.RotationTimeout <= 0 {
+		errs = append(errs, errors.New("WALLET_REAUTH_WINDOW, WALLET_PIN_LOCKOUT, WALLET_ROTATION_POLL_INTERVAL and WALLET_ROTATION_TIMEOUT must be positive"))
+	}
+	if c.Wallet.MaxPINAttempts < 1 {
+		errs = append(errs, errors.New("WALLET_MAX_PIN_ATTEMPTS must be at least 1"))
+	}
+
+	// Promotions
+	promotions := c.Billing.Promotions
+	if promotions.TrialDays < 0 || promotions.ReferralDays < 0 || promotions.ReferralMaxRewards < 0 {
+		errs = append(errs, errors.New("TRIAL_DAYS, REFERRAL_DAYS and REFERRAL_MAX_REWARDS cannot be negative"))
+	}
+	if !strings.HasPrefix(promotions.ReferralBaseURL, "https://") {
+		production = append(production, fmt.Errorf("REFERRAL_BASE_URL %s does not use https", promotions.ReferralBaseURL))
+	}
+
+	if c.IsProduction() {
+		errs = append(errs, production...)
+	} else {
+		for _, problem := range production {
+			slog.Warn("Unsafe configuration for production", logging.Err(problem))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"aura-backend/achievements"
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/plans"
+	"aura-backend/store"
+)
+
+// GetAchievementsHandler returns the user's achievement NFTs and their mint status
+func (c *Controller) GetAchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	list, err := c.Achievements.ListAchievements(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list achievements", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// saveCompletion saves the progress of a completed habit together with its
+// achievement and the outbox transaction minting it, so that a crash cannot
+// lose the mint. Without a wallet only the progress is saved.
+func (c *Controller) saveCompletion(r *http.Request, habit *Habit, completedAt time.Time) error {
+	wallet, err := c.Wallets.GetWallet(r.Context(), habit.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		logging.FromRequest(r).Warn("No wallet to receive the achievement", "habit_id", habit.ID)
+		return c.Habits.UpdateHabitProgress(r.Context(), habit)
+	} else if err != nil {
+		return err
+	}
+
+	achievement := achievements.NewAchievement(habit, wallet.Address, completedAt)
+	var queued []store.OutboxTransaction
+	if mint, err := achievements.MintTransaction(achievement, c.MintContract, completedAt); err == nil {
+		c.deferUnsponsored(r, mint, completedAt)
+		queued = append(queued, *mint)
+	} else {
+		// Left to the minter, which records why it cannot be minted
+		logging.FromRequest(r).Warn("Could not build the achievement mint", "habit_id", habit.ID, logging.Err(err))
+	}
+	return c.Outbox.SaveHabitProgress(r.Context(), habit, achievement, queued)
+}
+
+// deferUnsponsored holds back a transaction sent on behalf of a user who
+// spent the sponsored gas budget of their plan, until the fees counted
+// against it are out of the budget period. Failures are logged and the
+// transaction is sent: a completion is not refused over its budget.
+func (c *Controller) deferUnsponsored(r *http.Request, tx *store.OutboxTransaction, now time.Time) {
+	entitlements, err := c.entitlementsFor(r.Context(), tx.UserID)
+	if err != nil {
+		logging.FromRequest(r).Error("Database error resolving entitlements", logging.Err(err))
+		return
+	}
+	spent, err := c.Outbox.SponsoredFees(r.Context(), tx.UserID, now.Add(-plans.SponsoredGasPeriod))
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to sum sponsored fees", logging.Err(err))
+		return
+	}
+	if entitlements.CanSponsor(spent) {
+		return
+	}
+
+	tx.NextAttemptAt = now.Add(plans.SponsoredGasPeriod)
+	logging.FromRequest(r).Info("Sponsored gas budget spent, transaction deferred",
+		"kind", tx.Kind, "spent", spent.String(), "budget", entitlements.SponsoredGasBudget, "next_attempt_at", tx.NextAttemptAt)
+}
+
+// queueAchievement queues the mint of the achievement of a completed habit.
+// Failures are logged rather than returned: the progress is already saved.
+func (c *Controller) queueAchievement(r *http.Request, habit *Habit, completedAt time.Time) {
+	wallet, err := c.Wallets.GetWallet(r.Context(), habit.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		logging.FromRequest(r).Warn("No wallet to receive the achievement", "habit_id", habit.ID)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get wallet for achievement", logging.Err(err))
+		return
+	}
+
+	achievement := achievements.NewAchievement(habit, wallet.Address, completedAt)
+	err = c.Achievements.CreateAchievement(r.Context(), achievement)
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		logging.FromRequest(r).Error("Failed to queue achievement", "habit_id", habit.ID, logging.Err(err))
+	}
+}
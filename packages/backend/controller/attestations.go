@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/attestations"
+	"aura-backend/logging"
+	"aura-backend/store"
+	"aura-backend/validate"
+)
+
+// AttestationProofResponse lets a third party verify a check-in against the
+// root posted in the registry contract
+type AttestationProofResponse struct {
+	HabitID         string  `json:"habitId"`
+	Date            string  `json:"date"`
+	Day             uint32  `json:"day"` // Day number the registry stores the root under
+	WalletAddress   string  `json:"walletAddress"`
+	Contract        string  `json:"contract,omitempty"`
+	Leaves          int     `json:"leaves"`
+	Status          string  `json:"status"`
+	TransactionHash *string `json:"transactionHash,omitempty"`
+	attestations.Proof
+}
+
+var errAttestationNotFound = apierror.New(apierror.CodeAttestationNotFound, "No attested check-in on this habit that day")
+
+// GetAttestationProofHandler returns the Merkle proof of a check-in of one
+// of the user's habits on a UTC date
+func (c *Controller) GetAttestationProofHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	habitID := r.PathValue("habitId")
+	if !validate.IsUUID(habitID) {
+		apierror.Write(w, r, apierror.Invalid(map[string]string{"habitId": "must be a UUID"}))
+		return
+	}
+	day, err := time.Parse(time.DateOnly, r.PathValue("date"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid(map[string]string{"date": "must be a date like 2006-01-02"}))
+		return
+	}
+
+	if _, err := c.Habits.GetHabit(r.Context(), userID, habitID); errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitNotFound, "Habit not found"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Database error", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	attestation, err := c.Attestations.GetAttestation(r.Context(), day)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, errAttestationNotFound)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get attestation", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	// The tree is rebuilt from the leaves saved with the attestation, under
+	// the wallet the check-in was attested for
+	leaves, err := c.Attestations.AttestationLeaves(r.Context(), day)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list attested check-ins", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+	var walletAddress string
+	for _, leaf := range leaves {
+		if leaf.UserID == userID && leaf.HabitID == habitID {
+			walletAddress = leaf.WalletAddress
+		}
+	}
+	if walletAddress == "" {
+		apierror.Write(w, r, errAttestationNotFound)
+		return
+	}
+	proof, err := attestations.Prove(leaves, walletAddress, habitID, day)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to build attestation proof", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+	if proof.Root != attestation.Root {
+		logging.FromRequest(r).Error("Attested check-ins do not match the attested root", "day", r.PathValue("date"))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AttestationProofResponse{
+		HabitID:         habitID,
+		Date:            day.Format(time.DateOnly),
+		Day:             attestations.DayNumber(day),
+		WalletAddress:   walletAddress,
+		Contract:        c.AttestationContract,
+		Leaves:          attestation.Leaves,
+		Status:          attestation.Status,
+		TransactionHash: attestation.TransactionHash,
+		Proof:           *proof,
+	})
+}
+
+// recordCheckIn adds a check-in to the history attested on-chain. Failures
+// are logged rather than returned: the progress is already saved.
+func (c *Controller) recordCheckIn(r *http.Request, habit *Habit, at time.Time) {
+	err := c.Attestations.RecordCheckIn(r.Context(), &store.CheckIn{
+		UserID:    habit.UserID,
+		HabitID:   habit.ID,
+		Day:       attestations.Day(at),
+		CreatedAt: at,
+	})
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		logging.FromRequest(r).Error("Failed to record check-in", "habit_id", habit.ID, logging.Err(err))
+	}
+}
@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/custody"
+	"aura-backend/logging"
+	"aura-backend/ratelimit"
+	"aura-backend/store"
+	"aura-backend/validate"
+)
+
+// recentWalletEvents bounds the security log returned
+const recentWalletEvents = 50
+
+// SetWalletPINRequest sets the PIN guarding the wallet, or changes it
+type SetWalletPINRequest struct {
+	PIN        string `json:"pin" validate:"raw,required,min=6,max=6,digits"`
+	CurrentPIN string `json:"currentPin" validate:"raw,min=6,max=6,digits"` // Required once a PIN is set
+}
+
+// ExportWalletRequest exports the wallet key encrypted with a passphrase
+type ExportWalletRequest struct {
+	PIN        string `json:"pin" validate:"raw,required,min=6,max=6,digits"`
+	Passphrase string `json:"passphrase" validate:"raw,required,min=12,max=256"`
+}
+
+// StartRecoveryRequest rotates the wallet key
+type StartRecoveryRequest struct {
+	PIN string `json:"pin" validate:"raw,required,min=6,max=6,digits"`
+}
+
+var (
+	errCustodyDisabled  = apierror.New(apierror.CodeFeatureDisabled, "Wallet export and recovery are not enabled")
+	errRecoveryDisabled = apierror.New(apierror.CodeFeatureDisabled, "Wallet recovery needs a Starknet node")
+	errReauthRequired   = apierror.New(apierror.CodeReauthRequired, "Sign in again to continue")
+	errCustodyNoWallet  = apierror.New(apierror.CodeWalletNotFound, "Log in to create your wallet")
+)
+
+// custodyErrors maps the custody errors clients can act on to API errors
+var custodyErrors = map[error]*apierror.Error{
+	store.ErrNotFound:             errCustodyNoWallet,
+	custody.ErrNotCustodial:       apierror.New(apierror.CodeWalletNotCustodial, "The key of this wallet is not held by Aura"),
+	custody.ErrPINNotSet:          apierror.New(apierror.CodePINNotSet, "Set a wallet PIN first"),
+	custody.ErrInvalidPIN:         apierror.New(apierror.CodeInvalidPIN, "Wrong PIN"),
+	custody.ErrPINLocked:          apierror.New(apierror.CodePINLocked, "Too many wrong PINs, try again later"),
+	custody.ErrAlreadyExported:    apierror.New(apierror.CodeWalletAlreadyExported, "This key was already exported, recover your wallet to get a new one"),
+	custody.ErrRecoveryInProgress: apierror.New(apierror.CodeRecoveryInProgress, "Your wallet key is being replaced"),
+	custody.ErrNotDeployed:        apierror.New(apierror.CodeWalletNotDeployed, "Your wallet account is not deployed yet, it cannot be recovered"),
+	custody.ErrWeakPassphrase:     apierror.Invalid(map[string]string{"passphrase": "must be at least 12 characters"}),
+	custody.ErrRotationNotSent:    apierror.New(apierror.CodeChainUnavailable, "Could not send the recovery transaction, try again later"),
+}
+
+// custodyError returns the API error for a custody error, or nil when the
+// error is unexpected and must be reported as an internal error
+func custodyError(err error) *apierror.Error {
+	for target, apiErr := range custodyErrors {
+		if errors.Is(err, target) {
+			return apiErr
+		}
+	}
+	return nil
+}
+
+// authenticateCustody authenticates a request changing or releasing a wallet
+// key, which needs a recent sign-in: a stolen session alone is not enough
+func (c *Controller) authenticateCustody(r *http.Request) (string, error) {
+	if c.Custody == nil {
+		return "", errCustodyDisabled
+	}
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		return "", err
+	}
+	if !c.recentlyAuthenticated(r) {
+		return "", errReauthRequired
+	}
+	return userID, nil
+}
+
+// recentlyAuthenticated reports whether the user signed in within the
+// re-authentication window. Supabase lists the sign-ins of a session with
+// their time in the amr claim, which refreshing the token keeps.
+func (c *Controller) recentlyAuthenticated(r *http.Request) bool {
+	claims, ok := extractTokenClaims(r)
+	if !ok {
+		return false
+	}
+	methods, _ := claims["amr"].([]interface{})
+
+	var latest float64
+	for _, method := range methods {
+		entry, _ := method.(map[string]interface{})
+		if timestamp, ok := entry["timestamp"].(float64); ok && timestamp > latest {
+			latest = timestamp
+		}
+	}
+	return latest > 0 && time.Since(time.Unix(int64(latest), 0)) <= c.ReauthWindow
+}
+
+// SetWalletPINHandler sets the PIN required to export or recover the
+// user's wallet. Changing it requires the current PIN.
+func (c *Controller) SetWalletPINHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateCustody(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var request SetWalletPINRequest
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	err = c.Custody.SetPIN(r.Context(), userID, request.PIN, request.CurrentPIN, ratelimit.ClientIP(r, c.TrustProxy))
+	if apiErr := custodyError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to set wallet PIN", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportWalletHandler returns the private key of the user's wallet,
+// encrypted with their passphrase. A key is returned once; the response
+// must not be cached.
+func (c *Controller) ExportWalletHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateCustody(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var request ExportWalletRequest
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	export, err := c.Custody.Export(r.Context(), userID, request.PIN, request.Passphrase, ratelimit.ClientIP(r, c.TrustProxy))
+	if apiErr := custodyError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to export wallet", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(export)
+}
+
+// StartRecoveryHandler replaces the signing key of the user's wallet account
+// with a new one. The rotation completes once the transaction is accepted,
+// follow it on GET /api/wallet/recovery.
+func (c *Controller) StartRecoveryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateCustody(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if c.Custody.Node == nil {
+		apierror.Write(w, r, errRecoveryDisabled)
+		return
+	}
+
+	var request StartRecoveryRequest
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	rotation, err := c.Custody.StartRecovery(r.Context(), userID, request.PIN, ratelimit.ClientIP(r, c.TrustProxy))
+	if apiErr := custodyError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to start wallet recovery", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rotation)
+}
+
+// GetRecoveryHandler returns the user's latest key rotation
+func (c *Controller) GetRecoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if c.Custody == nil {
+		apierror.Write(w, r, errCustodyDisabled)
+		return
+	}
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	rotation, err := c.Wallets.LatestKeyRotation(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeRecoveryNotFound, "Your wallet key was never rotated"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get key rotation", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rotation)
+}
+
+// GetWalletEventsHandler returns the security log of the user's wallet,
+// newest first
+func (c *Controller) GetWalletEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	list, err := c.Wallets.ListWalletEvents(r.Context(), userID, recentWalletEvents)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list wallet events", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
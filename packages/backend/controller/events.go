@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/store"
+)
+
+// Page sizes of GET /api/events
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 200
+)
+
+// EventsResponse is a page of indexed contract events, newest first
+type EventsResponse struct {
+	Events     []store.ChainEvent `json:"events"`
+	NextCursor *int64             `json:"nextCursor,omitempty"` // Passed as before to get the next page
+}
+
+// GetEventsHandler returns the indexed events of our contracts, optionally
+// filtered by contract and event name
+func (c *Controller) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := c.authenticateUser(r); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	params := r.URL.Query()
+	query := store.EventQuery{
+		Contract: params.Get("contract"),
+		Name:     params.Get("event"),
+		Limit:    defaultEventsLimit,
+	}
+	fields := map[string]string{}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxEventsLimit {
+			fields["limit"] = "must be a number between 1 and " + strconv.Itoa(maxEventsLimit)
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || before < 1 {
+			fields["before"] = "must be an event ID"
+		}
+		query.Before = before
+	}
+	if len(fields) > 0 {
+		apierror.Write(w, r, apierror.Invalid(fields))
+		return
+	}
+
+	events, err := c.Events.ListEvents(r.Context(), query)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list events", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	response := EventsResponse{Events: events}
+	if len(events) == query.Limit {
+		response.NextCursor = &events[len(events)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
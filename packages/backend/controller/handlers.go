@@ -1,46 +1,44 @@
 package controller
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"aura-backend/apierror"
+	"aura-backend/billing"
+	"aura-backend/custody"
+	"aura-backend/health"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/plans"
+	"aura-backend/portfolio"
+	"aura-backend/rewards"
+	"aura-backend/store"
+	"aura-backend/tracing"
+	"aura-backend/validate"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("aura-backend/controller")
+
 // Required types for controllers
-type User struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
-}
+type User = store.User
 
-type Habit struct {
-	ID              string     `json:"id"`
-	UserID          string     `json:"userId"`
-	Name            string     `json:"name"`
-	DaysCompleted   int        `json:"daysCompleted"`
-	Completed       bool       `json:"completed"`
-	CreatedAt       time.Time  `json:"createdAt"`
-	LastTrackedDate *time.Time `json:"lastTrackedDate,omitempty"` // New property
-}
+type Habit = store.Habit
 
-type Wallet struct {
-	PublicKey           string `json:"publicKey"`
-	EncryptedPrivateKey string `json:"encryptedPrivateKey"`
-	Address             string `json:"address"`
-}
+type Wallet = store.Wallet
 
 type LoginRequest struct {
-	UserID string `json:"userId"`
-	Email  string `json:"email"`
+	UserID string `json:"userId" validate:"required,uuid"`
+	Email  string `json:"email" validate:"max=254,email"`
 }
 
 type LoginResponse struct {
@@ -49,79 +47,129 @@ type LoginResponse struct {
 	Wallet  *Wallet `json:"wallet,omitempty"`
 }
 
-// Controller structure that maintains the database connection
+// Controller structure that maintains the stores used by the handlers
 type Controller struct {
-	DB *sql.DB
+	Users               store.UserStore
+	Habits              store.HabitStore
+	Wallets             store.WalletStore
+	Subscriptions       store.SubscriptionStore
+	Achievements        store.AchievementStore
+	Stakes              store.StakeStore
+	Rewards             store.RewardStore
+	Attestations        store.AttestationStore
+	Events              store.EventStore
+	Outbox              store.OutboxStore
+	Plans               *plans.Catalog
+	Payments            *billing.StrkPayments // nil when STRK payments are disabled
+	Promotions          *billing.Promotions   // nil when promotions are disabled
+	JWTSecret           []byte                // Verifies token signatures, tokens are only decoded when empty
+	Readiness           *health.Checker       // Dependencies checked by /readyz, none when nil
+	Metrics             *metrics.Domain       // Business event counters
+	StakingContract     string                // Escrow stakes are deposited in, staking is disabled when empty
+	RewardRules         *rewards.Rules        // Points accrued per check-in, none are accrued when nil
+	AttestationContract string                // Registry the daily roots are posted to, shown with proofs
+	MintContract        string                // Achievement mints are queued in the outbox with the progress when set
+	Portfolio           *portfolio.Portfolio  // Reads wallet balances, balances are disabled when nil
+	Custody             *custody.Custody      // Holds wallet keys, wallets get simulated keys and no export when nil
+	ReauthWindow        time.Duration         // How recently users must have signed in to export or recover
+	TrustProxy          bool                  // Identify clients by X-Forwarded-For in the wallet security log
 }
 
 // NewController creates a new controller instance
-func NewController(db *sql.DB) *Controller {
-	return &Controller{DB: db}
+func NewController(s store.Store, catalog *plans.Catalog, payments *billing.StrkPayments, promotions *billing.Promotions) *Controller {
+	return &Controller{
+		Users:         s,
+		Habits:        s,
+		Wallets:       s,
+		Subscriptions: s,
+		Achievements:  s,
+		Stakes:        s,
+		Rewards:       s,
+		Attestations:  s,
+		Events:        s,
+		Outbox:        s,
+		Plans:         catalog,
+		Payments:      payments,
+		Promotions:    promotions,
+		Metrics:       &metrics.Domain{},
+	}
 }
 
 // LoginHandler handles login requests
 func (c *Controller) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	var request LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	if userID != request.UserID {
-		http.Error(w, "User ID mismatch", http.StatusForbidden)
+		apierror.Write(w, r, apierror.New(apierror.CodeForbidden, "User ID mismatch"))
 		return
 	}
 
 	// Check if user already has a wallet
-	var wallet Wallet
-	var exists bool
-
-	err = c.DB.QueryRow("SELECT public_key, encrypted_private_key, address FROM wallets WHERE user_id = $1", userID).
-		Scan(&wallet.PublicKey, &wallet.EncryptedPrivateKey, &wallet.Address)
-
-	if err == nil {
-		exists = true
-	} else if err != sql.ErrNoRows {
-		log.Printf("Database error checking wallet: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	wallet, err := c.Wallets.GetWallet(r.Context(), userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromRequest(r).Error("Database error checking wallet", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
 
 	response := LoginResponse{}
 
-	if exists {
+	if wallet != nil {
 		// If the user already has a wallet, return success
 		response.Success = true
 		response.Message = "User already has a wallet"
-		response.Wallet = &wallet
+		response.Wallet = wallet
 	} else {
 		// Create a new wallet for the user
 		// In a real case, here we would call the Chipi SDK function
 		// to create the wallet with account abstraction
 
 		// NOTE: This is a simulated implementation, in production
-		// you would use the Chipi SDK to generate these values
+		// you would use the Chipi SDK to generate these values. With
+		// custody enabled the key pair is real and sealed, the address
+		// stays a placeholder until the account is deployed.
+		ctx, span := tracer.Start(r.Context(), "wallet.create")
 		newWallet := Wallet{
 			PublicKey:           fmt.Sprintf("public_key_%s", generateID()),
 			EncryptedPrivateKey: fmt.Sprintf("encrypted_key_%s", generateID()),
 			Address:             fmt.Sprintf("0x%s", generateID()),
 		}
+		if c.Custody != nil {
+			newWallet.PublicKey, newWallet.EncryptedPrivateKey, err = c.Custody.NewWallet(userID)
+			if err != nil {
+				tracing.End(span, err)
+				logging.FromRequest(r).Error("Failed to generate wallet key", logging.Err(err))
+				apierror.Write(w, r, apierror.ErrInternal)
+				return
+			}
+		}
 
 		// Save the wallet in the database
-		_, err := c.DB.Exec(
-			"INSERT INTO wallets (user_id, public_key, encrypted_private_key, address) VALUES ($1, $2, $3, $4)",
-			userID, newWallet.PublicKey, newWallet.EncryptedPrivateKey, newWallet.Address,
-		)
+		err := c.Wallets.CreateWallet(ctx, userID, &newWallet)
+		tracing.End(span, err)
+		if err == nil {
+			c.Metrics.WalletsCreated.Inc()
+		} else if errors.Is(err, store.ErrConflict) {
+			// A concurrent login created the wallet first, return that one
+			wallet, err = c.Wallets.GetWallet(r.Context(), userID)
+			if err == nil {
+				newWallet = *wallet
+			}
+		}
 
 		if err != nil {
-			log.Printf("Error saving wallet: %v", err)
-			http.Error(w, "Failed to save wallet", http.StatusInternalServerError)
+			logging.FromRequest(r).Error("Failed to save wallet", logging.Err(err))
+			apierror.Write(w, r, apierror.ErrInternal)
 			return
 		}
 
@@ -136,9 +184,9 @@ func (c *Controller) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetUserRoleHandler handles requests to obtain the user's role
 func (c *Controller) GetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
@@ -148,33 +196,42 @@ func (c *Controller) GetUserRoleHandler(w http.ResponseWriter, r *http.Request)
 	user.FirstName, user.LastName = extractNameFromToken(r)
 
 	// Check if user exists in the database
-	err = c.DB.QueryRow("SELECT role, first_name, last_name FROM users_profiles WHERE id = $1", userID).Scan(&user.Role, &user.FirstName, &user.LastName)
-	if err == sql.ErrNoRows {
+	stored, err := c.Users.GetUser(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
 		// User doesn't exist, create a new user profile with default role
-		user.Role = "free" // Default role
-		_, err := c.DB.Exec("INSERT INTO users_profiles (id, email, role, first_name, last_name) VALUES ($1, $2, $3, $4, $5)",
-			userID, user.Email, user.Role, user.FirstName, user.LastName)
-		if err != nil {
-			log.Printf("Error creating user profile: %v", err)
-			http.Error(w, "Database error", http.StatusInternalServerError)
+		user.Role = c.Plans.Default().Name // Default role
+		if err := c.Users.CreateUser(r.Context(), &user); err != nil && !errors.Is(err, store.ErrConflict) {
+			logging.FromRequest(r).Error("Failed to create user profile", logging.Err(err))
+			apierror.Write(w, r, apierror.ErrInternal)
 			return
 		}
 	} else if err != nil {
-		log.Printf("Database error: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("Database error", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	} else {
+		user.Role = stored.Role
+
 		// User exists, but let's update first_name and last_name if they were null or if we got new values from token
 		if user.FirstName != "" || user.LastName != "" {
-			_, err = c.DB.Exec("UPDATE users_profiles SET first_name = COALESCE($1, first_name), last_name = COALESCE($2, last_name), email = COALESCE($3, email) WHERE id = $4",
-				nullIfEmpty(user.FirstName), nullIfEmpty(user.LastName), nullIfEmpty(user.Email), userID)
+			err = c.Users.UpdateUserProfile(r.Context(), userID, user.FirstName, user.LastName, user.Email)
 			if err != nil {
-				log.Printf("Error updating user profile: %v", err)
+				logging.FromRequest(r).Error("Failed to update user profile", logging.Err(err))
 				// Not returning an error to the client as this is not critical
 			}
+		} else {
+			user.FirstName, user.LastName = stored.FirstName, stored.LastName
 		}
 	}
 
+	// A running subscription (e.g. paid with STRK) takes precedence over the stored role
+	activePlan, err := c.Subscriptions.ActivePlan(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to get active subscription", logging.Err(err))
+	} else if activePlan != "" {
+		user.Role = activePlan
+	}
+
 	// Return user with role and name
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
@@ -182,37 +239,17 @@ func (c *Controller) GetUserRoleHandler(w http.ResponseWriter, r *http.Request)
 
 // GetHabitsHandler handles requests to obtain the user's habits
 func (c *Controller) GetHabitsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Get habits for user from database
-	rows, err := c.DB.Query(
-		"SELECT id, user_id, name, days_completed, completed, created_at, last_tracked_date FROM habits WHERE user_id = $1 ORDER BY created_at DESC",
-		userID,
-	)
+	habits, err := c.Habits.ListHabits(r.Context(), userID)
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var habits []Habit
-	for rows.Next() {
-		var h Habit
-		if err := rows.Scan(&h.ID, &h.UserID, &h.Name, &h.DaysCompleted, &h.Completed, &h.CreatedAt, &h.LastTrackedDate); err != nil {
-			log.Printf("Error scanning habit row: %v", err)
-			continue
-		}
-		habits = append(habits, h)
-	}
-
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating habits rows: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("Database error", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
 
@@ -227,49 +264,50 @@ func (c *Controller) GetHabitsHandler(w http.ResponseWriter, r *http.Request) {
 
 // CreateHabitHandler handles requests to create a new habit
 func (c *Controller) CreateHabitHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Parse request body
 	var request struct {
-		Name string `json:"name"`
+		Name     string `json:"name" validate:"required,max=100,printable"`
+		GoalDays int    `json:"goalDays,omitempty" validate:"min=0,max=365"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Get user role to check limits
-	var userRole string
-	err = c.DB.QueryRow("SELECT role FROM users_profiles WHERE id = $1", userID).Scan(&userRole)
-	if err == sql.ErrNoRows {
-		userRole = "free" // Default role if not found
-	} else if err != nil {
-		log.Printf("Database error getting user role: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	// Resolve the user's entitlements to check limits
+	entitlements, err := c.entitlementsFor(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Database error resolving entitlements", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	goalDays := request.GoalDays
+	if goalDays == 0 {
+		goalDays = plans.DefaultGoalDays
+	}
+	if !entitlements.AllowsGoal(goalDays) {
+		apierror.Write(w, r, apierror.New(apierror.CodeGoalTooLong, fmt.Sprintf("Your plan allows goals of up to %d days", entitlements.MaxGoalDays)))
 		return
 	}
 
 	// Count active habits (not completed)
-	var activeHabitCount int
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE user_id = $1 AND completed = false", userID).Scan(&activeHabitCount)
+	activeHabitCount, err := c.Habits.CountActiveHabits(r.Context(), userID)
 	if err != nil {
-		log.Printf("Database error counting habits: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("Database error counting habits", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
 
 	// Check if user has reached their habit limit (only counting active habits)
-	maxHabits := 1 // Default for free users
-	if userRole == "pro" {
-		maxHabits = 5
-	}
-
-	if activeHabitCount >= maxHabits {
-		http.Error(w, "You have reached the maximum number of active habits for your plan", http.StatusForbidden)
+	if !entitlements.CanCreateHabit(activeHabitCount) {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitLimitReached, "You have reached the maximum number of active habits for your plan"))
 		return
 	}
 
@@ -279,20 +317,18 @@ func (c *Controller) CreateHabitHandler(w http.ResponseWriter, r *http.Request)
 		UserID:        userID,
 		Name:          request.Name,
 		DaysCompleted: 0,
+		GoalDays:      goalDays,
 		Completed:     false,
 		CreatedAt:     time.Now(),
 	}
 
 	// Insert habit into database
-	_, err = c.DB.Exec(
-		"INSERT INTO habits (id, user_id, name, days_completed, completed, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
-		newHabit.ID, newHabit.UserID, newHabit.Name, newHabit.DaysCompleted, newHabit.Completed, newHabit.CreatedAt,
-	)
-	if err != nil {
-		log.Printf("Error creating habit: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if err := c.Habits.CreateHabit(r.Context(), &newHabit); err != nil {
+		logging.FromRequest(r).Error("Failed to create habit", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
+	c.Metrics.HabitsCreated.Inc()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(newHabit)
@@ -300,36 +336,27 @@ func (c *Controller) CreateHabitHandler(w http.ResponseWriter, r *http.Request)
 
 // UpdateHabitProgressHandler handles requests to update a habit's progress
 func (c *Controller) UpdateHabitProgressHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Get habit ID from path
-	path := r.URL.Path
-	segments := strings.Split(path, "/")
-	if len(segments) < 4 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+	habitID := r.PathValue("habitId")
+	if !validate.IsUUID(habitID) {
+		apierror.Write(w, r, apierror.Invalid(map[string]string{"habitId": "must be a UUID"}))
 		return
 	}
-	habitID := segments[3]
 
 	// Check if habit exists and belongs to the user
-	var habit Habit
-	err = c.DB.QueryRow(
-		"SELECT id, user_id, name, days_completed, completed, created_at, last_tracked_date FROM habits WHERE id = $1 AND user_id = $2",
-		habitID, userID,
-	).Scan(
-		&habit.ID, &habit.UserID, &habit.Name, &habit.DaysCompleted, &habit.Completed, &habit.CreatedAt, &habit.LastTrackedDate,
-	)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Habit not found", http.StatusNotFound)
+	habit, err := c.Habits.GetHabit(r.Context(), userID, habitID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitNotFound, "Habit not found"))
 		return
 	} else if err != nil {
-		log.Printf("Database error: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("Database error", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
 
@@ -339,100 +366,99 @@ func (c *Controller) UpdateHabitProgressHandler(w http.ResponseWriter, r *http.R
 		today := time.Now().Format("2006-01-02")
 
 		if lastTrackedDate == today {
-			http.Error(w, "You've already tracked progress for this habit today", http.StatusConflict)
+			apierror.Write(w, r, apierror.New(apierror.CodeAlreadyTrackedToday, "You've already tracked progress for this habit today"))
 			return
 		}
 	}
 
-	// Increment days completed
+	// Increment days completed, and the streak when the habit was tracked
+	// yesterday
 	habit.DaysCompleted++
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	if habit.LastTrackedDate != nil && habit.LastTrackedDate.Format("2006-01-02") == yesterday {
+		habit.Streak++
+	} else {
+		habit.Streak = 1
+	}
 
-	// Check if habit is completed (7 days)
-	if habit.DaysCompleted >= 7 {
+	// Check if habit has reached its goal
+	if habit.DaysCompleted >= habit.GoalDays {
 		habit.Completed = true
-		habit.DaysCompleted = 7 // Cap at 7 days
+		habit.DaysCompleted = habit.GoalDays // Cap at the goal
 	}
 
 	// Update lastTrackedDate to current time
 	now := time.Now()
 	habit.LastTrackedDate = &now
 
-	// Update habit in database
-	_, err = c.DB.Exec(
-		"UPDATE habits SET days_completed = $1, completed = $2, last_tracked_date = $3 WHERE id = $4",
-		habit.DaysCompleted, habit.Completed, habit.LastTrackedDate, habit.ID,
-	)
+	// Update habit in database, with the mint of its achievement once completed
+	if habit.Completed && c.MintContract != "" {
+		err = c.saveCompletion(r, habit, now)
+	} else {
+		err = c.Habits.UpdateHabitProgress(r.Context(), habit)
+	}
 	if err != nil {
-		log.Printf("Error updating habit: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("Failed to update habit", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
+	c.Metrics.CheckIns.Inc()
+	c.recordCheckIn(r, habit, now)
+	c.accrueRewards(r, habit, now)
+	if habit.Completed {
+		c.Metrics.HabitsCompleted.Inc()
+		if c.MintContract == "" {
+			c.queueAchievement(r, habit, now)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(habit)
 }
 
-// UpdateUserRoleHandler handles requests to update a user's role
+// UpdateUserRoleHandler switches a user back to the default plan. Paid
+// plans are only granted by STRK payments, trials and promo codes, which
+// check what they grant.
 func (c *Controller) UpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := authenticateUser(r)
+	userID, err := c.authenticateUser(r)
 	if err != nil {
-		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Parse request body
 	var request struct {
-		Role        string `json:"role"`
-		CustomerId  string `json:"customerId,omitempty"`
-		FromWebhook bool   `json:"fromWebhook,omitempty"`
+		Role string `json:"role" validate:"max=32"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Validate role value
-	if request.Role != "" && request.Role != "free" && request.Role != "pro" {
-		http.Error(w, "Invalid role value", http.StatusBadRequest)
-		return
-	}
-
-	// If no role is provided in request, default to upgrading to pro
-	roleToUpdate := "pro"
+	// Validate role value against the configured plans, without a role
+	// users go back to the default plan
+	plan := c.Plans.Default()
 	if request.Role != "" {
-		roleToUpdate = request.Role
+		requested, ok := c.Plans.Get(request.Role)
+		if !ok {
+			apierror.Write(w, r, apierror.New(apierror.CodeInvalidPlan, "Invalid role value"))
+			return
+		}
+		if requested.Name != plan.Name {
+			apierror.Write(w, r, apierror.New(apierror.CodePlanNotSelfService, "Paid plans are granted by a payment, a trial or a promo code"))
+			return
+		}
 	}
+	roleToUpdate := plan.Name
 
 	// Update the user's role in the database
-	_, err = c.DB.Exec("UPDATE users_profiles SET role = $1 WHERE id = $2",
-		roleToUpdate, userID)
-
-	if err != nil {
-		log.Printf("Error updating user role: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if err := c.Users.UpdateUserRole(r.Context(), userID, roleToUpdate); err != nil {
+		logging.FromRequest(r).Error("Failed to update user role", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
 		return
 	}
-
-	// Add customer_id if provided (for Stripe subscriptions)
-	if request.CustomerId != "" {
-		_, err = c.DB.Exec("UPDATE users_profiles SET stripe_customer_id = $1 WHERE id = $2",
-			request.CustomerId, userID)
-
-		if err != nil {
-			log.Printf("Error updating stripe customer ID: %v", err)
-			// We don't return an error here as the main operation (role update) was successful
-		}
-	}
-
-	// Log the successful role update
-	if request.FromWebhook {
-		log.Printf("User %s role updated to %s via webhook (customer ID: %s)",
-			userID, roleToUpdate, request.CustomerId)
-	} else {
-		log.Printf("User %s role updated to %s manually", userID, roleToUpdate)
-	}
+	logging.FromRequest(r).Info("User role updated", "role", roleToUpdate)
 
 	// Return the updated user data
 	var user User
@@ -440,13 +466,13 @@ func (c *Controller) UpdateUserRoleHandler(w http.ResponseWriter, r *http.Reques
 	user.Role = roleToUpdate
 
 	// Get other user data
-	err = c.DB.QueryRow("SELECT email, first_name, last_name FROM users_profiles WHERE id = $1",
-		userID).Scan(&user.Email, &user.FirstName, &user.LastName)
-
+	stored, err := c.Users.GetUser(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error retrieving updated user: %v", err)
+		logging.FromRequest(r).Error("Failed to retrieve updated user", logging.Err(err))
 		// Even if we encounter an error retrieving the full user data,
 		// we'll return what we have since the update was successful
+	} else {
+		user.Email, user.FirstName, user.LastName = stored.Email, stored.FirstName, stored.LastName
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -457,46 +483,107 @@ func (c *Controller) UpdateUserRoleHandler(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// GetEntitlementsHandler returns the limits of the user's current plan
+func (c *Controller) GetEntitlementsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	entitlements, err := c.entitlementsFor(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Database error resolving entitlements", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entitlements)
+}
+
 // Helper functions
 
-func authenticateUser(r *http.Request) (string, error) {
+// entitlementsFor resolves the entitlements of a user from their active
+// subscription, falling back to their stored role
+func (c *Controller) entitlementsFor(ctx context.Context, userID string) (plans.Entitlements, error) {
+	activePlan, err := c.Subscriptions.ActivePlan(ctx, userID)
+	if err != nil {
+		return plans.Entitlements{}, err
+	}
+	if activePlan != "" {
+		return c.Plans.Entitlements(activePlan), nil
+	}
+
+	var role string
+	user, err := c.Users.GetUser(ctx, userID)
+	if err == nil {
+		role = user.Role
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return plans.Entitlements{}, err
+	}
+
+	// Users without a profile get the default plan
+	return c.Plans.Entitlements(role), nil
+}
+
+// Authentication errors
+var (
+	errMissingToken = apierror.New(apierror.CodeUnauthorized, "Missing authorization header")
+	errTokenExpired = apierror.New(apierror.CodeTokenExpired, "Your session has expired, please sign in again")
+	errTokenInvalid = apierror.New(apierror.CodeTokenInvalid, "Invalid access token")
+)
+
+// authenticateUser returns the ID of the user the access token was issued to
+func (c *Controller) authenticateUser(r *http.Request) (string, error) {
 	// Get token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("no authorization header")
+		return "", errMissingToken
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Parse the JWT token without validation first to extract claims
-	parser := new(jwt.Parser)
-	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
-	if err != nil {
-		return "", fmt.Errorf("could not parse token: %v", err)
+	// Verify the signature with the Supabase JWT secret when configured,
+	// otherwise only decode the token, which is accepted in development
+	var token *jwt.Token
+	var err error
+	if len(c.JWTSecret) > 0 {
+		token, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+			return c.JWTSecret, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	} else {
+		token, _, err = new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	}
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "", errTokenExpired
+	} else if err != nil {
+		return "", errTokenInvalid
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", fmt.Errorf("invalid token claims")
+		return "", errTokenInvalid
 	}
 
 	// Validate the token expiration
 	exp, ok := claims["exp"].(float64)
 	if !ok || int64(exp) < time.Now().Unix() {
-		return "", fmt.Errorf("token expired")
+		return "", errTokenExpired
 	}
 
 	// Extract user ID (sub) from claims
 	sub, ok := claims["sub"].(string)
 	if !ok || sub == "" {
-		return "", fmt.Errorf("user ID not found in token")
+		return "", errTokenInvalid
 	}
 
 	// Validate the issuer is from Supabase
 	iss, ok := claims["iss"].(string)
 	if !ok || !strings.Contains(iss, "supabase") {
-		return "", fmt.Errorf("invalid token issuer: %s", iss)
+		return "", errTokenInvalid
 	}
+	logging.SetUserID(r.Context(), sub)
 
 	return sub, nil
 }
@@ -506,7 +593,6 @@ func extractTokenClaims(r *http.Request) (jwt.MapClaims, bool) {
 	// Get token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		log.Println("No Authorization header found")
 		return nil, false
 	}
 
@@ -515,13 +601,11 @@ func extractTokenClaims(r *http.Request) (jwt.MapClaims, bool) {
 	// Parse token without validation
 	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
 	if err != nil {
-		log.Printf("Error parsing token: %v", err)
 		return nil, false
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		log.Println("Invalid token claims")
 		return nil, false
 	}
 
@@ -548,7 +632,7 @@ func extractNameFromToken(r *http.Request) (string, string) {
 		return "", ""
 	}
 
-	// Extract name from claims
+	// Extract name from claims. Names are personal data, never log them.
 	var firstName, lastName string
 
 	// Try to get user_metadata first (where OAuth providers store data)
@@ -575,50 +659,35 @@ func extractNameFromToken(r *http.Request) (string, string) {
 					lastName = strings.Join(parts[1:], " ")
 				}
 			}
-			log.Printf("Extracted from name - firstName: %s, lastName: %s", firstName, lastName)
 			return firstName, lastName
 		}
 
 		// Try explicit first_name and last_name fields
 		if fn, ok := userMetadata["first_name"].(string); ok {
 			firstName = fn
-			log.Printf("Found first_name in metadata: %s", firstName)
 		} else if fn, ok := userMetadata["given_name"].(string); ok {
 			firstName = fn
-			log.Printf("Found given_name in metadata: %s", firstName)
 		}
 
 		if ln, ok := userMetadata["last_name"].(string); ok {
 			lastName = ln
-			log.Printf("Found last_name in metadata: %s", lastName)
 		} else if ln, ok := userMetadata["family_name"].(string); ok {
 			lastName = ln
-			log.Printf("Found family_name in metadata: %s", lastName)
 		}
-	} else {
-		log.Println("No user_metadata found in token")
 	}
 
 	// Try root level name claims
 	if firstName == "" {
 		if fn, ok := claims["given_name"].(string); ok {
 			firstName = fn
-			log.Printf("Found given_name at root level: %s", firstName)
-		} else {
-			log.Println("No given_name found at root level")
 		}
 	}
 	if lastName == "" {
 		if ln, ok := claims["family_name"].(string); ok {
 			lastName = ln
-			log.Printf("Found family_name at root level: %s", lastName)
-		} else {
-			log.Println("No family_name found at root level")
 		}
 	}
 
-	log.Printf("Final extracted name - firstName: %s, lastName: %s", firstName, lastName)
-
 	// For debugging purposes, always set a name if none is found
 	if firstName == "" && lastName == "" {
 		// This is only for testing - remove in production
@@ -631,7 +700,6 @@ func extractNameFromToken(r *http.Request) (string, string) {
 				if len(parts) > 1 {
 					lastName = strings.Title(parts[1])
 				}
-				log.Printf("Created name from email - firstName: %s, lastName: %s", firstName, lastName)
 			}
 		}
 	}
@@ -642,10 +710,3 @@ func extractNameFromToken(r *http.Request) (string, string) {
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
-
-func nullIfEmpty(value string) interface{} {
-	if value == "" {
-		return nil
-	}
-	return value
-}
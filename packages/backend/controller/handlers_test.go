@@ -0,0 +1,935 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/attestations"
+	"aura-backend/custody"
+	"aura-backend/health"
+	"aura-backend/metrics"
+	"aura-backend/plans"
+	"aura-backend/portfolio"
+	"aura-backend/ratelimit"
+	"aura-backend/rewards"
+	"aura-backend/starknet"
+	"aura-backend/store"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testUserID  = "0b7c2c1e-8f0e-4c53-9a56-2f6f7d1d2a10"
+	otherUserID = "9d8e7f6a-5b4c-4d3e-9f2a-1b0c9d8e7f6a"
+)
+
+// testToken builds a Supabase-like access token for the given user
+func testToken(t *testing.T, userID string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   userID,
+		"email": "jane.doe@example.com",
+		"iss":   "https://project.supabase.co/auth/v1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"user_metadata": map[string]interface{}{
+			"full_name": "Jane Doe",
+		},
+	})
+
+	signed, err := token.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestServer() (http.Handler, *store.Memory) {
+	memory := store.NewMemory()
+	return SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{}), memory
+}
+
+func doRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken(t, testUserID))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUnauthenticatedRequest(t *testing.T) {
+	handler, _ := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/habits", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestGetUserRoleCreatesProfile(t *testing.T) {
+	handler, memory := newTestServer()
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/user/role", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var user User
+	json.NewDecoder(rec.Body).Decode(&user)
+	if user.Role != "free" || user.FirstName != "Jane" || user.LastName != "Doe" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	if _, err := memory.GetUser(context.Background(), testUserID); err != nil {
+		t.Errorf("profile not stored: %v", err)
+	}
+}
+
+func TestCreateHabitEnforcesPlanLimit(t *testing.T) {
+	handler, _ := newTestServer()
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"Read"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first habit: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var habit Habit
+	json.NewDecoder(rec.Body).Decode(&habit)
+	if habit.Name != "Read" || habit.GoalDays != plans.DefaultGoalDays || habit.UserID != testUserID {
+		t.Errorf("unexpected habit %+v", habit)
+	}
+
+	// Free users can only have one active habit
+	rec = doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"Run"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("second habit: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestCreateHabitWithSubscription(t *testing.T) {
+	handler, memory := newTestServer()
+	memory.AddSubscription(testUserID, "pro", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	for _, name := range []string{"Read", "Run", "Meditate"} {
+		rec := doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"`+name+`","goalDays":21}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("habit %s: status = %d, body = %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/habits", "")
+	var habits []Habit
+	json.NewDecoder(rec.Body).Decode(&habits)
+	if len(habits) != 3 {
+		t.Errorf("got %d habits, want 3", len(habits))
+	}
+}
+
+const (
+	testHabitID    = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+	missingHabitID = "00000000-0000-4000-8000-000000000000"
+)
+
+func TestUpdateHabitProgress(t *testing.T) {
+	handler, memory := newTestServer()
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	memory.CreateHabit(context.Background(), &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   6,
+		GoalDays:        7,
+		CreatedAt:       yesterday,
+		LastTrackedDate: &yesterday,
+	})
+
+	rec := doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var habit Habit
+	json.NewDecoder(rec.Body).Decode(&habit)
+	if habit.DaysCompleted != 7 || !habit.Completed {
+		t.Errorf("habit not completed: %+v", habit)
+	}
+
+	// Tracking twice on the same day is rejected
+	rec = doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = doRequest(t, handler, http.MethodPut, "/api/habits/"+missingHabitID+"/progress", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLoginCreatesWalletOnce(t *testing.T) {
+	handler, _ := newTestServer()
+	body := `{"userId":"` + testUserID + `","email":"jane.doe@example.com"}`
+
+	var first, second LoginResponse
+	json.NewDecoder(doRequest(t, handler, http.MethodPost, "/api/login", body).Body).Decode(&first)
+	json.NewDecoder(doRequest(t, handler, http.MethodPost, "/api/login", body).Body).Decode(&second)
+
+	if first.Wallet == nil || second.Wallet == nil {
+		t.Fatal("login did not return a wallet")
+	}
+	if first.Wallet.Address != second.Wallet.Address {
+		t.Errorf("second login returned a different wallet")
+	}
+	if second.Message != "User already has a wallet" {
+		t.Errorf("unexpected message %q", second.Message)
+	}
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+otherUserID+`"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestUpdateUserRoleValidatesPlan(t *testing.T) {
+	handler, _ := newTestServer()
+	doRequest(t, handler, http.MethodGet, "/api/user/role", "")
+
+	rec := doRequest(t, handler, http.MethodPut, "/api/user/role", `{"role":"platinum"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Without a role, users go back to the default plan
+	rec = doRequest(t, handler, http.MethodPut, "/api/user/role", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var entitlements plans.Entitlements
+	json.NewDecoder(doRequest(t, handler, http.MethodGet, "/api/user/entitlements", "").Body).Decode(&entitlements)
+	if entitlements.Name != "free" || entitlements.HabitLimit != 1 {
+		t.Errorf("unexpected entitlements %+v", entitlements)
+	}
+}
+
+func TestUpdateUserRoleRefusesPaidPlans(t *testing.T) {
+	handler, memory := newTestServer()
+	doRequest(t, handler, http.MethodGet, "/api/user/role", "")
+
+	if rec := doRequest(t, handler, http.MethodPut, "/api/user/role", `{"role":"pro"}`); errorCode(t, rec) != apierror.CodePlanNotSelfService {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if user, _ := memory.GetUser(context.Background(), testUserID); user.Role != "free" {
+		t.Errorf("role = %q after a refused upgrade", user.Role)
+	}
+
+	// A paid user may give their plan up
+	memory.UpdateUserRole(context.Background(), testUserID, "pro")
+	if rec := doRequest(t, handler, http.MethodPut, "/api/user/role", `{"role":"FREE"}`); rec.Code != http.StatusOK {
+		t.Fatalf("downgrade: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if user, _ := memory.GetUser(context.Background(), testUserID); user.Role != "free" {
+		t.Errorf("role = %q after a downgrade", user.Role)
+	}
+}
+
+func TestVerifiedTokens(t *testing.T) {
+	handler := SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{JWTSecret: "test-secret"})
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/habits", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid token: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	handler = SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{JWTSecret: "another-secret"})
+	rec = doRequest(t, handler, http.MethodGet, "/api/habits", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("forged token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	readiness := health.NewChecker()
+	handler := SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{Readiness: readiness})
+
+	for _, path := range []string{"/healthz", "/readyz", "/version"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+
+	readiness.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	var report ReadyzResponse
+	json.NewDecoder(rec.Body).Decode(&report)
+	if report.Status != health.StatusUnavailable || report.Checks["database"] != health.StatusUnavailable {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if strings.Contains(rec.Body.String(), "connection refused") {
+		t.Errorf("readiness report exposes the check error: %s", rec.Body)
+	}
+
+	// Liveness does not depend on the database
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	handler := SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{
+		Metrics:      registry,
+		MetricsToken: "scraper-token",
+		Domain:       metrics.NewDomain(registry),
+	})
+
+	doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"Read","goalDays":7}`)
+
+	// Scrapes need the metrics token, a user's token is not enough
+	for _, header := range []string{"", "Bearer " + testToken(t, testUserID)} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("metrics with Authorization %q: status = %d, want %d", header, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scraper-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	for _, line := range []string{
+		`aura_habits_created_total 1`,
+		`http_requests_total{route="POST /api/habits",code="200"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, rec.Body)
+		}
+	}
+}
+
+// errorCode decodes the code of an error envelope
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) apierror.Code {
+	t.Helper()
+
+	var envelope struct {
+		Error struct {
+			Code      apierror.Code `json:"code"`
+			RequestID string        `json:"requestId"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatalf("body is not an error envelope: %v", err)
+	}
+	if envelope.Error.RequestID == "" || envelope.Error.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Errorf("error envelope request ID %q does not match the response header", envelope.Error.RequestID)
+	}
+	return envelope.Error.Code
+}
+
+func TestErrorCodes(t *testing.T) {
+	handler, _ := newTestServer()
+
+	doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"Read"}`)
+	rec := doRequest(t, handler, http.MethodPost, "/api/habits", `{"name":"Run"}`)
+	if code := errorCode(t, rec); code != apierror.CodeHabitLimitReached {
+		t.Errorf("second habit: code = %s, want %s", code, apierror.CodeHabitLimitReached)
+	}
+
+	rec = doRequest(t, handler, http.MethodPut, "/api/habits/"+missingHabitID+"/progress", "")
+	if code := errorCode(t, rec); code != apierror.CodeHabitNotFound {
+		t.Errorf("missing habit: code = %s, want %s", code, apierror.CodeHabitNotFound)
+	}
+
+	// Expired tokens are told apart from invalid ones so the frontend can refresh
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": testUserID,
+		"iss": "https://project.supabase.co/auth/v1",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	signed, _ := expired.SignedString([]byte("test-secret"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/habits", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if code := errorCode(t, rec); code != apierror.CodeTokenExpired {
+		t.Errorf("expired token: code = %s, want %s", code, apierror.CodeTokenExpired)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	handler, _ := newTestServer()
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		field                    string
+	}{
+		{"unknown field", http.MethodPost, "/api/habits", `{"name":"Read","admin":true}`, http.StatusUnprocessableEntity, "admin"},
+		{"empty name", http.MethodPost, "/api/habits", `{"name":"   "}`, http.StatusUnprocessableEntity, "name"},
+		{"long name", http.MethodPost, "/api/habits", `{"name":"` + strings.Repeat("a", 101) + `"}`, http.StatusUnprocessableEntity, "name"},
+		{"wrong type", http.MethodPost, "/api/habits", `{"name":"Read","goalDays":"7"}`, http.StatusUnprocessableEntity, "goalDays"},
+		{"negative goal", http.MethodPost, "/api/habits", `{"name":"Read","goalDays":-1}`, http.StatusUnprocessableEntity, "goalDays"},
+		{"habit ID", http.MethodPut, "/api/habits/habit-1/progress", "", http.StatusUnprocessableEntity, "habitId"},
+		{"user ID", http.MethodPost, "/api/login", `{"userId":"me"}`, http.StatusUnprocessableEntity, "userId"},
+		{"missing body", http.MethodPost, "/api/habits", "", http.StatusBadRequest, ""},
+		{"malformed body", http.MethodPost, "/api/habits", `{"name":`, http.StatusBadRequest, ""},
+		{"trailing data", http.MethodPost, "/api/habits", `{"name":"Read"}{}`, http.StatusBadRequest, ""},
+		{"too large", http.MethodPost, "/api/habits", `{"name":"` + strings.Repeat("a", 70<<10) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, handler, tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.status, rec.Body)
+			}
+
+			var envelope struct {
+				Error struct {
+					Fields map[string]string `json:"fields"`
+				} `json:"error"`
+			}
+			json.NewDecoder(rec.Body).Decode(&envelope)
+			if tt.field != "" && envelope.Error.Fields[tt.field] == "" {
+				t.Errorf("no error for field %q in %v", tt.field, envelope.Error.Fields)
+			}
+		})
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	handler := SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{RateLimits: ratelimit.NewMemory()})
+
+	body := `{"userId":"` + testUserID + `"}`
+	for i := 0; i < rateLimits["POST /api/login"].Limit; i++ {
+		if rec := doRequest(t, handler, http.MethodPost, "/api/login", body); rec.Code != http.StatusOK {
+			t.Fatalf("login %d: status = %d", i+1, rec.Code)
+		}
+	}
+	rec := doRequest(t, handler, http.MethodPost, "/api/login", body)
+	if code := errorCode(t, rec); code != apierror.CodeRateLimited || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("code = %s, Retry-After = %q", code, rec.Header().Get("Retry-After"))
+	}
+
+	// Limits are per route and per user
+	if rec := doRequest(t, handler, http.MethodGet, "/api/habits", ""); rec.Code != http.StatusOK {
+		t.Errorf("unlimited route: status = %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"userId":"`+otherUserID+`"}`))
+	req.Header.Set("Authorization", "Bearer "+testToken(t, otherUserID))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("other user: status = %d", rec.Code)
+	}
+}
+
+func TestCompletedHabitQueuesAchievement(t *testing.T) {
+	handler, memory := newTestServer()
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	memory.CreateHabit(context.Background(), &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   6,
+		GoalDays:        7,
+		CreatedAt:       yesterday,
+		LastTrackedDate: &yesterday,
+	})
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/achievements", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("before completion: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+
+	var list []store.Achievement
+	json.NewDecoder(doRequest(t, handler, http.MethodGet, "/api/achievements", "").Body).Decode(&list)
+	if len(list) != 1 {
+		t.Fatalf("got %d achievements, want 1", len(list))
+	}
+	wallet, _ := memory.GetWallet(context.Background(), testUserID)
+	if a := list[0]; a.HabitID != testHabitID || a.Status != store.AchievementQueued || a.WalletAddress != wallet.Address || a.GoalDays != 7 {
+		t.Errorf("unexpected achievement %+v", a)
+	}
+}
+
+func TestCompletedHabitQueuesMintTransaction(t *testing.T) {
+	memory := store.NewMemory()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{MintContract: "0xabc"})
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	memory.CreateHabit(context.Background(), &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   6,
+		GoalDays:        7,
+		CreatedAt:       yesterday,
+		LastTrackedDate: &yesterday,
+	})
+
+	if rec := doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", ""); rec.Code != http.StatusOK {
+		t.Fatalf("progress: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// The mint is queued with the achievement, which the minter skips
+	achievements, _ := memory.ListAchievements(context.Background(), testUserID)
+	if len(achievements) != 1 {
+		t.Fatalf("got %d achievements, want 1", len(achievements))
+	}
+	if pending, _ := memory.PendingAchievements(context.Background(), 10); len(pending) != 0 {
+		t.Errorf("achievement also pending for the minter: %+v", pending)
+	}
+
+	var list []store.OutboxTransaction
+	rec := doRequest(t, handler, http.MethodGet, "/api/transactions", "")
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list) != 1 {
+		t.Fatalf("transactions: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if tx := list[0]; tx.Kind != store.OutboxAchievementMint || tx.Reference != achievements[0].ID || tx.Status != store.OutboxQueued {
+		t.Errorf("unexpected transaction %+v", tx)
+	}
+}
+
+func TestStakeOnHabit(t *testing.T) {
+	memory := store.NewMemory()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{StakingContract: "0xabc"})
+	path := "/api/habits/" + testHabitID + "/stake"
+	body := `{"transactionHash":"0xdeposit"}`
+
+	memory.CreateHabit(context.Background(), &Habit{ID: testHabitID, UserID: testUserID, Name: "Read", GoalDays: 7, CreatedAt: time.Now()})
+
+	if rec := doRequest(t, handler, http.MethodPost, path, body); errorCode(t, rec) != apierror.CodeWalletNotFound {
+		t.Fatalf("without wallet: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(t, handler, http.MethodGet, path, ""); errorCode(t, rec) != apierror.CodeStakeNotFound {
+		t.Fatalf("before staking: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	rec := doRequest(t, handler, http.MethodPost, path, body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("stake: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var stake store.Stake
+	json.NewDecoder(doRequest(t, handler, http.MethodGet, path, "").Body).Decode(&stake)
+	wallet, _ := memory.GetWallet(context.Background(), testUserID)
+	if stake.Status != store.StakePending || stake.StakerAddress != wallet.Address || stake.DepositTransactionHash != "0xdeposit" {
+		t.Errorf("unexpected stake %+v", stake)
+	}
+
+	if rec := doRequest(t, handler, http.MethodPost, path, body); errorCode(t, rec) != apierror.CodeAlreadyStaked {
+		t.Errorf("second stake: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(t, handler, http.MethodPost, "/api/habits/"+missingHabitID+"/stake", body); errorCode(t, rec) != apierror.CodeHabitNotFound {
+		t.Errorf("missing habit: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStakeOnHabitInProgress(t *testing.T) {
+	memory := store.NewMemory()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{StakingContract: "0xabc"})
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+
+	// Six days of seven done leave nothing at stake
+	tracked := time.Now()
+	memory.CreateHabit(context.Background(), &Habit{ID: testHabitID, UserID: testUserID, Name: "Read", GoalDays: 7, DaysCompleted: 6, LastTrackedDate: &tracked, CreatedAt: time.Now().AddDate(0, 0, -6)})
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/habits/"+testHabitID+"/stake", `{"transactionHash":"0xdeposit"}`)
+	if errorCode(t, rec) != apierror.CodeHabitInProgress {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if _, err := memory.GetStake(context.Background(), testUserID, testHabitID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("stake stored: %v", err)
+	}
+}
+
+func TestStakingDisabled(t *testing.T) {
+	handler, _ := newTestServer()
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/habits/"+testHabitID+"/stake", `{"transactionHash":"0xdeposit"}`)
+	if errorCode(t, rec) != apierror.CodeFeatureDisabled {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckInAccruesRewards(t *testing.T) {
+	memory := store.NewMemory()
+	rules := rewards.DefaultRules()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{RewardRules: &rules})
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	memory.CreateHabit(context.Background(), &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   6,
+		Streak:          6,
+		GoalDays:        30,
+		CreatedAt:       yesterday,
+		LastTrackedDate: &yesterday,
+	})
+	memory.AddSubscription(testUserID, "pro", yesterday, time.Now().Add(24*time.Hour))
+
+	doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/rewards", "")
+	var response RewardsResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	// A 7 day streak earns the check-in and a milestone, doubled by the pro plan
+	if rec.Code != http.StatusOK || response.Pending != 120 || response.Claimed != 0 || len(response.Rewards) != 2 {
+		t.Errorf("status = %d, rewards = %+v", rec.Code, response)
+	}
+}
+
+func TestCheckInRestartsBrokenStreak(t *testing.T) {
+	memory := store.NewMemory()
+	rules := rewards.DefaultRules()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{RewardRules: &rules})
+
+	lastWeek := time.Now().AddDate(0, 0, -7)
+	memory.CreateHabit(context.Background(), &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   2,
+		Streak:          2,
+		GoalDays:        7,
+		CreatedAt:       lastWeek,
+		LastTrackedDate: &lastWeek,
+	})
+
+	rec := doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+	var habit Habit
+	json.NewDecoder(rec.Body).Decode(&habit)
+	if rec.Code != http.StatusOK || habit.DaysCompleted != 3 || habit.Streak != 1 {
+		t.Fatalf("status = %d, habit = %+v", rec.Code, habit)
+	}
+
+	// The third day tracked is not a 3 day streak
+	var response RewardsResponse
+	json.NewDecoder(doRequest(t, handler, http.MethodGet, "/api/rewards", "").Body).Decode(&response)
+	if response.Pending != 10 || len(response.Rewards) != 1 {
+		t.Errorf("rewards = %+v", response)
+	}
+}
+
+func TestRewardsHistoryFollowsPlan(t *testing.T) {
+	handler, memory := newTestServer()
+	ctx := context.Background()
+
+	memory.AddReward(ctx, &store.Reward{ID: "old", UserID: testUserID, HabitID: testHabitID, Reason: "check_in", Day: 1, Points: 10, CreatedAt: time.Now().AddDate(0, 0, -10)})
+	memory.AddReward(ctx, &store.Reward{ID: "new", UserID: testUserID, HabitID: testHabitID, Reason: "check_in", Day: 2, Points: 10, CreatedAt: time.Now()})
+
+	// The free plan shows a week of history, the totals still count everything
+	var response RewardsResponse
+	rec := doRequest(t, handler, http.MethodGet, "/api/rewards", "")
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusOK || response.Pending != 20 || len(response.Rewards) != 1 || response.Rewards[0].ID != "new" {
+		t.Fatalf("free: status = %d, rewards = %+v", rec.Code, response)
+	}
+
+	memory.AddSubscription(testUserID, "pro", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	json.NewDecoder(doRequest(t, handler, http.MethodGet, "/api/rewards", "").Body).Decode(&response)
+	if len(response.Rewards) != 2 {
+		t.Errorf("pro: rewards = %+v", response.Rewards)
+	}
+}
+
+func TestMintDeferredPastSponsoredGasBudget(t *testing.T) {
+	memory := store.NewMemory()
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{MintContract: "0xabc"})
+	ctx := context.Background()
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	memory.CreateHabit(ctx, &Habit{ID: "spent", UserID: testUserID, Name: "Run", GoalDays: 7, Completed: true, CreatedAt: yesterday})
+	memory.CreateHabit(ctx, &Habit{
+		ID:              testHabitID,
+		UserID:          testUserID,
+		Name:            "Read",
+		DaysCompleted:   6,
+		GoalDays:        7,
+		CreatedAt:       yesterday,
+		LastTrackedDate: &yesterday,
+	})
+
+	// An earlier mint used up the free plan's budget
+	spent := store.OutboxTransaction{
+		ID:        "spent",
+		UserID:    testUserID,
+		Kind:      store.OutboxAchievementMint,
+		Reference: "spent",
+		Status:    store.OutboxConfirmed,
+		Fee:       strconv.FormatUint(plans.DefaultCatalog().Default().SponsoredGasBudget, 10),
+		CreatedAt: yesterday,
+		UpdatedAt: yesterday,
+	}
+	memory.SaveHabitProgress(ctx, &Habit{ID: "spent", Completed: true}, nil, []store.OutboxTransaction{spent})
+
+	if rec := doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", ""); rec.Code != http.StatusOK {
+		t.Fatalf("progress: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// The mint is queued, but not sent before the budget period is over
+	list, _ := memory.ListOutbox(ctx, testUserID, 10)
+	if len(list) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(list))
+	}
+	if pending, _ := memory.PendingOutbox(ctx, time.Now().Add(24*time.Hour), 10); len(pending) != 0 {
+		t.Errorf("mint past the budget is due: %+v", pending)
+	}
+	if pending, _ := memory.PendingOutbox(ctx, time.Now().Add(plans.SponsoredGasPeriod), 10); len(pending) != 1 {
+		t.Errorf("mint not due after the budget period: %+v", pending)
+	}
+}
+
+func TestAttestationProof(t *testing.T) {
+	handler, memory := newTestServer()
+	ctx := context.Background()
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	memory.CreateHabit(ctx, &Habit{ID: testHabitID, UserID: testUserID, Name: "Read", GoalDays: 7, CreatedAt: time.Now()})
+	doRequest(t, handler, http.MethodPut, "/api/habits/"+testHabitID+"/progress", "")
+
+	today := attestations.Day(time.Now())
+	path := "/api/habits/" + testHabitID + "/attestations/" + today.Format(time.DateOnly)
+	if rec := doRequest(t, handler, http.MethodGet, path, ""); errorCode(t, rec) != apierror.CodeAttestationNotFound {
+		t.Fatalf("before attestation: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// Attest the day the way the attester does
+	leaves, _ := memory.CheckInLeaves(ctx, today)
+	tree, _ := attestations.Build(leaves, today)
+	memory.CreateAttestation(ctx, &store.Attestation{Day: today, Root: attestations.HashToHex(tree.Root()), Leaves: tree.Len(), Status: store.AttestationConfirmed}, leaves)
+
+	// A check-in by a user creating their wallet after the attestation does
+	// not change the proofs of the day
+	memory.CreateWallet(ctx, "late-user", &store.Wallet{Address: "0x0456"})
+	memory.RecordCheckIn(ctx, &store.CheckIn{UserID: "late-user", HabitID: "7a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d", Day: today})
+
+	rec := doRequest(t, handler, http.MethodGet, path, "")
+	var response AttestationProofResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusOK || response.Root != attestations.HashToHex(tree.Root()) || response.Leaf != response.Root || response.Status != store.AttestationConfirmed {
+		t.Errorf("status = %d, proof = %+v", rec.Code, response)
+	}
+
+	if rec := doRequest(t, handler, http.MethodGet, "/api/habits/"+testHabitID+"/attestations/yesterday", ""); errorCode(t, rec) != apierror.CodeValidationFailed {
+		t.Errorf("invalid date: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	handler, memory := newTestServer()
+
+	var events []store.ChainEvent
+	for i := 1; i <= 3; i++ {
+		events = append(events, store.ChainEvent{
+			Contract:        "AuraToken",
+			Name:            "RewardMinted",
+			Fields:          json.RawMessage(`{"amount":"10"}`),
+			BlockNumber:     uint64(i),
+			TransactionHash: "0x" + strconv.Itoa(i),
+		})
+	}
+	memory.SaveEvents(context.Background(), events, store.EventCheckpoint{BlockNumber: 3, BlockHash: "0x3"})
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/events?contract=AuraToken&event=RewardMinted&limit=2", "")
+	var page EventsResponse
+	json.NewDecoder(rec.Body).Decode(&page)
+	if rec.Code != http.StatusOK || len(page.Events) != 2 || page.Events[0].BlockNumber != 3 || page.NextCursor == nil {
+		t.Fatalf("first page: status = %d, page = %+v", rec.Code, page)
+	}
+
+	rec = doRequest(t, handler, http.MethodGet, "/api/events?limit=2&before="+strconv.FormatInt(*page.NextCursor, 10), "")
+	page = EventsResponse{}
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Events) != 1 || page.Events[0].BlockNumber != 1 || page.NextCursor != nil {
+		t.Fatalf("last page = %+v", page)
+	}
+
+	if rec := doRequest(t, handler, http.MethodGet, "/api/events?limit=1000", ""); errorCode(t, rec) != apierror.CodeValidationFailed {
+		t.Errorf("limit too high: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+// fakeBalances holds 2 of every token in every wallet
+type fakeBalances struct{}
+
+func (fakeBalances) CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error) {
+	return []string{"0x1bc16d674ec80000", "0x0"}, nil
+}
+
+func TestGetWalletBalances(t *testing.T) {
+	if rec := doRequest(t, SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{}), http.MethodGet, "/api/wallet/balances", ""); errorCode(t, rec) != apierror.CodeFeatureDisabled {
+		t.Fatalf("disabled: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	prices := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ethereum":{"usd":2000},"starknet":{"usd":0.5}}`))
+	}))
+	defer prices.Close()
+	balances := portfolio.NewPortfolio(fakeBalances{}, portfolio.Config{
+		Tokens: []portfolio.Token{
+			{Symbol: "STRK", Address: "0xa", Decimals: 18, PriceID: "starknet"},
+			{Symbol: "ETH", Address: "0xb", Decimals: 18, PriceID: "ethereum"},
+		},
+		PriceURL:   prices.URL,
+		BalanceTTL: time.Minute,
+		PriceTTL:   time.Minute,
+	})
+	handler := SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{Portfolio: balances})
+
+	if rec := doRequest(t, handler, http.MethodGet, "/api/wallet/balances", ""); errorCode(t, rec) != apierror.CodeWalletNotFound {
+		t.Fatalf("without wallet: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	rec := doRequest(t, handler, http.MethodGet, "/api/wallet/balances", "")
+	var response portfolio.Balances
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusOK || len(response.Tokens) != 2 || response.Tokens[0].Formatted != "2" || response.TotalUSD != 4001 {
+		t.Errorf("status = %d, balances = %+v", rec.Code, response)
+	}
+}
+
+// signedInToken is a test token whose session signed in with a password at
+// the given time
+func signedInToken(t *testing.T, signedInAt time.Time) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": testUserID,
+		"iss": "https://project.supabase.co/auth/v1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"amr": []map[string]interface{}{{"method": "password", "timestamp": signedInAt.Unix()}},
+	})
+	signed, err := token.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestWalletExport(t *testing.T) {
+	if rec := doRequest(t, SetupRoutes(store.NewMemory(), plans.DefaultCatalog(), nil, nil, Options{}), http.MethodPost, "/api/wallet/export", `{}`); errorCode(t, rec) != apierror.CodeFeatureDisabled {
+		t.Fatalf("disabled: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	memory := store.NewMemory()
+	keys, err := custody.NewCustody(memory, nil, custody.Config{MasterKey: make([]byte, 32), MaxPINAttempts: 5, PINLockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := SetupRoutes(memory, plans.DefaultCatalog(), nil, nil, Options{Custody: keys, WalletReauthWindow: 5 * time.Minute})
+	send := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	recent := signedInToken(t, time.Now().Add(-time.Minute))
+
+	// Logging in creates a wallet with a sealed key
+	doRequest(t, handler, http.MethodPost, "/api/login", `{"userId":"`+testUserID+`"}`)
+	wallet, _ := memory.GetWallet(context.Background(), testUserID)
+	if !strings.HasPrefix(wallet.EncryptedPrivateKey, "v1:") {
+		t.Fatalf("wallet key is not sealed: %+v", wallet)
+	}
+
+	// Tokens of old sessions must sign in again
+	for _, token := range []string{testToken(t, testUserID), signedInToken(t, time.Now().Add(-time.Hour))} {
+		if rec := send(token, http.MethodPut, "/api/wallet/pin", `{"pin":"123456"}`); errorCode(t, rec) != apierror.CodeReauthRequired {
+			t.Fatalf("old session: status = %d, body = %s", rec.Code, rec.Body)
+		}
+	}
+
+	if rec := send(recent, http.MethodPost, "/api/wallet/export", `{"pin":"123456","passphrase":"correct horse battery"}`); errorCode(t, rec) != apierror.CodePINNotSet {
+		t.Fatalf("without PIN: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := send(recent, http.MethodPut, "/api/wallet/pin", `{"pin":"12345a"}`); errorCode(t, rec) != apierror.CodeValidationFailed {
+		t.Fatalf("invalid PIN: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := send(recent, http.MethodPut, "/api/wallet/pin", `{"pin":"123456"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("set PIN: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := send(recent, http.MethodPost, "/api/wallet/export", `{"pin":"654321","passphrase":"correct horse battery"}`); errorCode(t, rec) != apierror.CodeInvalidPIN {
+		t.Fatalf("wrong PIN: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// The passphrase is used as typed, surrounding spaces included
+	rec := send(recent, http.MethodPost, "/api/wallet/export", `{"pin":"123456","passphrase":" correct horse battery "}`)
+	var export custody.Export
+	json.NewDecoder(rec.Body).Decode(&export)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" || export.Format != custody.ExportFormat {
+		t.Fatalf("export: status = %d, export = %+v", rec.Code, export)
+	}
+	if _, err := custody.OpenExport(export.Key, wallet.Address, " correct horse battery "); err != nil {
+		t.Errorf("OpenExport() error = %v", err)
+	}
+	if rec := send(recent, http.MethodPost, "/api/wallet/export", `{"pin":"123456","passphrase":"correct horse battery"}`); errorCode(t, rec) != apierror.CodeWalletAlreadyExported {
+		t.Fatalf("second export: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// Recovery needs a node
+	if rec := send(recent, http.MethodPost, "/api/wallet/recovery", `{"pin":"123456"}`); errorCode(t, rec) != apierror.CodeFeatureDisabled {
+		t.Fatalf("recovery: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var events []store.WalletEvent
+	rec = doRequest(t, handler, http.MethodGet, "/api/wallet/events", "")
+	json.NewDecoder(rec.Body).Decode(&events)
+	if len(events) != 3 || events[0].Kind != store.WalletKeyExported {
+		t.Errorf("events = %+v", events)
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"aura-backend/buildinfo"
+	"aura-backend/health"
+	"aura-backend/logging"
+)
+
+// HealthzHandler reports that the process is alive. It checks no dependency,
+// so a database outage does not get every instance restarted.
+func (c *Controller) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": health.StatusOK})
+}
+
+// ReadyzResponse is the public readiness report: the status of the instance
+// and of each dependency
+type ReadyzResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// ReadyzHandler reports whether the instance can serve traffic, with the
+// status of each dependency. Check errors can name hosts and credentials,
+// so they are logged and not returned.
+func (c *Controller) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}}
+	if c.Readiness != nil {
+		report = c.Readiness.Run(r.Context())
+	}
+
+	response := ReadyzResponse{Status: report.Status, Checks: make(map[string]string, len(report.Checks))}
+	for name, result := range report.Checks {
+		response.Checks[name] = result.Status
+		if result.Error != "" {
+			logging.FromRequest(r).Warn("Readiness check failed", "check", name, "optional", result.Optional, "error", result.Error)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != health.StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// VersionHandler reports the build running on this instance
+func (c *Controller) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/validate"
+
+	"github.com/google/uuid"
+)
+
+// CreateStrkPaymentHandler creates a request for the user to pay a plan with STRK
+func (c *Controller) CreateStrkPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Payments == nil {
+		apierror.Write(w, r, errPaymentsDisabled)
+		return
+	}
+
+	// Parse request body
+	var request struct {
+		Plan      string `json:"plan" validate:"max=32"`
+		PromoCode string `json:"promoCode,omitempty" validate:"max=64,printable"`
+	}
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Default to upgrading to pro, as the Stripe flow does
+	if request.Plan == "" {
+		request.Plan = "pro"
+	}
+
+	payment, err := c.Payments.CreatePaymentRequest(r.Context(), userID, request.Plan, request.PromoCode)
+	if apiErr := billingError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to create STRK payment", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
+
+// GetStrkPaymentHandler returns the status of a STRK payment request
+func (c *Controller) GetStrkPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Payments == nil {
+		apierror.Write(w, r, errPaymentsDisabled)
+		return
+	}
+
+	paymentID := r.PathValue("paymentId")
+	if _, err := uuid.Parse(paymentID); err != nil {
+		apierror.Write(w, r, errPaymentNotFound)
+		return
+	}
+
+	payment, err := c.Payments.GetPayment(r.Context(), userID, paymentID)
+	if apiErr := billingError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get STRK payment", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"aura-backend/apierror"
+	"aura-backend/billing"
+	"aura-backend/logging"
+	"aura-backend/validate"
+)
+
+// StartTrialHandler grants the user a free trial of the trial plan
+func (c *Controller) StartTrialHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Promotions == nil {
+		apierror.Write(w, r, errPromotionsDisabled)
+		return
+	}
+
+	grant, err := c.Promotions.StartTrial(r.Context(), userID)
+	if apiErr := billingError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to start trial", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grant)
+}
+
+// RedeemPromoCodeHandler redeems a promo code granting free days
+func (c *Controller) RedeemPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Promotions == nil {
+		apierror.Write(w, r, errPromotionsDisabled)
+		return
+	}
+
+	// Parse request body
+	var request struct {
+		Code string `json:"code" validate:"required,max=64,printable"`
+	}
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	grant, err := c.Promotions.RedeemPromoCode(r.Context(), userID, request.Code)
+	if apiErr := billingError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to redeem promo code", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grant)
+}
+
+// GetReferralHandler returns the user's referral code and link
+func (c *Controller) GetReferralHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Promotions == nil {
+		apierror.Write(w, r, errPromotionsDisabled)
+		return
+	}
+
+	referral, err := c.Promotions.GetReferral(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to get referral code", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(referral)
+}
+
+// ClaimReferralHandler credits the user and their referrer with free days
+func (c *Controller) ClaimReferralHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if c.Promotions == nil {
+		apierror.Write(w, r, errPromotionsDisabled)
+		return
+	}
+
+	// Parse request body
+	var request struct {
+		Code string `json:"code" validate:"required,max=64,printable"`
+	}
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	grant, err := c.Promotions.ClaimReferral(r.Context(), userID, request.Code)
+	if apiErr := billingError(err); apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to claim referral", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grant)
+}
+
+var (
+	errPromotionsDisabled = apierror.New(apierror.CodeFeatureDisabled, "Promotions are not enabled")
+	errPaymentsDisabled   = apierror.New(apierror.CodeFeatureDisabled, "STRK payments are not enabled")
+	errPaymentNotFound    = apierror.New(apierror.CodePaymentNotFound, "Payment not found")
+)
+
+// billingErrors maps the billing errors clients can act on to API errors
+var billingErrors = map[error]*apierror.Error{
+	billing.ErrPlanNotPurchasable:     apierror.New(apierror.CodePlanNotPurchasable, "This plan cannot be purchased with STRK"),
+	billing.ErrPaymentNotFound:        errPaymentNotFound,
+	billing.ErrTrialAlreadyUsed:       apierror.New(apierror.CodeTrialAlreadyUsed, "You have already used your free trial"),
+	billing.ErrPromoNotFound:          apierror.New(apierror.CodePromoCodeNotFound, "Promo code not found"),
+	billing.ErrPromoExpired:           apierror.New(apierror.CodePromoCodeExpired, "This promo code has expired"),
+	billing.ErrPromoExhausted:         apierror.New(apierror.CodePromoCodeExhausted, "This promo code has no redemptions left"),
+	billing.ErrPromoAlreadyRedeemed:   apierror.New(apierror.CodePromoAlreadyRedeemed, "You have already redeemed this promo code"),
+	billing.ErrPromoNotApplicable:     apierror.New(apierror.CodePromoNotApplicable, "This promo code cannot be used here"),
+	billing.ErrReferralNotFound:       apierror.New(apierror.CodeReferralNotFound, "Referral code not found"),
+	billing.ErrReferralAlreadyClaimed: apierror.New(apierror.CodeReferralAlreadyClaimed, "You have already claimed a referral"),
+	billing.ErrSelfReferral:           apierror.New(apierror.CodeSelfReferral, "You cannot use this referral code"),
+}
+
+// billingError returns the API error for a billing error, or nil when the
+// error is unexpected and must be reported as an internal error
+func billingError(err error) *apierror.Error {
+	for target, apiErr := range billingErrors {
+		if errors.Is(err, target) {
+			return apiErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/store"
+)
+
+// recentRewards bounds the ledger entries returned with the totals
+const recentRewards = 50
+
+// RewardsResponse shows the user's AURA points, pending until a claim mints
+// them to their wallet
+type RewardsResponse struct {
+	store.RewardTotals
+	Rewards []store.Reward `json:"rewards"` // Most recent first, within the plan's statistics history
+}
+
+// GetRewardsHandler returns the user's pending and claimed AURA points. The
+// ledger only goes back as far as the user's plan shows statistics.
+func (c *Controller) GetRewardsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	entitlements, err := c.entitlementsFor(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Database error resolving entitlements", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	totals, err := c.Rewards.RewardTotals(r.Context(), userID)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to sum rewards", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+	list, err := c.Rewards.ListRewards(r.Context(), userID, recentRewards)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list rewards", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+	since := entitlements.StatsSince(time.Now())
+	for i, reward := range list {
+		if reward.CreatedAt.Before(since) {
+			list = list[:i]
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RewardsResponse{RewardTotals: *totals, Rewards: list})
+}
+
+// accrueRewards records the points earned by a check-in, scaled by the
+// user's plan. Failures are logged rather than returned: the progress is
+// already saved.
+func (c *Controller) accrueRewards(r *http.Request, habit *Habit, at time.Time) {
+	if c.RewardRules == nil {
+		return
+	}
+
+	entitlements, err := c.entitlementsFor(r.Context(), habit.UserID)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to resolve reward multiplier", logging.Err(err))
+		return
+	}
+
+	for _, reward := range c.RewardRules.Accrue(habit, entitlements.RewardMultiplier, at) {
+		err := c.Rewards.AddReward(r.Context(), &reward)
+		if err != nil && !errors.Is(err, store.ErrConflict) {
+			logging.FromRequest(r).Error("Failed to accrue reward", "habit_id", habit.ID, "reason", reward.Reason, logging.Err(err))
+			continue
+		}
+		if err == nil {
+			c.Metrics.RewardPoints.Add(float64(reward.Points), "accrued")
+		}
+	}
+}
@@ -1,36 +1,192 @@
 package controller
 
 import (
-	"database/sql"
+	"crypto/subtle"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/billing"
+	"aura-backend/custody"
+	"aura-backend/health"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/plans"
+	"aura-backend/portfolio"
+	"aura-backend/ratelimit"
+	"aura-backend/rewards"
+	"aura-backend/store"
+	"aura-backend/tracing"
 
 	"github.com/rs/cors"
 )
 
+// Options configures the HTTP layer
+type Options struct {
+	AllowedOrigins      []string             // Origins allowed by CORS
+	JWTSecret           string               // Supabase JWT secret, tokens are only decoded when empty
+	Readiness           *health.Checker      // Dependencies checked by /readyz
+	Metrics             *metrics.Registry    // Served on /metrics, requests are not instrumented when nil
+	MetricsToken        string               // Bearer token required on /metrics, open when empty
+	Domain              *metrics.Domain      // Business event counters, registered in Metrics
+	Logger              *slog.Logger         // Base of the per-request loggers, slog.Default() when nil
+	RateLimits          ratelimit.Store      // Buckets of the rateLimits policies, requests are not limited when nil
+	TrustProxy          bool                 // Identify anonymous clients by X-Forwarded-For
+	StakingContract     string               // Address of the staking escrow, stakes are refused when empty
+	RewardRules         *rewards.Rules       // Points accrued per check-in, none are accrued when nil
+	AttestationContract string               // Registry the daily check-in roots are posted to
+	MintContract        string               // Achievement NFT minted through the outbox, queued for the minter when empty
+	Portfolio           *portfolio.Portfolio // Reads wallet balances, GET /api/wallet/balances is disabled when nil
+	Custody             *custody.Custody     // Holds wallet keys, PINs, exports and recoveries are disabled when nil
+	WalletReauthWindow  time.Duration        // How recently users must have signed in to export or recover
+}
+
+// rateLimits are the per-route policies. Requests are counted per user when
+// they carry a valid token and per IP address otherwise.
+var rateLimits = map[string]ratelimit.Policy{
+	"POST /api/login":                    {Limit: 10, Window: time.Minute}, // May create a wallet
+	"POST /api/habits":                   {Limit: 20, Window: time.Minute},
+	"PUT /api/habits/{habitId}/progress": {Limit: 30, Window: time.Minute},
+	"POST /api/payments/strk":            {Limit: 10, Window: time.Minute},
+	"POST /api/trial":                    {Limit: 5, Window: time.Minute},
+	"POST /api/promo/redeem":             {Limit: 5, Window: time.Minute}, // Slows down code guessing
+	"POST /api/referral/claim":           {Limit: 5, Window: time.Minute},
+	"POST /api/habits/{habitId}/stake":   {Limit: 5, Window: time.Minute},
+	"GET /api/wallet/balances":           {Limit: 30, Window: time.Minute}, // Reads the node when the cache expires
+	"PUT /api/wallet/pin":                {Limit: 5, Window: time.Minute},  // Slows down PIN guessing with the lockout
+	"POST /api/wallet/export":            {Limit: 3, Window: time.Minute},
+	"POST /api/wallet/recovery":          {Limit: 3, Window: time.Minute}, // Sends a transaction
+}
+
 // SetupRoutes configures all API routes
-func SetupRoutes(db *sql.DB) http.Handler {
+func SetupRoutes(s store.Store, catalog *plans.Catalog, payments *billing.StrkPayments, promotions *billing.Promotions, options Options) http.Handler {
 	// Create a new controller instance
-	controller := NewController(db)
+	controller := NewController(s, catalog, payments, promotions)
+	controller.JWTSecret = []byte(options.JWTSecret)
+	controller.Readiness = options.Readiness
+	controller.StakingContract = options.StakingContract
+	controller.RewardRules = options.RewardRules
+	controller.AttestationContract = options.AttestationContract
+	controller.MintContract = options.MintContract
+	controller.Portfolio = options.Portfolio
+	controller.Custody = options.Custody
+	controller.ReauthWindow = options.WalletReauthWindow
+	controller.TrustProxy = options.TrustProxy
+	if options.Domain != nil {
+		controller.Metrics = options.Domain
+	}
 
 	// Create a new HTTP multiplexer
 	mux := http.NewServeMux()
 
+	// Limit the routes with a policy
+	var limiter *ratelimit.Limiter
+	if options.RateLimits != nil {
+		limiter = &ratelimit.Limiter{
+			Store: options.RateLimits,
+			Key: func(r *http.Request) string {
+				return controller.rateLimitKey(r, options.TrustProxy)
+			},
+		}
+		if options.Metrics != nil {
+			limiter.Rejected = options.Metrics.Counter("http_rate_limited_total", "Requests rejected by rate limits", "route")
+		}
+	}
+	handle := func(pattern string, handler http.HandlerFunc) {
+		if policy, ok := rateLimits[pattern]; ok && limiter != nil {
+			mux.Handle(pattern, limiter.Limit(policy, handler))
+			return
+		}
+		mux.Handle(pattern, handler)
+	}
+
+	// Probes and build information for the load balancer and orchestrator
+	mux.HandleFunc("GET /healthz", controller.HealthzHandler)
+	mux.HandleFunc("GET /readyz", controller.ReadyzHandler)
+	mux.HandleFunc("GET /version", controller.VersionHandler)
+	if options.Metrics != nil {
+		mux.Handle("GET /metrics", requireBearer(options.MetricsToken, options.Metrics.Handler()))
+	}
+
 	// Configure routes
-	mux.HandleFunc("GET /api/user/role", controller.GetUserRoleHandler)
-	mux.HandleFunc("PUT /api/user/role", controller.UpdateUserRoleHandler)
-	mux.HandleFunc("GET /api/habits", controller.GetHabitsHandler)
-	mux.HandleFunc("POST /api/habits", controller.CreateHabitHandler)
-	mux.HandleFunc("PUT /api/habits/{habitId}/progress", controller.UpdateHabitProgressHandler)
-	mux.HandleFunc("POST /api/login", controller.LoginHandler)
+	handle("GET /api/user/role", controller.GetUserRoleHandler)
+	handle("PUT /api/user/role", controller.UpdateUserRoleHandler)
+	handle("GET /api/user/entitlements", controller.GetEntitlementsHandler)
+	handle("GET /api/habits", controller.GetHabitsHandler)
+	handle("POST /api/habits", controller.CreateHabitHandler)
+	handle("PUT /api/habits/{habitId}/progress", controller.UpdateHabitProgressHandler)
+	handle("POST /api/login", controller.LoginHandler)
+	handle("POST /api/payments/strk", controller.CreateStrkPaymentHandler)
+	handle("GET /api/payments/strk/{paymentId}", controller.GetStrkPaymentHandler)
+	handle("POST /api/trial", controller.StartTrialHandler)
+	handle("POST /api/promo/redeem", controller.RedeemPromoCodeHandler)
+	handle("GET /api/referral", controller.GetReferralHandler)
+	handle("POST /api/referral/claim", controller.ClaimReferralHandler)
+	handle("GET /api/achievements", controller.GetAchievementsHandler)
+	handle("POST /api/habits/{habitId}/stake", controller.CreateStakeHandler)
+	handle("GET /api/habits/{habitId}/stake", controller.GetStakeHandler)
+	handle("GET /api/rewards", controller.GetRewardsHandler)
+	handle("GET /api/habits/{habitId}/attestations/{date}", controller.GetAttestationProofHandler)
+	handle("GET /api/events", controller.GetEventsHandler)
+	handle("GET /api/transactions", controller.GetTransactionsHandler)
+	handle("GET /api/wallet/balances", controller.GetWalletBalancesHandler)
+	handle("PUT /api/wallet/pin", controller.SetWalletPINHandler)
+	handle("POST /api/wallet/export", controller.ExportWalletHandler)
+	handle("POST /api/wallet/recovery", controller.StartRecoveryHandler)
+	handle("GET /api/wallet/recovery", controller.GetRecoveryHandler)
+	handle("GET /api/wallet/events", controller.GetWalletEventsHandler)
 
 	// Configure CORS
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000"},
+		AllowedOrigins:   options.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", logging.RequestIDHeader, "traceparent", "tracestate"},
+		ExposedHeaders:   []string{logging.RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 	})
 
-	// Return handler with CORS middleware applied
-	return corsHandler.Handler(mux)
+	// Instrument inside CORS, preflight requests never reach a route
+	var handler http.Handler = mux
+	if options.Metrics != nil {
+		handler = metrics.InstrumentHandler(options.Metrics, mux)
+	}
+
+	// Every request, preflights included, gets a span, a request ID and an
+	// access log
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	handler = logging.Middleware(logger, corsHandler.Handler(handler), "GET /healthz", "GET /readyz", "GET /metrics")
+	return tracing.Middleware(handler)
+}
+
+// requireBearer only lets through requests carrying the token as a bearer
+// token. An empty token lets every request through.
+func requireBearer(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			apierror.Write(w, r, errMissingToken)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(header), want) != 1 {
+			apierror.Write(w, r, errTokenInvalid)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey identifies the client of a request for rate limiting
+func (c *Controller) rateLimitKey(r *http.Request, trustProxy bool) string {
+	if userID, err := c.authenticateUser(r); err == nil {
+		return "user:" + userID
+	}
+	return "ip:" + ratelimit.ClientIP(r, trustProxy)
 }
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/store"
+	"aura-backend/validate"
+)
+
+// StakeRequest links the transaction that deposited a stake to a habit
+type StakeRequest struct {
+	TransactionHash string `json:"transactionHash" validate:"required,max=66"`
+}
+
+var (
+	errStakingDisabled = apierror.New(apierror.CodeFeatureDisabled, "Staking is not enabled")
+	errStakeNotFound   = apierror.New(apierror.CodeStakeNotFound, "This habit has no stake")
+)
+
+// CreateStakeHandler records the deposit a user made in the staking escrow
+// for one of their habits. Stakes are placed on new habits: a habit with
+// progress is already partly won. The stake stays pending until the deposit
+// transaction is verified on-chain.
+func (c *Controller) CreateStakeHandler(w http.ResponseWriter, r *http.Request) {
+	if c.StakingContract == "" {
+		apierror.Write(w, r, errStakingDisabled)
+		return
+	}
+
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	habitID := r.PathValue("habitId")
+	if !validate.IsUUID(habitID) {
+		apierror.Write(w, r, apierror.Invalid(map[string]string{"habitId": "must be a UUID"}))
+		return
+	}
+
+	var request StakeRequest
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	habit, err := c.Habits.GetHabit(r.Context(), userID, habitID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitNotFound, "Habit not found"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Database error", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+	if habit.Completed {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitAlreadyCompleted, "Completed habits cannot be staked on"))
+		return
+	}
+	if habit.DaysCompleted > 0 || habit.LastTrackedDate != nil {
+		apierror.Write(w, r, apierror.New(apierror.CodeHabitInProgress, "Stake on a habit before its first check-in"))
+		return
+	}
+
+	// The deposit must come from the user's wallet, the resolver checks the
+	// staker of the on-chain event against it
+	wallet, err := c.Wallets.GetWallet(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeWalletNotFound, "Log in to create your wallet before staking"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get wallet", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	now := time.Now()
+	stake := &store.Stake{
+		HabitID:                habit.ID,
+		UserID:                 userID,
+		StakerAddress:          wallet.Address,
+		DepositTransactionHash: request.TransactionHash,
+		Status:                 store.StakePending,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+	}
+	if err := c.Stakes.CreateStake(r.Context(), stake); errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.New(apierror.CodeAlreadyStaked, "This habit or transaction already has a stake"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to create stake", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(stake)
+}
+
+// GetStakeHandler returns the stake on a habit and its resolution status
+func (c *Controller) GetStakeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	habitID := r.PathValue("habitId")
+	if !validate.IsUUID(habitID) {
+		apierror.Write(w, r, apierror.Invalid(map[string]string{"habitId": "must be a UUID"}))
+		return
+	}
+
+	stake, err := c.Stakes.GetStake(r.Context(), userID, habitID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, errStakeNotFound)
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get stake", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stake)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+)
+
+// recentTransactions bounds the outbox transactions returned
+const recentTransactions = 50
+
+// GetTransactionsHandler returns the status of the on-chain transactions
+// queued on behalf of the user, newest first
+func (c *Controller) GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	list, err := c.Outbox.ListOutbox(r.Context(), userID, recentTransactions)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to list transactions", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/store"
+)
+
+var errPortfolioDisabled = apierror.New(apierror.CodeFeatureDisabled, "Wallet balances are not enabled")
+
+// GetWalletBalancesHandler returns the STRK, ETH and AURA balances of the
+// user's wallet with their USD value. Balances may be a few seconds old.
+func (c *Controller) GetWalletBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	if c.Portfolio == nil {
+		apierror.Write(w, r, errPortfolioDisabled)
+		return
+	}
+
+	userID, err := c.authenticateUser(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	wallet, err := c.Wallets.GetWallet(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(apierror.CodeWalletNotFound, "Log in to create your wallet"))
+		return
+	} else if err != nil {
+		logging.FromRequest(r).Error("Failed to get wallet", logging.Err(err))
+		apierror.Write(w, r, apierror.ErrInternal)
+		return
+	}
+
+	balances, err := c.Portfolio.Balances(r.Context(), wallet.Address)
+	if err != nil {
+		logging.FromRequest(r).Error("Failed to read wallet balances", logging.Err(err))
+		apierror.Write(w, r, apierror.New(apierror.CodeChainUnavailable, "Could not read balances from Starknet, try again later"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+}
@@ -0,0 +1,364 @@
+package custody
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/custody")
+
+var (
+	ErrPINNotSet          = errors.New("wallet PIN is not set")
+	ErrInvalidPIN         = errors.New("invalid wallet PIN")
+	ErrPINLocked          = errors.New("wallet PIN is locked after too many wrong attempts")
+	ErrAlreadyExported    = errors.New("wallet key was already exported")
+	ErrRecoveryInProgress = errors.New("a key rotation is in progress")
+	// ErrNotDeployed is returned when the wallet address is not an account
+	// deployed with the wallet's key, which set_public_key needs
+	ErrNotDeployed = errors.New("wallet is not a deployed account using its key")
+	// ErrRotationNotSent wraps the error of a set_public_key transaction the
+	// node refused; the rotation is failed and can be started again
+	ErrRotationNotSent = errors.New("set_public_key transaction was not sent")
+)
+
+// Config configures the custody of wallet keys
+type Config struct {
+	MasterKey            []byte        // Seals the keys at rest, see NewKeyring
+	MaxPINAttempts       int           // Wrong PINs before the PIN is locked
+	PINLockout           time.Duration // How long a locked PIN is refused
+	RotationPollInterval time.Duration
+	RotationTimeout      time.Duration // Rotations whose account still has the old key are failed after this
+}
+
+// Node is the subset of the Starknet RPC used to rotate keys: wallet
+// accounts send set_public_key, then their key and receipt are read
+type Node interface {
+	starknet.AccountNode
+	CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Export is a wallet key encrypted for the user, returned once
+type Export struct {
+	Address    string    `json:"address"`
+	PublicKey  string    `json:"publicKey"`
+	Format     string    `json:"format"`
+	Key        string    `json:"key"` // ExportFormat, a colon and the base32 encrypted key
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// Custody guards the keys of custodial wallets. Every PIN change, wrong PIN,
+// export and rotation is recorded in the wallet's security log.
+type Custody struct {
+	Store   store.WalletStore
+	Keyring *Keyring
+	Node    Node
+	Config  Config
+
+	Events *metrics.Counter // Counts security events by kind, optional
+
+	now func() time.Time
+}
+
+// NewCustody creates the custody service. Without a node, keys can be
+// exported but not rotated.
+func NewCustody(s store.WalletStore, node Node, config Config) (*Custody, error) {
+	keyring, err := NewKeyring(config.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Custody{Store: s, Keyring: keyring, Node: node, Config: config, now: time.Now}, nil
+}
+
+// NewWallet generates a private key for a new wallet and seals it for the user
+func (c *Custody) NewWallet(userID string) (publicKey, sealed string, err error) {
+	privateKey, err := starknet.GeneratePrivateKey(nil)
+	if err != nil {
+		return "", "", err
+	}
+	return c.seal(userID, privateKey)
+}
+
+// SetPIN sets the PIN guarding the user's wallet. Changing a PIN requires
+// the current one.
+func (c *Custody) SetPIN(ctx context.Context, userID, pin, currentPIN, ipAddress string) (err error) {
+	ctx, span := tracer.Start(ctx, "custody.set_pin")
+	defer func() { tracing.End(span, err) }()
+
+	if _, _, err := c.openWallet(ctx, userID); err != nil {
+		return err
+	}
+	security, err := c.Store.GetWalletSecurity(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if security.PINHash != "" {
+		if err := c.checkPIN(ctx, security, currentPIN, ipAddress); err != nil {
+			return err
+		}
+	}
+
+	pinHash, err := HashPIN(pin)
+	if err != nil {
+		return err
+	}
+	if err := c.Store.SetWalletPIN(ctx, userID, pinHash, c.now()); err != nil {
+		return err
+	}
+	c.record(ctx, userID, store.WalletPINSet, ipAddress)
+	return nil
+}
+
+// Export returns the user's private key encrypted with the passphrase. Each
+// key is exported once: a key that leaked must be rotated, which makes the
+// new one exportable.
+func (c *Custody) Export(ctx context.Context, userID, pin, passphrase, ipAddress string) (export *Export, err error) {
+	ctx, span := tracer.Start(ctx, "custody.export")
+	defer func() { tracing.End(span, err) }()
+
+	if len([]rune(passphrase)) < MinPassphraseLength {
+		return nil, ErrWeakPassphrase
+	}
+	wallet, privateKey, err := c.openWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	security, err := c.Store.GetWalletSecurity(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkPIN(ctx, security, pin, ipAddress); err != nil {
+		return nil, err
+	}
+	if security.ExportedAt != nil {
+		return nil, ErrAlreadyExported
+	}
+	if err := c.checkNoRotation(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	key, err := SealExport(privateKey, wallet.Address, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marked before the key is returned: of parallel exports, only the one
+	// marking it gets the key, and a failed save returns none
+	now := c.now()
+	if err := c.Store.MarkWalletExported(ctx, userID, now); errors.Is(err, store.ErrConflict) {
+		return nil, ErrAlreadyExported
+	} else if err != nil {
+		return nil, err
+	}
+	c.record(ctx, userID, store.WalletKeyExported, ipAddress)
+
+	return &Export{
+		Address:    wallet.Address,
+		PublicKey:  wallet.PublicKey,
+		Format:     ExportFormat,
+		Key:        key,
+		ExportedAt: now,
+	}, nil
+}
+
+// StartRecovery generates a new key for the user's wallet and sends the
+// account's set_public_key, signed with the current key. The new key is
+// saved before the transaction is sent; the wallet switches to it once the
+// account reports it, see Process.
+func (c *Custody) StartRecovery(ctx context.Context, userID, pin, ipAddress string) (rotation *store.KeyRotation, err error) {
+	ctx, span := tracer.Start(ctx, "custody.start_recovery")
+	defer func() { tracing.End(span, err) }()
+
+	wallet, oldKey, err := c.openWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	security, err := c.Store.GetWalletSecurity(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkPIN(ctx, security, pin, ipAddress); err != nil {
+		return nil, err
+	}
+	if err := c.checkDeployed(ctx, wallet); err != nil {
+		return nil, err
+	}
+
+	newKey, err := starknet.GeneratePrivateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+	newPublicKey, sealed, err := c.seal(userID, newKey)
+	if err != nil {
+		return nil, err
+	}
+	call, err := SetPublicKeyCall(wallet.Address, wallet.PublicKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	rotation = &store.KeyRotation{
+		ID:                  uuid.NewString(),
+		UserID:              userID,
+		WalletAddress:       wallet.Address,
+		OldPublicKey:        wallet.PublicKey,
+		NewPublicKey:        newPublicKey,
+		EncryptedPrivateKey: sealed,
+		Status:              store.RotationPending,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+	if err := c.Store.CreateKeyRotation(ctx, rotation); errors.Is(err, store.ErrConflict) {
+		return nil, ErrRecoveryInProgress
+	} else if err != nil {
+		return nil, err
+	}
+	c.record(ctx, userID, store.WalletRecoveryStarted, ipAddress)
+
+	txHash, err := c.sendRotation(ctx, wallet.Address, oldKey, call)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to send set_public_key", "rotation_id", rotation.ID, logging.Err(err))
+		if failErr := c.failRotation(ctx, rotation, err.Error()); failErr != nil {
+			return nil, failErr
+		}
+		return nil, fmt.Errorf("%w: %w", ErrRotationNotSent, err)
+	}
+
+	rotation.Status = store.RotationSubmitted
+	rotation.TransactionHash = &txHash
+	rotation.UpdatedAt = c.now()
+	if err := c.Store.UpdateKeyRotation(ctx, rotation); err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// checkDeployed checks that the wallet's address is an account reporting the
+// wallet's key. Wallets created without an account, whose address is only a
+// placeholder, are refused.
+func (c *Custody) checkDeployed(ctx context.Context, wallet *store.Wallet) error {
+	result, err := c.Node.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    wallet.Address,
+		EntryPointSelector: getPublicKeySelector,
+	}, starknet.LatestBlock)
+	if starknet.IsTransient(err) {
+		return err
+	}
+	if err != nil || len(result) != 1 || starknet.NormalizeAddress(result[0]) != starknet.NormalizeAddress(wallet.PublicKey) {
+		return ErrNotDeployed
+	}
+	return nil
+}
+
+// sendRotation sends set_public_key from the wallet's account
+func (c *Custody) sendRotation(ctx context.Context, address string, privateKey *big.Int, call starknet.FunctionCall) (string, error) {
+	account, err := starknet.NewAccount(c.Node, starknet.AccountConfig{
+		Address:      address,
+		PrivateKey:   starknet.FeltToHex(privateKey),
+		AmountMargin: starknet.DefaultAmountMargin,
+		PriceMargin:  starknet.DefaultPriceMargin,
+	})
+	if err != nil {
+		return "", err
+	}
+	return account.Invoke(ctx, []starknet.FunctionCall{call})
+}
+
+// openWallet returns the user's wallet and its private key
+func (c *Custody) openWallet(ctx context.Context, userID string) (*store.Wallet, *big.Int, error) {
+	wallet, err := c.Store.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := c.Keyring.Open(userID, wallet.EncryptedPrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wallet, privateKey, nil
+}
+
+// checkPIN verifies a PIN, locking it after too many wrong attempts. Wrong
+// PINs are counted by the store, so parallel guesses cannot share a count.
+func (c *Custody) checkPIN(ctx context.Context, security *store.WalletSecurity, pin, ipAddress string) error {
+	if security.PINHash == "" {
+		return ErrPINNotSet
+	}
+	now := c.now()
+	if security.LockedUntil != nil && now.Before(*security.LockedUntil) {
+		return ErrPINLocked
+	}
+
+	if VerifyPIN(security.PINHash, pin) {
+		if security.FailedAttempts == 0 && security.LockedUntil == nil {
+			return nil
+		}
+		return c.Store.ResetWalletPINFailures(ctx, security.UserID, now)
+	}
+
+	updated, err := c.Store.RecordWalletPINFailure(ctx, security.UserID, c.Config.MaxPINAttempts, now.Add(c.Config.PINLockout), now)
+	if err != nil {
+		return err
+	}
+	kind, result := store.WalletPINFailed, ErrInvalidPIN
+	if updated.LockedUntil != nil && now.Before(*updated.LockedUntil) {
+		kind, result = store.WalletPINLocked, ErrPINLocked
+	}
+	c.record(ctx, security.UserID, kind, ipAddress)
+	return result
+}
+
+// checkNoRotation refuses to export a key that is being replaced
+func (c *Custody) checkNoRotation(ctx context.Context, userID string) error {
+	latest, err := c.Store.LatestKeyRotation(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if latest.Status == store.RotationPending || latest.Status == store.RotationSubmitted {
+		return ErrRecoveryInProgress
+	}
+	return nil
+}
+
+func (c *Custody) seal(userID string, privateKey *big.Int) (publicKey, sealed string, err error) {
+	public, err := starknet.GetPublicKey(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+	if sealed, err = c.Keyring.Seal(userID, privateKey); err != nil {
+		return "", "", err
+	}
+	return starknet.FeltToHex(public), sealed, nil
+}
+
+// record appends an event to the wallet's security log. The log is an audit
+// trail, failing to write it does not fail the change it describes.
+func (c *Custody) record(ctx context.Context, userID, kind, ipAddress string) {
+	c.Events.Inc(kind)
+	logging.FromContext(ctx).Info("Wallet security event", "kind", kind, "ip_address", ipAddress)
+
+	err := c.Store.AddWalletEvent(ctx, &store.WalletEvent{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Kind:      kind,
+		IPAddress: ipAddress,
+		CreatedAt: c.now(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to record wallet security event", "kind", kind, logging.Err(err))
+	}
+}
@@ -0,0 +1,469 @@
+package custody
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/store"
+)
+
+const (
+	userID        = "0b7c2c1e-8f0e-4c53-9a56-2f6f7d1d2a10"
+	walletAddress = "0x2fd23d9182193775423497fc0c472e156c57c69e4089a1967fb288a2d84e914"
+	passphrase    = "correct horse battery"
+)
+
+// fakeNode is a wallet account: it records the transactions sent from it and
+// reports the public key the test sets
+type fakeNode struct {
+	submitted []*starknet.InvokeTransaction
+	fail      error // Returned by submissions
+	publicKey string
+	receipts  map[string]*starknet.Receipt
+	callErrs  map[string]error // Returned by calls to an address
+}
+
+func (n *fakeNode) ChainID(ctx context.Context) (string, error) {
+	return "0x534e5f5345504f4c4941", nil
+}
+
+func (n *fakeNode) GetNonce(ctx context.Context, block *starknet.BlockID, address string) (*big.Int, error) {
+	return big.NewInt(int64(len(n.submitted))), nil
+}
+
+func (n *fakeNode) EstimateFee(ctx context.Context, tx *starknet.InvokeTransaction) (*starknet.FeeEstimate, error) {
+	return &starknet.FeeEstimate{GasConsumed: "0x10", GasPrice: "0x64", OverallFee: "0x7d0", Unit: "FRI"}, nil
+}
+
+func (n *fakeNode) AddInvokeTransaction(ctx context.Context, tx *starknet.InvokeTransaction) (string, error) {
+	if n.fail != nil {
+		return "", n.fail
+	}
+	n.submitted = append(n.submitted, tx)
+	return "0xfeed", nil
+}
+
+func (n *fakeNode) CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error) {
+	if err, ok := n.callErrs[starknet.NormalizeAddress(call.ContractAddress)]; ok {
+		return nil, err
+	}
+	return []string{n.publicKey}, nil
+}
+
+func (n *fakeNode) GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error) {
+	if receipt, ok := n.receipts[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, &starknet.RPCError{Code: starknet.ErrCodeTransactionNotFound, Message: "Transaction hash not found"}
+}
+
+// newTestCustody creates a custodial wallet with a PIN
+func newTestCustody(t *testing.T, now *time.Time) (*Custody, *store.Memory, *fakeNode) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := store.NewMemory()
+	node := &fakeNode{receipts: map[string]*starknet.Receipt{}, callErrs: map[string]error{}}
+	c, err := NewCustody(s, node, Config{
+		MasterKey:       bytes.Repeat([]byte{7}, 32),
+		MaxPINAttempts:  3,
+		PINLockout:      15 * time.Minute,
+		RotationTimeout: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return *now }
+
+	publicKey, sealed, err := c.NewWallet(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.publicKey = publicKey
+	if err := s.CreateWallet(ctx, userID, &store.Wallet{PublicKey: publicKey, EncryptedPrivateKey: sealed, Address: walletAddress}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPIN(ctx, userID, "123456", "", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	return c, s, node
+}
+
+func eventKinds(t *testing.T, s *store.Memory) []string {
+	t.Helper()
+	events, err := s.ListWalletEvents(context.Background(), userID, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for i := len(events) - 1; i >= 0; i-- {
+		kinds = append(kinds, events[i].Kind)
+	}
+	return kinds
+}
+
+func TestKeyring(t *testing.T) {
+	keyring, err := NewKeyring(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := big.NewInt(123456789)
+
+	sealed, err := keyring.Seal(userID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := keyring.Open(userID, sealed); err != nil || opened.Cmp(key) != 0 {
+		t.Fatalf("Open() = %v, %v", opened, err)
+	}
+
+	// A sealed key only opens for its user and with its master key
+	if _, err := keyring.Open("another-user", sealed); err == nil {
+		t.Error("opened the key of another user")
+	}
+	other, _ := NewKeyring(bytes.Repeat([]byte{2}, 32))
+	if _, err := other.Open(userID, sealed); err == nil {
+		t.Error("opened a key sealed with another master key")
+	}
+	if _, err := keyring.Open(userID, "encrypted_key_42"); !errors.Is(err, ErrNotCustodial) {
+		t.Errorf("simulated key: %v", err)
+	}
+	if _, err := NewKeyring([]byte("short")); err == nil {
+		t.Error("NewKeyring() accepted a short master key")
+	}
+}
+
+func TestPIN(t *testing.T) {
+	hash, err := HashPIN("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyPIN(hash, "123456") || VerifyPIN(hash, "654321") || VerifyPIN("", "123456") {
+		t.Errorf("VerifyPIN() accepted a wrong PIN or rejected the right one")
+	}
+	if again, _ := HashPIN("123456"); again == hash {
+		t.Error("PIN hashes are not salted")
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	key := big.NewInt(987654321)
+	export, err := SealExport(key, walletAddress, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upper case letters, digits and the colon fit QR alphanumeric mode
+	for _, r := range export {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ':') {
+			t.Fatalf("export %q is not QR alphanumeric", export)
+		}
+	}
+
+	if opened, err := OpenExport(export, walletAddress, passphrase); err != nil || opened.Cmp(key) != 0 {
+		t.Fatalf("OpenExport() = %v, %v", opened, err)
+	}
+	if _, err := OpenExport(export, walletAddress, "wrong passphrase"); !errors.Is(err, ErrInvalidExport) {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+	if _, err := OpenExport(export, "0x1", passphrase); !errors.Is(err, ErrInvalidExport) {
+		t.Errorf("wrong address: %v", err)
+	}
+	if _, err := SealExport(key, walletAddress, "short"); !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("short passphrase: %v", err)
+	}
+}
+
+func TestSetPublicKeyCall(t *testing.T) {
+	newKey := big.NewInt(42)
+	call, err := SetPublicKeyCall(walletAddress, "0x123", newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.EntryPointSelector != starknet.SelectorFromName("set_public_key") || len(call.Calldata) != 4 || call.Calldata[1] != "0x2" {
+		t.Fatalf("call = %+v", call)
+	}
+
+	// The new key signs the ownership message of the account and current key
+	publicKey, _ := starknet.GetPublicKey(newKey)
+	account, _ := starknet.ParseFelt(walletAddress)
+	hash := starknet.PoseidonHashMany([]*big.Int{
+		new(big.Int).SetBytes([]byte("StarkNet Message")),
+		new(big.Int).SetBytes([]byte("accept_ownership")),
+		account,
+		big.NewInt(0x123),
+	})
+	r, _ := starknet.ParseFelt(call.Calldata[2])
+	s, _ := starknet.ParseFelt(call.Calldata[3])
+	if call.Calldata[0] != starknet.FeltToHex(publicKey) || !starknet.Verify(hash, r, s, publicKey) {
+		t.Errorf("calldata %v is not signed by the new key", call.Calldata)
+	}
+}
+
+func TestExportOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, s, _ := newTestCustody(t, &now)
+
+	export, err := c.Export(ctx, userID, "123456", passphrase, "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := OpenExport(export.Key, walletAddress, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey, _ := starknet.GetPublicKey(key); starknet.FeltToHex(publicKey) != export.PublicKey {
+		t.Errorf("exported key does not match the wallet public key %s", export.PublicKey)
+	}
+
+	if _, err := c.Export(ctx, userID, "123456", passphrase, ""); !errors.Is(err, ErrAlreadyExported) {
+		t.Errorf("second export: %v", err)
+	}
+	if kinds := eventKinds(t, s); len(kinds) != 2 || kinds[1] != store.WalletKeyExported {
+		t.Errorf("events = %v", kinds)
+	}
+}
+
+func TestParallelExports(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, _, _ := newTestCustody(t, &now)
+
+	var wg sync.WaitGroup
+	results := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Export(ctx, userID, "123456", passphrase, "")
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	exported := 0
+	for err := range results {
+		if err == nil {
+			exported++
+		} else if !errors.Is(err, ErrAlreadyExported) {
+			t.Errorf("export: %v", err)
+		}
+	}
+	if exported != 1 {
+		t.Errorf("key exported %d times", exported)
+	}
+}
+
+func TestParallelWrongPINs(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, _, _ := newTestCustody(t, &now)
+
+	// Guesses sent together are all counted
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Export(ctx, userID, "000000", passphrase, "")
+		}()
+	}
+	wg.Wait()
+
+	if _, err := c.Export(ctx, userID, "123456", passphrase, ""); !errors.Is(err, ErrPINLocked) {
+		t.Errorf("after parallel wrong PINs: %v", err)
+	}
+}
+
+func TestPINLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, s, _ := newTestCustody(t, &now)
+
+	for i, want := range []error{ErrInvalidPIN, ErrInvalidPIN, ErrPINLocked} {
+		if _, err := c.Export(ctx, userID, "000000", passphrase, ""); !errors.Is(err, want) {
+			t.Fatalf("attempt %d: %v, want %v", i+1, err, want)
+		}
+	}
+	// Even the right PIN is refused while locked
+	if _, err := c.Export(ctx, userID, "123456", passphrase, ""); !errors.Is(err, ErrPINLocked) {
+		t.Fatalf("locked PIN: %v", err)
+	}
+
+	now = now.Add(16 * time.Minute)
+	if _, err := c.Export(ctx, userID, "123456", passphrase, ""); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+	want := []string{store.WalletPINSet, store.WalletPINFailed, store.WalletPINFailed, store.WalletPINLocked, store.WalletKeyExported}
+	if kinds := eventKinds(t, s); len(kinds) != len(want) || kinds[3] != store.WalletPINLocked {
+		t.Errorf("events = %v, want %v", kinds, want)
+	}
+
+	// Changing the PIN needs the current one
+	if err := c.SetPIN(ctx, userID, "654321", "111111", ""); !errors.Is(err, ErrInvalidPIN) {
+		t.Errorf("change with a wrong PIN: %v", err)
+	}
+	if err := c.SetPIN(ctx, userID, "654321", "123456", ""); err != nil {
+		t.Errorf("change: %v", err)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, s, node := newTestCustody(t, &now)
+	c.Export(ctx, userID, "123456", passphrase, "")
+	old, _ := s.GetWallet(ctx, userID)
+
+	rotation, err := c.StartRecovery(ctx, userID, "123456", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotation.Status != store.RotationSubmitted || *rotation.TransactionHash != "0xfeed" || len(node.submitted) != 1 {
+		t.Fatalf("rotation = %+v", rotation)
+	}
+	if _, err := c.StartRecovery(ctx, userID, "123456", ""); !errors.Is(err, ErrRecoveryInProgress) {
+		t.Errorf("second recovery: %v", err)
+	}
+	if _, err := c.Export(ctx, userID, "123456", passphrase, ""); !errors.Is(err, ErrAlreadyExported) {
+		t.Errorf("export during recovery: %v", err)
+	}
+
+	// The wallet keeps its key until the account reports the new one
+	c.Process(ctx)
+	if wallet, _ := s.GetWallet(ctx, userID); wallet.PublicKey != old.PublicKey {
+		t.Fatal("wallet switched before the account")
+	}
+
+	node.publicKey = rotation.NewPublicKey
+	if err := c.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wallet, _ := s.GetWallet(ctx, userID)
+	if wallet.PublicKey != rotation.NewPublicKey || wallet.EncryptedPrivateKey == old.EncryptedPrivateKey {
+		t.Fatalf("wallet = %+v", wallet)
+	}
+	if latest, _ := s.LatestKeyRotation(ctx, userID); latest.Status != store.RotationCompleted {
+		t.Errorf("rotation = %+v", latest)
+	}
+
+	// The new key can be exported
+	export, err := c.Export(ctx, userID, "123456", passphrase, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.PublicKey != rotation.NewPublicKey {
+		t.Errorf("exported %s, want the new key %s", export.PublicKey, rotation.NewPublicKey)
+	}
+}
+
+func TestRecoveryFails(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+
+	t.Run("refused", func(t *testing.T) {
+		c, s, node := newTestCustody(t, &now)
+		node.fail = &starknet.RPCError{Code: 20, Message: "Contract not found"}
+
+		if _, err := c.StartRecovery(ctx, userID, "123456", ""); !errors.Is(err, ErrRotationNotSent) {
+			t.Fatalf("StartRecovery() error = %v", err)
+		}
+		if latest, _ := s.LatestKeyRotation(ctx, userID); latest.Status != store.RotationFailed {
+			t.Errorf("rotation = %+v", latest)
+		}
+		// A failed rotation does not block the next one
+		node.fail = nil
+		if _, err := c.StartRecovery(ctx, userID, "123456", ""); err != nil {
+			t.Errorf("retry: %v", err)
+		}
+	})
+
+	t.Run("reverted", func(t *testing.T) {
+		c, s, node := newTestCustody(t, &now)
+		rotation, _ := c.StartRecovery(ctx, userID, "123456", "")
+		node.receipts["0xfeed"] = &starknet.Receipt{ExecutionStatus: starknet.ExecutionReverted, RevertReason: "invalid owner sig"}
+
+		c.Process(ctx)
+		latest, _ := s.LatestKeyRotation(ctx, userID)
+		if latest.ID != rotation.ID || latest.Status != store.RotationFailed || latest.LastError != "reverted: invalid owner sig" {
+			t.Errorf("rotation = %+v", latest)
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		start := now
+		c, s, _ := newTestCustody(t, &start)
+		c.StartRecovery(ctx, userID, "123456", "")
+
+		start = start.Add(11 * time.Minute)
+		c.Process(ctx)
+		if latest, _ := s.LatestKeyRotation(ctx, userID); latest.Status != store.RotationFailed {
+			t.Errorf("rotation = %+v", latest)
+		}
+		if kinds := eventKinds(t, s); kinds[len(kinds)-1] != store.WalletRecoveryFailed {
+			t.Errorf("events = %v", kinds)
+		}
+	})
+}
+
+func TestRecoveryNeedsDeployedAccount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, s, node := newTestCustody(t, &now)
+
+	// The address of a wallet whose account was never deployed
+	node.callErrs[starknet.NormalizeAddress(walletAddress)] = &starknet.RPCError{Code: 20, Message: "Contract not found"}
+	if _, err := c.StartRecovery(ctx, userID, "123456", ""); !errors.Is(err, ErrNotDeployed) {
+		t.Fatalf("undeployed: StartRecovery() error = %v", err)
+	}
+	if _, err := s.LatestKeyRotation(ctx, userID); !errors.Is(err, store.ErrNotFound) || len(node.submitted) != 0 {
+		t.Fatalf("rotation started for an undeployed account: %v, %d sent", err, len(node.submitted))
+	}
+
+	// An account using another key cannot be rotated with the wallet's
+	delete(node.callErrs, starknet.NormalizeAddress(walletAddress))
+	node.publicKey = "0x1234"
+	if _, err := c.StartRecovery(ctx, userID, "123456", ""); !errors.Is(err, ErrNotDeployed) {
+		t.Errorf("other key: StartRecovery() error = %v", err)
+	}
+}
+
+func TestProcessFollowsEveryRotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	c, s, node := newTestCustody(t, &now)
+
+	// An older rotation whose account the node fails to read
+	stuck := &store.KeyRotation{
+		ID:            "stuck",
+		UserID:        "5d0c8a3e-1f3b-4b7a-9c1d-2e3f4a5b6c7d",
+		WalletAddress: "0xdead",
+		Status:        store.RotationSubmitted,
+		CreatedAt:     now.Add(-time.Minute),
+		UpdatedAt:     now.Add(-time.Minute),
+	}
+	if err := s.CreateKeyRotation(ctx, stuck); err != nil {
+		t.Fatal(err)
+	}
+	node.callErrs["0xdead"] = &starknet.RPCError{Code: starknet.ErrCodeInternal, Message: "Internal error"}
+
+	rotation, err := c.StartRecovery(ctx, userID, "123456", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.publicKey = rotation.NewPublicKey
+	if err := c.Process(ctx); err == nil {
+		t.Error("Process() hid the failed rotation")
+	}
+	if latest, _ := s.LatestKeyRotation(ctx, userID); latest.Status != store.RotationCompleted {
+		t.Errorf("rotation after a failed one = %+v", latest)
+	}
+}
@@ -0,0 +1,103 @@
+package custody
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"math/big"
+	"strings"
+
+	"aura-backend/starknet"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ExportFormat prefixes exported keys. Exports are upper case base32, which
+// QR codes encode in their compact alphanumeric mode.
+const ExportFormat = "AURAKEY1"
+
+// MinPassphraseLength is the shortest passphrase an export is encrypted with.
+// Exports leave the backend, so only the passphrase protects them.
+const MinPassphraseLength = 12
+
+// argon2id parameters of export keys, the first RFC 9106 recommendation
+// scaled down to 64 MiB
+const (
+	exportTime    = 3
+	exportMemory  = 64 * 1024 // KiB
+	exportThreads = 4
+)
+
+var (
+	exportEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	// ErrWeakPassphrase is returned for passphrases shorter than MinPassphraseLength
+	ErrWeakPassphrase = errors.New("passphrase is too short")
+	// ErrInvalidExport is returned for exports that cannot be decrypted with
+	// the passphrase for the address
+	ErrInvalidExport = errors.New("invalid export or passphrase")
+)
+
+// SealExport encrypts a private key with a key derived from the passphrase.
+// The account address is authenticated with it, so an export only opens
+// for the account it was made for.
+func SealExport(privateKey *big.Int, address, passphrase string) (string, error) {
+	if len([]rune(passphrase)) < MinPassphraseLength {
+		return "", ErrWeakPassphrase
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := exportCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	data := append(salt, nonce...)
+	data = aead.Seal(data, nonce, privateKey.FillBytes(make([]byte, keySize)), []byte(starknet.NormalizeAddress(address)))
+	return ExportFormat + ":" + exportEncoding.EncodeToString(data), nil
+}
+
+// OpenExport decrypts an export made by SealExport
+func OpenExport(export, address, passphrase string) (*big.Int, error) {
+	encoded, ok := strings.CutPrefix(export, ExportFormat+":")
+	if !ok {
+		return nil, ErrInvalidExport
+	}
+	data, err := exportEncoding.DecodeString(encoded)
+	if err != nil || len(data) < saltSize {
+		return nil, ErrInvalidExport
+	}
+
+	salt := data[:saltSize]
+	aead, err := exportCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidExport
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(starknet.NormalizeAddress(address)))
+	if err != nil {
+		return nil, ErrInvalidExport
+	}
+	return new(big.Int).SetBytes(plain), nil
+}
+
+func exportCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, exportTime, exportMemory, exportThreads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
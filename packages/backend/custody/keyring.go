@@ -0,0 +1,81 @@
+// Package custody holds the signing keys of the wallets the backend creates.
+// Keys are sealed at rest with a master key; users can export theirs once
+// behind a PIN, and rotate it on-chain through their account's
+// set_public_key when they recover their account.
+package custody
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// sealedPrefix versions the sealed keys, so the master key or cipher can
+// change without guessing how a key was sealed
+const sealedPrefix = "v1:"
+
+// keySize is the size of private keys and of the master key, in bytes
+const keySize = 32
+
+var (
+	// ErrNotCustodial is returned for wallets whose key the backend does not
+	// hold, such as the simulated wallets created before custody
+	ErrNotCustodial = errors.New("wallet key is not held by the backend")
+	errSealedKey    = errors.New("sealed key is corrupted or was sealed with another master key")
+)
+
+// Keyring seals private keys with AES-256-GCM, binding each one to its user
+// so that a sealed key copied to another wallet cannot be opened
+type Keyring struct {
+	aead cipher.AEAD
+}
+
+// NewKeyring creates a keyring from a 32-byte master key
+func NewKeyring(masterKey []byte) (*Keyring, error) {
+	if len(masterKey) != keySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{aead: aead}, nil
+}
+
+// Seal encrypts the private key of a user's wallet
+func (k *Keyring) Seal(userID string, privateKey *big.Int) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, privateKey.FillBytes(make([]byte, keySize)), []byte(userID))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a key sealed for the user, or returns ErrNotCustodial when
+// the wallet's key was never sealed by a keyring
+func (k *Keyring) Open(userID, sealed string) (*big.Int, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return nil, ErrNotCustodial
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < k.aead.NonceSize() {
+		return nil, errSealedKey
+	}
+	size := k.aead.NonceSize()
+	plain, err := k.aead.Open(nil, data[:size], data[size:], []byte(userID))
+	if err != nil {
+		return nil, errSealedKey
+	}
+	return new(big.Int).SetBytes(plain), nil
+}
@@ -0,0 +1,155 @@
+package custody
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+)
+
+var (
+	setPublicKeySelector = starknet.SelectorFromName("set_public_key")
+	getPublicKeySelector = starknet.SelectorFromName("get_public_key")
+
+	// Short strings of the message a new key signs to accept an account
+	starknetMessage = new(big.Int).SetBytes([]byte("StarkNet Message"))
+	acceptOwnership = new(big.Int).SetBytes([]byte("accept_ownership"))
+)
+
+// batchSize bounds the rotations checked per poll
+const batchSize = 20
+
+// SetPublicKeyCall builds the call replacing the key of an OpenZeppelin
+// account. The new key proves it is held by signing
+// poseidon('StarkNet Message', 'accept_ownership', account, current key),
+// as the account's assert_valid_new_owner checks.
+func SetPublicKeyCall(accountAddress, currentPublicKey string, newKey *big.Int) (starknet.FunctionCall, error) {
+	account, err := starknet.ParseFelt(accountAddress)
+	if err != nil {
+		return starknet.FunctionCall{}, fmt.Errorf("account address: %w", err)
+	}
+	current, err := starknet.ParseFelt(currentPublicKey)
+	if err != nil {
+		return starknet.FunctionCall{}, fmt.Errorf("current public key: %w", err)
+	}
+	newPublicKey, err := starknet.GetPublicKey(newKey)
+	if err != nil {
+		return starknet.FunctionCall{}, err
+	}
+
+	hash := starknet.PoseidonHashMany([]*big.Int{starknetMessage, acceptOwnership, account, current})
+	r, s, err := starknet.Sign(hash, newKey)
+	if err != nil {
+		return starknet.FunctionCall{}, err
+	}
+	return starknet.FunctionCall{
+		ContractAddress:    starknet.FeltToHex(account),
+		EntryPointSelector: setPublicKeySelector,
+		Calldata:           []string{starknet.FeltToHex(newPublicKey), "0x2", starknet.FeltToHex(r), starknet.FeltToHex(s)},
+	}, nil
+}
+
+// Run follows open rotations every poll interval until the context is cancelled
+func (c *Custody) Run(ctx context.Context) {
+	slog.Info("Wallet key rotations started")
+
+	ticker := time.NewTicker(c.Config.RotationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process key rotations", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process completes the open rotations whose account reports the new key,
+// and fails those whose transaction reverted or never landed. The account
+// is the source of truth: a rotation whose hash was lost completes all the
+// same once the key changed. A rotation that cannot be followed is logged
+// and retried on the next poll, without holding back the others.
+func (c *Custody) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "custody.process_rotations")
+	defer func() { tracing.End(span, err) }()
+
+	open, err := c.Store.OpenKeyRotations(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i := range open {
+		if err := c.follow(ctx, &open[i]); err != nil {
+			slog.Error("Failed to follow key rotation", "rotation_id", open[i].ID, "user_id", open[i].UserID, logging.Err(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d key rotations could not be followed", failed, len(open))
+	}
+	return nil
+}
+
+// follow checks the account of one rotation
+func (c *Custody) follow(ctx context.Context, rotation *store.KeyRotation) error {
+	result, err := c.Node.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    rotation.WalletAddress,
+		EntryPointSelector: getPublicKeySelector,
+	}, starknet.LatestBlock)
+	if starknet.IsTransient(err) {
+		return err
+	}
+	// An account the node cannot call, such as one not deployed, has not
+	// switched either, and fails once the rotation times out
+	if err == nil && len(result) == 1 && starknet.NormalizeAddress(result[0]) == starknet.NormalizeAddress(rotation.NewPublicKey) {
+		rotation.Status = store.RotationCompleted
+		rotation.LastError = ""
+		rotation.UpdatedAt = c.now()
+		if err := c.Store.CompleteKeyRotation(ctx, rotation); err != nil {
+			return err
+		}
+		slog.Info("Wallet key rotated", "rotation_id", rotation.ID, "user_id", rotation.UserID)
+		c.record(ctx, rotation.UserID, store.WalletKeyRotated, "")
+		return nil
+	}
+
+	if rotation.TransactionHash != nil {
+		receipt, err := c.Node.GetTransactionReceipt(ctx, *rotation.TransactionHash)
+		if err != nil && !starknet.IsNotFound(err) {
+			return err
+		}
+		if err == nil && receipt.ExecutionStatus == starknet.ExecutionReverted {
+			return c.failRotation(ctx, rotation, "reverted: "+receipt.RevertReason)
+		}
+	}
+	if c.now().Sub(rotation.CreatedAt) > c.Config.RotationTimeout {
+		return c.failRotation(ctx, rotation, "account still uses the old key")
+	}
+	return nil
+}
+
+// failRotation records that the account kept its old key, which the wallet
+// keeps using. The rotation keeps the new key sealed, so an account that
+// switches after all can still be recovered.
+func (c *Custody) failRotation(ctx context.Context, rotation *store.KeyRotation, reason string) error {
+	rotation.Status = store.RotationFailed
+	rotation.LastError = reason
+	rotation.UpdatedAt = c.now()
+	if err := c.Store.UpdateKeyRotation(ctx, rotation); err != nil {
+		return err
+	}
+	slog.Warn("Wallet key rotation failed", "rotation_id", rotation.ID, "user_id", rotation.UserID, "reason", reason)
+	c.record(ctx, rotation.UserID, store.WalletRecoveryFailed, "")
+	return nil
+}
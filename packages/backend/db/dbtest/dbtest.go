@@ -0,0 +1,66 @@
+// Package dbtest creates throwaway Postgres databases for tests
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	database "aura-backend/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// New creates a database with every migration applied, dropped when the test
+// ends. The test is skipped unless TEST_DATABASE_URL points at a Postgres
+// server where the user may create databases.
+func New(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	adminURL := os.Getenv("TEST_DATABASE_URL")
+	if adminURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, adminURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close(ctx)
+
+	name := fmt.Sprintf("aura_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+	t.Cleanup(func() {
+		admin, err := pgx.Connect(context.Background(), adminURL)
+		if err != nil {
+			t.Logf("could not drop database %s: %v", name, err)
+			return
+		}
+		defer admin.Close(context.Background())
+		admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+	})
+
+	fresh, err := url.Parse(adminURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh.Path = "/" + name
+
+	db, err := database.Connect(ctx, fresh.String(), database.PoolSettings{MaxConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	if _, err := database.MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp() error: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes mapped to domain errors
+const (
+	codeUniqueViolation      = "23505"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a record with the same key already exists
+	ErrConflict = errors.New("already exists")
+	// ErrSerializationFailure is returned when a transaction lost a race with a
+	// concurrent one and can safely be retried
+	ErrSerializationFailure = errors.New("serialization failure")
+)
+
+// MapError converts the Postgres errors callers care about into domain errors.
+// The original error stays in the chain, so errors.Is works on both.
+func MapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case codeUniqueViolation:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case codeSerializationFailure, codeDeadlockDetected:
+		return fmt.Errorf("%w: %w", ErrSerializationFailure, err)
+	}
+	return err
+}
+
+// IsConflict reports whether err is a unique constraint violation
+func IsConflict(err error) bool {
+	return errors.Is(MapError(err), ErrConflict)
+}
+
+// IsSerializationFailure reports whether err aborted a transaction that can be retried
+func IsSerializationFailure(err error) bool {
+	return errors.Is(MapError(err), ErrSerializationFailure)
+}
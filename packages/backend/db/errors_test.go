@@ -0,0 +1,44 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no rows", pgx.ErrNoRows, ErrNotFound},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ErrConflict},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), ErrConflict},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, ErrSerializationFailure},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, ErrSerializationFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapped := MapError(tt.err)
+			if !errors.Is(mapped, tt.want) {
+				t.Errorf("MapError() = %v, want %v", mapped, tt.want)
+			}
+			if !errors.Is(mapped, tt.err) {
+				t.Errorf("MapError() lost the original error %v", tt.err)
+			}
+		})
+	}
+
+	other := &pgconn.PgError{Code: "23503"}
+	if mapped := MapError(other); mapped != error(other) {
+		t.Errorf("MapError() = %v, want the error unchanged", mapped)
+	}
+	if MapError(nil) != nil {
+		t.Error("MapError(nil) != nil")
+	}
+}
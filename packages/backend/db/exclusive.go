@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"aura-backend/logging"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WorkerLockID is the advisory lock key held by the instance running the
+// workers that send transactions from the operator account
+const WorkerLockID = 727275
+
+// RunExclusive runs fn on one instance at a time. fn starts once this
+// instance holds the advisory lock key, on a connection kept for as long as
+// fn runs, and its context is cancelled when the connection is lost: the lock
+// goes with it. Until then, and after fn returns, the lock is tried again
+// every interval until ctx is cancelled.
+func RunExclusive(ctx context.Context, db *pgxpool.Pool, key int64, interval time.Duration, fn func(ctx context.Context)) {
+	for {
+		if err := runLocked(ctx, db, key, interval, fn); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to hold the advisory lock of exclusive workers", "lock_id", key, logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runLocked runs fn if the lock is free, checking the connection holding it
+// every interval
+func runLocked(ctx context.Context, db *pgxpool.Pool, key int64, interval time.Duration, fn func(ctx context.Context)) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+	slog.Info("Acquired the advisory lock of exclusive workers", "lock_id", key)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(runCtx)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if err := conn.Ping(runCtx); err != nil {
+				cancel()
+				<-done
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRunExclusive(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	db, err := Connect(ctx, url, PoolSettings{MaxConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Each instance holds its own connection, like two instances would
+	key := time.Now().UnixNano()
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	firstStarted := make(chan struct{})
+	firstStopped := make(chan struct{})
+	go func() {
+		defer close(firstStopped)
+		RunExclusive(firstCtx, db, key, 50*time.Millisecond, func(ctx context.Context) {
+			close(firstStarted)
+			<-ctx.Done()
+		})
+	}()
+	<-firstStarted
+
+	secondCtx, stopSecond := context.WithCancel(ctx)
+	defer stopSecond()
+	secondStarted := make(chan struct{})
+	go RunExclusive(secondCtx, db, key, 50*time.Millisecond, func(ctx context.Context) {
+		close(secondStarted)
+		<-ctx.Done()
+	})
+
+	select {
+	case <-secondStarted:
+		t.Fatal("second instance ran while the first held the lock")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Once the first stops, the second takes over
+	stopFirst()
+	<-firstStopped
+	select {
+	case <-secondStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second instance did not take the lock over")
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"aura-backend/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RegisterPoolMetrics exposes the connection pool statistics, read from the
+// pool each time metrics are scraped
+func RegisterPoolMetrics(r *metrics.Registry, pool *pgxpool.Pool) {
+	gauge := func(name, help string, value func(*pgxpool.Stat) float64) {
+		r.GaugeFunc(name, help, func() float64 { return value(pool.Stat()) })
+	}
+	counter := func(name, help string, value func(*pgxpool.Stat) float64) {
+		r.CounterFunc(name, help, func() float64 { return value(pool.Stat()) })
+	}
+
+	gauge("db_pool_max_conns", "Maximum size of the connection pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	gauge("db_pool_total_conns", "Connections currently open.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("db_pool_acquired_conns", "Connections currently in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("db_pool_idle_conns", "Connections currently idle.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	counter("db_pool_acquires_total", "Connections acquired from the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("db_pool_empty_acquires_total", "Acquires that waited because the pool was empty.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("db_pool_canceled_acquires_total", "Acquires canceled by their context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+	counter("db_pool_acquire_wait_seconds_total", "Time spent waiting to acquire connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations() error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+
+	if version := SchemaVersion(); version != len(migrations) {
+		t.Errorf("SchemaVersion() = %d, want %d", version, len(migrations))
+	}
+}
+
+// TestMigrationsOnFreshDatabase applies every migration to a new database.
+// It needs TEST_DATABASE_URL pointing at a Postgres server where the user may
+// create databases.
+func TestMigrationsOnFreshDatabase(t *testing.T) {
+	adminURL := os.Getenv("TEST_DATABASE_URL")
+	if adminURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, adminURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close(ctx)
+
+	name := fmt.Sprintf("aura_migrations_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+	defer admin.Exec(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+
+	fresh, err := url.Parse(adminURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh.Path = "/" + name
+
+	db, err := Connect(ctx, fresh.String(), PoolSettings{MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrations, _ := LoadMigrations()
+
+	if pending, err := PendingMigrations(ctx, db); err != nil || len(pending) != len(migrations) {
+		t.Fatalf("PendingMigrations() on a fresh database = %d, %v", len(pending), err)
+	}
+
+	applied, err := MigrateUp(ctx, db)
+	if err != nil {
+		t.Fatalf("MigrateUp() error: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+
+	// A second run must be a no-op
+	if applied, err := MigrateUp(ctx, db); err != nil || len(applied) != 0 {
+		t.Fatalf("second MigrateUp() = %d, %v", len(applied), err)
+	}
+	if pending, err := PendingMigrations(ctx, db); err != nil || len(pending) != 0 {
+		t.Fatalf("PendingMigrations() after MigrateUp() = %d, %v", len(pending), err)
+	}
+
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		t.Fatalf("MigrationStatus() error: %v", err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("migration %d_%s not applied", state.Version, state.Name)
+		}
+	}
+
+	// The baseline holds production data and never rolls back
+	if _, err := MigrateDown(ctx, db, len(migrations)); !errors.Is(err, ErrBelowBaseline) {
+		t.Fatalf("MigrateDown() past the baseline error = %v, want ErrBelowBaseline", err)
+	}
+	if pending, err := PendingMigrations(ctx, db); err != nil || len(pending) != 0 {
+		t.Fatalf("refused MigrateDown() rolled back %d migrations, %v", len(pending), err)
+	}
+
+	// Every other migration must roll back cleanly and apply again
+	if _, err := MigrateDown(ctx, db, len(migrations)-BaselineVersion); err != nil {
+		t.Fatalf("MigrateDown() error: %v", err)
+	}
+	if pending, err := PendingMigrations(ctx, db); err != nil || len(pending) != len(migrations)-BaselineVersion {
+		t.Fatalf("PendingMigrations() after MigrateDown() = %d, %v", len(pending), err)
+	}
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp() after rollback error: %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+-- The initial schema adopted tables that hold production data, so it is
+-- never rolled back. MigrateDown refuses to go below it; this guards manual runs.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'the initial schema cannot be rolled back';
+END
+$$;
@@ -0,0 +1,35 @@
+-- Core tables used by the API. They were originally created by hand in
+-- Supabase, so every statement is idempotent to adopt existing databases.
+
+CREATE TABLE IF NOT EXISTS users_profiles (
+    id                 UUID PRIMARY KEY,
+    email              TEXT,
+    role               TEXT NOT NULL DEFAULT 'free',
+    first_name         TEXT,
+    last_name          TEXT,
+    stripe_customer_id TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS habits (
+    id                UUID PRIMARY KEY,
+    user_id           UUID NOT NULL,
+    name              TEXT NOT NULL,
+    days_completed    INTEGER NOT NULL DEFAULT 0,
+    completed         BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_tracked_date TIMESTAMPTZ
+);
+
+-- Goals became configurable per plan
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS goal_days INTEGER NOT NULL DEFAULT 7;
+
+CREATE INDEX IF NOT EXISTS habits_user_id_created_at_idx ON habits (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS wallets (
+    user_id               UUID PRIMARY KEY,
+    public_key            TEXT NOT NULL,
+    encrypted_private_key TEXT NOT NULL,
+    address               TEXT NOT NULL,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS strk_payment_checkpoint;
+DROP TABLE IF EXISTS strk_payments;
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,42 @@
+-- Time-boxed plan grants (STRK payments, trials, promo codes, referrals)
+CREATE TABLE subscriptions (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL,
+    plan       TEXT NOT NULL,
+    source     TEXT NOT NULL,
+    reference  TEXT NOT NULL DEFAULT '',
+    starts_at  TIMESTAMPTZ NOT NULL,
+    ends_at    TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX subscriptions_user_id_ends_at_idx ON subscriptions (user_id, ends_at DESC);
+
+-- Requests for a user to pay a plan with an on-chain STRK transfer
+CREATE TABLE strk_payments (
+    id               UUID PRIMARY KEY,
+    user_id          UUID NOT NULL,
+    plan             TEXT NOT NULL,
+    amount           NUMERIC(78, 0) NOT NULL,
+    reference        TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    from_address     TEXT,
+    transaction_hash TEXT UNIQUE, -- A transfer pays one request, however often it is scanned
+    block_number     BIGINT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at       TIMESTAMPTZ NOT NULL,
+    confirmed_at     TIMESTAMPTZ
+);
+
+-- Amounts identify open payments, so they must not collide
+CREATE UNIQUE INDEX strk_payments_open_amount_idx ON strk_payments (amount)
+    WHERE status IN ('pending', 'confirming');
+
+CREATE INDEX strk_payments_user_id_idx ON strk_payments (user_id);
+
+-- Last block scanned for transfers to the treasury, a single row
+CREATE TABLE strk_payment_checkpoint (
+    id           BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    block_number BIGINT NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS referrals;
+DROP TABLE IF EXISTS referral_codes;
+DROP INDEX IF EXISTS subscriptions_one_trial_idx;
+DROP TABLE IF EXISTS promo_redemptions;
+ALTER TABLE strk_payments DROP COLUMN IF EXISTS promo_code;
+DROP TABLE IF EXISTS promo_codes;
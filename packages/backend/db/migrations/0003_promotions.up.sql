@@ -0,0 +1,43 @@
+CREATE TABLE promo_codes (
+    code              TEXT PRIMARY KEY,
+    plan              TEXT NOT NULL DEFAULT 'pro',
+    percent_off       INTEGER NOT NULL DEFAULT 0 CHECK (percent_off BETWEEN 0 AND 100),
+    amount_off        NUMERIC(78, 0) NOT NULL DEFAULT 0 CHECK (amount_off >= 0),
+    free_days         INTEGER NOT NULL DEFAULT 0 CHECK (free_days >= 0),
+    max_redemptions   INTEGER,
+    redemptions_count INTEGER NOT NULL DEFAULT 0,
+    expires_at        TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Discounted payments that expire give their code back, and are not matched late
+ALTER TABLE strk_payments ADD COLUMN promo_code TEXT REFERENCES promo_codes (code);
+
+CREATE TABLE promo_redemptions (
+    id          UUID PRIMARY KEY,
+    code        TEXT NOT NULL REFERENCES promo_codes (code),
+    user_id     UUID NOT NULL,
+    payment_id  UUID REFERENCES strk_payments (id),
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (code, user_id)
+);
+
+-- A user can only start one trial
+CREATE UNIQUE INDEX subscriptions_one_trial_idx ON subscriptions (user_id) WHERE source = 'trial';
+
+CREATE TABLE referral_codes (
+    user_id    UUID PRIMARY KEY,
+    code       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE referrals (
+    id                UUID PRIMARY KEY,
+    referrer_id       UUID NOT NULL,
+    referred_id       UUID NOT NULL UNIQUE,
+    code              TEXT NOT NULL,
+    referrer_rewarded BOOLEAN NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX referrals_referrer_id_idx ON referrals (referrer_id);
@@ -0,0 +1,8 @@
+-- Token buckets shared by the API instances, keyed by route and client
+CREATE TABLE rate_limits (
+    key        TEXT PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limits_updated_at_idx ON rate_limits (updated_at);
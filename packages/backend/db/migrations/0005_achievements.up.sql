@@ -0,0 +1,23 @@
+-- Achievement NFTs minted when a habit is completed, one per habit
+CREATE TABLE achievements (
+    id               UUID PRIMARY KEY,
+    user_id          UUID NOT NULL,
+    habit_id         UUID NOT NULL UNIQUE,
+    habit_name       TEXT NOT NULL,
+    goal_days        INTEGER NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,
+    completed_at     TIMESTAMPTZ NOT NULL,
+    wallet_address   TEXT NOT NULL,
+    status           TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'submitted', 'minted', 'failed')),
+    transaction_hash TEXT,
+    token_id         TEXT,
+    last_error       TEXT,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX achievements_user_id_completed_at_idx ON achievements (user_id, completed_at DESC);
+
+-- The mint worker only scans unfinished achievements
+CREATE INDEX achievements_pending_idx ON achievements (updated_at) WHERE status IN ('queued', 'submitted');
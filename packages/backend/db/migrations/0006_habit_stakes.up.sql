@@ -0,0 +1,20 @@
+-- STRK locked in the escrow contract on a habit, resolved by the backend oracle
+CREATE TABLE habit_stakes (
+    habit_id                    UUID PRIMARY KEY REFERENCES habits (id),
+    user_id                     UUID NOT NULL,
+    staker_address              TEXT NOT NULL,
+    amount                      NUMERIC(78, 0),
+    deadline                    TIMESTAMPTZ,
+    deposit_transaction_hash    TEXT NOT NULL UNIQUE,
+    status                      TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'active', 'resolving', 'returned', 'forfeited', 'rejected')),
+    success                     BOOLEAN,
+    resolution_transaction_hash TEXT,
+    last_error                  TEXT,
+    attempts                    INTEGER NOT NULL DEFAULT 0,
+    created_at                  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at                  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The resolution job only scans open stakes
+CREATE INDEX habit_stakes_open_idx ON habit_stakes (updated_at) WHERE status IN ('pending', 'active', 'resolving');
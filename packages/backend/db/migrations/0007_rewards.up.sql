@@ -0,0 +1,32 @@
+-- Batches of AURA rewards minted in a single transaction
+CREATE TABLE reward_claims (
+    id               UUID PRIMARY KEY,
+    status           TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'submitted', 'confirmed', 'failed')),
+    transaction_hash TEXT,
+    recipients       INTEGER NOT NULL,
+    points           BIGINT NOT NULL,
+    last_error       TEXT,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The claim worker only scans unfinished claims
+CREATE INDEX reward_claims_open_idx ON reward_claims (created_at) WHERE status IN ('pending', 'submitted');
+
+-- AURA points accrued by check-ins and milestones, one entry per habit,
+-- reason and day so retried check-ins cannot accrue twice
+CREATE TABLE rewards (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL,
+    habit_id   UUID NOT NULL REFERENCES habits (id),
+    reason     TEXT NOT NULL CHECK (reason IN ('check_in', 'milestone')),
+    day        INTEGER NOT NULL,
+    points     BIGINT NOT NULL CHECK (points > 0),
+    claim_id   UUID REFERENCES reward_claims (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (habit_id, reason, day)
+);
+
+CREATE INDEX rewards_user_id_created_at_idx ON rewards (user_id, created_at DESC);
+CREATE INDEX rewards_unclaimed_idx ON rewards (user_id) WHERE claim_id IS NULL;
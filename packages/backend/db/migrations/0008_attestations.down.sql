@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS attestation_leaves;
+DROP TABLE IF EXISTS attestations;
+DROP TABLE IF EXISTS check_ins;
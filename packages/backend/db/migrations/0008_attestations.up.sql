@@ -0,0 +1,36 @@
+-- Days habits were tracked on, the leaves of the daily attestations
+CREATE TABLE check_ins (
+    habit_id   UUID NOT NULL REFERENCES habits (id),
+    day        DATE NOT NULL,
+    user_id    UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (habit_id, day)
+);
+
+CREATE INDEX check_ins_day_idx ON check_ins (day);
+
+-- Merkle roots of each day's check-ins, posted to the registry contract
+CREATE TABLE attestations (
+    day              DATE PRIMARY KEY,
+    root             TEXT NOT NULL,
+    leaves           INTEGER NOT NULL,
+    status           TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'submitted', 'confirmed', 'failed')),
+    transaction_hash TEXT,
+    last_error       TEXT,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The attestation worker only scans unfinished attestations
+CREATE INDEX attestations_pending_idx ON attestations (day) WHERE status IN ('queued', 'submitted');
+
+-- The leaves each root was computed from. Proofs are built from this
+-- snapshot: a user creating a wallet later adds to the day's check-ins.
+CREATE TABLE attestation_leaves (
+    day            DATE NOT NULL REFERENCES attestations (day) ON DELETE CASCADE,
+    user_id        UUID NOT NULL,
+    habit_id       UUID NOT NULL,
+    wallet_address TEXT NOT NULL,
+    PRIMARY KEY (day, habit_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS event_checkpoint;
+DROP TABLE IF EXISTS chain_events;
@@ -0,0 +1,28 @@
+-- Events emitted by our deployed contracts, as indexed from the chain
+CREATE TABLE chain_events (
+    id               BIGSERIAL PRIMARY KEY,
+    contract         TEXT NOT NULL,
+    contract_address TEXT NOT NULL,
+    name             TEXT,
+    keys             TEXT[] NOT NULL,
+    data             TEXT[] NOT NULL,
+    fields           JSONB,
+    block_number     BIGINT NOT NULL,
+    block_hash       TEXT NOT NULL,
+    transaction_hash TEXT NOT NULL,
+    event_index      INTEGER NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (transaction_hash, contract_address, event_index)
+);
+
+-- Reorgs delete the events above a block
+CREATE INDEX chain_events_block_idx ON chain_events (block_number);
+CREATE INDEX chain_events_contract_idx ON chain_events (contract, name, id);
+
+-- Last block processed by the indexer, a single row
+CREATE TABLE event_checkpoint (
+    id           BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    block_number BIGINT NOT NULL,
+    block_hash   TEXT NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
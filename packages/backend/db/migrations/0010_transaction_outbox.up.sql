@@ -0,0 +1,22 @@
+-- On-chain transactions queued in the same transaction as the domain change
+-- that triggers them, and sent by the outbox worker
+CREATE TABLE transaction_outbox (
+    id               UUID PRIMARY KEY,
+    user_id          UUID,
+    kind             TEXT NOT NULL,
+    reference        TEXT NOT NULL,
+    calls            JSONB NOT NULL,
+    status           TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'submitted', 'confirmed', 'reverted', 'failed')),
+    transaction_hash TEXT,
+    last_error       TEXT,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, reference)
+);
+
+CREATE INDEX transaction_outbox_user_id_created_at_idx ON transaction_outbox (user_id, created_at DESC);
+
+-- The worker only scans unfinished transactions
+CREATE INDEX transaction_outbox_pending_idx ON transaction_outbox (updated_at) WHERE status IN ('queued', 'submitted');
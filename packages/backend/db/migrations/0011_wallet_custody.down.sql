@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS wallet_key_rotations;
+DROP TABLE IF EXISTS wallet_events;
+DROP TABLE IF EXISTS wallet_security;
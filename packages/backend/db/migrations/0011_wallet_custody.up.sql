@@ -0,0 +1,41 @@
+-- PIN and export state of the wallets whose keys the backend holds
+CREATE TABLE wallet_security (
+    user_id         UUID PRIMARY KEY REFERENCES wallets (user_id) ON DELETE CASCADE,
+    pin_hash        TEXT NOT NULL DEFAULT '',
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMPTZ,
+    exported_at     TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Security log of the wallets: PIN changes and failures, exports, recoveries
+CREATE TABLE wallet_events (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL,
+    kind       TEXT NOT NULL,
+    ip_address TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wallet_events_user_id_created_at_idx ON wallet_events (user_id, created_at DESC);
+
+-- Rotations of the signing keys of wallet accounts through set_public_key.
+-- The new key is saved before the transaction is sent, so it is never lost.
+CREATE TABLE wallet_key_rotations (
+    id                    UUID PRIMARY KEY,
+    user_id               UUID NOT NULL REFERENCES wallets (user_id) ON DELETE CASCADE,
+    wallet_address        TEXT NOT NULL,
+    old_public_key        TEXT NOT NULL,
+    new_public_key        TEXT NOT NULL,
+    encrypted_private_key TEXT NOT NULL,
+    status                TEXT NOT NULL CHECK (status IN ('pending', 'submitted', 'completed', 'failed')),
+    transaction_hash      TEXT,
+    last_error            TEXT,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wallet_key_rotations_user_id_created_at_idx ON wallet_key_rotations (user_id, created_at DESC);
+
+-- A wallet rotates one key at a time
+CREATE UNIQUE INDEX wallet_key_rotations_open_idx ON wallet_key_rotations (user_id) WHERE status IN ('pending', 'submitted');
@@ -0,0 +1 @@
+ALTER TABLE transaction_outbox DROP COLUMN IF EXISTS fee;
@@ -0,0 +1,3 @@
+-- Fees paid by the operator for the transactions sent on behalf of users,
+-- counted against the sponsored gas budget of their plan
+ALTER TABLE transaction_outbox ADD COLUMN fee NUMERIC(78, 0);
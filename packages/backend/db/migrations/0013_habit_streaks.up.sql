@@ -0,0 +1,3 @@
+-- Consecutive days a habit was tracked up to its last check-in, which
+-- reward milestones are based on
+ALTER TABLE habits ADD COLUMN streak INTEGER NOT NULL DEFAULT 0;
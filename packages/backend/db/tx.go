@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxTxAttempts bounds how many times a transaction is run when it keeps
+// failing with serialization failures or deadlocks
+const maxTxAttempts = 5
+
+// txRetryDelay is the base delay between attempts, doubled on every retry
+const txRetryDelay = 20 * time.Millisecond
+
+// Querier is satisfied by *pgxpool.Pool, *pgxpool.Conn and pgx.Tx, so queries
+// can run either on the pool or inside a transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// TxStarter is satisfied by *pgxpool.Pool and *pgxpool.Conn
+type TxStarter interface {
+	BeginTx(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error)
+}
+
+// RunInTx runs fn in a transaction and commits it if fn succeeds. When the
+// transaction fails with a serialization failure or a deadlock it is rolled
+// back and fn runs again, so fn must not have side effects outside of tx.
+func RunInTx(ctx context.Context, db TxStarter, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = runTx(ctx, db, options, fn)
+		if !IsSerializationFailure(err) || attempt == maxTxAttempts {
+			break
+		}
+
+		// Back off with jitter so the competing transactions do not collide again
+		delay := txRetryDelay << (attempt - 1)
+		delay += rand.N(delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+func runTx(ctx context.Context, db TxStarter, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := db.BeginTx(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
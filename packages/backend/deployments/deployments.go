@@ -0,0 +1,131 @@
+// Package deployments reads the contracts deployed by snfoundry, the Go
+// counterpart of parse-deployments.ts: deploy.ts writes the addresses and
+// class hashes of each network to deployments/<network>_latest.json, and
+// scarb writes the compiled classes holding the ABIs to
+// contracts/target/dev.
+package deployments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"aura-backend/starknet"
+)
+
+// Networks deploy.ts deploys to
+const (
+	Devnet  = "devnet"
+	Sepolia = "sepolia"
+	Mainnet = "mainnet"
+)
+
+// ErrNotDeployed is returned for a contract missing from the deployments file
+var ErrNotDeployed = errors.New("contract not deployed")
+
+// Contract is a deployed contract
+type Contract struct {
+	Name      string // Name in the deployments file, e.g. AuraToken
+	Class     string // Cairo contract the class was compiled from
+	Address   string
+	ClassHash string
+	ABI       *starknet.ABI // nil when the class is not compiled
+}
+
+// Deployments are the contracts deployed on a network
+type Deployments struct {
+	Network   string
+	contracts map[string]Contract
+}
+
+// entry is a contract of the deployments file
+type entry struct {
+	Contract  string `json:"contract"`
+	Address   string `json:"address"`
+	ClassHash string `json:"classHash"`
+}
+
+// Load reads the deployments of a network from deploymentsDir and the ABIs
+// from the compiled classes in classesDir. Like parse-deployments.ts, it
+// skips the ABIs of classes that are not compiled.
+func Load(deploymentsDir, classesDir, network string) (*Deployments, error) {
+	switch network {
+	case Devnet, Sepolia, Mainnet:
+	default:
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
+
+	path := filepath.Join(deploymentsDir, network+"_latest.json")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]entry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	deployments := &Deployments{Network: network, contracts: make(map[string]Contract, len(entries))}
+	for name, e := range entries {
+		contract := Contract{
+			Name:      name,
+			Class:     e.Contract,
+			Address:   starknet.NormalizeAddress(e.Address),
+			ClassHash: starknet.NormalizeAddress(e.ClassHash),
+		}
+
+		abi, err := LoadABI(filepath.Join(classesDir, "contracts_"+e.Contract+".contract_class.json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("contract %s: %w", name, err)
+		}
+		contract.ABI = abi
+
+		deployments.contracts[name] = contract
+	}
+
+	return deployments, nil
+}
+
+// LoadABI parses the ABI of a compiled Sierra contract class
+func LoadABI(path string) (*starknet.ABI, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var class struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(content, &class); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return starknet.ParseABI(class.ABI)
+}
+
+// Get returns a deployed contract, or ErrNotDeployed
+func (d *Deployments) Get(name string) (Contract, error) {
+	contract, ok := d.contracts[name]
+	if !ok {
+		return Contract{}, fmt.Errorf("%s on %s: %w", name, d.Network, ErrNotDeployed)
+	}
+	return contract, nil
+}
+
+// Address returns the address of a deployed contract, or an empty string
+func (d *Deployments) Address(name string) string {
+	return d.contracts[name].Address
+}
+
+// Names returns the names of the deployed contracts, sorted
+func (d *Deployments) Names() []string {
+	names := make([]string, 0, len(d.contracts))
+	for name := range d.contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,80 @@
+package deployments
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tokenABI declares the mint function of AuraToken
+const tokenABI = `[
+	{"type": "struct", "name": "core::integer::u256", "members": [
+		{"name": "low", "type": "core::integer::u128"},
+		{"name": "high", "type": "core::integer::u128"}
+	]},
+	{"type": "interface", "name": "contracts::AuraToken::IAuraToken", "items": [
+		{"type": "function", "name": "mint", "inputs": [
+			{"name": "claim_id", "type": "core::felt252"},
+			{"name": "to", "type": "core::starknet::contract_address::ContractAddress"},
+			{"name": "amount", "type": "core::integer::u256"}
+		], "outputs": [{"type": "core::bool"}], "state_mutability": "external"}
+	]}
+]`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "sepolia_latest.json"), `{
+		"AuraToken": {"contract": "AuraToken", "address": "0x00AB", "classHash": "0x0C1"},
+		"YourContract": {"contract": "YourContract", "address": "0xcd", "classHash": "0xc2"}
+	}`)
+	// deploy.ts keeps the previous deployments under a timestamp
+	writeFile(t, filepath.Join(dir, "sepolia_1700000000000.json"), `{"AuraToken": {"contract": "AuraToken", "address": "0x1"}}`)
+	// Older class files store the ABI as a string
+	abi, _ := json.Marshal(tokenABI)
+	writeFile(t, filepath.Join(dir, "contracts_AuraToken.contract_class.json"), `{"abi": `+string(abi)+`}`)
+
+	deployed, err := Load(dir, dir, Sepolia)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if names := deployed.Names(); !reflect.DeepEqual(names, []string{"AuraToken", "YourContract"}) {
+		t.Errorf("Names() = %v", names)
+	}
+	if address := deployed.Address("AuraToken"); address != "0xab" {
+		t.Errorf("Address(AuraToken) = %q, want 0xab", address)
+	}
+
+	token, err := deployed.Get("AuraToken")
+	if err != nil || token.ClassHash != "0xc1" || token.ABI == nil {
+		t.Fatalf("Get(AuraToken) = %+v, %v", token, err)
+	}
+	call, err := token.ABI.Call(token.Address, "mint", "0x1", "0x2", "1000")
+	if err != nil || !reflect.DeepEqual(call.Calldata, []string{"0x1", "0x2", "0x3e8", "0x0"}) {
+		t.Errorf("Call(mint) = %+v, %v", call, err)
+	}
+
+	// Classes that are not compiled have no ABI
+	if contract, err := deployed.Get("YourContract"); err != nil || contract.ABI != nil {
+		t.Errorf("Get(YourContract) = %+v, %v, want no ABI", contract, err)
+	}
+	if _, err := deployed.Get("AuraStaking"); !errors.Is(err, ErrNotDeployed) {
+		t.Errorf("Get(AuraStaking) error = %v, want ErrNotDeployed", err)
+	}
+
+	if _, err := Load(dir, dir, Mainnet); err == nil {
+		t.Error("Load(mainnet) succeeded without a deployments file")
+	}
+	if _, err := Load(dir, dir, "testnet"); err == nil {
+		t.Error("Load(testnet) succeeded")
+	}
+}
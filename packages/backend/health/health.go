@@ -0,0 +1,119 @@
+// Package health runs the dependency checks behind the readiness probe
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses reported for the service and for each dependency
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// DefaultTimeout bounds each check, so one hanging dependency cannot make the
+// probe itself time out
+const DefaultTimeout = 2 * time.Second
+
+// Check returns an error when a dependency is not usable
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Optional  bool   `json:"optional,omitempty"`
+}
+
+// Report is the outcome of every check. Status is ok only if all the
+// required checks are.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs named dependency checks concurrently
+type Checker struct {
+	Timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]registered
+}
+
+type registered struct {
+	check    Check
+	optional bool
+}
+
+// NewChecker creates a checker with the default timeout
+func NewChecker() *Checker {
+	return &Checker{Timeout: DefaultTimeout, checks: make(map[string]registered)}
+}
+
+// Add registers a required check under a name, replacing any check with the
+// same name. The instance is not ready while a required check fails.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = registered{check: check}
+}
+
+// AddOptional registers a check that is reported but does not make the
+// instance unready, for dependencies only some features need
+func (c *Checker) AddOptional(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = registered{check: check, optional: true}
+}
+
+// Run runs every check and reports their results
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]registered, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check.check)
+			result.Optional = check.optional
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK && !check.optional {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := check(ctx)
+	result := Result{Status: StatusOK, LatencyMs: time.Since(started).Milliseconds()}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	checker := NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.AddOptional("starknet", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Run(context.Background())
+	if report.Status != StatusOK {
+		t.Errorf("status = %s, an optional failure must not make the instance unready", report.Status)
+	}
+	if result := report.Checks["starknet"]; result.Status != StatusUnavailable || result.Error != "connection refused" || !result.Optional {
+		t.Errorf("unexpected starknet result %+v", result)
+	}
+
+	checker.Add("migrations", func(ctx context.Context) error { return errors.New("2 pending migration(s)") })
+	if report := checker.Run(context.Background()); report.Status != StatusUnavailable {
+		t.Errorf("status = %s, want %s when a required check fails", report.Status, StatusUnavailable)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	checker := NewChecker()
+	checker.Timeout = 10 * time.Millisecond
+	checker.Add("hanging", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	started := time.Now()
+	report := checker.Run(context.Background())
+	if report.Status != StatusUnavailable {
+		t.Errorf("status = %s, want %s", report.Status, StatusUnavailable)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Run() took %s, the check timeout was not applied", elapsed)
+	}
+}
@@ -0,0 +1,41 @@
+// Package httpx holds helpers shared by the HTTP middlewares
+package httpx
+
+import (
+	"context"
+	"net/http"
+)
+
+// StatusRecorder remembers the status code written by a handler
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	wroteHeader bool
+}
+
+// NewStatusRecorder wraps w, reporting 200 until a handler writes a status
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (s *StatusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.Status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// ServeWithContext serves r with a new context. The ServeMux records the
+// matched pattern on the request it receives, it is copied back to r so the
+// middlewares further out still see r.Pattern.
+func ServeWithContext(ctx context.Context, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	inner := r.WithContext(ctx)
+	next.ServeHTTP(w, inner)
+	r.Pattern = inner.Pattern
+}
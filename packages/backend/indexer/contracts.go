@@ -0,0 +1,35 @@
+package indexer
+
+import (
+	"fmt"
+
+	"aura-backend/deployments"
+)
+
+// LoadContracts returns the deployed contracts to index, with their ABIs.
+// When names are configured only those contracts are returned.
+func LoadContracts(config Config) ([]deployments.Contract, error) {
+	deployed, err := deployments.Load(config.DeploymentsDir, config.ClassesDir, config.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	names := config.Contracts
+	if len(names) == 0 {
+		names = deployed.Names()
+	}
+
+	contracts := make([]deployments.Contract, 0, len(names))
+	for _, name := range names {
+		contract, err := deployed.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if contract.ABI == nil {
+			return nil, fmt.Errorf("contract %s: class %s is not compiled", name, contract.Class)
+		}
+		contracts = append(contracts, contract)
+	}
+
+	return contracts, nil
+}
@@ -0,0 +1,239 @@
+// Package indexer follows the events of our deployed contracts: it polls
+// starknet_getEvents from the last indexed block, decodes the events with
+// the contracts' ABIs and stores them for the API, rewinding when a reorg
+// replaces indexed blocks.
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"aura-backend/deployments"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/indexer")
+
+// eventsChunkSize is the page size requested from the node
+const eventsChunkSize = 100
+
+// Config configures the indexer
+type Config struct {
+	Network        string   // devnet, sepolia or mainnet, names the deployments file
+	DeploymentsDir string   // snfoundry/deployments
+	ClassesDir     string   // Compiled contract classes, snfoundry/contracts/target/dev
+	Contracts      []string // Deployment names to index, all when empty
+	StartBlock     uint64   // First block indexed when there is no checkpoint
+	BatchBlocks    uint64   // Blocks requested at once
+	ReorgDepth     uint64   // Blocks indexed again after a reorg
+	PollInterval   time.Duration
+}
+
+// ChainReader is the subset of the Starknet RPC used to index events
+type ChainReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GetBlockHeader(ctx context.Context, block *starknet.BlockID) (*starknet.BlockHeader, error)
+	GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsPage, error)
+}
+
+// Indexer stores the events of the contracts from the checkpoint up to the
+// latest block. The checkpoint keeps the hash of the last indexed block: when
+// the node no longer has it, the last ReorgDepth blocks are indexed again.
+// Deeper reorgs are not repaired.
+type Indexer struct {
+	Store     store.EventStore
+	Chain     ChainReader
+	Contracts []deployments.Contract
+	Config    Config
+
+	Indexed *metrics.Counter // Counts stored events by contract, optional
+
+	now func() time.Time
+}
+
+// NewIndexer creates the event indexer
+func NewIndexer(s store.EventStore, chain ChainReader, contracts []deployments.Contract, config Config) *Indexer {
+	return &Indexer{Store: s, Chain: chain, Contracts: contracts, Config: config, now: time.Now}
+}
+
+// Run indexes new blocks every poll interval until the context is cancelled
+func (ix *Indexer) Run(ctx context.Context) {
+	slog.Info("Event indexer started", "network", ix.Config.Network, "contracts", len(ix.Contracts))
+
+	ticker := time.NewTicker(ix.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ix.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to index events", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process checks the checkpoint is still on the chain, then indexes the
+// blocks after it up to the latest one
+func (ix *Indexer) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "indexer.process")
+	defer func() { tracing.End(span, err) }()
+
+	head, err := ix.Chain.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get block number: %w", err)
+	}
+
+	from := ix.Config.StartBlock
+	checkpoint, err := ix.Store.EventCheckpoint(ctx)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		if checkpoint, err = ix.checkReorg(ctx, checkpoint); err != nil {
+			return err
+		}
+		from = checkpoint.BlockNumber + 1
+	}
+
+	for from <= head {
+		to := min(head, from+ix.Config.BatchBlocks-1)
+		if err := ix.index(ctx, from, to); err != nil {
+			return err
+		}
+		from = to + 1
+	}
+	return nil
+}
+
+// checkReorg rewinds the checkpoint when its block was replaced and returns
+// the checkpoint to index from
+func (ix *Indexer) checkReorg(ctx context.Context, checkpoint *store.EventCheckpoint) (*store.EventCheckpoint, error) {
+	header, err := ix.Chain.GetBlockHeader(ctx, starknet.BlockNumberID(checkpoint.BlockNumber))
+	if err != nil {
+		return nil, fmt.Errorf("could not get block %d: %w", checkpoint.BlockNumber, err)
+	}
+	if starknet.NormalizeAddress(header.BlockHash) == starknet.NormalizeAddress(checkpoint.BlockHash) {
+		return checkpoint, nil
+	}
+
+	target := ix.Config.StartBlock
+	if checkpoint.BlockNumber > target+ix.Config.ReorgDepth {
+		target = checkpoint.BlockNumber - ix.Config.ReorgDepth
+	}
+	header, err = ix.Chain.GetBlockHeader(ctx, starknet.BlockNumberID(target))
+	if err != nil {
+		return nil, fmt.Errorf("could not get block %d: %w", target, err)
+	}
+
+	slog.Warn("Chain reorganization, indexing blocks again", "checkpoint", checkpoint.BlockNumber, "from", target+1)
+	rewound := store.EventCheckpoint{BlockNumber: target, BlockHash: header.BlockHash}
+	if err := ix.Store.RewindEvents(ctx, rewound); err != nil {
+		return nil, err
+	}
+	return &rewound, nil
+}
+
+// index stores the events of a block range and moves the checkpoint to its
+// last block
+func (ix *Indexer) index(ctx context.Context, from, to uint64) error {
+	header, err := ix.Chain.GetBlockHeader(ctx, starknet.BlockNumberID(to))
+	if err != nil {
+		return fmt.Errorf("could not get block %d: %w", to, err)
+	}
+
+	var events []store.ChainEvent
+	for _, contract := range ix.Contracts {
+		found, err := ix.fetch(ctx, contract, from, to)
+		if err != nil {
+			return err
+		}
+		events = append(events, found...)
+	}
+
+	// The last block must not have changed since its hash was read, or the
+	// checkpoint would not match the events
+	for _, event := range events {
+		if event.BlockNumber == to && starknet.NormalizeAddress(event.BlockHash) != starknet.NormalizeAddress(header.BlockHash) {
+			return fmt.Errorf("block %d changed while indexing", to)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].BlockNumber < events[j].BlockNumber
+	})
+	if err := ix.Store.SaveEvents(ctx, events, store.EventCheckpoint{BlockNumber: to, BlockHash: header.BlockHash}); err != nil {
+		return err
+	}
+	for _, event := range events {
+		ix.Indexed.Inc(event.Contract)
+	}
+	return nil
+}
+
+// fetch returns the events of a contract between two blocks, decoded with
+// its ABI. Events the ABI does not describe are kept undecoded.
+func (ix *Indexer) fetch(ctx context.Context, contract deployments.Contract, from, to uint64) ([]store.ChainEvent, error) {
+	filter := starknet.EventFilter{
+		FromBlock: starknet.BlockNumberID(from),
+		ToBlock:   starknet.BlockNumberID(to),
+		Address:   contract.Address,
+		ChunkSize: eventsChunkSize,
+	}
+
+	var events []store.ChainEvent
+	positions := map[string]int{} // Next event index per transaction
+	for {
+		page, err := ix.Chain.GetEvents(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("could not get events of %s: %w", contract.Name, err)
+		}
+
+		for _, emitted := range page.Events {
+			event := store.ChainEvent{
+				Contract:        contract.Name,
+				ContractAddress: contract.Address,
+				Keys:            emitted.Keys,
+				Data:            emitted.Data,
+				BlockNumber:     emitted.BlockNumber,
+				BlockHash:       emitted.BlockHash,
+				TransactionHash: emitted.TransactionHash,
+				EventIndex:      positions[emitted.TransactionHash],
+				CreatedAt:       ix.now(),
+			}
+			positions[emitted.TransactionHash]++
+
+			decoded, err := contract.ABI.DecodeEvent(emitted.Keys, emitted.Data)
+			switch {
+			case err == nil:
+				event.Name = decoded.Name
+				if event.Fields, err = json.Marshal(decoded.Fields); err != nil {
+					return nil, err
+				}
+			case !errors.Is(err, starknet.ErrUnknownEvent):
+				slog.Warn("Could not decode event", "contract", contract.Name, "transaction", emitted.TransactionHash, logging.Err(err))
+			}
+			events = append(events, event)
+		}
+
+		if page.ContinuationToken == "" {
+			return events, nil
+		}
+		filter.ContinuationToken = page.ContinuationToken
+	}
+}
@@ -0,0 +1,206 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"aura-backend/deployments"
+	"aura-backend/starknet"
+	"aura-backend/store"
+)
+
+const tokenAddress = "0x0aaa"
+
+// tokenABI declares the Transfer event of a token
+const tokenABI = `[
+	{"type": "event", "name": "contracts::Token::Token::Transfer", "kind": "struct", "members": [
+		{"name": "from", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "to", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "value", "type": "core::felt252", "kind": "data"}
+	]},
+	{"type": "event", "name": "contracts::Token::Token::Event", "kind": "enum", "variants": [
+		{"name": "Transfer", "type": "contracts::Token::Token::Transfer", "kind": "nested"}
+	]}
+]`
+
+// fakeChain is a node whose blocks are identified by their hashes. It
+// returns events two at a time to exercise continuation tokens.
+type fakeChain struct {
+	hashes []string
+	events []starknet.EmittedEvent
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(len(c.hashes) - 1), nil
+}
+
+func (c *fakeChain) GetBlockHeader(ctx context.Context, block *starknet.BlockID) (*starknet.BlockHeader, error) {
+	if block.Number == nil || *block.Number >= uint64(len(c.hashes)) {
+		return nil, &starknet.RPCError{Code: starknet.ErrCodeBlockNotFound, Message: "Block not found"}
+	}
+	return &starknet.BlockHeader{BlockNumber: *block.Number, BlockHash: c.hashes[*block.Number]}, nil
+}
+
+func (c *fakeChain) GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsPage, error) {
+	var matching []starknet.EmittedEvent
+	for _, event := range c.events {
+		if event.FromAddress == filter.Address && event.BlockNumber >= *filter.FromBlock.Number && event.BlockNumber <= *filter.ToBlock.Number {
+			matching = append(matching, event)
+		}
+	}
+
+	start, _ := strconv.Atoi(filter.ContinuationToken)
+	page := &starknet.EventsPage{Events: matching[start:min(start+2, len(matching))]}
+	if start+2 < len(matching) {
+		page.ContinuationToken = strconv.Itoa(start + 2)
+	}
+	return page, nil
+}
+
+// mine appends a block with a transfer of the given value
+func (c *fakeChain) mine(hash string, value int) {
+	number := uint64(len(c.hashes))
+	c.hashes = append(c.hashes, hash)
+	c.events = append(c.events, starknet.EmittedEvent{
+		FromAddress:     tokenAddress,
+		Keys:            []string{starknet.SelectorFromName("Transfer"), "0x1", "0x2"},
+		Data:            []string{fmt.Sprintf("0x%x", value)},
+		BlockHash:       hash,
+		BlockNumber:     number,
+		TransactionHash: "0xt" + hash,
+	})
+}
+
+// reorg replaces the blocks from the given number on
+func (c *fakeChain) reorg(from uint64) {
+	c.hashes = c.hashes[:from]
+	kept := c.events[:0]
+	for _, event := range c.events {
+		if event.BlockNumber < from {
+			kept = append(kept, event)
+		}
+	}
+	c.events = kept
+}
+
+func values(t *testing.T, s *store.Memory) []string {
+	t.Helper()
+
+	events, err := s.ListEvents(context.Background(), store.EventQuery{Limit: 100})
+	if err != nil {
+		t.Fatalf("ListEvents() error = %v", err)
+	}
+	var values []string
+	for i := len(events) - 1; i >= 0; i-- {
+		var fields struct{ Value string }
+		if err := json.Unmarshal(events[i].Fields, &fields); err != nil || events[i].Name != "Transfer" {
+			t.Fatalf("event %d = %s %s, want a decoded Transfer", events[i].ID, events[i].Name, events[i].Fields)
+		}
+		values = append(values, fields.Value)
+	}
+	return values
+}
+
+func TestIndexer(t *testing.T) {
+	ctx := context.Background()
+	abi, err := starknet.ParseABI([]byte(tokenABI))
+	if err != nil {
+		t.Fatalf("ParseABI() error = %v", err)
+	}
+
+	chain := &fakeChain{hashes: []string{"0xg"}}
+	for i := 1; i <= 5; i++ {
+		chain.mine(fmt.Sprintf("0xa%d", i), i)
+	}
+
+	s := store.NewMemory()
+	indexer := NewIndexer(s, chain, []deployments.Contract{{Name: "Token", Address: tokenAddress, ABI: abi}}, Config{
+		StartBlock:  1,
+		BatchBlocks: 2,
+		ReorgDepth:  2,
+	})
+
+	if err := indexer.Process(ctx); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := values(t, s); fmt.Sprint(got) != "[0x1 0x2 0x3 0x4 0x5]" {
+		t.Fatalf("indexed %v, want the five transfers", got)
+	}
+	checkpoint, _ := s.EventCheckpoint(ctx)
+	if checkpoint.BlockNumber != 5 || checkpoint.BlockHash != "0xa5" {
+		t.Fatalf("checkpoint = %+v, want block 5", checkpoint)
+	}
+
+	// Indexing again without new blocks stores nothing
+	if err := indexer.Process(ctx); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := values(t, s); len(got) != 5 {
+		t.Fatalf("indexed %v after a second poll", got)
+	}
+
+	// Block 5 is replaced and block 6 mined on the new branch: blocks 4 and
+	// above are indexed again
+	chain.reorg(5)
+	chain.mine("0xb5", 50)
+	chain.mine("0xb6", 60)
+	if err := indexer.Process(ctx); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := values(t, s); fmt.Sprint(got) != "[0x1 0x2 0x3 0x4 0x32 0x3c]" {
+		t.Fatalf("indexed %v after the reorg", got)
+	}
+	checkpoint, _ = s.EventCheckpoint(ctx)
+	if checkpoint.BlockNumber != 6 || checkpoint.BlockHash != "0xb6" {
+		t.Fatalf("checkpoint = %+v, want block 6 of the new branch", checkpoint)
+	}
+
+	// Filters and paging
+	events, _ := s.ListEvents(ctx, store.EventQuery{Name: "Transfer", Limit: 2})
+	if len(events) != 2 || events[0].BlockNumber != 6 {
+		t.Fatalf("ListEvents(limit 2) = %+v, want the two newest", events)
+	}
+	older, _ := s.ListEvents(ctx, store.EventQuery{Before: events[1].ID, Limit: 100})
+	if len(older) != 4 {
+		t.Errorf("ListEvents(before) returned %d events, want 4", len(older))
+	}
+	if none, _ := s.ListEvents(ctx, store.EventQuery{Contract: "Other", Limit: 100}); len(none) != 0 {
+		t.Errorf("ListEvents(other contract) = %+v", none)
+	}
+}
+
+func TestLoadContracts(t *testing.T) {
+	dir := t.TempDir()
+	deployments := `{
+		"Token": {"contract": "Token", "address": "0x00AAA", "classHash": "0x1"},
+		"Other": {"contract": "Missing", "address": "0xbbb", "classHash": "0x2"}
+	}`
+	class, _ := json.Marshal(map[string]string{"abi": tokenABI})
+	os.WriteFile(filepath.Join(dir, "devnet_latest.json"), []byte(deployments), 0o644)
+	os.WriteFile(filepath.Join(dir, "contracts_Token.contract_class.json"), class, 0o644)
+
+	config := Config{Network: "devnet", DeploymentsDir: dir, ClassesDir: dir, Contracts: []string{"Token"}}
+	contracts, err := LoadContracts(config)
+	if err != nil {
+		t.Fatalf("LoadContracts() error = %v", err)
+	}
+	if len(contracts) != 1 || contracts[0].Name != "Token" || contracts[0].Address != "0xaaa" {
+		t.Fatalf("LoadContracts() = %+v", contracts)
+	}
+	if _, err := contracts[0].ABI.DecodeEvent([]string{starknet.SelectorFromName("Transfer"), "0x1", "0x2"}, []string{"0x3"}); err != nil {
+		t.Errorf("DecodeEvent() error = %v", err)
+	}
+
+	// Every deployment is indexed by default, their classes must exist
+	if _, err := LoadContracts(Config{Network: "devnet", DeploymentsDir: dir, ClassesDir: dir}); err == nil {
+		t.Error("LoadContracts() succeeded without the class of Other")
+	}
+	if _, err := LoadContracts(Config{Network: "sepolia", DeploymentsDir: dir, ClassesDir: dir}); err == nil {
+		t.Error("LoadContracts() succeeded without a deployments file")
+	}
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "info", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.With("first_name", "Jane").Info("Login from jane.doe@example.com",
+		"lastName", "Doe",
+		"plan", "pro",
+		Err(errors.New("lookup jane.doe@example.com: Bearer eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl")),
+		slog.Group("wallet", "encrypted_private_key", "0x1234", "address", "0xabc"),
+	)
+
+	line := out.String()
+	for _, leaked := range []string{"Jane", "Doe", "jane.doe@example.com", "eyJ", "0x1234"} {
+		if strings.Contains(line, leaked) {
+			t.Errorf("log line leaks %q: %s", leaked, line)
+		}
+	}
+	for _, kept := range []string{`"plan":"pro"`, `"address":"0xabc"`} {
+		if !strings.Contains(line, kept) {
+			t.Errorf("log line is missing %s: %s", kept, line)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "warn", FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(out.String(), "hidden") || !strings.Contains(out.String(), "shown") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if _, err := New(&out, "verbose", FormatJSON); err == nil {
+		t.Error("New() accepted an unknown level")
+	}
+	if _, err := New(&out, "info", "xml"); err == nil {
+		t.Error("New() accepted an unknown format")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger, _ := New(&out, "info", FormatJSON)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/habits/{habitId}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), "user-1")
+		FromRequest(r).Info("handled")
+	})
+	handler := Middleware(logger, mux)
+
+	// A well-formed ID from the caller is reused
+	req := httptest.NewRequest(http.MethodGet, "/api/habits/42", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("%s = %q, want abc-123", RequestIDHeader, got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the handler's and the access log", len(lines))
+	}
+	for _, line := range lines {
+		var record map[string]any
+		json.Unmarshal([]byte(line), &record)
+		if record["request_id"] != "abc-123" || record["user_id"] != "user-1" || record["route"] != "GET /api/habits/{habitId}" {
+			t.Errorf("missing request attributes: %s", line)
+		}
+	}
+
+	// Malformed IDs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/api/habits/42", nil)
+	req.Header.Set(RequestIDHeader, "forged\nline")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got == "" || strings.Contains(got, "forged") {
+		t.Errorf("%s = %q, want a generated ID", RequestIDHeader, got)
+	}
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values that must not reach the logs
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are always redacted, compared
+// in lower case without separators
+var sensitiveKeys = map[string]bool{
+	"email":               true,
+	"name":                true,
+	"firstname":           true,
+	"lastname":            true,
+	"fullname":            true,
+	"givenname":           true,
+	"familyname":          true,
+	"password":            true,
+	"passphrase":          true,
+	"pin":                 true,
+	"secret":              true,
+	"token":               true,
+	"authorization":       true,
+	"apikey":              true,
+	"privatekey":          true,
+	"encryptedprivatekey": true,
+	"seed":                true,
+	"mnemonic":            true,
+}
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	bearerPattern = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+)
+
+// RedactingHandler keeps personal data and credentials out of the logs. It
+// redacts attributes with sensitive keys, and scrubs emails and tokens from
+// messages and string values, such as wrapped errors, that embed them.
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps a handler with the redaction layer
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Scrub(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// Scrub removes emails and bearer tokens from free text
+func Scrub(text string) string {
+	if !strings.ContainsAny(text, "@.") {
+		return text
+	}
+	text = emailPattern.ReplaceAllString(text, Redacted)
+	text = bearerPattern.ReplaceAllString(text, "Bearer "+Redacted)
+	return jwtPattern.ReplaceAllString(text, Redacted)
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindString:
+		return slog.String(attr.Key, Scrub(value.String()))
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, Scrub(err.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+func isSensitive(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	return sensitiveKeys[normalized]
+}
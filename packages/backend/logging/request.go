@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"aura-backend/httpx"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID from the caller and back to it
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from callers
+const maxRequestIDLength = 128
+
+type contextKey struct{}
+
+// requestState is shared by everything handling one request, so the user ID
+// found while authenticating reaches the access log
+type requestState struct {
+	id     string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	userID string
+}
+
+// Middleware assigns every request an ID, reusing a well-formed X-Request-ID
+// from the caller, echoes it in the response and writes one access log line
+// per request. Requests to quietRoutes, such as probes, are logged at debug.
+func Middleware(logger *slog.Logger, next http.Handler, quietRoutes ...string) http.Handler {
+	quiet := make(map[string]bool, len(quietRoutes))
+	for _, route := range quietRoutes {
+		quiet[route] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		// Correlate the logs with the trace started by the tracing middleware
+		requestLogger := logger.With("request_id", id)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+		}
+
+		state := &requestState{id: id, logger: requestLogger}
+		ctx := context.WithValue(r.Context(), contextKey{}, state)
+		recorder := httpx.NewStatusRecorder(w)
+
+		httpx.ServeWithContext(ctx, next, recorder, r)
+
+		level := slog.LevelInfo
+		if recorder.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if quiet[r.Pattern] {
+			level = slog.LevelDebug
+		}
+		FromRequest(r.WithContext(ctx)).LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.Status),
+			slog.Int64("duration_ms", time.Since(started).Milliseconds()),
+		)
+	})
+}
+
+// FromContext returns the logger of the request handled under ctx, carrying
+// its request ID and user ID, or the default logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	state, ok := ctx.Value(contextKey{}).(*requestState)
+	if !ok {
+		return slog.Default()
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.userID != "" {
+		return state.logger.With("user_id", state.userID)
+	}
+	return state.logger
+}
+
+// FromRequest is FromContext with the route pattern the request matched
+func FromRequest(r *http.Request) *slog.Logger {
+	logger := FromContext(r.Context())
+	if r.Pattern != "" {
+		logger = logger.With("route", r.Pattern)
+	}
+	return logger
+}
+
+// SetUserID records the authenticated user for the rest of the request
+func SetUserID(ctx context.Context, userID string) {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		state.userID = userID
+	}
+}
+
+// RequestID returns the ID of the request handled under ctx, or an empty
+// string, so outgoing calls can propagate it
+func RequestID(ctx context.Context) string {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		return state.id
+	}
+	return ""
+}
+
+// validRequestID accepts IDs of reasonable length made of characters that
+// cannot forge log fields or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -1,41 +1,403 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"aura-backend/achievements"
+	"aura-backend/attestations"
+	"aura-backend/billing"
+	"aura-backend/buildinfo"
+	"aura-backend/config"
 	"aura-backend/controller"
+	"aura-backend/custody"
 	database "aura-backend/db"
-
-	"github.com/joho/godotenv"
+	"aura-backend/health"
+	"aura-backend/indexer"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/outbox"
+	"aura-backend/plans"
+	"aura-backend/portfolio"
+	"aura-backend/ratelimit"
+	"aura-backend/rewards"
+	"aura-backend/staking"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
 )
 
+// workerLockInterval is how often an instance tries to take the worker lock,
+// and how often the instance holding it checks its connection
+const workerLockInterval = 10 * time.Second
+
 func main() {
-	// Load environment variables
-	err := godotenv.Load()
+	// Load the configuration from the config file, environment and flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+
+	// Structured logs, redacted of personal data, also receive the output of
+	// the standard log package
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	slog.SetDefault(logger)
+
+	// The config subcommand inspects the configuration without connecting anywhere
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(cfg, args[1:]); err != nil {
+			fatal("Config command failed", err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	// Traces continue the frontend's trace context and are exported when enabled
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Enabled:        cfg.Tracing.Enabled,
+		Endpoint:       cfg.Tracing.Endpoint,
+		ServiceName:    cfg.Tracing.ServiceName,
+		ServiceVersion: buildinfo.Get().GitSHA,
+		SampleRatio:    cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		log.Println("Warning: Error loading .env file:", err)
+		fatal("Failed to set up tracing", err)
 	}
 
-	// Initialize the database connection
-	db, err := database.InitDB()
+	// Initialize the database connection. The pool is closed last, once the
+	// server and the background workers have stopped using it.
+	db, err := database.InitDB(cfg.Database.URL, cfg.PoolSettings())
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
-	// Configure routes
-	handler := controller.SetupRoutes(db)
+	// Run the migrate subcommand instead of the server when requested
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(db, args[1:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
+	}
+
+	// Apply pending migrations on start when enabled
+	if cfg.Database.AutoMigrate {
+		if _, err := database.MigrateUp(context.Background(), db); err != nil {
+			fatal("Failed to apply migrations", err)
+		}
+	}
+
+	// Dependencies checked by the readiness probe. The node is optional: only
+	// on-chain features need it, the rest of the API keeps working without it.
+	readiness := health.NewChecker()
+	readiness.Add("database", db.Ping)
+	readiness.Add("migrations", func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migration(s)", len(pending))
+		}
+		return nil
+	})
+	if cfg.Starknet.RPCURL != "" {
+		rpc := starknet.NewClient(cfg.Starknet.RPCURL)
+		readiness.AddOptional("starknet", func(ctx context.Context) error {
+			_, err := rpc.ChainID(ctx)
+			return err
+		})
+	}
+
+	// Stop on SIGTERM from the orchestrator or SIGINT from a terminal
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers are stopped after the server has drained
+	background := newWorkers()
+
+	// Prometheus metrics for requests, the connection pool and business events
+	var registry *metrics.Registry
+	domain := &metrics.Domain{}
+	if cfg.Features.Metrics {
+		registry = metrics.NewRegistry()
+		database.RegisterPoolMetrics(registry, db)
+		domain = metrics.NewDomain(registry)
+	}
+
+	// Load the plan catalog used to resolve entitlements
+	catalog, err := plans.LoadOrDefault(cfg.Plans.File)
+	if err != nil {
+		fatal("Failed to load plans", err)
+	}
+
+	// Pollers reading or writing shared state run on one instance at a time,
+	// see exclusiveWorkers below
+	var exclusiveWorkers []func(ctx context.Context)
+
+	// Enable on-chain STRK payments when a treasury and an RPC node are configured
+	var payments *billing.StrkPayments
+	if strkConfig, ok := cfg.StrkPayments(); ok {
+		payments = billing.NewStrkPayments(db, starknet.NewClient(cfg.Starknet.RPCURL), catalog, strkConfig)
+		payments.Upgrades = domain.Upgrades
+		exclusiveWorkers = append(exclusiveWorkers, payments.Run)
+	} else {
+		slog.Info("STRK payments disabled: feature off, or STRK_TREASURY_ADDRESS or STARKNET_RPC_URL not set")
+	}
+
+	// Trials, promo codes and referrals
+	var promotions *billing.Promotions
+	if cfg.Features.Promotions {
+		promotions = billing.NewPromotions(db, catalog, cfg.Promotions())
+		promotions.Upgrades = domain.Upgrades
+	}
+
+	// The workers below share the operator account so that their
+	// transactions take consecutive nonces
+	operator := operatorAccount(cfg)
+
+	// Transactions queued with domain changes are sent by the outbox worker
+	var transactions *outbox.Worker
+	if outboxConfig, ok := cfg.TransactionOutbox(); ok && operator != nil {
+		transactions = outbox.NewWorker(store.NewPostgres(db), operator, starknet.NewClient(cfg.Starknet.RPCURL), outboxConfig)
+		transactions.Finished = domain.OutboxFinished
+	} else {
+		slog.Info("Transaction outbox disabled: feature off, no operator account, or STARKNET_RPC_URL not set")
+	}
+
+	// Completed habits always queue their achievement. The NFTs are minted
+	// once an operator account can send the transactions: through the outbox
+	// in the transaction completing the habit when it runs, and otherwise by
+	// the minter polling the queued achievements.
+	var mintContract string
+	if mintConfig, ok := cfg.AchievementMinting(); ok {
+		if operator != nil {
+			minter := achievements.NewMinter(store.NewPostgres(db), operator, starknet.NewClient(cfg.Starknet.RPCURL), mintConfig)
+			minter.Minted = domain.Achievements
+			exclusiveWorkers = append(exclusiveWorkers, minter.Run)
+			if transactions != nil {
+				transactions.Handlers[store.OutboxAchievementMint] = minter
+				mintContract = mintConfig.ContractAddress
+			}
+		} else {
+			slog.Info("Achievement minting disabled: no operator account to send transactions")
+		}
+	} else {
+		slog.Info("Achievement minting disabled: feature off, or ACHIEVEMENTS_CONTRACT_ADDRESS or STARKNET_RPC_URL not set")
+	}
 
-	// Get port from environment variables or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if transactions != nil {
+		exclusiveWorkers = append(exclusiveWorkers, transactions.Run)
 	}
 
+	// Stakes are accepted once the escrow is configured. Deposits are verified
+	// and stakes resolved once the operator account, the escrow's oracle, can
+	// send the transactions.
+	var stakingContract string
+	if stakeConfig, ok := cfg.StakeResolution(); ok {
+		stakingContract = stakeConfig.ContractAddress
+		if operator != nil {
+			stakes := store.NewPostgres(db)
+			resolver := staking.NewResolver(stakes, stakes, operator, starknet.NewClient(cfg.Starknet.RPCURL), stakeConfig)
+			exclusiveWorkers = append(exclusiveWorkers, resolver.Run)
+		} else {
+			slog.Info("Stake resolution disabled: no operator account to send transactions")
+		}
+	} else {
+		slog.Info("Staking disabled: feature off, or STAKING_CONTRACT_ADDRESS or STARKNET_RPC_URL not set")
+	}
+
+	// Check-ins accrue points in the ledger. The points are minted to wallets
+	// once an operator account, the token's minter, can send the claims.
+	var rewardRules *rewards.Rules
+	if cfg.Features.Rewards {
+		rules := rewards.DefaultRules()
+		rewardRules = &rules
+	}
+	if claimConfig, ok := cfg.RewardClaims(); ok {
+		if operator != nil {
+			distributor := rewards.NewDistributor(store.NewPostgres(db), operator, starknet.NewClient(cfg.Starknet.RPCURL), claimConfig)
+			distributor.Points = domain.RewardPoints
+			exclusiveWorkers = append(exclusiveWorkers, distributor.Run)
+		} else {
+			slog.Info("Reward claims disabled: no operator account to send transactions")
+		}
+	} else {
+		slog.Info("Reward claims disabled: feature off, or REWARDS_TOKEN_ADDRESS or STARKNET_RPC_URL not set")
+	}
+
+	// Check-ins are always recorded. The root of each finished day is posted
+	// once an operator account, the registry's poster, can send transactions.
+	var attestationContract string
+	if attestConfig, ok := cfg.AttestationPosting(); ok {
+		attestationContract = attestConfig.ContractAddress
+		if operator != nil {
+			attester := attestations.NewAttester(store.NewPostgres(db), operator, starknet.NewClient(cfg.Starknet.RPCURL), attestConfig)
+			exclusiveWorkers = append(exclusiveWorkers, attester.Run)
+		} else {
+			slog.Info("Attestations disabled: no operator account to send transactions")
+		}
+	} else {
+		slog.Info("Attestations disabled: feature off, or ATTESTATIONS_CONTRACT_ADDRESS or STARKNET_RPC_URL not set")
+	}
+
+	// Events of the deployed contracts are indexed for GET /api/events
+	if indexConfig, ok := cfg.EventIndexing(); ok {
+		contracts, err := indexer.LoadContracts(indexConfig)
+		if err != nil {
+			slog.Warn("Event indexer disabled: could not load the deployed contracts", logging.Err(err))
+		} else {
+			events := indexer.NewIndexer(store.NewPostgres(db), starknet.NewClient(cfg.Starknet.RPCURL), contracts, indexConfig)
+			events.Indexed = domain.IndexedEvents
+			exclusiveWorkers = append(exclusiveWorkers, events.Run)
+		}
+	} else {
+		slog.Info("Event indexer disabled: feature off, or STARKNET_RPC_URL not set")
+	}
+
+	// Every instance would otherwise send the same transactions from the
+	// operator account, with colliding nonces, credit the same STRK payments
+	// and index the same events: the instance holding the worker lock runs
+	// all of them, and another takes over if it stops. The resolver,
+	// distributor and attester are not outbox kinds: they decide their calls
+	// when sending from the current state of their records, and recover from
+	// failures in ways of their own, such as keeping a claim's rewards until
+	// its mint reverted.
+	if len(exclusiveWorkers) > 0 {
+		background.Go(func(ctx context.Context) {
+			database.RunExclusive(ctx, db, database.WorkerLockID, workerLockInterval, func(ctx context.Context) {
+				var wg sync.WaitGroup
+				for _, run := range exclusiveWorkers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						run(ctx)
+					}()
+				}
+				wg.Wait()
+			})
+		})
+	}
+
+	// Wallet balances are read through the node for GET /api/wallet/balances
+	var balances *portfolio.Portfolio
+	if portfolioConfig, ok := cfg.WalletBalances(); ok {
+		balances = portfolio.NewPortfolio(starknet.NewClient(cfg.Starknet.RPCURL), portfolioConfig)
+	} else {
+		slog.Info("Wallet balances disabled: feature off, or STARKNET_RPC_URL not set")
+	}
+
+	// Wallet keys are generated and sealed by the backend once an encryption
+	// key is configured. Keys are rotated through the wallet accounts, which
+	// needs a node.
+	var keys *custody.Custody
+	if custodyConfig, ok := cfg.WalletCustody(); ok {
+		var node custody.Node
+		if cfg.Starknet.RPCURL != "" {
+			node = starknet.NewClient(cfg.Starknet.RPCURL)
+		}
+		keys, err = custody.NewCustody(store.NewPostgres(db), node, custodyConfig)
+		if err != nil {
+			fatal("Failed to create the wallet keyring", err)
+		}
+		keys.Events = domain.WalletEvents
+		if node != nil {
+			background.Go(keys.Run)
+		} else {
+			slog.Info("Wallet recovery disabled: STARKNET_RPC_URL not set")
+		}
+	} else {
+		slog.Info("Wallet custody disabled: feature off, or WALLET_ENCRYPTION_KEY not set")
+	}
+
+	// Rate limits are shared through Postgres when several instances run
+	var rateLimits ratelimit.Store
+	if cfg.RateLimit.Enabled {
+		if cfg.RateLimit.Backend == config.RateLimitPostgres {
+			limits := ratelimit.NewPostgres(db)
+			background.Go(limits.Run)
+			rateLimits = limits
+		} else {
+			rateLimits = ratelimit.NewMemory()
+		}
+	}
+
+	// Configure routes
+	handler := controller.SetupRoutes(store.NewPostgres(db), catalog, payments, promotions, controller.Options{
+		AllowedOrigins:      cfg.CORS.AllowedOrigins,
+		JWTSecret:           cfg.Auth.JWTSecret,
+		Readiness:           readiness,
+		Metrics:             registry,
+		MetricsToken:        cfg.Server.MetricsToken,
+		Domain:              domain,
+		Logger:              logger,
+		RateLimits:          rateLimits,
+		TrustProxy:          cfg.RateLimit.TrustProxy,
+		StakingContract:     stakingContract,
+		RewardRules:         rewardRules,
+		AttestationContract: attestationContract,
+		MintContract:        mintContract,
+		Portfolio:           balances,
+		Custody:             keys,
+		WalletReauthWindow:  cfg.Wallet.ReauthWindow,
+	})
+
 	// Start the server
-	fmt.Printf("Server running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	server := newServer(cfg.Server, handler)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("Failed to listen on port "+cfg.Server.Port, err)
+	}
+
+	slog.Info("Server running", "port", cfg.Server.Port)
+	err = serve(ctx, server, listener, background, cfg.Server.ShutdownTimeout)
+	db.Close()
+
+	// Flush the spans of the last requests
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush traces", logging.Err(err))
+	}
+
+	if err != nil {
+		fatal("Server stopped with error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// operatorAccount returns the account the backend sends transactions from,
+// or nil when none is configured
+func operatorAccount(cfg *config.Config) starknet.Sender {
+	accountConfig, ok := cfg.OperatorAccount()
+	if !ok {
+		slog.Info("No operator account: OPERATOR_ADDRESS, OPERATOR_PRIVATE_KEY or STARKNET_RPC_URL not set")
+		return nil
+	}
+
+	account, err := starknet.NewAccount(starknet.NewClient(cfg.Starknet.RPCURL), accountConfig)
+	if err != nil {
+		fatal("Invalid operator account", err)
+	}
+	slog.Info("Operator account loaded", "address", accountConfig.Address, "publicKey", account.PublicKey())
+	return account
+}
+
+// fatal logs an error and exits, like log.Fatal for the structured logger
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
 }
@@ -0,0 +1,113 @@
+// Package merkle builds keccak-256 Merkle trees over sorted pairs, as
+// OpenZeppelin's MerkleProof verifies them: a node hashes its two children
+// in ascending order, so a proof is the list of siblings from the leaf up
+// and needs no positions.
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Hash is a 32-byte keccak-256 digest
+type Hash [32]byte
+
+// ErrUnknownLeaf is returned when proving a leaf that is not in the tree
+var ErrUnknownLeaf = errors.New("leaf is not in the tree")
+
+// Tree is a Merkle tree whose levels go from the sorted leaves to the root
+type Tree struct {
+	levels [][]Hash
+}
+
+// New builds the tree of the given leaves. Leaves are sorted first so the
+// root does not depend on the order they were read in. A node without a
+// sibling moves up a level unchanged.
+func New(leaves []Hash) *Tree {
+	level := append([]Hash(nil), leaves...)
+	sort.Slice(level, func(i, j int) bool {
+		return bytes.Compare(level[i][:], level[j][:]) < 0
+	})
+
+	tree := &Tree{levels: [][]Hash{level}}
+	for len(level) > 1 {
+		next := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, HashPair(level[i], level[i+1]))
+			}
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree
+}
+
+// Root returns the root of the tree, zero when it has no leaves
+func (t *Tree) Root() Hash {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return Hash{}
+	}
+	return top[0]
+}
+
+// Len returns the number of leaves
+func (t *Tree) Len() int {
+	return len(t.levels[0])
+}
+
+// Proof returns the siblings of a leaf from the bottom of the tree up
+func (t *Tree) Proof(leaf Hash) ([]Hash, error) {
+	leaves := t.levels[0]
+	index := sort.Search(len(leaves), func(i int) bool {
+		return bytes.Compare(leaves[i][:], leaf[:]) >= 0
+	})
+	if index == len(leaves) || leaves[index] != leaf {
+		return nil, ErrUnknownLeaf
+	}
+
+	proof := []Hash{}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Verify reports whether a proof links a leaf to a root
+func Verify(root, leaf Hash, proof []Hash) bool {
+	node := leaf
+	for _, sibling := range proof {
+		node = HashPair(node, sibling)
+	}
+	return node == root
+}
+
+// HashPair hashes two nodes in ascending order
+func HashPair(a, b Hash) Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return Keccak(a[:], b[:])
+}
+
+// Keccak returns the keccak-256 digest of the concatenated data
+func Keccak(data ...[]byte) Hash {
+	hash := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hash.Write(d)
+	}
+
+	var digest Hash
+	hash.Sum(digest[:0])
+	return digest
+}
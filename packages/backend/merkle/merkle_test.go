@@ -0,0 +1,73 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func leaves(n int) []Hash {
+	hashes := make([]Hash, n)
+	for i := range hashes {
+		hashes[i] = Keccak([]byte{byte(i)})
+	}
+	return hashes
+}
+
+func TestProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		tree := New(leaves(n))
+		if tree.Len() != n {
+			t.Fatalf("%d leaves: Len = %d", n, tree.Len())
+		}
+
+		for _, leaf := range leaves(n) {
+			proof, err := tree.Proof(leaf)
+			if err != nil {
+				t.Fatalf("%d leaves: %v", n, err)
+			}
+			if !Verify(tree.Root(), leaf, proof) {
+				t.Errorf("%d leaves: proof of %x does not verify", n, leaf)
+			}
+		}
+	}
+}
+
+func TestRootIgnoresLeafOrder(t *testing.T) {
+	forward := leaves(5)
+	reversed := make([]Hash, len(forward))
+	for i, leaf := range forward {
+		reversed[len(forward)-1-i] = leaf
+	}
+
+	if New(forward).Root() != New(reversed).Root() {
+		t.Error("root depends on the order of the leaves")
+	}
+}
+
+func TestSingleLeaf(t *testing.T) {
+	leaf := Keccak([]byte("check-in"))
+	tree := New([]Hash{leaf})
+
+	proof, err := tree.Proof(leaf)
+	if err != nil || len(proof) != 0 || tree.Root() != leaf {
+		t.Errorf("root = %x, proof = %x, err = %v", tree.Root(), proof, err)
+	}
+}
+
+func TestUnknownLeaf(t *testing.T) {
+	tree := New(leaves(4))
+	if _, err := tree.Proof(Keccak([]byte("missing"))); err != ErrUnknownLeaf {
+		t.Errorf("err = %v", err)
+	}
+	if New(nil).Root() != (Hash{}) {
+		t.Error("empty tree has a root")
+	}
+}
+
+func TestKeccak(t *testing.T) {
+	// keccak256("") as used by Ethereum and Cairo's keccak syscall
+	want := "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
+	if got := Keccak(); hex.EncodeToString(got[:]) != want {
+		t.Errorf("Keccak() = %x", got)
+	}
+}
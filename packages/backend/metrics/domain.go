@@ -0,0 +1,31 @@
+package metrics
+
+// Domain counts the business events product dashboards are built on
+type Domain struct {
+	HabitsCreated   *Counter
+	CheckIns        *Counter
+	HabitsCompleted *Counter
+	WalletsCreated  *Counter
+	Upgrades        *Counter // Labelled by plan and source (strk, trial, promo, referral, role)
+	Achievements    *Counter // Achievement NFTs minted on-chain
+	RewardPoints    *Counter // AURA points, labelled by status (accrued, claimed)
+	IndexedEvents   *Counter // Contract events stored by the indexer, labelled by contract
+	OutboxFinished  *Counter // Outbox transactions finished, labelled by kind and status
+	WalletEvents    *Counter // Wallet security events, labelled by kind
+}
+
+// NewDomain registers the business event counters
+func NewDomain(r *Registry) *Domain {
+	return &Domain{
+		HabitsCreated:   r.Counter("aura_habits_created_total", "Habits created."),
+		CheckIns:        r.Counter("aura_habit_checkins_total", "Daily habit check-ins."),
+		HabitsCompleted: r.Counter("aura_habits_completed_total", "Habits that reached their goal."),
+		WalletsCreated:  r.Counter("aura_wallets_created_total", "Wallets created at first login."),
+		Upgrades:        r.Counter("aura_plan_upgrades_total", "Plans granted to users.", "plan", "source"),
+		Achievements:    r.Counter("aura_achievements_minted_total", "Achievement NFTs minted for completed habits."),
+		RewardPoints:    r.Counter("aura_reward_points_total", "AURA points accrued by check-ins and minted by claims.", "status"),
+		IndexedEvents:   r.Counter("aura_indexed_events_total", "Contract events stored by the indexer.", "contract"),
+		OutboxFinished:  r.Counter("aura_outbox_transactions_total", "Outbox transactions confirmed, reverted or failed.", "kind", "status"),
+		WalletEvents:    r.Counter("aura_wallet_security_events_total", "Wallet PIN changes and failures, key exports and rotations.", "kind"),
+	}
+}
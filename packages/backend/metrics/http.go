@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"aura-backend/httpx"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing
+// random paths cannot create unbounded series
+const unmatchedRoute = "unmatched"
+
+// InstrumentHandler counts requests and observes their latency per route
+// pattern. It must wrap the ServeMux, which records the matched pattern on
+// the request.
+func InstrumentHandler(r *Registry, next http.Handler) http.Handler {
+	requests := r.Counter("http_requests_total", "HTTP requests by route and status code.", "route", "code")
+	duration := r.Histogram("http_request_duration_seconds", "HTTP request latency by route.", DefaultBuckets, "route")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started := time.Now()
+		recorder := httpx.NewStatusRecorder(w)
+
+		next.ServeHTTP(recorder, req)
+
+		route := req.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		requests.Inc(route, strconv.Itoa(recorder.Status))
+		duration.Observe(time.Since(started).Seconds(), route)
+	})
+}
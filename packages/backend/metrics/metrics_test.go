@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	checkins := r.Counter("checkins_total", "Check-ins.")
+	upgrades := r.Counter("upgrades_total", "Upgrades.", "plan", "source")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	r.GaugeFunc("pool_idle", "Idle connections.", func() float64 { return 3 })
+
+	upgrades.Inc("pro", "strk")
+	upgrades.Add(2, "pro", `tr"ial`)
+	latency.Observe(0.05, "GET /api/habits")
+	latency.Observe(0.5, "GET /api/habits")
+	latency.Observe(5, "GET /api/habits")
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP checkins_total Check-ins.
+# TYPE checkins_total counter
+checkins_total 0
+# HELP upgrades_total Upgrades.
+# TYPE upgrades_total counter
+upgrades_total{plan="pro",source="strk"} 1
+upgrades_total{plan="pro",source="tr\"ial"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="GET /api/habits",le="0.1"} 1
+latency_seconds_bucket{route="GET /api/habits",le="1"} 2
+latency_seconds_bucket{route="GET /api/habits",le="+Inf"} 3
+latency_seconds_sum{route="GET /api/habits"} 5.55
+latency_seconds_count{route="GET /api/habits"} 3
+# HELP pool_idle Idle connections.
+# TYPE pool_idle gauge
+pool_idle 3
+`
+	if out.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	checkins.Inc()
+	if got := checkins.Value(); got != 1 {
+		t.Errorf("Value() = %v, want 1", got)
+	}
+}
+
+func TestNilMetricsIgnoreUpdates(t *testing.T) {
+	var counter *Counter
+	var histogram *Histogram
+	counter.Inc("pro", "strk")
+	histogram.Observe(1)
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	r := NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/habits/{habitId}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	handler := InstrumentHandler(r, mux)
+
+	for _, path := range []string{"/api/habits/1", "/api/habits/2", "/random"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	var out strings.Builder
+	r.Write(&out)
+
+	// Requests are grouped by route pattern rather than by path
+	for _, line := range []string{
+		`http_requests_total{route="GET /api/habits/{habitId}",code="404"} 2`,
+		`http_requests_total{route="unmatched",code="404"} 1`,
+		`http_request_duration_seconds_count{route="GET /api/habits/{habitId}"} 2`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package outbox sends the on-chain transactions queued with domain changes.
+// Transactions are written in the same database transaction as the change
+// that triggers them, so they are not lost when the process dies before
+// sending them, then submitted from the operator account and followed until
+// their receipt.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/outbox")
+
+// batchSize bounds the transactions handled per poll
+const batchSize = 20
+
+// Config configures the outbox worker
+type Config struct {
+	PollInterval  time.Duration
+	MaxAttempts   int           // Submissions tried before a transaction fails
+	RetryBackoff  time.Duration // Delay before the first retry, doubled after each attempt
+	MaxBackoff    time.Duration // Longest delay between retries
+	ResubmitAfter time.Duration // Unknown transactions older than this are sent again
+}
+
+// ReceiptReader is the subset of the Starknet RPC used to follow transactions
+type ReceiptReader interface {
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Handler applies the progress of the transactions of a kind to the records
+// they were queued for. It is called after each status change, with the
+// receipt once the transaction is included, and may be called again with the
+// same status when saving the transaction fails.
+type Handler interface {
+	TransactionUpdated(ctx context.Context, tx *store.OutboxTransaction, receipt *starknet.Receipt) error
+}
+
+// Worker submits queued transactions and checks the receipts of submitted
+// ones. Transient errors of the node are retried with exponential backoff;
+// transactions the node rejects fail at once.
+type Worker struct {
+	Store    store.OutboxStore
+	Sender   starknet.Sender
+	Chain    ReceiptReader
+	Config   Config
+	Handlers map[string]Handler // By transaction kind, optional
+
+	Finished *metrics.Counter // Counts finished transactions by kind and status, optional
+
+	now func() time.Time
+}
+
+// NewWorker creates the outbox worker
+func NewWorker(s store.OutboxStore, sender starknet.Sender, chain ReceiptReader, config Config) *Worker {
+	return &Worker{Store: s, Sender: sender, Chain: chain, Config: config, Handlers: map[string]Handler{}, now: time.Now}
+}
+
+// NewTransaction builds a queued transaction executing calls, due now
+func NewTransaction(userID, kind, reference string, calls []starknet.FunctionCall, now time.Time) (*store.OutboxTransaction, error) {
+	encoded, err := json.Marshal(calls)
+	if err != nil {
+		return nil, err
+	}
+	return &store.OutboxTransaction{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		Kind:          kind,
+		Reference:     reference,
+		Calls:         encoded,
+		Status:        store.OutboxQueued,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// Run processes the outbox every poll interval until the context is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("Transaction outbox started")
+
+	ticker := time.NewTicker(w.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process transaction outbox", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process submits due transactions and checks the receipts of submitted ones
+func (w *Worker) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "outbox.process")
+	defer func() { tracing.End(span, err) }()
+
+	pending, err := w.Store.PendingOutbox(ctx, w.now(), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		tx := &pending[i]
+		switch tx.Status {
+		case store.OutboxQueued:
+			err = w.submit(ctx, tx)
+		case store.OutboxSubmitted:
+			err = w.confirm(ctx, tx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit sends a queued transaction
+func (w *Worker) submit(ctx context.Context, tx *store.OutboxTransaction) error {
+	var calls []starknet.FunctionCall
+	if err := json.Unmarshal(tx.Calls, &calls); err != nil {
+		return w.finish(ctx, tx, store.OutboxFailed, fmt.Sprintf("invalid calls: %v", err), nil)
+	}
+
+	txHash, err := w.Sender.Invoke(ctx, calls)
+	tx.Attempts++
+	if err != nil {
+		slog.Warn("Failed to submit outbox transaction", "outbox_id", tx.ID, "kind", tx.Kind, "attempt", tx.Attempts, logging.Err(err))
+		if !starknet.IsTransient(err) || tx.Attempts >= w.Config.MaxAttempts {
+			return w.finish(ctx, tx, store.OutboxFailed, err.Error(), nil)
+		}
+		tx.LastError = err.Error()
+		tx.NextAttemptAt = w.now().Add(w.backoff(tx.Attempts))
+		tx.UpdatedAt = w.now()
+		return w.Store.UpdateOutbox(ctx, tx)
+	}
+
+	tx.Status = store.OutboxSubmitted
+	tx.TransactionHash = &txHash
+	tx.LastError = ""
+	tx.UpdatedAt = w.now()
+	if err := w.Store.UpdateOutbox(ctx, tx); err != nil {
+		return err
+	}
+	// The hash is saved: a failing handler only delays the record's status
+	// until the receipt
+	if err := w.notify(ctx, tx, nil); err != nil {
+		slog.Warn("Failed to update the record of a submitted transaction", "outbox_id", tx.ID, "kind", tx.Kind, logging.Err(err))
+	}
+	return nil
+}
+
+// confirm checks the receipt of a submitted transaction
+func (w *Worker) confirm(ctx context.Context, tx *store.OutboxTransaction) error {
+	receipt, err := w.Chain.GetTransactionReceipt(ctx, *tx.TransactionHash)
+	if starknet.IsNotFound(err) {
+		// The transaction may have been dropped from the mempool
+		if w.now().Sub(tx.UpdatedAt) > w.Config.ResubmitAfter {
+			tx.Status = store.OutboxQueued
+			tx.LastError = "transaction not found"
+			tx.NextAttemptAt = w.now()
+			tx.UpdatedAt = w.now()
+			return w.Store.UpdateOutbox(ctx, tx)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Reverted transactions are charged too
+	tx.Fee = fee(receipt)
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return w.finish(ctx, tx, store.OutboxReverted, "reverted: "+receipt.RevertReason, receipt)
+	}
+	return w.finish(ctx, tx, store.OutboxConfirmed, "", receipt)
+}
+
+// finish records the final status of a transaction. The handler runs first
+// so that it is called again if saving fails.
+func (w *Worker) finish(ctx context.Context, tx *store.OutboxTransaction, status, reason string, receipt *starknet.Receipt) error {
+	tx.Status = status
+	tx.LastError = reason
+	tx.UpdatedAt = w.now()
+	if err := w.notify(ctx, tx, receipt); err != nil {
+		return fmt.Errorf("outbox transaction %s: %w", tx.ID, err)
+	}
+	if err := w.Store.UpdateOutbox(ctx, tx); err != nil {
+		return err
+	}
+
+	w.Finished.Inc(tx.Kind, status)
+	if status == store.OutboxConfirmed {
+		slog.Info("Outbox transaction confirmed", "outbox_id", tx.ID, "kind", tx.Kind, "transaction_hash", *tx.TransactionHash)
+	} else {
+		slog.Error("Outbox transaction "+status, "outbox_id", tx.ID, "kind", tx.Kind, "reason", reason)
+	}
+	return nil
+}
+
+func (w *Worker) notify(ctx context.Context, tx *store.OutboxTransaction, receipt *starknet.Receipt) error {
+	handler, ok := w.Handlers[tx.Kind]
+	if !ok {
+		return nil
+	}
+	return handler.TransactionUpdated(ctx, tx, receipt)
+}
+
+// fee returns the fee paid for an included transaction in FRI, empty when
+// the node did not report it in FRI
+func fee(receipt *starknet.Receipt) string {
+	if receipt.ActualFee == nil || receipt.ActualFee.Unit != "FRI" {
+		return ""
+	}
+	amount, err := starknet.ParseFelt(receipt.ActualFee.Amount)
+	if err != nil {
+		return ""
+	}
+	return amount.String()
+}
+
+// backoff returns the delay before the retry following an attempt
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.Config.RetryBackoff
+	for i := 1; i < attempts && delay < w.Config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, w.Config.MaxBackoff)
+}
@@ -0,0 +1,255 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/starknet/starknettest"
+	"aura-backend/store"
+)
+
+const habitID = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+
+// recorder is a Handler recording the statuses it is notified of
+type recorder struct {
+	statuses []string
+	receipts []*starknet.Receipt
+}
+
+func (r *recorder) TransactionUpdated(ctx context.Context, tx *store.OutboxTransaction, receipt *starknet.Receipt) error {
+	r.statuses = append(r.statuses, tx.Status)
+	r.receipts = append(r.receipts, receipt)
+	return nil
+}
+
+// enqueue saves a habit's progress with a queued transaction, as the
+// controller does on completion
+func enqueue(t *testing.T, s *store.Memory, now time.Time) *store.OutboxTransaction {
+	t.Helper()
+	ctx := context.Background()
+
+	habit := &store.Habit{ID: habitID, UserID: "user-1", Name: "Read", GoalDays: 7, CreatedAt: now}
+	if err := s.CreateHabit(ctx, habit); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := NewTransaction("user-1", "test", habitID, []starknet.FunctionCall{{
+		ContractAddress:    "0xabc",
+		EntryPointSelector: starknet.SelectorFromName("mint"),
+		Calldata:           []string{"0x1"},
+	}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit.Completed = true
+	if err := s.SaveHabitProgress(ctx, habit, nil, []store.OutboxTransaction{*tx}); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func newTestWorker(s *store.Memory, sender *starknettest.Sender, chain ReceiptReader, now *time.Time) (*Worker, *recorder) {
+	worker := NewWorker(s, sender, chain, Config{
+		PollInterval:  time.Second,
+		MaxAttempts:   3,
+		RetryBackoff:  time.Minute,
+		MaxBackoff:    90 * time.Second,
+		ResubmitAfter: 10 * time.Minute,
+	})
+	worker.now = func() time.Time { return *now }
+	handler := &recorder{}
+	worker.Handlers["test"] = handler
+	return worker, handler
+}
+
+func listOutbox(t *testing.T, s *store.Memory) store.OutboxTransaction {
+	t.Helper()
+	list, err := s.ListOutbox(context.Background(), "user-1", 10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListOutbox() = %+v, %v", list, err)
+	}
+	return list[0]
+}
+
+func TestOutboxConfirms(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	s := store.NewMemory()
+	enqueue(t, s, now)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xfeed": map[string]interface{}{
+			"transaction_hash": "0xfeed",
+			"execution_status": starknet.ExecutionSucceeded,
+			"finality_status":  starknet.FinalityAcceptedL2,
+			"actual_fee":       map[string]string{"amount": "0x2386f26fc10000", "unit": "FRI"},
+		},
+	})
+	sender := &starknettest.Sender{TxHash: "0xfeed"}
+	worker, handler := newTestWorker(s, sender, chain, &now)
+
+	// The first pass submits the transaction
+	if err := worker.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tx := listOutbox(t, s)
+	if len(sender.Calls) != 1 || tx.Status != store.OutboxSubmitted || *tx.TransactionHash != "0xfeed" || tx.Attempts != 1 {
+		t.Fatalf("after submit: %+v", tx)
+	}
+
+	// The second reads the receipt
+	if err := worker.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tx := listOutbox(t, s); tx.Status != store.OutboxConfirmed || tx.Fee != "10000000000000000" {
+		t.Fatalf("after receipt: %+v", tx)
+	}
+	if spent, err := s.SponsoredFees(ctx, "user-1", now); err != nil || spent.String() != "10000000000000000" {
+		t.Errorf("SponsoredFees() = %v, %v", spent, err)
+	}
+	if len(handler.statuses) != 2 || handler.statuses[1] != store.OutboxConfirmed || handler.receipts[1] == nil {
+		t.Errorf("handler notified of %v", handler.statuses)
+	}
+
+	// Confirmed transactions are not pending anymore
+	worker.Process(ctx)
+	if len(sender.Calls) != 1 || len(handler.statuses) != 2 {
+		t.Errorf("confirmed transaction processed again")
+	}
+}
+
+func TestOutboxRetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	s := store.NewMemory()
+	enqueue(t, s, now)
+
+	busy := &starknet.RPCError{Code: starknet.ErrCodeInternal, Message: "Internal error"}
+	sender := &starknettest.Sender{TxHash: "0xfeed", Errs: []error{busy, busy}}
+	worker, _ := newTestWorker(s, sender, starknettest.NewNode(t, nil), &now)
+
+	worker.Process(ctx)
+	tx := listOutbox(t, s)
+	if tx.Status != store.OutboxQueued || tx.Attempts != 1 || !tx.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("after first failure: %+v", tx)
+	}
+
+	// Nothing is sent before the backoff elapses
+	worker.Process(ctx)
+	if len(sender.Calls) != 1 {
+		t.Fatalf("retried before the backoff: %d calls", len(sender.Calls))
+	}
+
+	// The backoff doubles up to its maximum
+	now = now.Add(time.Minute)
+	worker.Process(ctx)
+	if tx := listOutbox(t, s); tx.Attempts != 2 || !tx.NextAttemptAt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("after second failure: %+v", tx)
+	}
+
+	now = now.Add(90 * time.Second)
+	worker.Process(ctx)
+	if tx := listOutbox(t, s); tx.Status != store.OutboxSubmitted || tx.LastError != "" {
+		t.Fatalf("after recovery: %+v", tx)
+	}
+}
+
+func TestOutboxFails(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+
+	t.Run("rejected", func(t *testing.T) {
+		s := store.NewMemory()
+		enqueue(t, s, now)
+		rejected := &starknet.RPCError{Code: 41, Message: "Transaction execution error"}
+		worker, handler := newTestWorker(s, &starknettest.Sender{Errs: []error{rejected}}, starknettest.NewNode(t, nil), &now)
+
+		worker.Process(ctx)
+		if tx := listOutbox(t, s); tx.Status != store.OutboxFailed || tx.Attempts != 1 {
+			t.Fatalf("rejected transaction: %+v", tx)
+		}
+		if len(handler.statuses) != 1 || handler.statuses[0] != store.OutboxFailed {
+			t.Errorf("handler notified of %v", handler.statuses)
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		s := store.NewMemory()
+		enqueue(t, s, now)
+		down := errors.New("connection refused")
+		worker, _ := newTestWorker(s, &starknettest.Sender{Errs: []error{down, down, down}}, starknettest.NewNode(t, nil), &now)
+
+		for i := 0; i < 3; i++ {
+			worker.Process(ctx)
+			now = now.Add(time.Hour)
+		}
+		if tx := listOutbox(t, s); tx.Status != store.OutboxFailed || tx.Attempts != 3 || tx.LastError != "connection refused" {
+			t.Fatalf("after max attempts: %+v", tx)
+		}
+	})
+
+	t.Run("reverted", func(t *testing.T) {
+		s := store.NewMemory()
+		enqueue(t, s, now)
+		chain := starknettest.NewNode(t, map[string]interface{}{
+			"0xbad": map[string]interface{}{
+				"transaction_hash": "0xbad",
+				"execution_status": starknet.ExecutionReverted,
+				"finality_status":  starknet.FinalityAcceptedL2,
+				"revert_reason":    "Caller is not the minter",
+			},
+		})
+		worker, _ := newTestWorker(s, &starknettest.Sender{TxHash: "0xbad"}, chain, &now)
+
+		worker.Process(ctx)
+		worker.Process(ctx)
+		if tx := listOutbox(t, s); tx.Status != store.OutboxReverted || tx.LastError != "reverted: Caller is not the minter" {
+			t.Fatalf("reverted transaction: %+v", tx)
+		}
+	})
+}
+
+func TestOutboxResubmitsDroppedTransaction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	s := store.NewMemory()
+	enqueue(t, s, now)
+
+	sender := &starknettest.Sender{TxHash: "0xlost"}
+	worker, _ := newTestWorker(s, sender, starknettest.NewNode(t, nil), &now)
+
+	worker.Process(ctx)
+	worker.Process(ctx)
+	if tx := listOutbox(t, s); tx.Status != store.OutboxSubmitted {
+		t.Fatalf("unknown transaction requeued too early: %+v", tx)
+	}
+
+	now = now.Add(11 * time.Minute)
+	worker.Process(ctx)
+	if tx := listOutbox(t, s); tx.Status != store.OutboxQueued || tx.LastError != "transaction not found" {
+		t.Fatalf("dropped transaction: %+v", tx)
+	}
+}
+
+func TestSaveHabitProgressQueuesOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	s := store.NewMemory()
+	first := enqueue(t, s, now)
+
+	again, _ := NewTransaction("user-1", "test", habitID, nil, now)
+	habit, _ := s.GetHabit(ctx, "user-1", habitID)
+	if err := s.SaveHabitProgress(ctx, habit, nil, []store.OutboxTransaction{*again}); err != nil {
+		t.Fatal(err)
+	}
+	if tx := listOutbox(t, s); tx.ID != first.ID {
+		t.Errorf("queued %s, want the first transaction %s", tx.ID, first.ID)
+	}
+
+	unknown := &store.Habit{ID: "2b1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f", UserID: "user-1"}
+	if err := s.SaveHabitProgress(ctx, unknown, nil, nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown habit: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package plans
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Plan describes the limits and perks attached to a subscription tier
+type Plan struct {
+	Name               string  `json:"name"`
+	HabitLimit         int     `json:"habitLimit"`          // Maximum number of active (not completed) habits
+	MaxGoalDays        int     `json:"maxGoalDays"`         // Longest goal a habit can be created with
+	StatsHistoryDays   int     `json:"statsHistoryDays"`    // How far back statistics can be queried
+	RewardMultiplier   float64 `json:"rewardMultiplier"`    // Multiplier applied to on-chain rewards
+	SponsoredGasBudget uint64  `json:"sponsoredGasBudget"`  // Gas paid by the backend per SponsoredGasPeriod, in FRI
+	PriceStrk          string  `json:"priceStrk,omitempty"` // Price per billing period in STRK, empty if not sold for STRK
+	BillingPeriodDays  int     `json:"billingPeriodDays,omitempty"`
+}
+
+// SponsoredGasPeriod is the rolling window the sponsored gas budget covers
+const SponsoredGasPeriod = 30 * 24 * time.Hour
+
+// PurchasableWithStrk reports whether the plan can be bought with an on-chain STRK payment
+func (p Plan) PurchasableWithStrk() bool {
+	return p.PriceStrk != "" && p.BillingPeriodDays > 0
+}
+
+// Entitlements are the effective permissions of a user, resolved from their plan
+type Entitlements struct {
+	Plan
+}
+
+// CanCreateHabit reports whether a user with activeHabits active habits may create another one
+func (e Entitlements) CanCreateHabit(activeHabits int) bool {
+	return activeHabits < e.HabitLimit
+}
+
+// AllowsGoal reports whether a habit goal of the given length is allowed by the plan
+func (e Entitlements) AllowsGoal(goalDays int) bool {
+	return goalDays > 0 && goalDays <= e.MaxGoalDays
+}
+
+// StatsSince returns the oldest time the plan shows statistics from
+func (e Entitlements) StatsSince(now time.Time) time.Time {
+	return now.AddDate(0, 0, -e.StatsHistoryDays)
+}
+
+// CanSponsor reports whether the backend still pays the gas of a user whose
+// transactions cost spent FRI over the last SponsoredGasPeriod
+func (e Entitlements) CanSponsor(spent *big.Int) bool {
+	return spent.Cmp(new(big.Int).SetUint64(e.SponsoredGasBudget)) < 0
+}
+
+// DefaultGoalDays is the goal used when a habit is created without an explicit one
+const DefaultGoalDays = 7
+
+// Catalog holds every plan known to the backend, indexed by name
+type Catalog struct {
+	plans       map[string]Plan
+	defaultPlan string
+}
+
+// catalogFile is the on-disk representation of a plan catalog
+type catalogFile struct {
+	Default string `json:"default"`
+	Plans   []Plan `json:"plans"`
+}
+
+// DefaultCatalog returns the built-in free and pro plans
+func DefaultCatalog() *Catalog {
+	catalog, _ := newCatalog("free", []Plan{
+		{
+			Name:               "free",
+			HabitLimit:         1,
+			MaxGoalDays:        7,
+			StatsHistoryDays:   7,
+			RewardMultiplier:   1,
+			SponsoredGasBudget: 100000000000000000, // 0.1 STRK
+		},
+		{
+			Name:               "pro",
+			HabitLimit:         5,
+			MaxGoalDays:        30,
+			StatsHistoryDays:   365,
+			RewardMultiplier:   2,
+			SponsoredGasBudget: 1000000000000000000, // 1 STRK
+			PriceStrk:          "10",
+			BillingPeriodDays:  30,
+		},
+	})
+	return catalog
+}
+
+// Load reads a plan catalog from a JSON file
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse plans file %s: %v", path, err)
+	}
+
+	return newCatalog(file.Default, file.Plans)
+}
+
+// LoadOrDefault loads the catalog from a file, falling back to the built-in
+// plans when no file is configured
+func LoadOrDefault(path string) (*Catalog, error) {
+	if path == "" {
+		slog.Info("PLANS_FILE not set, using built-in plans")
+		return DefaultCatalog(), nil
+	}
+
+	catalog, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Loaded plans", "count", len(catalog.plans), "path", path)
+	return catalog, nil
+}
+
+func newCatalog(defaultPlan string, plans []Plan) (*Catalog, error) {
+	catalog := &Catalog{
+		plans:       make(map[string]Plan, len(plans)),
+		defaultPlan: normalizeName(defaultPlan),
+	}
+
+	for _, p := range plans {
+		p.Name = normalizeName(p.Name)
+		if p.Name == "" {
+			return nil, fmt.Errorf("plan without a name")
+		}
+		if _, exists := catalog.plans[p.Name]; exists {
+			return nil, fmt.Errorf("duplicate plan %q", p.Name)
+		}
+		if p.HabitLimit < 0 || p.MaxGoalDays < 1 || p.StatsHistoryDays < 0 || p.RewardMultiplier < 0 || p.BillingPeriodDays < 0 {
+			return nil, fmt.Errorf("plan %q has invalid limits", p.Name)
+		}
+		catalog.plans[p.Name] = p
+	}
+
+	if _, ok := catalog.plans[catalog.defaultPlan]; !ok {
+		return nil, fmt.Errorf("default plan %q is not defined", defaultPlan)
+	}
+
+	return catalog, nil
+}
+
+// Get returns the plan with the given name
+func (c *Catalog) Get(name string) (Plan, bool) {
+	p, ok := c.plans[normalizeName(name)]
+	return p, ok
+}
+
+// Default returns the plan assigned to users without a known role
+func (c *Catalog) Default() Plan {
+	return c.plans[c.defaultPlan]
+}
+
+// Has reports whether a plan with the given name exists
+func (c *Catalog) Has(name string) bool {
+	_, ok := c.Get(name)
+	return ok
+}
+
+// Entitlements resolves the entitlements of a user holding the given role.
+// Unknown roles fall back to the default plan.
+func (c *Catalog) Entitlements(role string) Entitlements {
+	p, ok := c.Get(role)
+	if !ok {
+		p = c.Default()
+	}
+	return Entitlements{Plan: p}
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
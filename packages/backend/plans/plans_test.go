@@ -0,0 +1,131 @@
+package plans
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCatalog(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plans.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOrDefault(t *testing.T) {
+	catalog, err := LoadOrDefault("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Default().Name != "free" {
+		t.Errorf("default plan = %q, want free", catalog.Default().Name)
+	}
+
+	path := writeCatalog(t, `{
+		"default": "Basic",
+		"plans": [
+			{"name": "basic", "habitLimit": 2, "maxGoalDays": 14, "rewardMultiplier": 1},
+			{"name": " Team ", "habitLimit": 20, "maxGoalDays": 90, "rewardMultiplier": 2.5, "priceStrk": "40", "billingPeriodDays": 30}
+		]
+	}`)
+	catalog, err = LoadOrDefault(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Default().Name != "basic" || catalog.Default().HabitLimit != 2 {
+		t.Errorf("default plan = %+v", catalog.Default())
+	}
+	team, ok := catalog.Get("TEAM")
+	if !ok || !team.PurchasableWithStrk() {
+		t.Errorf("team plan = %+v, %v", team, ok)
+	}
+	if catalog.Has("pro") {
+		t.Error("a loaded catalog does not include the built-in plans")
+	}
+	if got := catalog.Entitlements("pro").Name; got != "basic" {
+		t.Errorf("unknown role resolves to %q, want the default plan", got)
+	}
+}
+
+func TestLoadOrDefaultErrors(t *testing.T) {
+	if _, err := LoadOrDefault(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file loaded")
+	}
+
+	for name, content := range map[string]string{
+		"not json":          `plans:`,
+		"unknown default":   `{"default": "gold", "plans": [{"name": "free", "maxGoalDays": 7}]}`,
+		"duplicate plan":    `{"default": "free", "plans": [{"name": "free", "maxGoalDays": 7}, {"name": "FREE", "maxGoalDays": 7}]}`,
+		"plan without name": `{"default": "free", "plans": [{"name": "free", "maxGoalDays": 7}, {"name": " ", "maxGoalDays": 7}]}`,
+		"no goal":           `{"default": "free", "plans": [{"name": "free", "maxGoalDays": 0}]}`,
+		"negative limit":    `{"default": "free", "plans": [{"name": "free", "habitLimit": -1, "maxGoalDays": 7}]}`,
+		"negative history":  `{"default": "free", "plans": [{"name": "free", "maxGoalDays": 7, "statsHistoryDays": -1}]}`,
+	} {
+		if _, err := LoadOrDefault(writeCatalog(t, content)); err == nil {
+			t.Errorf("%s: catalog loaded", name)
+		}
+	}
+}
+
+func TestCanCreateHabit(t *testing.T) {
+	free := DefaultCatalog().Entitlements("free")
+	if !free.CanCreateHabit(0) {
+		t.Error("free plan refuses a first habit")
+	}
+	if free.CanCreateHabit(1) {
+		t.Error("free plan allows a second active habit")
+	}
+
+	pro := DefaultCatalog().Entitlements("pro")
+	if !pro.CanCreateHabit(4) || pro.CanCreateHabit(5) {
+		t.Errorf("pro plan limit is not %d habits", pro.HabitLimit)
+	}
+
+	none := Entitlements{Plan: Plan{HabitLimit: 0}}
+	if none.CanCreateHabit(0) {
+		t.Error("plan without habits allows one")
+	}
+}
+
+func TestAllowsGoal(t *testing.T) {
+	free := DefaultCatalog().Entitlements("free")
+	for goal, want := range map[int]bool{-1: false, 0: false, 1: true, DefaultGoalDays: true, 8: false} {
+		if got := free.AllowsGoal(goal); got != want {
+			t.Errorf("free AllowsGoal(%d) = %v, want %v", goal, got, want)
+		}
+	}
+	if !DefaultCatalog().Entitlements("pro").AllowsGoal(30) {
+		t.Error("pro plan refuses a 30 day goal")
+	}
+}
+
+func TestStatsSince(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	if got := DefaultCatalog().Entitlements("free").StatsSince(now); !got.Equal(time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("free StatsSince = %v, want a week ago", got)
+	}
+	if got := DefaultCatalog().Entitlements("pro").StatsSince(now); !got.Equal(now.AddDate(-1, 0, 0)) {
+		t.Errorf("pro StatsSince = %v, want a year ago", got)
+	}
+}
+
+func TestCanSponsor(t *testing.T) {
+	free := DefaultCatalog().Entitlements("free")
+	budget := new(big.Int).SetUint64(free.SponsoredGasBudget)
+	if !free.CanSponsor(big.NewInt(0)) || !free.CanSponsor(new(big.Int).Sub(budget, big.NewInt(1))) {
+		t.Error("free plan refuses gas within its budget")
+	}
+	if free.CanSponsor(budget) {
+		t.Error("free plan sponsors gas past its budget")
+	}
+
+	none := Entitlements{Plan: Plan{SponsoredGasBudget: 0}}
+	if none.CanSponsor(big.NewInt(0)) {
+		t.Error("plan without a budget sponsors gas")
+	}
+}
@@ -0,0 +1,211 @@
+// Package portfolio reads the ERC-20 balances of users' wallets and values
+// them in USD. Balances and prices are cached for a short time so that
+// pages polling the portfolio do not hit the node and the price API on
+// every request.
+package portfolio
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/tracing"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/portfolio")
+
+var balanceOfSelector = starknet.SelectorFromName("balance_of")
+
+// DefaultEthTokenAddress is the ETH ERC-20 contract, at the same address on
+// mainnet and Sepolia
+const DefaultEthTokenAddress = "0x049d36570d4e46f48e99674bd3fcc84644ddd6b96f7c741b1562b82f9e004dc7"
+
+// DefaultPriceURL is CoinGecko's simple price endpoint, as used by the
+// frontend's /api/price route
+const DefaultPriceURL = "https://api.coingecko.com/api/v3/simple/price"
+
+// Token is an ERC-20 token held in wallets
+type Token struct {
+	Symbol   string
+	Address  string
+	Decimals int
+	PriceID  string // CoinGecko id of the token, valued at 0 when empty
+}
+
+// Config configures the portfolio
+type Config struct {
+	Tokens     []Token
+	PriceURL   string
+	BalanceTTL time.Duration // How long the balances of a wallet are reused
+	PriceTTL   time.Duration // How long prices are reused
+}
+
+// BalanceReader is the subset of the Starknet RPC used to read balances
+type BalanceReader interface {
+	CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error)
+}
+
+// TokenBalance is the balance of one token in a wallet
+type TokenBalance struct {
+	Symbol       string  `json:"symbol"`
+	TokenAddress string  `json:"tokenAddress"`
+	Decimals     int     `json:"decimals"`
+	Balance      string  `json:"balance"`   // In the token's smallest unit
+	Formatted    string  `json:"formatted"` // In tokens
+	PriceUSD     float64 `json:"priceUsd"`
+	ValueUSD     float64 `json:"valueUsd"`
+}
+
+// Balances are the token balances of a wallet and their total value
+type Balances struct {
+	WalletAddress string         `json:"walletAddress"`
+	Tokens        []TokenBalance `json:"tokens"`
+	TotalUSD      float64        `json:"totalUsd"`
+	UpdatedAt     time.Time      `json:"updatedAt"` // When the balances were read
+}
+
+// cachedBalances are the raw balances of a wallet, in the order of the
+// configured tokens
+type cachedBalances struct {
+	amounts []*big.Int
+	readAt  time.Time
+}
+
+// Portfolio reads wallet balances through the node and prices through the
+// price API. It is safe for concurrent use.
+type Portfolio struct {
+	Chain  BalanceReader
+	HTTP   *http.Client
+	Config Config
+
+	mu       sync.Mutex
+	balances map[string]cachedBalances // By normalized wallet address
+
+	// priceMu is held while fetching prices, so requests arriving meanwhile
+	// wait for them rather than fetching them again
+	priceMu  sync.Mutex
+	prices   map[string]float64 // By price id
+	pricedAt time.Time
+
+	now func() time.Time
+}
+
+// NewPortfolio creates the portfolio
+func NewPortfolio(chain BalanceReader, config Config) *Portfolio {
+	return &Portfolio{
+		Chain:    chain,
+		HTTP:     &http.Client{Timeout: 10 * time.Second},
+		Config:   config,
+		balances: map[string]cachedBalances{},
+		now:      time.Now,
+	}
+}
+
+// Balances returns the balances of a wallet valued at the current prices.
+// Prices that cannot be fetched are 0, as the frontend's price route
+// returns them; failing to read a balance fails the whole portfolio.
+func (p *Portfolio) Balances(ctx context.Context, walletAddress string) (balances *Balances, err error) {
+	ctx, span := tracer.Start(ctx, "portfolio.balances")
+	defer func() { tracing.End(span, err) }()
+
+	cached, err := p.readBalances(ctx, starknet.NormalizeAddress(walletAddress))
+	if err != nil {
+		return nil, err
+	}
+	prices := p.currentPrices(ctx)
+
+	balances = &Balances{WalletAddress: walletAddress, Tokens: []TokenBalance{}, UpdatedAt: cached.readAt}
+	for i, token := range p.Config.Tokens {
+		amount := cached.amounts[i]
+		price := prices[token.PriceID]
+		tokens, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(unit(token.Decimals))).Float64()
+
+		balances.Tokens = append(balances.Tokens, TokenBalance{
+			Symbol:       token.Symbol,
+			TokenAddress: token.Address,
+			Decimals:     token.Decimals,
+			Balance:      amount.String(),
+			Formatted:    FormatUnits(amount, token.Decimals),
+			PriceUSD:     price,
+			ValueUSD:     tokens * price,
+		})
+		balances.TotalUSD += tokens * price
+	}
+	return balances, nil
+}
+
+// readBalances returns the cached balances of a wallet, reading them from
+// the node once they expire
+func (p *Portfolio) readBalances(ctx context.Context, address string) (cachedBalances, error) {
+	p.mu.Lock()
+	cached, ok := p.balances[address]
+	p.mu.Unlock()
+	if ok && p.now().Sub(cached.readAt) < p.Config.BalanceTTL {
+		return cached, nil
+	}
+
+	cached = cachedBalances{readAt: p.now()}
+	for _, token := range p.Config.Tokens {
+		amount, err := p.balanceOf(ctx, token, address)
+		if err != nil {
+			return cachedBalances{}, err
+		}
+		cached.amounts = append(cached.amounts, amount)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Drop the wallets nobody asked about lately, the cache would otherwise
+	// grow with every user
+	for key, entry := range p.balances {
+		if p.now().Sub(entry.readAt) >= p.Config.BalanceTTL {
+			delete(p.balances, key)
+		}
+	}
+	p.balances[address] = cached
+	return cached, nil
+}
+
+// balanceOf reads the u256 balance of a wallet from a token contract
+func (p *Portfolio) balanceOf(ctx context.Context, token Token, address string) (*big.Int, error) {
+	result, err := p.Chain.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    token.Address,
+		EntryPointSelector: balanceOfSelector,
+		Calldata:           []string{address},
+	}, starknet.LatestBlock)
+	if err != nil {
+		return nil, fmt.Errorf("%s balance: %w", token.Symbol, err)
+	}
+	if len(result) != 2 {
+		return nil, fmt.Errorf("%s balance: got %d felts, want a u256", token.Symbol, len(result))
+	}
+	amount, err := starknet.U256FromFelts(result[0], result[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s balance: %w", token.Symbol, err)
+	}
+	return amount, nil
+}
+
+// FormatUnits writes an amount in the smallest unit of a token as a decimal
+// number of tokens, without trailing zeros
+func FormatUnits(amount *big.Int, decimals int) string {
+	quo, rem := new(big.Int).QuoRem(amount, unit(decimals), new(big.Int))
+	if rem.Sign() == 0 {
+		return quo.String()
+	}
+	fraction := rem.String()
+	fraction = strings.Repeat("0", decimals-len(fraction)) + fraction
+	return quo.String() + "." + strings.TrimRight(fraction, "0")
+}
+
+// unit is one token of the given decimals in its smallest unit
+func unit(decimals int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
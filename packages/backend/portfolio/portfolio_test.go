@@ -0,0 +1,176 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+)
+
+const wallet = "0x0123"
+
+// fakeChain answers balance_of with the balances of each token
+type fakeChain struct {
+	balances map[string]*big.Int // By token address
+	calls    int
+	err      error
+}
+
+func (c *fakeChain) CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	if call.EntryPointSelector != balanceOfSelector || len(call.Calldata) != 1 || call.Calldata[0] != "0x123" {
+		return nil, errors.New("unexpected call")
+	}
+	low, high := starknet.U256ToFelts(c.balances[call.ContractAddress])
+	return []string{low, high}, nil
+}
+
+// priceServer answers like CoinGecko's simple price endpoint
+func priceServer(t *testing.T, requests *atomic.Int32, status int) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Query().Get("ids") != "ethereum,starknet" || r.URL.Query().Get("vs_currencies") != "usd" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ethereum":{"usd":2000},"starknet":{"usd":0.5}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func tokens() []Token {
+	return []Token{
+		{Symbol: "STRK", Address: "0xa", Decimals: 18, PriceID: "starknet"},
+		{Symbol: "ETH", Address: "0xb", Decimals: 18, PriceID: "ethereum"},
+		{Symbol: "AURA", Address: "0xc", Decimals: 18},
+	}
+}
+
+func newTestPortfolio(chain *fakeChain, priceURL string, now *time.Time) *Portfolio {
+	p := NewPortfolio(chain, Config{Tokens: tokens(), PriceURL: priceURL, BalanceTTL: 15 * time.Second, PriceTTL: time.Minute})
+	p.now = func() time.Time { return *now }
+	return p
+}
+
+func ether(s string) *big.Int {
+	value, _ := new(big.Int).SetString(s, 10)
+	return value
+}
+
+func TestBalances(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1736294400, 0)
+	var requests atomic.Int32
+	chain := &fakeChain{balances: map[string]*big.Int{
+		"0xa": ether("12500000000000000000"), // 12.5 STRK
+		"0xb": ether("10000000000000000"),    // 0.01 ETH
+		"0xc": ether("300000000000000000000"),
+	}}
+	p := newTestPortfolio(chain, priceServer(t, &requests, http.StatusOK), &now)
+
+	balances, err := p.Balances(ctx, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances.Tokens) != 3 || balances.WalletAddress != wallet || !balances.UpdatedAt.Equal(now) {
+		t.Fatalf("balances = %+v", balances)
+	}
+	strk, eth, aura := balances.Tokens[0], balances.Tokens[1], balances.Tokens[2]
+	if strk.Balance != "12500000000000000000" || strk.Formatted != "12.5" || strk.PriceUSD != 0.5 || strk.ValueUSD != 6.25 {
+		t.Errorf("STRK = %+v", strk)
+	}
+	if eth.Formatted != "0.01" || eth.ValueUSD != 20 {
+		t.Errorf("ETH = %+v", eth)
+	}
+	if aura.Formatted != "300" || aura.PriceUSD != 0 || aura.ValueUSD != 0 {
+		t.Errorf("AURA = %+v", aura)
+	}
+	if balances.TotalUSD != 26.25 {
+		t.Errorf("total = %v", balances.TotalUSD)
+	}
+
+	// Both are cached until they expire
+	chain.balances["0xa"] = ether("0")
+	p.Balances(ctx, wallet)
+	if chain.calls != 3 || requests.Load() != 1 {
+		t.Fatalf("cached portfolio read %d balances and %d prices", chain.calls, requests.Load())
+	}
+
+	now = now.Add(20 * time.Second)
+	balances, _ = p.Balances(ctx, wallet)
+	if chain.calls != 6 || requests.Load() != 1 || balances.Tokens[0].Balance != "0" {
+		t.Errorf("after the balance TTL: %d balance reads, %d price requests, %+v", chain.calls, requests.Load(), balances.Tokens[0])
+	}
+
+	now = now.Add(time.Minute)
+	p.Balances(ctx, wallet)
+	if requests.Load() != 2 {
+		t.Errorf("after the price TTL: %d price requests", requests.Load())
+	}
+}
+
+func TestBalancesWithoutPrices(t *testing.T) {
+	now := time.Unix(1736294400, 0)
+	var requests atomic.Int32
+	chain := &fakeChain{balances: map[string]*big.Int{"0xa": ether("1000000000000000000"), "0xb": ether("0"), "0xc": ether("0")}}
+	p := newTestPortfolio(chain, priceServer(t, &requests, http.StatusTooManyRequests), &now)
+
+	// Like the frontend's price route, an unavailable price values tokens at 0
+	balances, err := p.Balances(context.Background(), wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances.Tokens[0].Formatted != "1" || balances.Tokens[0].PriceUSD != 0 || balances.TotalUSD != 0 {
+		t.Errorf("balances = %+v", balances)
+	}
+}
+
+func TestBalancesNodeError(t *testing.T) {
+	now := time.Unix(1736294400, 0)
+	var requests atomic.Int32
+	chain := &fakeChain{err: &starknet.RPCError{Code: 20, Message: "Contract not found"}}
+	p := newTestPortfolio(chain, priceServer(t, &requests, http.StatusOK), &now)
+
+	if _, err := p.Balances(context.Background(), wallet); err == nil {
+		t.Fatal("Balances() succeeded while the node failed")
+	}
+
+	// Failures are not cached
+	chain.err = nil
+	chain.balances = map[string]*big.Int{"0xa": big.NewInt(1), "0xb": big.NewInt(0), "0xc": big.NewInt(0)}
+	if _, err := p.Balances(context.Background(), wallet); err != nil {
+		t.Errorf("Balances() after recovery error = %v", err)
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   *big.Int
+		decimals int
+		want     string
+	}{
+		{big.NewInt(0), 18, "0"},
+		{ether("1000000000000000000"), 18, "1"},
+		{big.NewInt(1), 18, "0.000000000000000001"},
+		{big.NewInt(123456), 3, "123.456"},
+		{big.NewInt(1200), 3, "1.2"},
+		{big.NewInt(42), 0, "42"},
+	}
+	for _, tt := range tests {
+		if got := FormatUnits(tt.amount, tt.decimals); got != tt.want {
+			t.Errorf("FormatUnits(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
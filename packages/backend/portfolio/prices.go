@@ -0,0 +1,80 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"aura-backend/logging"
+)
+
+// currentPrices returns the cached USD prices by price id, fetching them
+// once they expire. When the price API fails the last prices are kept, or
+// tokens are valued at 0, until the next expiry.
+func (p *Portfolio) currentPrices(ctx context.Context) map[string]float64 {
+	p.priceMu.Lock()
+	defer p.priceMu.Unlock()
+
+	if p.prices != nil && p.now().Sub(p.pricedAt) < p.Config.PriceTTL {
+		return p.prices
+	}
+
+	prices, err := p.fetchPrices(ctx)
+	if err != nil {
+		slog.Warn("Failed to fetch token prices", logging.Err(err))
+		if p.prices == nil {
+			p.prices = map[string]float64{}
+		}
+	} else {
+		p.prices = prices
+	}
+	p.pricedAt = p.now()
+	return p.prices
+}
+
+// fetchPrices asks the price API for the USD price of every priced token in
+// one request
+func (p *Portfolio) fetchPrices(ctx context.Context) (map[string]float64, error) {
+	var ids []string
+	for _, token := range p.Config.Tokens {
+		if token.PriceID != "" {
+			ids = append(ids, token.PriceID)
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]float64{}, nil
+	}
+	sort.Strings(ids)
+
+	query := url.Values{"ids": {strings.Join(ids, ",")}, "vs_currencies": {"usd"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Config.PriceURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price API response status: %d", res.StatusCode)
+	}
+
+	// {"ethereum":{"usd":3120.5},"starknet":{"usd":0.42}}
+	var body map[string]struct {
+		USD float64 `json:"usd"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("price API response: %w", err)
+	}
+	prices := make(map[string]float64, len(body))
+	for id, price := range body {
+		prices[id] = price.USD
+	}
+	return prices, nil
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from memory
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in the process. Limits are per instance, so use
+// Postgres when the API runs on several instances.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, policy Policy, now time.Time) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, now.Sub(b.updated), policy)
+	b.updated = now
+	b.policy = policy
+
+	if b.tokens < 1 {
+		return decide(false, b.tokens, policy), nil
+	}
+	b.tokens--
+	return decide(true, b.tokens, policy), nil
+}
+
+// sweep drops the buckets that have refilled, which behave like new ones
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if refill(b.tokens, now.Sub(b.updated), b.policy) >= float64(b.policy.Limit) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets in memory, for tests
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"aura-backend/apierror"
+	"aura-backend/logging"
+	"aura-backend/metrics"
+)
+
+// Limiter limits requests per route and client
+type Limiter struct {
+	Store Store
+	// Key identifies the client of a request, such as "user:<id>" or "ip:<address>"
+	Key func(r *http.Request) string
+	// Rejected counts limited requests by route, it may be nil
+	Rejected *metrics.Counter
+}
+
+// Limit applies the policy to the handler of a route. Each route has its own
+// buckets. Requests are let through when the store fails, so that an outage
+// of the store does not take the API down.
+func (l *Limiter) Limit(policy Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Pattern + " " + l.Key(r)
+		decision, err := l.Store.Take(r.Context(), key, policy, time.Now())
+		if err != nil {
+			logging.FromRequest(r).Warn("Rate limit store failed, request not limited", logging.Err(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Headers of draft-ietf-httpapi-ratelimit-headers
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(decision.Reset))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.Limit, ceilSeconds(policy.Window)))
+
+		if !decision.Allowed {
+			l.Rejected.Inc(r.Pattern)
+			retryAfter := ceilSeconds(decision.RetryAfter)
+			header.Set("Retry-After", retryAfter)
+			apierror.Write(w, r, apierror.New(apierror.CodeRateLimited, "Too many requests, retry in "+retryAfter+" seconds"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds formats a duration in whole seconds, rounded up so that clients
+// retrying on time find a token
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// ClientIP returns the address of the client. Behind a reverse proxy, set
+// trustProxy to use the last address of X-Forwarded-For, the one added by
+// the proxy, since earlier entries can be forged by the client.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
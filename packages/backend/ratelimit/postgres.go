@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"aura-backend/logging"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres keeps buckets in the rate_limits table so that every instance
+// shares them. Each take is a single statement.
+type Postgres struct {
+	db *pgxpool.Pool
+	// Retention is how long idle buckets are kept. It must be longer than the
+	// longest policy window, after which a bucket is full anyway.
+	Retention time.Duration
+}
+
+// NewPostgres creates a store backed by the given connection pool
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db, Retention: 24 * time.Hour}
+}
+
+// takeQuery refills the bucket and takes a token in one statement. No row is
+// returned when the bucket is empty, the row is then left untouched.
+const takeQuery = `
+INSERT INTO rate_limits AS b (key, tokens, updated_at)
+VALUES ($1, $2::float8 - 1, $3)
+ON CONFLICT (key) DO UPDATE
+SET tokens = LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM $3::timestamptz - b.updated_at)::float8, 0) * $4::float8) - 1,
+    updated_at = $3
+WHERE LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM $3::timestamptz - b.updated_at)::float8, 0) * $4::float8) >= 1
+RETURNING tokens`
+
+func (p *Postgres) Take(ctx context.Context, key string, policy Policy, now time.Time) (Decision, error) {
+	var tokens float64
+	err := p.db.QueryRow(ctx, takeQuery, key, float64(policy.Limit), now, policy.rate()).Scan(&tokens)
+	if err == nil {
+		return decide(true, tokens, policy), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Decision{}, err
+	}
+
+	// The bucket is empty, read it to tell the client when to retry
+	var updated time.Time
+	err = p.db.QueryRow(ctx, "SELECT tokens, updated_at FROM rate_limits WHERE key = $1", key).Scan(&tokens, &updated)
+	if err != nil {
+		return Decision{}, err
+	}
+	return decide(false, refill(tokens, now.Sub(updated), policy), policy), nil
+}
+
+// Prune deletes the buckets idle for longer than the retention
+func (p *Postgres) Prune(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := p.db.Exec(ctx, "DELETE FROM rate_limits WHERE updated_at < $1", now.Add(-p.Retention))
+	return tag.RowsAffected(), err
+}
+
+// Run prunes idle buckets every hour until the context is cancelled
+func (p *Postgres) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Prune(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to prune rate limits", logging.Err(err))
+			}
+		}
+	}
+}
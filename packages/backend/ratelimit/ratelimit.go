@@ -0,0 +1,62 @@
+// Package ratelimit limits requests with token buckets kept in a pluggable
+// store, in memory for a single instance or in Postgres when several
+// instances share the limits
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy is a token bucket: Limit requests may be made at once, and the
+// bucket refills at Limit tokens per Window
+type Policy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// rate returns the tokens added per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// Decision is the outcome of taking a token
+type Decision struct {
+	Allowed    bool
+	Remaining  int           // Whole tokens left in the bucket
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next token, when not allowed
+}
+
+// Store keeps the buckets. Take removes one token from the bucket with the
+// given key if it has one, atomically for concurrent callers.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Decision, error)
+}
+
+// refill returns the tokens of a bucket after elapsed time, capped at Limit
+func refill(tokens float64, elapsed time.Duration, policy Policy) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * policy.rate()
+	}
+	return math.Min(tokens, float64(policy.Limit))
+}
+
+// decide describes a bucket left with tokens after a take that was allowed
+// or not
+func decide(allowed bool, tokens float64, policy Policy) Decision {
+	decision := Decision{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(policy.Limit) - tokens) / policy.rate()),
+	}
+	if !allowed {
+		decision.RetryAfter = seconds((1 - tokens) / policy.rate())
+	}
+	return decision
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
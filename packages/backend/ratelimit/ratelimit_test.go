@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var perMinute = Policy{Limit: 3, Window: time.Minute}
+
+func TestMemoryBucket(t *testing.T) {
+	store := NewMemory()
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		decision, _ := store.Take(ctx, "user:1", perMinute, now)
+		if !decision.Allowed || decision.Remaining != i {
+			t.Fatalf("take %d: %+v", 3-i, decision)
+		}
+	}
+
+	decision, _ := store.Take(ctx, "user:1", perMinute, now)
+	if decision.Allowed {
+		t.Fatal("fourth request allowed")
+	}
+	if decision.RetryAfter != 20*time.Second || decision.Reset != time.Minute {
+		t.Errorf("retry after %s, reset %s", decision.RetryAfter, decision.Reset)
+	}
+
+	// Other keys have their own buckets
+	if decision, _ := store.Take(ctx, "user:2", perMinute, now); !decision.Allowed {
+		t.Error("another user was limited")
+	}
+
+	// One token is back after a third of the window
+	if decision, _ := store.Take(ctx, "user:1", perMinute, now.Add(20*time.Second)); !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("after refill: %+v", decision)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	store := NewMemory()
+	ctx := context.Background()
+	now := time.Now()
+
+	store.Take(ctx, "user:1", perMinute, now)
+	store.Take(ctx, "user:2", perMinute, now.Add(2*time.Minute))
+	if n := store.Len(); n != 1 {
+		t.Errorf("%d buckets kept, want 1", n)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	limiter := &Limiter{
+		Store: NewMemory(),
+		Key:   func(r *http.Request) string { return "ip:" + ClientIP(r, false) },
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/login", limiter.Limit(Policy{Limit: 1, Window: 10 * time.Second}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/login", nil))
+		return rec
+	}
+
+	rec := request()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	for header, want := range map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "10", "RateLimit-Policy": "1;w=10"} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	rec = request()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Retry-After = %q, want 10", got)
+	}
+	var envelope struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if json.NewDecoder(rec.Body).Decode(&envelope); envelope.Error.Code != "RATE_LIMITED" {
+		t.Errorf("code = %q, want RATE_LIMITED", envelope.Error.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	r.Header.Add("X-Forwarded-For", "3.3.3.3")
+
+	if ip := ClientIP(r, false); ip != "10.0.0.1" {
+		t.Errorf("untrusted proxy: %s", ip)
+	}
+	if ip := ClientIP(r, true); ip != "3.3.3.3" {
+		t.Errorf("trusted proxy: %s", ip)
+	}
+}
@@ -0,0 +1,259 @@
+package rewards
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/metrics"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/rewards")
+
+var (
+	mintSelector     = starknet.SelectorFromName("mint")
+	isMintedSelector = starknet.SelectorFromName("is_minted")
+)
+
+// tokenUnit is one AURA, which has 18 decimals
+var tokenUnit = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// Config configures the claims minting accrued points
+type Config struct {
+	TokenAddress  string
+	ClaimInterval time.Duration // Time between two claims
+	MaxRecipients int           // Wallets paid by a single claim transaction
+	PollInterval  time.Duration
+	MaxAttempts   int           // Sends tried before a claim waits for an operator
+	ResubmitAfter time.Duration // Unknown transactions older than this are sent again
+}
+
+// Node is the subset of the Starknet RPC used to follow claims: their
+// receipts, and the token's record of the claims it paid
+type Node interface {
+	CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Distributor mints unclaimed points to users' wallets. Every claim interval
+// it attaches the unclaimed rewards to a claim and mints them with one
+// multicall of the token's mint function. The token mints a claim once per
+// recipient, so a claim whose transaction was dropped is sent again as is.
+// Rewards are only released for another claim once a transaction of theirs
+// reverted: a claim whose sends keep failing may still be minted by one of
+// them, and waits for an operator until the token reports it paid.
+type Distributor struct {
+	Store  store.RewardStore
+	Sender starknet.Sender
+	Chain  Node
+	Config Config
+	Points *metrics.Counter // Counts claimed points, optional
+
+	lastClaim time.Time
+	now       func() time.Time
+}
+
+// NewDistributor creates the claim worker
+func NewDistributor(s store.RewardStore, sender starknet.Sender, chain Node, config Config) *Distributor {
+	return &Distributor{Store: s, Sender: sender, Chain: chain, Config: config, now: time.Now}
+}
+
+// Run processes claims every poll interval until the context is cancelled
+func (d *Distributor) Run(ctx context.Context) {
+	slog.Info("Reward distributor started", "token", d.Config.TokenAddress, "claim_interval", d.Config.ClaimInterval)
+
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process reward claims", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process follows the open claims, and creates the next claim once none is
+// open and the claim interval has passed
+func (d *Distributor) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "rewards.process")
+	defer func() { tracing.End(span, err) }()
+
+	open, err := d.Store.OpenRewardClaims(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range open {
+		claim := &open[i]
+		switch claim.Status {
+		case store.ClaimPending:
+			err = d.send(ctx, claim, nil)
+		case store.ClaimSubmitted:
+			err = d.confirm(ctx, claim)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(open) > 0 || d.now().Sub(d.lastClaim) < d.Config.ClaimInterval {
+		return nil
+	}
+
+	now := d.now()
+	claim := &store.RewardClaim{ID: uuid.New().String(), Status: store.ClaimPending, CreatedAt: now, UpdatedAt: now}
+	balances, err := d.Store.CreateRewardClaim(ctx, claim, d.Config.MaxRecipients)
+	if err != nil {
+		return err
+	}
+	d.lastClaim = now
+	if len(balances) == 0 {
+		return nil
+	}
+
+	slog.Info("Claiming rewards", "claim_id", claim.ID, "recipients", claim.Recipients, "points", claim.Points)
+	return d.send(ctx, claim, balances)
+}
+
+// send mints a claim's balances in one transaction. Balances are loaded from
+// the store when nil. Once MaxAttempts sends failed, the claim is no longer
+// sent and is only closed if the token paid it.
+func (d *Distributor) send(ctx context.Context, claim *store.RewardClaim, balances []store.RewardBalance) error {
+	if balances == nil {
+		var err error
+		if balances, err = d.Store.RewardClaimBalances(ctx, claim.ID); err != nil {
+			return err
+		}
+	}
+
+	calls, err := MintCalls(d.Config.TokenAddress, claim.ID, balances)
+	if err != nil {
+		return d.fail(ctx, claim, err.Error())
+	}
+	if claim.Attempts >= d.Config.MaxAttempts {
+		return d.closeIfMinted(ctx, claim, calls)
+	}
+
+	txHash, err := d.Sender.Invoke(ctx, calls)
+	claim.Attempts++
+	if err != nil {
+		slog.Warn("Failed to send reward claim", "claim_id", claim.ID, "attempt", claim.Attempts, logging.Err(err))
+		claim.LastError = err.Error()
+		claim.UpdatedAt = d.now()
+		return d.Store.UpdateRewardClaim(ctx, claim)
+	}
+
+	claim.Status = store.ClaimSubmitted
+	claim.TransactionHash = &txHash
+	claim.LastError = ""
+	claim.UpdatedAt = d.now()
+	return d.Store.UpdateRewardClaim(ctx, claim)
+}
+
+// confirm closes a claim once its transaction succeeded. Reverted claims
+// minted nothing and release their rewards; dropped ones are sent again.
+func (d *Distributor) confirm(ctx context.Context, claim *store.RewardClaim) error {
+	receipt, err := d.Chain.GetTransactionReceipt(ctx, *claim.TransactionHash)
+	if starknet.IsNotFound(err) {
+		if d.now().Sub(claim.UpdatedAt) > d.Config.ResubmitAfter {
+			claim.Status = store.ClaimPending
+			return d.send(ctx, claim, nil)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return d.fail(ctx, claim, "reverted: "+receipt.RevertReason)
+	}
+	return d.close(ctx, claim)
+}
+
+// closeIfMinted confirms a claim the token already paid. Its mints are sent
+// in one multicall, so the first recipient tells for every one.
+func (d *Distributor) closeIfMinted(ctx context.Context, claim *store.RewardClaim, calls []starknet.FunctionCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	result, err := d.Chain.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    d.Config.TokenAddress,
+		EntryPointSelector: isMintedSelector,
+		Calldata:           calls[0].Calldata[:2],
+	}, starknet.LatestBlock)
+	if err != nil {
+		return err
+	}
+	if len(result) != 1 {
+		return fmt.Errorf("is_minted: got %d felts, want a bool", len(result))
+	}
+	minted, err := starknet.ParseFelt(result[0])
+	if err != nil {
+		return err
+	}
+	if minted.Sign() == 0 {
+		return nil
+	}
+	return d.close(ctx, claim)
+}
+
+// close marks a claim whose rewards were minted as confirmed
+func (d *Distributor) close(ctx context.Context, claim *store.RewardClaim) error {
+	claim.Status = store.ClaimConfirmed
+	claim.LastError = ""
+	claim.UpdatedAt = d.now()
+	if err := d.Store.UpdateRewardClaim(ctx, claim); err != nil {
+		return err
+	}
+	d.Points.Add(float64(claim.Points), "claimed")
+	slog.Info("Rewards claimed", "claim_id", claim.ID, "recipients", claim.Recipients, "points", claim.Points)
+	return nil
+}
+
+// fail gives up a claim nothing minted, releasing its rewards for the next one
+func (d *Distributor) fail(ctx context.Context, claim *store.RewardClaim, reason string) error {
+	slog.Error("Reward claim failed, releasing its rewards", "claim_id", claim.ID, "reason", reason)
+	claim.Status = store.ClaimFailed
+	claim.LastError = reason
+	claim.UpdatedAt = d.now()
+	return d.Store.UpdateRewardClaim(ctx, claim)
+}
+
+// MintCalls encodes a claim as one call of the token's mint function per
+// recipient: claim id, recipient and the two halves of the u256 amount
+func MintCalls(tokenAddress, claimID string, balances []store.RewardBalance) ([]starknet.FunctionCall, error) {
+	id, err := uuid.Parse(claimID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim id %q: %w", claimID, err)
+	}
+	claim := starknet.FeltToHex(new(big.Int).SetBytes(id[:]))
+
+	calls := make([]starknet.FunctionCall, 0, len(balances))
+	for _, balance := range balances {
+		to, err := starknet.ParseFelt(balance.WalletAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wallet address %q of user %s", balance.WalletAddress, balance.UserID)
+		}
+		amount := new(big.Int).Mul(big.NewInt(balance.Points), tokenUnit)
+		low, high := starknet.U256ToFelts(amount)
+		calls = append(calls, starknet.FunctionCall{
+			ContractAddress:    tokenAddress,
+			EntryPointSelector: mintSelector,
+			Calldata:           []string{claim, starknet.FeltToHex(to), low, high},
+		})
+	}
+	return calls, nil
+}
@@ -0,0 +1,245 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/starknet/starknettest"
+	"aura-backend/store"
+)
+
+const (
+	tokenAddress = "0x0abc"
+	claimID      = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+)
+
+func receipt(hash, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_hash": hash,
+		"execution_status": status,
+		"finality_status":  starknet.FinalityAcceptedL2,
+	}
+}
+
+// accrue stores a wallet for the user and the rewards of a check-in made
+// every day since the habit was created
+func accrue(t *testing.T, s *store.Memory, userID, wallet string, day int) {
+	t.Helper()
+	ctx := context.Background()
+
+	s.CreateWallet(ctx, userID, &store.Wallet{Address: wallet})
+	habit := &store.Habit{ID: userID + "-habit", UserID: userID, DaysCompleted: day, Streak: day}
+	for _, reward := range DefaultRules().Accrue(habit, 1, time.Now()) {
+		if err := s.AddReward(ctx, &reward); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestDistributor(s *store.Memory, sender *starknettest.Sender, chain Node) *Distributor {
+	return NewDistributor(s, sender, chain, Config{
+		TokenAddress:  tokenAddress,
+		ClaimInterval: time.Hour,
+		MaxRecipients: 10,
+		PollInterval:  time.Second,
+		MaxAttempts:   2,
+		ResubmitAfter: time.Minute,
+	})
+}
+
+func totals(t *testing.T, s *store.Memory, userID string) store.RewardTotals {
+	t.Helper()
+	totals, err := s.RewardTotals(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *totals
+}
+
+func TestAccrue(t *testing.T) {
+	rules := DefaultRules()
+	habit := &store.Habit{ID: "habit-1", UserID: "user-1", DaysCompleted: 2, Streak: 2}
+
+	got := rules.Accrue(habit, 2.5, time.Now())
+	if len(got) != 1 || got[0].Reason != store.RewardCheckIn || got[0].Points != 25 || got[0].Day != 2 {
+		t.Fatalf("check-in rewards = %+v", got)
+	}
+
+	habit.DaysCompleted, habit.Streak = 7, 7
+	got = rules.Accrue(habit, 1, time.Now())
+	if len(got) != 2 || got[1].Reason != store.RewardMilestone || got[1].Points != 50 || got[1].Day != 7 {
+		t.Fatalf("milestone rewards = %+v", got)
+	}
+
+	// Milestones count consecutive days, not every day the habit was tracked
+	habit.DaysCompleted, habit.Streak = 30, 4
+	if got := rules.Accrue(habit, 1, time.Now()); len(got) != 1 {
+		t.Errorf("broken streak rewards = %+v", got)
+	}
+
+	if got := rules.Accrue(habit, 0, time.Now()); len(got) != 0 {
+		t.Errorf("zero multiplier accrued %+v", got)
+	}
+}
+
+func TestMintCalls(t *testing.T) {
+	calls, err := MintCalls(tokenAddress, claimID, []store.RewardBalance{{UserID: "user-1", WalletAddress: "0x0123", Points: 25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f",
+		"0x123",
+		"0x15af1d78b58c40000", "0x0", // 25 AURA with 18 decimals
+	}
+	if len(calls) != 1 || calls[0].EntryPointSelector != starknet.SelectorFromName("mint") || !reflect.DeepEqual(calls[0].Calldata, want) {
+		t.Errorf("calls = %+v", calls)
+	}
+
+	if _, err := MintCalls(tokenAddress, claimID, []store.RewardBalance{{WalletAddress: "not-an-address"}}); err == nil {
+		t.Error("invalid wallet address accepted")
+	}
+}
+
+func TestClaimPipeline(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	accrue(t, s, "user-1", "0x123", 7)
+	accrue(t, s, "user-2", "0x456", 1)
+	s.AddReward(ctx, &store.Reward{ID: "no-wallet", UserID: "user-3", HabitID: "habit-3", Reason: store.RewardCheckIn, Points: 10})
+
+	sender := &starknettest.Sender{TxHash: "0xclaim"}
+	distributor := newTestDistributor(s, sender, starknettest.NewNode(t, map[string]interface{}{
+		"0xclaim": receipt("0xclaim", starknet.ExecutionSucceeded),
+	}))
+
+	// The first pass attaches the rewards of users with a wallet and sends
+	// one multicall
+	if err := distributor.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls) != 1 || len(sender.Calls[0]) != 2 {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	if got := totals(t, s, "user-1"); got.Pending != 60 || got.Claimed != 0 {
+		t.Errorf("while submitted: %+v", got)
+	}
+
+	// The second confirms it
+	if err := distributor.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := totals(t, s, "user-1"); got.Pending != 0 || got.Claimed != 60 {
+		t.Errorf("after confirmation: %+v", got)
+	}
+	if got := totals(t, s, "user-3"); got.Pending != 10 {
+		t.Errorf("user without wallet: %+v", got)
+	}
+	list, _ := s.ListRewards(ctx, "user-2", 10)
+	if len(list) != 1 || !list[0].Claimed {
+		t.Errorf("rewards = %+v", list)
+	}
+
+	// No new claim is made before the claim interval
+	accrue(t, s, "user-1", "0x123", 8)
+	distributor.Process(ctx)
+	if len(sender.Calls) != 1 {
+		t.Errorf("claimed again within the interval")
+	}
+}
+
+func TestRevertedClaimReleasesRewards(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	accrue(t, s, "user-1", "0x123", 1)
+
+	sender := &starknettest.Sender{TxHash: "0xbad"}
+	distributor := newTestDistributor(s, sender, starknettest.NewNode(t, map[string]interface{}{
+		"0xbad": receipt("0xbad", starknet.ExecutionReverted),
+	}))
+
+	distributor.Process(ctx)
+	distributor.Process(ctx)
+	if open, _ := s.OpenRewardClaims(ctx); len(open) != 0 {
+		t.Fatalf("open claims = %+v", open)
+	}
+
+	// The released rewards go in the next claim
+	distributor.lastClaim = time.Time{}
+	distributor.Process(ctx)
+	if len(sender.Calls) != 2 {
+		t.Errorf("rewards not claimed again, calls = %d", len(sender.Calls))
+	}
+}
+
+func TestDroppedClaimIsSentAgain(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	accrue(t, s, "user-1", "0x123", 1)
+
+	sender := &starknettest.Sender{TxHash: "0xlost"}
+	distributor := newTestDistributor(s, sender, starknettest.NewNode(t, nil))
+	distributor.Process(ctx)
+
+	// Once the transaction is unknown for longer than ResubmitAfter, the
+	// same claim is sent again
+	distributor.now = func() time.Time { return time.Now().Add(time.Hour) }
+	distributor.Process(ctx)
+	if len(sender.Calls) != 2 || !reflect.DeepEqual(sender.Calls[0], sender.Calls[1]) {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+}
+
+func TestUnsentClaimKeepsRewards(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	accrue(t, s, "user-1", "0x123", 1)
+
+	sender := &starknettest.Sender{Err: errors.New("insufficient fee")}
+	node := starknettest.NewNode(t, nil)
+	node.SetResult("is_minted", "0x0")
+	distributor := newTestDistributor(s, sender, node)
+	for range 4 {
+		distributor.Process(ctx)
+		distributor.lastClaim = time.Time{}
+	}
+
+	// A failed send may still land: the claim stops sending but keeps its
+	// rewards, so no other claim mints them again
+	open, _ := s.OpenRewardClaims(ctx)
+	if len(open) != 1 || open[0].LastError != "insufficient fee" {
+		t.Fatalf("open claims = %+v", open)
+	}
+	if len(sender.Calls) != 2 {
+		t.Errorf("sent %d times", len(sender.Calls))
+	}
+	if got := totals(t, s, "user-1"); got.Pending != 10 {
+		t.Errorf("after failed sends: %+v", got)
+	}
+}
+
+func TestUnsentClaimMintedOnChain(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	accrue(t, s, "user-1", "0x123", 1)
+
+	// One of the failed sends was minted after all
+	node := starknettest.NewNode(t, nil)
+	node.SetResult("is_minted", "0x1")
+	distributor := newTestDistributor(s, &starknettest.Sender{Err: errors.New("timeout")}, node)
+	for range 3 {
+		distributor.Process(ctx)
+	}
+
+	if open, _ := s.OpenRewardClaims(ctx); len(open) != 0 {
+		t.Fatalf("open claims = %+v", open)
+	}
+	if got := totals(t, s, "user-1"); got.Pending != 0 || got.Claimed != 10 {
+		t.Errorf("after minted claim: %+v", got)
+	}
+}
@@ -0,0 +1,61 @@
+// Package rewards accrues AURA points for check-ins and streak milestones,
+// and mints the accrued points to users' wallets in periodic batched claims
+package rewards
+
+import (
+	"math"
+	"time"
+
+	"aura-backend/store"
+
+	"github.com/google/uuid"
+)
+
+// Rules decide the points a check-in earns before the plan multiplier
+type Rules struct {
+	CheckIn    int64         // Points for every check-in
+	Milestones map[int]int64 // Bonus points when a habit's streak reaches a number of consecutive days
+}
+
+// DefaultRules returns the built-in point rules. The milestones are reached
+// within the longest goals of the built-in and example plans: 7, 30 and 90
+// days.
+func DefaultRules() Rules {
+	return Rules{
+		CheckIn: 10,
+		Milestones: map[int]int64{
+			3:  20,
+			7:  50,
+			30: 250,
+			90: 1000,
+		},
+	}
+}
+
+// Accrue returns the rewards earned by the check-in that brought the habit
+// to its current days completed and streak, scaled by the plan's reward
+// multiplier
+func (r Rules) Accrue(habit *store.Habit, multiplier float64, at time.Time) []store.Reward {
+	var rewards []store.Reward
+	add := func(reason string, points int64) {
+		scaled := int64(math.Round(float64(points) * multiplier))
+		if scaled <= 0 {
+			return
+		}
+		rewards = append(rewards, store.Reward{
+			ID:        uuid.New().String(),
+			UserID:    habit.UserID,
+			HabitID:   habit.ID,
+			Reason:    reason,
+			Day:       habit.DaysCompleted,
+			Points:    scaled,
+			CreatedAt: at,
+		})
+	}
+
+	add(store.RewardCheckIn, r.CheckIn)
+	if bonus, ok := r.Milestones[habit.Streak]; ok {
+		add(store.RewardMilestone, bonus)
+	}
+	return rewards
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"aura-backend/config"
+)
+
+func TestServeDrainsRequestsAndWorkers(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	background := newWorkers()
+	workerStopped := false
+	background.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		workerStopped = true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, newServer(config.Default().Server, handler), listener, background, 5*time.Second)
+	}()
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+
+	// Shut down while the request is in flight
+	<-started
+	cancel()
+
+	if body := <-response; body != "done" {
+		t.Errorf("in-flight request got %q, want it to complete", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve() error: %v", err)
+	}
+	if !workerStopped {
+		t.Error("serve() returned before the background worker stopped")
+	}
+
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
@@ -0,0 +1,366 @@
+// Package staking runs the backend side of commitment stakes: it verifies
+// the STRK deposits users make in the AuraStaking escrow and, as the
+// escrow's oracle, resolves each stake once its habit is completed or its
+// streak breaks
+package staking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"aura-backend/achievements"
+	"aura-backend/logging"
+	"aura-backend/starknet"
+	"aura-backend/store"
+	"aura-backend/tracing"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("aura-backend/staking")
+
+var (
+	resolveSelector = starknet.SelectorFromName("resolve")
+	stakeOfSelector = starknet.SelectorFromName("stake_of")
+	stakedEventKey  = starknet.SelectorFromName("Staked")
+	errNoDeposit    = errors.New("receipt has no Staked event for the habit and wallet")
+)
+
+// batchSize bounds the stakes handled per poll
+const batchSize = 50
+
+// Statuses of a stake in the escrow, the variants of its StakeStatus enum
+const (
+	chainStakeNone = iota
+	chainStakeActive
+	chainStakeReturned
+	chainStakeForfeited
+)
+
+// Config configures the resolution of stakes
+type Config struct {
+	ContractAddress string
+	PollInterval    time.Duration
+	MaxAttempts     int           // Resolutions tried before giving up on a stake
+	ResubmitAfter   time.Duration // Unknown transactions older than this are given up on or sent again
+}
+
+// Node is the subset of the Starknet RPC used to follow stakes
+type Node interface {
+	CallContract(ctx context.Context, call starknet.FunctionCall, block *starknet.BlockID) ([]string, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (*starknet.Receipt, error)
+}
+
+// Resolver verifies deposits and resolves stakes from the oracle account.
+// The escrow settles a stake only once and reverts any later resolution, so
+// before a resolution is sent again the escrow is read: a stake it already
+// settled, by an earlier resolution or the staker's reclaim, is closed
+// instead.
+type Resolver struct {
+	Stakes store.StakeStore
+	Habits store.HabitStore
+	Sender starknet.Sender
+	Chain  Node
+	Config Config
+
+	now func() time.Time
+}
+
+// NewResolver creates the stake resolver
+func NewResolver(stakes store.StakeStore, habits store.HabitStore, sender starknet.Sender, chain Node, config Config) *Resolver {
+	return &Resolver{Stakes: stakes, Habits: habits, Sender: sender, Chain: chain, Config: config, now: time.Now}
+}
+
+// Run processes open stakes every poll interval until the context is cancelled
+func (r *Resolver) Run(ctx context.Context) {
+	slog.Info("Stake resolver started", "contract", r.Config.ContractAddress)
+
+	ticker := time.NewTicker(r.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Process(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to process stakes", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process verifies pending deposits, resolves active stakes whose outcome is
+// known and checks the receipts of sent resolutions
+func (r *Resolver) Process(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "staking.process")
+	defer func() { tracing.End(span, err) }()
+
+	open, err := r.Stakes.OpenStakes(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range open {
+		s := &open[i]
+		switch s.Status {
+		case store.StakePending:
+			err = r.verifyDeposit(ctx, s)
+		case store.StakeActive:
+			err = r.resolveIfDue(ctx, s)
+		case store.StakeResolving:
+			err = r.confirmResolution(ctx, s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDeposit activates a stake once its deposit transaction succeeded and
+// staked on the habit from the user's wallet. The amount and deadline are
+// read from the event rather than trusted from the client.
+func (r *Resolver) verifyDeposit(ctx context.Context, s *store.Stake) error {
+	receipt, err := r.Chain.GetTransactionReceipt(ctx, s.DepositTransactionHash)
+	if starknet.IsNotFound(err) {
+		if r.now().Sub(s.CreatedAt) > r.Config.ResubmitAfter {
+			return r.close(ctx, s, store.StakeRejected, "deposit transaction not found")
+		}
+		return r.touch(ctx, s)
+	} else if err != nil {
+		return err
+	}
+
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return r.close(ctx, s, store.StakeRejected, "deposit reverted: "+receipt.RevertReason)
+	}
+	deposit, err := DepositFromReceipt(receipt, r.Config.ContractAddress, s.HabitID, s.StakerAddress)
+	if err != nil {
+		return r.close(ctx, s, store.StakeRejected, err.Error())
+	}
+
+	s.Amount = deposit.Amount
+	s.Deadline = &deposit.Deadline
+	s.Status = store.StakeActive
+	s.LastError = ""
+	s.UpdatedAt = r.now()
+	return r.Stakes.UpdateStake(ctx, s)
+}
+
+// resolveIfDue sends the resolution of a stake whose habit was completed,
+// whose streak broke or whose deadline passed. Only a habit completed by the
+// deadline wins the stake back.
+func (r *Resolver) resolveIfDue(ctx context.Context, s *store.Stake) error {
+	habit, err := r.Habits.GetHabit(ctx, s.UserID, s.HabitID)
+	if err != nil {
+		return err
+	}
+
+	now := r.now()
+	var success bool
+	switch {
+	case habit.Completed:
+		success = CompletedBy(habit, s.Deadline)
+	case s.Deadline != nil && now.After(*s.Deadline):
+		success = false
+	case StreakBroken(habit, now):
+		success = false
+	default:
+		return r.touch(ctx, s)
+	}
+
+	habitID, err := achievements.HabitFelt(s.HabitID)
+	if err != nil {
+		return err
+	}
+	if s.Attempts > 0 {
+		if settled, err := r.closeIfSettled(ctx, s, habitID); err != nil || settled {
+			return err
+		}
+	}
+
+	// Stakes whose resolution keeps failing wait for an operator, the
+	// last error says why
+	if s.Attempts >= r.Config.MaxAttempts {
+		return r.touch(ctx, s)
+	}
+	outcome := "0x0"
+	if success {
+		outcome = "0x1"
+	}
+	txHash, err := r.Sender.Invoke(ctx, []starknet.FunctionCall{{
+		ContractAddress:    r.Config.ContractAddress,
+		EntryPointSelector: resolveSelector,
+		Calldata:           []string{habitID, outcome},
+	}})
+	s.Attempts++
+	if err != nil {
+		slog.Warn("Failed to send stake resolution", "habit_id", s.HabitID, "attempt", s.Attempts, logging.Err(err))
+		s.LastError = err.Error()
+		return r.touch(ctx, s)
+	}
+
+	s.Status = store.StakeResolving
+	s.Success = &success
+	s.ResolutionTransactionHash = &txHash
+	s.LastError = ""
+	s.UpdatedAt = r.now()
+	return r.Stakes.UpdateStake(ctx, s)
+}
+
+// confirmResolution closes a stake once its resolution is on-chain, or sends
+// it again when the transaction was dropped or reverted
+func (r *Resolver) confirmResolution(ctx context.Context, s *store.Stake) error {
+	receipt, err := r.Chain.GetTransactionReceipt(ctx, *s.ResolutionTransactionHash)
+	if starknet.IsNotFound(err) {
+		if r.now().Sub(s.UpdatedAt) > r.Config.ResubmitAfter {
+			return r.retry(ctx, s, "resolution transaction not found")
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if receipt.ExecutionStatus == starknet.ExecutionReverted {
+		return r.retry(ctx, s, "resolution reverted: "+receipt.RevertReason)
+	}
+
+	status := store.StakeForfeited
+	if s.Success != nil && *s.Success {
+		status = store.StakeReturned
+	}
+	slog.Info("Stake resolved", "habit_id", s.HabitID, "status", status)
+	return r.close(ctx, s, status, "")
+}
+
+// closeIfSettled closes a stake the escrow already settled, with the outcome
+// read from the escrow. Its stake_of returns the staker, the two halves of
+// the u256 amount, the deadline and the status.
+func (r *Resolver) closeIfSettled(ctx context.Context, s *store.Stake, habitID string) (bool, error) {
+	result, err := r.Chain.CallContract(ctx, starknet.FunctionCall{
+		ContractAddress:    r.Config.ContractAddress,
+		EntryPointSelector: stakeOfSelector,
+		Calldata:           []string{habitID},
+	}, starknet.LatestBlock)
+	if err != nil {
+		return false, err
+	}
+	if len(result) != 5 {
+		return false, fmt.Errorf("stake_of: got %d felts, want a Stake", len(result))
+	}
+	status, err := starknet.ParseFelt(result[4])
+	if err != nil {
+		return false, err
+	}
+
+	var success bool
+	switch status.Int64() {
+	case chainStakeReturned:
+		success = true
+	case chainStakeForfeited:
+		success = false
+	default:
+		return false, nil
+	}
+	s.Success = &success
+	closed := store.StakeForfeited
+	if success {
+		closed = store.StakeReturned
+	}
+	slog.Info("Stake already settled on-chain", "habit_id", s.HabitID, "status", closed)
+	return true, r.close(ctx, s, closed, "")
+}
+
+// retry makes a stake active again so its resolution is sent again, once
+// the escrow was read
+func (r *Resolver) retry(ctx context.Context, s *store.Stake, reason string) error {
+	slog.Warn("Stake resolution not applied", "habit_id", s.HabitID, "attempt", s.Attempts, "reason", reason)
+	s.Status = store.StakeActive
+	s.LastError = reason
+	return r.touch(ctx, s)
+}
+
+func (r *Resolver) close(ctx context.Context, s *store.Stake, status, reason string) error {
+	if status == store.StakeRejected {
+		slog.Warn("Stake deposit rejected", "habit_id", s.HabitID, "reason", reason)
+	}
+	s.Status = status
+	s.LastError = reason
+	s.UpdatedAt = r.now()
+	return r.Stakes.UpdateStake(ctx, s)
+}
+
+// touch saves a stake so the next polls move on to other stakes
+func (r *Resolver) touch(ctx context.Context, s *store.Stake) error {
+	s.UpdatedAt = r.now()
+	return r.Stakes.UpdateStake(ctx, s)
+}
+
+// StreakBroken reports whether a whole day went by without a check-in: the
+// last check-in, or the creation of a habit never tracked, is before yesterday
+func StreakBroken(habit *store.Habit, now time.Time) bool {
+	last := habit.CreatedAt
+	if habit.LastTrackedDate != nil {
+		last = *habit.LastTrackedDate
+	}
+	year, month, day := now.Date()
+	yesterday := time.Date(year, month, day-1, 0, 0, 0, 0, now.Location())
+	return last.Before(yesterday)
+}
+
+// CompletedBy reports whether a completed habit was completed by the
+// deadline: the check-in completing a habit is its last one
+func CompletedBy(habit *store.Habit, deadline *time.Time) bool {
+	if !habit.Completed {
+		return false
+	}
+	if deadline == nil || habit.LastTrackedDate == nil {
+		return true
+	}
+	return !habit.LastTrackedDate.After(*deadline)
+}
+
+// Deposit is a stake read from the escrow's Staked event
+type Deposit struct {
+	Amount   string // In FRI
+	Deadline time.Time
+}
+
+// DepositFromReceipt finds the Staked event of the habit and staker in a
+// receipt. Its keys are the selector, the habit id and the staker; its data
+// the two halves of the u256 amount and the deadline.
+func DepositFromReceipt(receipt *starknet.Receipt, contractAddress, habitID, stakerAddress string) (*Deposit, error) {
+	habit, err := achievements.HabitFelt(habitID)
+	if err != nil {
+		return nil, err
+	}
+	contract := starknet.NormalizeAddress(contractAddress)
+	staker := starknet.NormalizeAddress(stakerAddress)
+
+	for _, event := range receipt.Events {
+		if starknet.NormalizeAddress(event.FromAddress) != contract || len(event.Keys) < 3 || len(event.Data) < 3 {
+			continue
+		}
+		if starknet.NormalizeAddress(event.Keys[0]) != stakedEventKey ||
+			starknet.NormalizeAddress(event.Keys[1]) != habit ||
+			starknet.NormalizeAddress(event.Keys[2]) != staker {
+			continue
+		}
+
+		amount, err := starknet.U256FromFelts(event.Data[0], event.Data[1])
+		if err != nil {
+			return nil, err
+		}
+		deadline, err := starknet.ParseFelt(event.Data[2])
+		if err != nil || !deadline.IsInt64() {
+			return nil, errors.New("invalid stake deadline")
+		}
+		return &Deposit{Amount: amount.String(), Deadline: time.Unix(deadline.Int64(), 0)}, nil
+	}
+	return nil, errNoDeposit
+}
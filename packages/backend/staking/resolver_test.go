@@ -0,0 +1,379 @@
+package staking
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"aura-backend/starknet"
+	"aura-backend/starknet/starknettest"
+	"aura-backend/store"
+)
+
+const (
+	contractAddress = "0x0abc"
+	habitID         = "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+	habitFelt       = "0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f"
+	stakerAddress   = "0x0123"
+)
+
+// beforeDeadline is a day before the deadline of the test deposit
+var beforeDeadline = time.Date(2024, 12, 31, 9, 0, 0, 0, time.UTC)
+
+// deposit is the receipt of a successful stake of 5 STRK on the test habit
+func deposit(staker string) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_hash": "0xdeposit",
+		"execution_status": starknet.ExecutionSucceeded,
+		"finality_status":  starknet.FinalityAcceptedL2,
+		"events": []map[string]interface{}{{
+			"from_address": "0xabc",
+			"keys":         []string{starknet.SelectorFromName("Staked"), habitFelt, staker},
+			"data":         []string{"0x4563918244f40000", "0x0", "0x67748580"},
+		}},
+	}
+}
+
+// setup stores a habit created at createdAt and a pending stake on it
+func setup(t *testing.T, s *store.Memory, createdAt time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	habit := &store.Habit{ID: habitID, UserID: "user-1", Name: "Read", GoalDays: 7, CreatedAt: createdAt}
+	if err := s.CreateHabit(ctx, habit); err != nil {
+		t.Fatal(err)
+	}
+	stake := &store.Stake{
+		HabitID:                habitID,
+		UserID:                 "user-1",
+		StakerAddress:          stakerAddress,
+		DepositTransactionHash: "0xdeposit",
+		Status:                 store.StakePending,
+		CreatedAt:              time.Now(),
+		UpdatedAt:              time.Now(),
+	}
+	if err := s.CreateStake(ctx, stake); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestResolver returns a resolver whose clock reads beforeDeadline
+func newTestResolver(s *store.Memory, sender *starknettest.Sender, chain Node) *Resolver {
+	resolver := NewResolver(s, s, sender, chain, Config{
+		ContractAddress: contractAddress,
+		PollInterval:    time.Second,
+		MaxAttempts:     2,
+		ResubmitAfter:   time.Minute,
+	})
+	resolver.now = func() time.Time { return beforeDeadline }
+	return resolver
+}
+
+// escrowStake is the stake_of result of the test deposit with an escrow status
+func escrowStake(status string) []string {
+	return []string{stakerAddress, "0x4563918244f40000", "0x0", "0x67748580", status}
+}
+
+func stakeStatus(t *testing.T, s *store.Memory) *store.Stake {
+	t.Helper()
+	stake, err := s.GetStake(context.Background(), "user-1", habitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stake
+}
+
+func TestStreakBroken(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	tracked := func(at time.Time) *store.Habit {
+		return &store.Habit{CreatedAt: now.AddDate(0, 0, -10), LastTrackedDate: &at}
+	}
+
+	cases := []struct {
+		name  string
+		habit *store.Habit
+		want  bool
+	}{
+		{"tracked today", tracked(now.Add(-time.Hour)), false},
+		{"tracked yesterday", tracked(time.Date(2025, 3, 9, 0, 30, 0, 0, time.UTC)), false},
+		{"missed yesterday", tracked(time.Date(2025, 3, 8, 23, 0, 0, 0, time.UTC)), true},
+		{"created today", &store.Habit{CreatedAt: now.Add(-time.Hour)}, false},
+		{"never tracked", &store.Habit{CreatedAt: now.AddDate(0, 0, -3)}, true},
+	}
+	for _, c := range cases {
+		if got := StreakBroken(c.habit, now); got != c.want {
+			t.Errorf("%s: StreakBroken = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDepositFromReceipt(t *testing.T) {
+	receipt := &starknet.Receipt{ExecutionStatus: starknet.ExecutionSucceeded, Events: []starknet.ReceiptEvent{{
+		FromAddress: "0xabc",
+		Keys:        []string{starknet.SelectorFromName("Staked"), habitFelt, "0x123"},
+		Data:        []string{"0x4563918244f40000", "0x0", "0x67748580"},
+	}}}
+
+	got, err := DepositFromReceipt(receipt, contractAddress, habitID, stakerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Amount != "5000000000000000000" || !got.Deadline.Equal(time.Unix(1735689600, 0)) {
+		t.Errorf("deposit = %+v", got)
+	}
+
+	if _, err := DepositFromReceipt(receipt, contractAddress, habitID, "0x0456"); !errors.Is(err, errNoDeposit) {
+		t.Errorf("other staker: %v", err)
+	}
+	if _, err := DepositFromReceipt(receipt, "0x0def", habitID, stakerAddress); !errors.Is(err, errNoDeposit) {
+		t.Errorf("other contract: %v", err)
+	}
+}
+
+func TestCompletedBy(t *testing.T) {
+	deadline := time.Unix(1735689600, 0)
+	completed := func(at time.Time) *store.Habit {
+		return &store.Habit{Completed: true, LastTrackedDate: &at}
+	}
+
+	if !CompletedBy(completed(deadline.Add(-time.Hour)), &deadline) {
+		t.Error("habit completed before the deadline")
+	}
+	if !CompletedBy(completed(deadline), &deadline) {
+		t.Error("habit completed at the deadline")
+	}
+	if CompletedBy(completed(deadline.Add(time.Hour)), &deadline) {
+		t.Error("habit completed after the deadline")
+	}
+	if CompletedBy(&store.Habit{}, &deadline) {
+		t.Error("habit in progress")
+	}
+}
+
+func TestResolveCompletedHabit(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xdeposit": deposit("0x123"),
+		"0xresolve": map[string]interface{}{
+			"transaction_hash": "0xresolve",
+			"execution_status": starknet.ExecutionSucceeded,
+			"finality_status":  starknet.FinalityAcceptedL2,
+		},
+	})
+	sender := &starknettest.Sender{TxHash: "0xresolve"}
+	resolver := newTestResolver(s, sender, chain)
+
+	// The first pass verifies the deposit
+	if err := resolver.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stake := stakeStatus(t, s)
+	if stake.Status != store.StakeActive || stake.Amount != "5000000000000000000" || stake.Deadline == nil {
+		t.Fatalf("after deposit: %+v", stake)
+	}
+	if len(sender.Calls) != 0 {
+		t.Fatalf("resolved an habit in progress: %+v", sender.Calls)
+	}
+
+	// Completing the habit sends a successful resolution
+	habit, _ := s.GetHabit(ctx, "user-1", habitID)
+	habit.Completed = true
+	habit.LastTrackedDate = &beforeDeadline
+	s.UpdateHabitProgress(ctx, habit)
+	if err := resolver.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls) != 1 {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	call := sender.Calls[0][0]
+	if call.EntryPointSelector != starknet.SelectorFromName("resolve") || call.Calldata[0] != habitFelt || call.Calldata[1] != "0x1" {
+		t.Errorf("resolve call = %+v", call)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeResolving || !*stake.Success {
+		t.Fatalf("after resolve: %+v", stake)
+	}
+
+	// The receipt closes the stake
+	if err := resolver.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeReturned {
+		t.Fatalf("after receipt: %+v", stake)
+	}
+	if len(sender.Calls) != 1 {
+		t.Errorf("resolution sent %d times", len(sender.Calls))
+	}
+}
+
+func TestResolveBrokenStreak(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline.AddDate(0, 0, -3))
+
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x123")})
+	sender := &starknettest.Sender{TxHash: "0xforfeit"}
+	resolver := newTestResolver(s, sender, chain)
+
+	resolver.Process(ctx)
+	resolver.Process(ctx)
+	if len(sender.Calls) != 1 || sender.Calls[0][0].Calldata[1] != "0x0" {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeResolving || *stake.Success {
+		t.Fatalf("after resolve: %+v", stake)
+	}
+}
+
+func TestResolveAfterDeadline(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x123")})
+	sender := &starknettest.Sender{TxHash: "0xforfeit"}
+	resolver := newTestResolver(s, sender, chain)
+	resolver.Process(ctx)
+
+	// The streak is unbroken, but the deadline passed before the goal
+	afterDeadline := beforeDeadline.AddDate(0, 0, 2)
+	habit, _ := s.GetHabit(ctx, "user-1", habitID)
+	habit.DaysCompleted = 3
+	habit.LastTrackedDate = &afterDeadline
+	s.UpdateHabitProgress(ctx, habit)
+	resolver.now = func() time.Time { return afterDeadline }
+
+	resolver.Process(ctx)
+	if len(sender.Calls) != 1 || sender.Calls[0][0].Calldata[1] != "0x0" {
+		t.Fatalf("calls = %+v", sender.Calls)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeResolving || *stake.Success {
+		t.Fatalf("after deadline: %+v", stake)
+	}
+}
+
+func TestResolveLateCompletion(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline)
+
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x123")})
+	sender := &starknettest.Sender{TxHash: "0xforfeit"}
+	resolver := newTestResolver(s, sender, chain)
+	resolver.Process(ctx)
+
+	// The habit was completed, a day after the deadline
+	completedAt := beforeDeadline.AddDate(0, 0, 2)
+	habit, _ := s.GetHabit(ctx, "user-1", habitID)
+	habit.Completed = true
+	habit.LastTrackedDate = &completedAt
+	s.UpdateHabitProgress(ctx, habit)
+	resolver.now = func() time.Time { return completedAt }
+
+	resolver.Process(ctx)
+	if len(sender.Calls) != 1 || sender.Calls[0][0].Calldata[1] != "0x0" {
+		t.Fatalf("late completion resolved as %+v", sender.Calls)
+	}
+}
+
+func TestRejectsForeignDeposit(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline)
+
+	// The deposit was made from another wallet
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x0456")})
+	resolver := newTestResolver(s, &starknettest.Sender{}, chain)
+
+	if err := resolver.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeRejected {
+		t.Fatalf("foreign deposit: %+v", stake)
+	}
+}
+
+func TestResolutionAttemptsAreBounded(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline.AddDate(0, 0, -3))
+
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x123")})
+	chain.SetResult("stake_of", escrowStake("0x1")...)
+	sender := &starknettest.Sender{Err: errors.New("insufficient fee")}
+	resolver := newTestResolver(s, sender, chain)
+
+	for range 5 {
+		resolver.Process(ctx)
+	}
+	stake := stakeStatus(t, s)
+	if len(sender.Calls) != 2 || stake.Status != store.StakeActive || stake.LastError != "insufficient fee" {
+		t.Fatalf("sent %d times, stake %+v", len(sender.Calls), stake)
+	}
+}
+
+func TestRevertedResolutionAlreadySettled(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline.AddDate(0, 0, -3))
+
+	// The first resolution landed late: its resend reverted as the stake
+	// was no longer active
+	chain := starknettest.NewNode(t, map[string]interface{}{
+		"0xdeposit": deposit("0x123"),
+		"0xforfeit": map[string]interface{}{
+			"transaction_hash": "0xforfeit",
+			"execution_status": starknet.ExecutionReverted,
+			"finality_status":  starknet.FinalityAcceptedL2,
+			"revert_reason":    "NOT_ACTIVE",
+		},
+	})
+	chain.SetResult("stake_of", escrowStake("0x3")...)
+	sender := &starknettest.Sender{TxHash: "0xforfeit"}
+	resolver := newTestResolver(s, sender, chain)
+
+	for range 4 {
+		if err := resolver.Process(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sender.Calls) != 1 {
+		t.Errorf("resolution sent %d times", len(sender.Calls))
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeForfeited || *stake.Success {
+		t.Fatalf("after revert: %+v", stake)
+	}
+}
+
+func TestExhaustedResolutionReclaimed(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	setup(t, s, beforeDeadline.AddDate(0, 0, -3))
+
+	chain := starknettest.NewNode(t, map[string]interface{}{"0xdeposit": deposit("0x123")})
+	chain.SetResult("stake_of", escrowStake("0x1")...)
+	sender := &starknettest.Sender{Err: errors.New("insufficient fee")}
+	resolver := newTestResolver(s, sender, chain)
+	for range 4 {
+		resolver.Process(ctx)
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeActive {
+		t.Fatalf("before reclaim: %+v", stake)
+	}
+
+	// The staker reclaimed the stake once the escrow let them
+	chain.SetResult("stake_of", escrowStake("0x2")...)
+	if err := resolver.Process(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Calls) != 2 {
+		t.Errorf("resolution sent %d times", len(sender.Calls))
+	}
+	if stake := stakeStatus(t, s); stake.Status != store.StakeReturned || !*stake.Success {
+		t.Fatalf("after reclaim: %+v", stake)
+	}
+}
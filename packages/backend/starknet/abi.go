@@ -0,0 +1,348 @@
+package starknet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrUnknownEvent is returned when an event is not declared in the ABI
+var ErrUnknownEvent = errors.New("event not in the ABI")
+
+// ABI is a Cairo contract ABI, as found in the Sierra contract class
+type ABI struct {
+	structs   map[string][]abiMember
+	enums     map[string][]abiMember
+	functions map[string]abiEntry
+	events    map[string]eventDef // Keyed by the joined selectors identifying the event
+}
+
+// abiEntry is an item of the ABI JSON. Interfaces nest their functions in
+// items; structs, enums and events declare their members or variants.
+type abiEntry struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	Members  []abiMember `json:"members"`
+	Variants []abiMember `json:"variants"`
+	Inputs   []abiMember `json:"inputs"`
+	Outputs  []abiMember `json:"outputs"`
+	Items    []abiEntry  `json:"items"`
+}
+
+// abiMember is a struct member or enum variant. Event members are keys or
+// data; event variants are nested under their own selector or flat.
+type abiMember struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+}
+
+// eventDef is an event struct reachable from the contract's event enum
+type eventDef struct {
+	name      string
+	selectors []string // Leading keys naming the variant path, one per nested enum
+	members   []abiMember
+}
+
+// DecodedEvent is an event with its members decoded from keys and data
+type DecodedEvent struct {
+	Name   string                 // Variant name, e.g. Transfer
+	Fields map[string]interface{} // Members by name
+}
+
+// ParseABI parses the ABI of a contract class. The ABI may be given as a
+// JSON array or as a string holding one, as some class files store it.
+func ParseABI(data []byte) (*ABI, error) {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		data = []byte(text)
+	}
+
+	var entries []abiEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid ABI: %w", err)
+	}
+
+	abi := &ABI{
+		structs:   map[string][]abiMember{},
+		enums:     map[string][]abiMember{},
+		functions: map[string]abiEntry{},
+		events:    map[string]eventDef{},
+	}
+	events := map[string]abiEntry{}
+	nested := map[string]bool{}
+	for _, entry := range entries {
+		switch entry.Type {
+		case "struct":
+			abi.structs[entry.Name] = entry.Members
+		case "enum":
+			abi.enums[entry.Name] = entry.Variants
+		case "function":
+			abi.functions[entry.Name] = entry
+		case "interface":
+			for _, item := range entry.Items {
+				if item.Type == "function" {
+					abi.functions[item.Name] = item
+				}
+			}
+		case "event":
+			events[entry.Name] = entry
+			for _, variant := range entry.Variants {
+				nested[variant.Type] = true
+			}
+		}
+	}
+
+	// Walk down from the contract's event enum, the only one no other event
+	// nests. Component events are nested under their variant's selector
+	// unless flattened.
+	var walk func(entry abiEntry, selectors []string, name string)
+	walk = func(entry abiEntry, selectors []string, name string) {
+		if entry.Kind == "struct" {
+			abi.events[strings.Join(selectors, ",")] = eventDef{name: name, selectors: selectors, members: entry.Members}
+			return
+		}
+		for _, variant := range entry.Variants {
+			child, ok := events[variant.Type]
+			if !ok {
+				continue
+			}
+			path := selectors
+			if variant.Kind != "flat" {
+				path = append(append([]string{}, selectors...), SelectorFromName(variant.Name))
+			}
+			walk(child, path, variant.Name)
+		}
+	}
+	for name, entry := range events {
+		if entry.Kind == "enum" && !nested[name] {
+			walk(entry, nil, "")
+		}
+	}
+
+	return abi, nil
+}
+
+// DecodeEvent decodes an emitted event into its name and members
+func (a *ABI) DecodeEvent(keys, data []string) (*DecodedEvent, error) {
+	normalized := make([]string, len(keys))
+	for i, key := range keys {
+		normalized[i] = NormalizeAddress(key)
+	}
+
+	// Nested component events are identified by more than one key, try the
+	// longest path first
+	for n := len(normalized); n > 0; n-- {
+		def, ok := a.events[strings.Join(normalized[:n], ",")]
+		if !ok {
+			continue
+		}
+
+		fields := map[string]interface{}{}
+		keyReader := &feltReader{felts: keys[n:]}
+		dataReader := &feltReader{felts: data}
+		for _, member := range def.members {
+			reader := dataReader
+			if member.Kind == "key" {
+				reader = keyReader
+			} else if member.Kind != "data" {
+				return nil, fmt.Errorf("event %s: unsupported member kind %q", def.name, member.Kind)
+			}
+
+			value, err := a.decode(member.Type, reader)
+			if err != nil {
+				return nil, fmt.Errorf("event %s: member %s: %w", def.name, member.Name, err)
+			}
+			fields[member.Name] = value
+		}
+		return &DecodedEvent{Name: def.name, Fields: fields}, nil
+	}
+
+	return nil, ErrUnknownEvent
+}
+
+// feltReader consumes a serialized Cairo value felt by felt
+type feltReader struct {
+	felts []string
+	pos   int
+}
+
+func (r *feltReader) next() (*big.Int, error) {
+	if r.pos >= len(r.felts) {
+		return nil, errors.New("not enough felts")
+	}
+	value, err := ParseFelt(r.felts[r.pos])
+	if err != nil {
+		return nil, err
+	}
+	r.pos++
+	return value, nil
+}
+
+// Cairo types decoded to JSON friendly values. Integers that may not fit a
+// JavaScript number are decimal strings.
+var (
+	hexTypes = map[string]bool{
+		"core::felt252": true,
+		"core::starknet::contract_address::ContractAddress": true,
+		"core::starknet::class_hash::ClassHash":             true,
+		"core::starknet::eth_address::EthAddress":           true,
+		"core::bytes_31::bytes31":                           true,
+	}
+	smallIntTypes = map[string]bool{
+		"core::integer::u8": true, "core::integer::u16": true, "core::integer::u32": true,
+		"core::integer::i8": true, "core::integer::i16": true, "core::integer::i32": true,
+	}
+	bigIntTypes = map[string]bool{
+		"core::integer::u64": true, "core::integer::u128": true,
+		"core::integer::i64": true, "core::integer::i128": true,
+	}
+)
+
+// halfPrime separates positive felts from the encoding of negative integers
+var halfPrime = new(big.Int).Rsh(Prime, 1)
+
+// decode reads a value of the given Cairo type
+func (a *ABI) decode(typ string, r *feltReader) (interface{}, error) {
+	switch {
+	case typ == "()":
+		return nil, nil
+	case hexTypes[typ]:
+		value, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		return FeltToHex(value), nil
+	case typ == "core::bool":
+		value, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		return value.Sign() != 0, nil
+	case smallIntTypes[typ], bigIntTypes[typ]:
+		value, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if value.Cmp(halfPrime) > 0 {
+			value = new(big.Int).Sub(value, Prime)
+		}
+		if smallIntTypes[typ] {
+			return value.Int64(), nil
+		}
+		return value.String(), nil
+	case typ == "core::integer::u256":
+		low, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		high, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Add(new(big.Int).Lsh(high, 128), low).String(), nil
+	case typ == "core::byte_array::ByteArray":
+		return decodeByteArray(r)
+	case strings.HasPrefix(typ, "core::array::Array::<"), strings.HasPrefix(typ, "core::array::Span::<"):
+		return a.decodeArray(genericArgument(typ), r)
+	}
+
+	if members, ok := a.structs[typ]; ok {
+		value := map[string]interface{}{}
+		for _, member := range members {
+			field, err := a.decode(member.Type, r)
+			if err != nil {
+				return nil, err
+			}
+			value[member.Name] = field
+		}
+		return value, nil
+	}
+
+	if variants, ok := a.enums[typ]; ok {
+		index, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if !index.IsInt64() || index.Int64() >= int64(len(variants)) {
+			return nil, fmt.Errorf("invalid variant %s of %s", index, typ)
+		}
+		variant := variants[index.Int64()]
+		value, err := a.decode(variant.Type, r)
+		if err != nil {
+			return nil, err
+		}
+		// Options decode to their value or null
+		if strings.HasPrefix(typ, "core::option::Option::<") {
+			return value, nil
+		}
+		return map[string]interface{}{variant.Name: value}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+func (a *ABI) decodeArray(typ string, r *feltReader) (interface{}, error) {
+	length, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if !length.IsInt64() || length.Int64() > int64(len(r.felts)-r.pos) {
+		return nil, fmt.Errorf("invalid array length %s", length)
+	}
+
+	items := make([]interface{}, 0, length.Int64())
+	for i := int64(0); i < length.Int64(); i++ {
+		item, err := a.decode(typ, r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// decodeByteArray reads a ByteArray written by EncodeByteArray
+func decodeByteArray(r *feltReader) (string, error) {
+	words, err := r.next()
+	if err != nil {
+		return "", err
+	}
+	if !words.IsInt64() || words.Int64() > int64(len(r.felts)-r.pos) {
+		return "", fmt.Errorf("invalid ByteArray length %s", words)
+	}
+
+	var data []byte
+	for i := int64(0); i < words.Int64(); i++ {
+		word, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		data = append(data, word.FillBytes(make([]byte, bytesPerWord))...)
+	}
+
+	pending, err := r.next()
+	if err != nil {
+		return "", err
+	}
+	pendingLen, err := r.next()
+	if err != nil {
+		return "", err
+	}
+	if !pendingLen.IsInt64() || pendingLen.Int64() >= bytesPerWord || pending.BitLen() > int(pendingLen.Int64())*8 {
+		return "", fmt.Errorf("invalid ByteArray pending word")
+	}
+	return string(append(data, pending.FillBytes(make([]byte, pendingLen.Int64()))...)), nil
+}
+
+// genericArgument returns T in a type like core::array::Array::<T>
+func genericArgument(typ string) string {
+	start := strings.Index(typ, "<")
+	if start < 0 || !strings.HasSuffix(typ, ">") {
+		return ""
+	}
+	return typ[start+1 : len(typ)-1]
+}
@@ -0,0 +1,117 @@
+package starknet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// tokenABI is an excerpt of the AuraToken class: its own events, the flat
+// Ownable events and the nested ERC20 events
+const tokenABI = `[
+	{"type": "struct", "name": "core::integer::u256", "members": [
+		{"name": "low", "type": "core::integer::u128"},
+		{"name": "high", "type": "core::integer::u128"}
+	]},
+	{"type": "enum", "name": "core::bool", "variants": [
+		{"name": "False", "type": "()"},
+		{"name": "True", "type": "()"}
+	]},
+	{"type": "enum", "name": "core::option::Option::<core::integer::u32>", "variants": [
+		{"name": "Some", "type": "core::integer::u32"},
+		{"name": "None", "type": "()"}
+	]},
+	{"type": "interface", "name": "contracts::AuraToken::IAuraToken", "items": [
+		{"type": "function", "name": "is_minted", "inputs": [], "outputs": [{"type": "core::bool"}], "state_mutability": "view"}
+	]},
+	{"type": "event", "name": "openzeppelin_token::erc20::erc20::ERC20Component::Transfer", "kind": "struct", "members": [
+		{"name": "from", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "to", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "value", "type": "core::integer::u256", "kind": "data"}
+	]},
+	{"type": "event", "name": "openzeppelin_token::erc20::erc20::ERC20Component::Event", "kind": "enum", "variants": [
+		{"name": "Transfer", "type": "openzeppelin_token::erc20::erc20::ERC20Component::Transfer", "kind": "nested"}
+	]},
+	{"type": "event", "name": "openzeppelin_access::ownable::ownable::OwnableComponent::OwnershipTransferred", "kind": "struct", "members": [
+		{"name": "previous_owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "new_owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"}
+	]},
+	{"type": "event", "name": "openzeppelin_access::ownable::ownable::OwnableComponent::Event", "kind": "enum", "variants": [
+		{"name": "OwnershipTransferred", "type": "openzeppelin_access::ownable::ownable::OwnableComponent::OwnershipTransferred", "kind": "nested"}
+	]},
+	{"type": "event", "name": "contracts::AuraToken::AuraToken::RewardMinted", "kind": "struct", "members": [
+		{"name": "claim_id", "type": "core::felt252", "kind": "key"},
+		{"name": "to", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "amount", "type": "core::integer::u256", "kind": "data"},
+		{"name": "note", "type": "core::byte_array::ByteArray", "kind": "data"},
+		{"name": "streak", "type": "core::option::Option::<core::integer::u32>", "kind": "data"},
+		{"name": "first", "type": "core::bool", "kind": "data"}
+	]},
+	{"type": "event", "name": "contracts::AuraToken::AuraToken::Event", "kind": "enum", "variants": [
+		{"name": "ERC20Event", "type": "openzeppelin_token::erc20::erc20::ERC20Component::Event", "kind": "nested"},
+		{"name": "OwnableEvent", "type": "openzeppelin_access::ownable::ownable::OwnableComponent::Event", "kind": "flat"},
+		{"name": "RewardMinted", "type": "contracts::AuraToken::AuraToken::RewardMinted", "kind": "nested"}
+	]}
+]`
+
+func TestDecodeEvent(t *testing.T) {
+	abi, err := ParseABI([]byte(tokenABI))
+	if err != nil {
+		t.Fatalf("ParseABI() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		keys   []string
+		data   []string
+		want   string
+		fields map[string]interface{}
+	}{
+		{
+			name: "own event",
+			keys: []string{SelectorFromName("RewardMinted"), "0x7", "0x00abc"},
+			data: append(append([]string{"0x2", "0x1"}, EncodeByteArray("Seven day streak")...), "0x0", "0x7", "0x1"),
+			want: "RewardMinted",
+			fields: map[string]interface{}{
+				"claim_id": "0x7",
+				"to":       "0xabc",
+				"amount":   "340282366920938463463374607431768211458",
+				"note":     "Seven day streak",
+				"streak":   int64(7),
+				"first":    true,
+			},
+		},
+		{
+			name:   "flat component event",
+			keys:   []string{SelectorFromName("OwnershipTransferred"), "0x0", "0x1"},
+			want:   "OwnershipTransferred",
+			fields: map[string]interface{}{"previous_owner": "0x0", "new_owner": "0x1"},
+		},
+		{
+			name:   "nested component event",
+			keys:   []string{SelectorFromName("ERC20Event"), SelectorFromName("Transfer"), "0x1", "0x2"},
+			data:   []string{"0x64", "0x0"},
+			want:   "Transfer",
+			fields: map[string]interface{}{"from": "0x1", "to": "0x2", "value": "100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := abi.DecodeEvent(tt.keys, tt.data)
+			if err != nil {
+				t.Fatalf("DecodeEvent() error = %v", err)
+			}
+			if event.Name != tt.want || !reflect.DeepEqual(event.Fields, tt.fields) {
+				t.Errorf("DecodeEvent() = %s %v, want %s %v", event.Name, event.Fields, tt.want, tt.fields)
+			}
+		})
+	}
+
+	if _, err := abi.DecodeEvent([]string{SelectorFromName("Transfer")}, nil); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("DecodeEvent(unnested Transfer) error = %v, want ErrUnknownEvent", err)
+	}
+	if _, err := abi.DecodeEvent([]string{SelectorFromName("RewardMinted"), "0x7"}, nil); err == nil {
+		t.Error("DecodeEvent(missing members) succeeded")
+	}
+}
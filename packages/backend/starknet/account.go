@@ -0,0 +1,175 @@
+package starknet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"aura-backend/tracing"
+)
+
+// Default fee margins, as starknet.js pads its estimates
+const (
+	DefaultAmountMargin = 1.5
+	DefaultPriceMargin  = 1.5
+)
+
+// AccountNode is the subset of the Starknet RPC an account sends through
+type AccountNode interface {
+	ChainID(ctx context.Context) (string, error)
+	GetNonce(ctx context.Context, block *BlockID, address string) (*big.Int, error)
+	EstimateFee(ctx context.Context, tx *InvokeTransaction) (*FeeEstimate, error)
+	AddInvokeTransaction(ctx context.Context, tx *InvokeTransaction) (string, error)
+}
+
+// AccountConfig configures the account the backend signs transactions with.
+// The account must be a Cairo 1 account checking Stark ECDSA signatures,
+// such as OpenZeppelin's or Argent's.
+type AccountConfig struct {
+	Address    string
+	PrivateKey string
+	// AmountMargin and PriceMargin multiply the estimated gas and gas price
+	// into the bounds of transactions, so they survive price moves and
+	// state changes between estimation and inclusion
+	AmountMargin float64
+	PriceMargin  float64
+}
+
+// Account signs and sends INVOKE v3 transactions from an account. Sends are
+// serialised so concurrent callers get consecutive nonces; the nonce is
+// cached between sends and read again from the node after any failure.
+type Account struct {
+	Node   AccountNode
+	Config AccountConfig
+
+	privateKey *big.Int
+
+	mu      sync.Mutex
+	chainID string
+	nonce   *big.Int // Next nonce, nil when it must be read from the node
+}
+
+// NewAccount creates the account, checking its address and private key
+func NewAccount(node AccountNode, config AccountConfig) (*Account, error) {
+	if _, err := ParseFelt(config.Address); err != nil {
+		return nil, fmt.Errorf("account address: %w", err)
+	}
+	privateKey, err := ParseFelt(config.PrivateKey)
+	if err != nil || privateKey.Sign() == 0 || privateKey.Cmp(curveOrder) >= 0 {
+		return nil, ErrInvalidKey
+	}
+	if config.AmountMargin < 1 || config.PriceMargin < 1 {
+		return nil, fmt.Errorf("fee margins must be at least 1, got %g and %g", config.AmountMargin, config.PriceMargin)
+	}
+	return &Account{Node: node, Config: config, privateKey: privateKey}, nil
+}
+
+// PublicKey returns the public key of the account's signer
+func (a *Account) PublicKey() string {
+	publicKey, _ := GetPublicKey(a.privateKey)
+	return FeltToHex(publicKey)
+}
+
+// Invoke executes the calls in one transaction and returns its hash
+func (a *Account) Invoke(ctx context.Context, calls []FunctionCall) (txHash string, err error) {
+	ctx, span := tracer.Start(ctx, "starknet.invoke")
+	defer func() { tracing.End(span, err) }()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	txHash, err = a.invoke(ctx, calls)
+	if err != nil {
+		// The node may have accepted the transaction or another sender used
+		// the nonce: only the node knows the next one
+		a.nonce = nil
+		return "", err
+	}
+	a.nonce = new(big.Int).Add(a.nonce, big.NewInt(1))
+	return txHash, nil
+}
+
+func (a *Account) invoke(ctx context.Context, calls []FunctionCall) (string, error) {
+	calldata, err := ExecuteCalldata(calls)
+	if err != nil {
+		return "", err
+	}
+
+	if a.chainID == "" {
+		if a.chainID, err = a.Node.ChainID(ctx); err != nil {
+			return "", fmt.Errorf("could not get chain id: %w", err)
+		}
+	}
+	if a.nonce == nil {
+		if a.nonce, err = a.Node.GetNonce(ctx, PendingBlock, a.Config.Address); err != nil {
+			return "", fmt.Errorf("could not get nonce: %w", err)
+		}
+	}
+
+	tx := &InvokeTransaction{
+		SenderAddress: a.Config.Address,
+		Calldata:      calldata,
+		Nonce:         a.nonce,
+	}
+
+	query := *tx
+	query.Query = true
+	estimate, err := a.Node.EstimateFee(ctx, &query)
+	if err != nil {
+		return "", fmt.Errorf("could not estimate fee: %w", err)
+	}
+	if tx.ResourceBounds, err = a.bounds(estimate); err != nil {
+		return "", err
+	}
+
+	if err := a.sign(tx); err != nil {
+		return "", err
+	}
+	return a.Node.AddInvokeTransaction(ctx, tx)
+}
+
+// bounds derives the L1 gas bounds from a fee estimate: the overall fee in
+// gas at the current price, both padded by the margins. L2 gas is not
+// charged separately yet.
+func (a *Account) bounds(estimate *FeeEstimate) (ResourceBounds, error) {
+	overallFee, err := ParseFelt(estimate.OverallFee)
+	if err != nil {
+		return ResourceBounds{}, fmt.Errorf("fee estimate: %w", err)
+	}
+	gasPrice, err := ParseFelt(estimate.GasPrice)
+	if err != nil || gasPrice.Sign() == 0 {
+		return ResourceBounds{}, fmt.Errorf("fee estimate: invalid gas price %q", estimate.GasPrice)
+	}
+
+	// Round up so data gas paid at its own price stays covered
+	amount := new(big.Int).Add(overallFee, new(big.Int).Sub(gasPrice, big.NewInt(1)))
+	amount.Quo(amount, gasPrice)
+
+	return ResourceBounds{L1Gas: ResourceBound{
+		MaxAmount:       scale(amount, a.Config.AmountMargin),
+		MaxPricePerUnit: scale(gasPrice, a.Config.PriceMargin),
+	}}, nil
+}
+
+func (a *Account) sign(tx *InvokeTransaction) error {
+	hash, err := tx.Hash(a.chainID)
+	if err != nil {
+		return err
+	}
+	r, s, err := Sign(hash, a.privateKey)
+	if err != nil {
+		return err
+	}
+	tx.Signature = []string{FeltToHex(r), FeltToHex(s)}
+	return nil
+}
+
+// scale multiplies an amount by a margin, rounding up
+func scale(value *big.Int, margin float64) *big.Int {
+	scaled, accuracy := new(big.Float).Mul(new(big.Float).SetInt(value), big.NewFloat(margin)).Int(nil)
+	if accuracy == big.Below {
+		scaled.Add(scaled, big.NewInt(1))
+	}
+	return scaled
+}
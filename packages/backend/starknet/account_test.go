@@ -0,0 +1,156 @@
+package starknet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+// fakeAccountNode records the transactions an account submits
+type fakeAccountNode struct {
+	mu        sync.Mutex
+	nonce     int64
+	nonceRead int
+	submitted []*InvokeTransaction
+	fail      error // Returned once by the next submission
+}
+
+func (n *fakeAccountNode) ChainID(ctx context.Context) (string, error) {
+	return "0x534e5f5345504f4c4941", nil
+}
+
+func (n *fakeAccountNode) GetNonce(ctx context.Context, block *BlockID, address string) (*big.Int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nonceRead++
+	return big.NewInt(n.nonce), nil
+}
+
+func (n *fakeAccountNode) EstimateFee(ctx context.Context, tx *InvokeTransaction) (*FeeEstimate, error) {
+	if !tx.Query || len(tx.Signature) != 0 {
+		return nil, errors.New("estimated a transaction that could be sent")
+	}
+	return &FeeEstimate{GasConsumed: "0x10", GasPrice: "0x64", OverallFee: "0x7d0", Unit: "FRI"}, nil
+}
+
+func (n *fakeAccountNode) AddInvokeTransaction(ctx context.Context, tx *InvokeTransaction) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail != nil {
+		err := n.fail
+		n.fail = nil
+		return "", err
+	}
+	if tx.Nonce.Int64() != n.nonce {
+		return "", &RPCError{Code: 52, Message: "Invalid transaction nonce"}
+	}
+	n.nonce++
+	n.submitted = append(n.submitted, tx)
+	return FeltToHex(big.NewInt(n.nonce)), nil
+}
+
+const testPrivateKey = "0x3c1e9550e66958296d11b60f8e8e7a7ad990d07fa65d5f7652c4a6c87d4e3cc"
+
+func TestAccountInvoke(t *testing.T) {
+	node := &fakeAccountNode{nonce: 5}
+	account, err := NewAccount(node, AccountConfig{
+		Address:      "0x2fd23d9182193775423497fc0c472e156c57c69e4089a1967fb288a2d84e914",
+		PrivateKey:   testPrivateKey,
+		AmountMargin: DefaultAmountMargin,
+		PriceMargin:  DefaultPriceMargin,
+	})
+	if err != nil {
+		t.Fatalf("NewAccount() error = %v", err)
+	}
+	call := FunctionCall{ContractAddress: "0xa", EntryPointSelector: SelectorFromName("mint"), Calldata: []string{"0x1"}}
+
+	// Concurrent sends get consecutive nonces from a single read
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := account.Invoke(context.Background(), []FunctionCall{call, call}); err != nil {
+				t.Errorf("Invoke() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(node.submitted) != 8 || node.nonce != 13 || node.nonceRead != 1 {
+		t.Fatalf("submitted %d transactions up to nonce %d with %d nonce reads", len(node.submitted), node.nonce, node.nonceRead)
+	}
+
+	tx := node.submitted[0]
+	if len(tx.Calldata) != 9 || tx.Calldata[0] != "0x2" {
+		t.Errorf("calldata = %v, want a multicall of 2 calls", tx.Calldata)
+	}
+	// 2000 FRI at 100 per gas, padded by half
+	if tx.ResourceBounds.L1Gas.MaxAmount.Int64() != 30 || tx.ResourceBounds.L1Gas.MaxPricePerUnit.Int64() != 150 {
+		t.Errorf("bounds = %+v", tx.ResourceBounds.L1Gas)
+	}
+
+	hash, _ := tx.Hash("0x534e5f5345504f4c4941")
+	publicKey := mustFelt(t, account.PublicKey())
+	if len(tx.Signature) != 2 || !Verify(hash, mustFelt(t, tx.Signature[0]), mustFelt(t, tx.Signature[1]), publicKey) {
+		t.Errorf("invalid signature %v", tx.Signature)
+	}
+
+	// A failed send reads the nonce from the node again
+	node.fail = errors.New("connection reset")
+	if _, err := account.Invoke(context.Background(), []FunctionCall{call}); err == nil {
+		t.Fatal("Invoke() succeeded while the node failed")
+	}
+	node.nonce = 20 // Sent by another process meanwhile
+	if _, err := account.Invoke(context.Background(), []FunctionCall{call}); err != nil {
+		t.Fatalf("Invoke() after a failure error = %v", err)
+	}
+	if node.nonceRead != 2 || node.nonce != 21 {
+		t.Errorf("nonce reads = %d, nonce = %d", node.nonceRead, node.nonce)
+	}
+}
+
+func TestNewAccount(t *testing.T) {
+	config := AccountConfig{Address: "0x1", PrivateKey: testPrivateKey, AmountMargin: 1, PriceMargin: 1}
+	if _, err := NewAccount(nil, config); err != nil {
+		t.Fatalf("NewAccount() error = %v", err)
+	}
+
+	for name, mutate := range map[string]func(*AccountConfig){
+		"zero key":     func(c *AccountConfig) { c.PrivateKey = "0x0" },
+		"invalid key":  func(c *AccountConfig) { c.PrivateKey = "key" },
+		"address":      func(c *AccountConfig) { c.Address = "operator" },
+		"small margin": func(c *AccountConfig) { c.PriceMargin = 0.9 },
+	} {
+		invalid := config
+		mutate(&invalid)
+		if _, err := NewAccount(nil, invalid); err == nil {
+			t.Errorf("NewAccount() accepted an invalid %s", name)
+		}
+	}
+}
+
+func TestClientInvokeMethods(t *testing.T) {
+	node := fakeNode(t, map[string]interface{}{
+		"starknet_getNonce":             "0x7",
+		"starknet_estimateFee":          []map[string]string{{"gas_consumed": "0x1", "gas_price": "0x2", "overall_fee": "0x2", "unit": "FRI"}},
+		"starknet_addInvokeTransaction": map[string]string{"transaction_hash": "0xabc"},
+		"starknet_chainId":              "0x534e5f5345504f4c4941",
+	})
+	defer node.Close()
+	client := NewClient(node.URL)
+	ctx := context.Background()
+
+	nonce, err := client.GetNonce(ctx, PendingBlock, "0x1")
+	if err != nil || nonce.Int64() != 7 {
+		t.Fatalf("GetNonce() = %v, %v", nonce, err)
+	}
+	tx := &InvokeTransaction{SenderAddress: "0x1", Calldata: []string{"0x0"}, Nonce: nonce, Query: true}
+	if estimate, err := client.EstimateFee(ctx, tx); err != nil || estimate.OverallFee != "0x2" {
+		t.Fatalf("EstimateFee() = %+v, %v", estimate, err)
+	}
+	if hash, err := client.AddInvokeTransaction(ctx, tx); err != nil || hash != "0xabc" {
+		t.Fatalf("AddInvokeTransaction() = %q, %v", hash, err)
+	}
+}
@@ -0,0 +1,294 @@
+package starknet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// ErrUnknownFunction is returned when a function is not declared in the ABI
+var ErrUnknownFunction = errors.New("function not in the ABI")
+
+// intBits are the widths of the Cairo integer types encoded in one felt
+var intBits = map[string]int{
+	"core::integer::u8": 8, "core::integer::u16": 16, "core::integer::u32": 32,
+	"core::integer::u64": 64, "core::integer::u128": 128,
+	"core::integer::i8": 8, "core::integer::i16": 16, "core::integer::i32": 32,
+	"core::integer::i64": 64, "core::integer::i128": 128,
+}
+
+// maxU256 is the largest u256
+var maxU256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// Call builds the call to a function of the contract at address, encoding
+// the arguments in the order of the function's inputs
+func (a *ABI) Call(address, function string, args ...interface{}) (FunctionCall, error) {
+	calldata, err := a.EncodeCalldata(function, args...)
+	if err != nil {
+		return FunctionCall{}, err
+	}
+	return FunctionCall{
+		ContractAddress:    address,
+		EntryPointSelector: SelectorFromName(function),
+		Calldata:           calldata,
+	}, nil
+}
+
+// EncodeCalldata serializes the arguments of a function. Arguments take the
+// values Decode returns: felts as hex or decimal strings or Go integers,
+// u256 as a *big.Int or string, ByteArray as a string, structs as maps of
+// their members, Option as nil or the value, other enums as a map of one
+// variant name to its value, and arrays as slices.
+func (a *ABI) EncodeCalldata(function string, args ...interface{}) ([]string, error) {
+	entry, ok := a.functions[function]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", function, ErrUnknownFunction)
+	}
+	if len(args) != len(entry.Inputs) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", function, len(entry.Inputs), len(args))
+	}
+
+	calldata := []string{}
+	for i, input := range entry.Inputs {
+		encoded, err := a.Encode(input.Type, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %s: %w", function, input.Name, err)
+		}
+		calldata = append(calldata, encoded...)
+	}
+	return calldata, nil
+}
+
+// DecodeOutputs decodes the result of a starknet_call to a function
+func (a *ABI) DecodeOutputs(function string, result []string) ([]interface{}, error) {
+	entry, ok := a.functions[function]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", function, ErrUnknownFunction)
+	}
+
+	reader := &feltReader{felts: result}
+	outputs := make([]interface{}, 0, len(entry.Outputs))
+	for _, output := range entry.Outputs {
+		value, err := a.decode(output.Type, reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", function, err)
+		}
+		outputs = append(outputs, value)
+	}
+	if reader.pos != len(result) {
+		return nil, fmt.Errorf("%s: %d unexpected trailing felts", function, len(result)-reader.pos)
+	}
+	return outputs, nil
+}
+
+// Decode reads a single value of a Cairo type from its serialization
+func (a *ABI) Decode(typ string, felts []string) (interface{}, error) {
+	reader := &feltReader{felts: felts}
+	value, err := a.decode(typ, reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader.pos != len(felts) {
+		return nil, fmt.Errorf("%d unexpected trailing felts", len(felts)-reader.pos)
+	}
+	return value, nil
+}
+
+// Encode serializes a value of a Cairo type, see EncodeCalldata for the
+// accepted Go values
+func (a *ABI) Encode(typ string, value interface{}) ([]string, error) {
+	switch {
+	case typ == "()":
+		return nil, nil
+	case hexTypes[typ]:
+		felt, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		if felt.Sign() < 0 || felt.Cmp(Prime) >= 0 {
+			return nil, fmt.Errorf("%s out of range for %s", felt, typ)
+		}
+		return []string{FeltToHex(felt)}, nil
+	case typ == "core::bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("want a bool, got %T", value)
+		}
+		if b {
+			return []string{"0x1"}, nil
+		}
+		return []string{"0x0"}, nil
+	case intBits[typ] > 0:
+		return encodeInt(typ, value)
+	case typ == "core::integer::u256":
+		n, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		if n.Sign() < 0 || n.Cmp(maxU256) > 0 {
+			return nil, fmt.Errorf("%s out of range for u256", n)
+		}
+		low, high := U256ToFelts(n)
+		return []string{low, high}, nil
+	case typ == "core::byte_array::ByteArray":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("want a string, got %T", value)
+		}
+		return EncodeByteArray(s), nil
+	case strings.HasPrefix(typ, "core::array::Array::<"), strings.HasPrefix(typ, "core::array::Span::<"):
+		return a.encodeArray(genericArgument(typ), value)
+	}
+
+	if members, ok := a.structs[typ]; ok {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("want a map of the members of %s, got %T", typ, value)
+		}
+		felts := []string{}
+		for _, member := range members {
+			field, ok := fields[member.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing member %s of %s", member.Name, typ)
+			}
+			encoded, err := a.Encode(member.Type, field)
+			if err != nil {
+				return nil, fmt.Errorf("member %s: %w", member.Name, err)
+			}
+			felts = append(felts, encoded...)
+		}
+		return felts, nil
+	}
+
+	if variants, ok := a.enums[typ]; ok {
+		name, variantValue, err := enumVariant(typ, value)
+		if err != nil {
+			return nil, err
+		}
+		for i, variant := range variants {
+			if variant.Name != name {
+				continue
+			}
+			encoded, err := a.Encode(variant.Type, variantValue)
+			if err != nil {
+				return nil, fmt.Errorf("variant %s: %w", name, err)
+			}
+			return append([]string{FeltToHex(big.NewInt(int64(i)))}, encoded...), nil
+		}
+		return nil, fmt.Errorf("%s has no variant %s", typ, name)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// enumVariant returns the variant an enum value selects. Options are nil
+// for None and the value itself for Some.
+func enumVariant(typ string, value interface{}) (string, interface{}, error) {
+	if strings.HasPrefix(typ, "core::option::Option::<") {
+		if value == nil {
+			return "None", nil, nil
+		}
+		return "Some", value, nil
+	}
+
+	variant, ok := value.(map[string]interface{})
+	if !ok || len(variant) != 1 {
+		return "", nil, fmt.Errorf("want a map of one variant of %s, got %v", typ, value)
+	}
+	for name, variantValue := range variant {
+		return name, variantValue, nil
+	}
+	return "", nil, nil
+}
+
+func (a *ABI) encodeArray(typ string, value interface{}) ([]string, error) {
+	items := reflect.ValueOf(value)
+	if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+		return nil, fmt.Errorf("want a slice, got %T", value)
+	}
+
+	felts := []string{FeltToHex(big.NewInt(int64(items.Len())))}
+	for i := 0; i < items.Len(); i++ {
+		encoded, err := a.Encode(typ, items.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		felts = append(felts, encoded...)
+	}
+	return felts, nil
+}
+
+// encodeInt checks an integer fits its Cairo type. Negative values of signed
+// types are encoded as their field opposites.
+func encodeInt(typ string, value interface{}) ([]string, error) {
+	n, err := toBigInt(value)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := intBits[typ]
+	if strings.HasPrefix(typ, "core::integer::i") {
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+		if n.Cmp(new(big.Int).Neg(limit)) < 0 || n.Cmp(limit) >= 0 {
+			return nil, fmt.Errorf("%s out of range for %s", n, typ)
+		}
+		if n.Sign() < 0 {
+			n = new(big.Int).Add(n, Prime)
+		}
+		return []string{FeltToHex(n)}, nil
+	}
+
+	if n.Sign() < 0 || n.BitLen() > bits {
+		return nil, fmt.Errorf("%s out of range for %s", n, typ)
+	}
+	return []string{FeltToHex(n)}, nil
+}
+
+// toBigInt converts a Go integer, a whole float64 as decoded from JSON, a
+// *big.Int, or a hex or decimal string
+func toBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		if v == nil {
+			return nil, errors.New("nil integer")
+		}
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if negative, ok := strings.CutPrefix(s, "-"); ok {
+			n, ok := new(big.Int).SetString(negative, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid integer %q", v)
+			}
+			return n.Neg(n), nil
+		}
+		if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+			n, ok := new(big.Int).SetString(hex, 16)
+			if !ok {
+				return nil, fmt.Errorf("invalid integer %q", v)
+			}
+			return n, nil
+		}
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", v)
+		}
+		return n, nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil, fmt.Errorf("%v is not an exact integer", v)
+		}
+		return big.NewInt(int64(v)), nil
+	}
+
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), nil
+	}
+	return nil, fmt.Errorf("want an integer, got %T", value)
+}
@@ -0,0 +1,168 @@
+package starknet
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// registryABI declares functions taking the types the encoder supports
+const registryABI = `[
+	{"type": "struct", "name": "core::integer::u256", "members": [
+		{"name": "low", "type": "core::integer::u128"},
+		{"name": "high", "type": "core::integer::u128"}
+	]},
+	{"type": "enum", "name": "core::bool", "variants": [
+		{"name": "False", "type": "()"},
+		{"name": "True", "type": "()"}
+	]},
+	{"type": "enum", "name": "core::option::Option::<core::integer::u32>", "variants": [
+		{"name": "Some", "type": "core::integer::u32"},
+		{"name": "None", "type": "()"}
+	]},
+	{"type": "enum", "name": "contracts::Registry::Visibility", "variants": [
+		{"name": "Public", "type": "()"},
+		{"name": "Friends", "type": "core::array::Span::<core::starknet::contract_address::ContractAddress>"}
+	]},
+	{"type": "struct", "name": "contracts::Registry::Profile", "members": [
+		{"name": "name", "type": "core::byte_array::ByteArray"},
+		{"name": "streak", "type": "core::option::Option::<core::integer::u32>"},
+		{"name": "offset", "type": "core::integer::i32"},
+		{"name": "visibility", "type": "contracts::Registry::Visibility"}
+	]},
+	{"type": "interface", "name": "contracts::Registry::IRegistry", "items": [
+		{"type": "function", "name": "mint", "inputs": [
+			{"name": "claim_id", "type": "core::felt252"},
+			{"name": "to", "type": "core::starknet::contract_address::ContractAddress"},
+			{"name": "amount", "type": "core::integer::u256"}
+		], "outputs": [{"type": "core::bool"}], "state_mutability": "external"},
+		{"type": "function", "name": "set_profile", "inputs": [
+			{"name": "profile", "type": "contracts::Registry::Profile"}
+		], "outputs": [], "state_mutability": "external"},
+		{"type": "function", "name": "balance", "inputs": [], "outputs": [
+			{"type": "core::integer::u256"},
+			{"type": "core::integer::u8"}
+		], "state_mutability": "view"}
+	]}
+]`
+
+func TestEncodeCalldata(t *testing.T) {
+	abi, err := ParseABI([]byte(registryABI))
+	if err != nil {
+		t.Fatalf("ParseABI() error = %v", err)
+	}
+
+	amount := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(3), 128), big.NewInt(5))
+	call, err := abi.Call("0x0abc", "mint", "0x7", "0x00def", amount)
+	if err != nil {
+		t.Fatalf("Call(mint) error = %v", err)
+	}
+	want := FunctionCall{
+		ContractAddress:    "0x0abc",
+		EntryPointSelector: SelectorFromName("mint"),
+		Calldata:           []string{"0x7", "0xdef", "0x5", "0x3"},
+	}
+	if !reflect.DeepEqual(call, want) {
+		t.Errorf("Call(mint) = %+v, want %+v", call, want)
+	}
+
+	tests := []struct {
+		name    string
+		profile map[string]interface{}
+		want    []string
+	}{
+		{
+			name: "some and unit variant",
+			profile: map[string]interface{}{
+				"name":       "Ada",
+				"streak":     int64(12),
+				"offset":     int64(-2),
+				"visibility": map[string]interface{}{"Public": nil},
+			},
+			want: []string{
+				"0x0", "0x416461", "0x3", // ByteArray "Ada"
+				"0x0", "0xc", // Some(12)
+				FeltToHex(new(big.Int).Sub(Prime, big.NewInt(2))),
+				"0x0",
+			},
+		},
+		{
+			name: "none and variant with data",
+			profile: map[string]interface{}{
+				"name":       "",
+				"streak":     nil,
+				"offset":     int64(3),
+				"visibility": map[string]interface{}{"Friends": []interface{}{"0x1", "0x2"}},
+			},
+			want: []string{"0x0", "0x0", "0x0", "0x1", "0x3", "0x1", "0x2", "0x1", "0x2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calldata, err := abi.EncodeCalldata("set_profile", tt.profile)
+			if err != nil {
+				t.Fatalf("EncodeCalldata() error = %v", err)
+			}
+			if !reflect.DeepEqual(calldata, tt.want) {
+				t.Fatalf("EncodeCalldata() = %v, want %v", calldata, tt.want)
+			}
+
+			// Decoding gives back the profile
+			decoded, err := abi.Decode("contracts::Registry::Profile", calldata)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			encoded, err := abi.Encode("contracts::Registry::Profile", decoded)
+			if err != nil || !reflect.DeepEqual(encoded, calldata) {
+				t.Errorf("Encode(Decode()) = %v, %v, want %v", encoded, err, calldata)
+			}
+		})
+	}
+
+	outputs, err := abi.DecodeOutputs("balance", []string{"0x5", "0x3", "0x12"})
+	if err != nil || !reflect.DeepEqual(outputs, []interface{}{amount.String(), int64(18)}) {
+		t.Errorf("DecodeOutputs(balance) = %v, %v", outputs, err)
+	}
+}
+
+func TestEncodeCalldataErrors(t *testing.T) {
+	abi, err := ParseABI([]byte(registryABI))
+	if err != nil {
+		t.Fatalf("ParseABI() error = %v", err)
+	}
+
+	if _, err := abi.EncodeCalldata("burn"); !errors.Is(err, ErrUnknownFunction) {
+		t.Errorf("EncodeCalldata(burn) error = %v, want ErrUnknownFunction", err)
+	}
+
+	tests := []struct {
+		name  string
+		typ   string
+		value interface{}
+	}{
+		{"felt out of range", "core::felt252", FeltToHex(Prime)},
+		{"u8 overflow", "core::integer::u8", 256},
+		{"negative unsigned", "core::integer::u32", -1},
+		{"i8 underflow", "core::integer::i8", -129},
+		{"u256 overflow", "core::integer::u256", new(big.Int).Lsh(big.NewInt(1), 256)},
+		{"fractional number", "core::integer::u32", 1.5},
+		{"not a string", "core::byte_array::ByteArray", 7},
+		{"missing member", "contracts::Registry::Profile", map[string]interface{}{"name": "Ada"}},
+		{"unknown variant", "contracts::Registry::Visibility", map[string]interface{}{"Private": nil}},
+		{"unsupported type", "core::integer::u512", "0x1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if felts, err := abi.Encode(tt.typ, tt.value); err == nil {
+				t.Errorf("Encode() = %v, want an error", felts)
+			}
+		})
+	}
+
+	if _, err := abi.Decode("core::integer::u256", []string{"0x1", "0x0", "0x0"}); err == nil {
+		t.Error("Decode() succeeded with trailing felts")
+	}
+}
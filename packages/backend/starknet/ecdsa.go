@@ -0,0 +1,272 @@
+package starknet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// The STARK curve y^2 = x^3 + x + beta over the felt field
+var (
+	curveBeta, _  = new(big.Int).SetString("6f21413efbe40de150e596d72f7a8c5609ad26c15c915c1f4cdfcb99cee9e89", 16)
+	curveOrder, _ = new(big.Int).SetString("800000000000010ffffffffffffffffb781126dcae7b2321e66a241adc64d2f", 16)
+	generatorX, _ = new(big.Int).SetString("1ef15c18599971b7beced415a40f0c7deacfd9b0d1819e03d723d8bc943cfca", 16)
+	generatorY, _ = new(big.Int).SetString("5668060aa49730b7be4801df46ec62de53ecd11abe43a32873000c36e8dc1f", 16)
+)
+
+// maxSignable bounds message hashes, r and w: Stark ECDSA works on 251-bit values
+var maxSignable = new(big.Int).Lsh(big.NewInt(1), 251)
+
+// ErrInvalidKey is returned for a private key outside [1, curve order)
+var ErrInvalidKey = errors.New("invalid private key")
+
+// point is an affine point of the curve, nil being the point at infinity
+type point struct {
+	x, y *big.Int
+}
+
+var generator = &point{generatorX, generatorY}
+
+func (p *point) add(q *point) *point {
+	switch {
+	case p == nil:
+		return q
+	case q == nil:
+		return p
+	case p.x.Cmp(q.x) == 0:
+		if p.y.Cmp(q.y) != 0 || p.y.Sign() == 0 {
+			return nil
+		}
+		return p.double()
+	}
+
+	dx := new(big.Int).Sub(q.x, p.x)
+	slope := new(big.Int).Sub(q.y, p.y)
+	slope.Mul(slope, dx.ModInverse(dx.Mod(dx, Prime), Prime))
+	return p.withSlope(q, slope.Mod(slope, Prime))
+}
+
+func (p *point) double() *point {
+	if p == nil || p.y.Sign() == 0 {
+		return nil
+	}
+
+	// slope = (3x^2 + alpha) / 2y with alpha = 1
+	slope := new(big.Int).Mul(p.x, p.x)
+	slope.Mul(slope, three).Add(slope, big.NewInt(1))
+	slope.Mul(slope, new(big.Int).ModInverse(new(big.Int).Lsh(p.y, 1), Prime))
+	return p.withSlope(p, slope.Mod(slope, Prime))
+}
+
+// withSlope completes the addition of p and q given the slope of their line
+func (p *point) withSlope(q *point, slope *big.Int) *point {
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, p.x).Sub(x, q.x).Mod(x, Prime)
+
+	y := new(big.Int).Sub(p.x, x)
+	y.Mul(y, slope).Sub(y, p.y).Mod(y, Prime)
+	return &point{x, y}
+}
+
+func (p *point) multiply(k *big.Int) *point {
+	var result *point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if k.Bit(i) == 1 {
+			result = result.add(p)
+		}
+	}
+	return result
+}
+
+func (p *point) onCurve() bool {
+	left := new(big.Int).Mul(p.y, p.y)
+	right := new(big.Int).Exp(p.x, three, Prime)
+	right.Add(right, p.x).Add(right, curveBeta)
+	return left.Mod(left, Prime).Cmp(right.Mod(right, Prime)) == 0
+}
+
+// GetPublicKey returns the public key of a private key, the x coordinate of
+// its multiple of the generator
+func GetPublicKey(privateKey *big.Int) (*big.Int, error) {
+	if privateKey.Sign() <= 0 || privateKey.Cmp(curveOrder) >= 0 {
+		return nil, ErrInvalidKey
+	}
+	return generator.multiply(privateKey).x, nil
+}
+
+// GeneratePrivateKey draws a private key uniformly from [1, curve order)
+// using the given source of randomness, crypto/rand.Reader when nil
+func GeneratePrivateKey(random io.Reader) (*big.Int, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	key, err := rand.Int(random, new(big.Int).Sub(curveOrder, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return key.Add(key, big.NewInt(1)), nil
+}
+
+// Sign signs a message hash with the Stark ECDSA variant accounts verify:
+// r is the x coordinate of k*G itself rather than reduced by the order, and
+// r, w = k / (hash + r*key) and the hash must all fit in 251 bits. k is
+// derived from the key and hash as in RFC 6979, so signatures are
+// deterministic.
+func Sign(messageHash, privateKey *big.Int) (r, s *big.Int, err error) {
+	if messageHash.Sign() < 0 || messageHash.Cmp(maxSignable) >= 0 {
+		return nil, nil, errors.New("message hash does not fit in 251 bits")
+	}
+	if privateKey.Sign() <= 0 || privateKey.Cmp(curveOrder) >= 0 {
+		return nil, nil, ErrInvalidKey
+	}
+
+	for attempt := 0; ; attempt++ {
+		k := generateK(messageHash, privateKey, attempt)
+
+		r = generator.multiply(k).x
+		if r.Sign() == 0 || r.Cmp(maxSignable) >= 0 {
+			continue
+		}
+
+		// s = (hash + r*key) / k
+		sum := new(big.Int).Mul(r, privateKey)
+		sum.Add(sum, messageHash).Mod(sum, curveOrder)
+		if sum.Sign() == 0 {
+			continue
+		}
+		w := new(big.Int).Mul(k, new(big.Int).ModInverse(sum, curveOrder))
+		w.Mod(w, curveOrder)
+		if w.Sign() == 0 || w.Cmp(maxSignable) >= 0 {
+			continue
+		}
+
+		return r, new(big.Int).ModInverse(w, curveOrder), nil
+	}
+}
+
+// Verify checks a Stark ECDSA signature of a message hash against a public key
+func Verify(messageHash, r, s, publicKey *big.Int) bool {
+	if messageHash.Sign() < 0 || messageHash.Cmp(maxSignable) >= 0 ||
+		r.Sign() <= 0 || r.Cmp(maxSignable) >= 0 ||
+		s.Sign() <= 0 || s.Cmp(curveOrder) >= 0 {
+		return false
+	}
+	w := new(big.Int).ModInverse(s, curveOrder)
+	if w == nil || w.Cmp(maxSignable) >= 0 {
+		return false
+	}
+
+	// Both points with this x coordinate are valid keys
+	y := curveY(publicKey)
+	if y == nil {
+		return false
+	}
+	key := &point{publicKey, y}
+
+	// k*G = (hash*w)*G + (r*w)*key
+	u1 := new(big.Int).Mul(messageHash, w)
+	u2 := new(big.Int).Mul(r, w)
+	a := generator.multiply(u1.Mod(u1, curveOrder))
+	b := key.multiply(u2.Mod(u2, curveOrder))
+	for _, candidate := range []*point{a.add(b), a.add(b.negate())} {
+		if candidate != nil && candidate.x.Cmp(r) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *point) negate() *point {
+	if p == nil {
+		return nil
+	}
+	return &point{p.x, new(big.Int).Sub(Prime, p.y)}
+}
+
+// curveY returns a y coordinate of the curve point with the given x, or nil
+func curveY(x *big.Int) *big.Int {
+	if x.Sign() < 0 || x.Cmp(Prime) >= 0 {
+		return nil
+	}
+	y2 := new(big.Int).Exp(x, three, Prime)
+	y2.Add(y2, x).Add(y2, curveBeta).Mod(y2, Prime)
+	return new(big.Int).ModSqrt(y2, Prime)
+}
+
+// generateK derives the nonce of a signature as RFC 6979 does with
+// HMAC-SHA256, padding the hash like cairo-lang's generate_k_rfc6979. Later
+// attempts mix in a counter as extra entropy.
+func generateK(messageHash, privateKey *big.Int, attempt int) *big.Int {
+	// A hash one nibble short of 252 bits is shifted, as elliptic.js does
+	h := new(big.Int).Set(messageHash)
+	if bits := h.BitLen(); bits >= 248 && bits%8 >= 1 && bits%8 <= 4 {
+		h.Lsh(h, 4)
+	}
+
+	var extra []byte
+	if attempt > 0 {
+		extra = big.NewInt(int64(attempt)).Bytes()
+	}
+
+	qlen := curveOrder.BitLen()
+	rolen := (qlen + 7) / 8
+	key := int2octets(privateKey, rolen)
+	message := bits2octets(h.Bytes(), qlen, rolen)
+
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+
+	mac := func(key []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, key)
+		for _, part := range parts {
+			m.Write(part)
+		}
+		return m.Sum(nil)
+	}
+	k = mac(k, v, []byte{0x00}, key, message, extra)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, key, message, extra)
+	v = mac(k, v)
+
+	for {
+		var t []byte
+		for len(t) < rolen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		candidate := bits2int(t, qlen)
+		if candidate.Sign() > 0 && candidate.Cmp(curveOrder) < 0 {
+			return candidate
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+// bits2int keeps the qlen leftmost bits of a byte string
+func bits2int(data []byte, qlen int) *big.Int {
+	value := new(big.Int).SetBytes(data)
+	if excess := len(data)*8 - qlen; excess > 0 {
+		value.Rsh(value, uint(excess))
+	}
+	return value
+}
+
+func int2octets(value *big.Int, rolen int) []byte {
+	return value.FillBytes(make([]byte, rolen))
+}
+
+func bits2octets(data []byte, qlen, rolen int) []byte {
+	z := bits2int(data, qlen)
+	if z.Cmp(curveOrder) >= 0 {
+		z.Sub(z, curveOrder)
+	}
+	return int2octets(z, rolen)
+}
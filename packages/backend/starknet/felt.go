@@ -0,0 +1,106 @@
+package starknet
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Prime is the order of the field felts live in: 2^251 + 17*2^192 + 1
+var Prime, _ = new(big.Int).SetString("800000000000011000000000000000000000000000000000000000000000001", 16)
+
+// mask250 keeps the 250 low bits of a keccak digest, as starknet_keccak does
+var mask250 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 250), big.NewInt(1))
+
+// mask128 keeps the low half of a u256
+var mask128 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+// ParseFelt parses a hex (0x-prefixed) or decimal string into a field element
+func ParseFelt(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	value := new(big.Int)
+
+	var ok bool
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		hex := s[2:]
+		if hex == "" {
+			hex = "0"
+		}
+		_, ok = value.SetString(hex, 16)
+	} else {
+		_, ok = value.SetString(s, 10)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("invalid felt %q", s)
+	}
+	if value.Sign() < 0 || value.Cmp(Prime) >= 0 {
+		return nil, fmt.Errorf("felt %q out of range", s)
+	}
+
+	return value, nil
+}
+
+// FeltToHex formats a field element as a 0x-prefixed hex string without leading zeros
+func FeltToHex(value *big.Int) string {
+	return "0x" + value.Text(16)
+}
+
+// NormalizeAddress returns the canonical form of an address so that
+// differently padded or cased spellings compare equal
+func NormalizeAddress(address string) string {
+	value, err := ParseFelt(address)
+	if err != nil {
+		return strings.ToLower(address)
+	}
+	return FeltToHex(value)
+}
+
+// SelectorFromName computes the entry point selector (starknet_keccak) of a function or event name
+func SelectorFromName(name string) string {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(name))
+
+	value := new(big.Int).SetBytes(hash.Sum(nil))
+	value.And(value, mask250)
+
+	return FeltToHex(value)
+}
+
+// U256FromFelts joins the low and high 128-bit halves of a Cairo u256
+func U256FromFelts(low, high string) (*big.Int, error) {
+	lowValue, err := ParseFelt(low)
+	if err != nil {
+		return nil, err
+	}
+	highValue, err := ParseFelt(high)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Add(new(big.Int).Lsh(highValue, 128), lowValue), nil
+}
+
+// U256ToFelts splits a Cairo u256 into its low and high 128-bit halves
+func U256ToFelts(value *big.Int) (low, high string) {
+	return FeltToHex(new(big.Int).And(value, mask128)), FeltToHex(new(big.Int).Rsh(value, 128))
+}
+
+// bytesPerWord is the number of bytes a ByteArray packs in each full felt
+const bytesPerWord = 31
+
+// EncodeByteArray serializes a string as a Cairo ByteArray: the number of
+// full 31-byte words, the words, then the pending word and its length
+func EncodeByteArray(s string) []string {
+	data := []byte(s)
+	full := len(data) / bytesPerWord
+
+	felts := []string{FeltToHex(big.NewInt(int64(full)))}
+	for i := 0; i < full; i++ {
+		felts = append(felts, FeltToHex(new(big.Int).SetBytes(data[i*bytesPerWord:(i+1)*bytesPerWord])))
+	}
+	pending := data[full*bytesPerWord:]
+	return append(felts, FeltToHex(new(big.Int).SetBytes(pending)), FeltToHex(big.NewInt(int64(len(pending)))))
+}
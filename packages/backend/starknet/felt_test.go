@@ -0,0 +1,41 @@
+package starknet
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeByteArray(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{"0x0", "0x0", "0x0"}},
+		{"hello", []string{"0x0", "0x68656c6c6f", "0x5"}},
+		{
+			strings.Repeat("a", 31) + "b",
+			[]string{"0x1", "0x" + strings.Repeat("61", 31), "0x62", "0x1"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := EncodeByteArray(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EncodeByteArray(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestU256ToFelts(t *testing.T) {
+	value, _ := new(big.Int).SetString("340282366920938463463374607431768211457", 10) // 2^128 + 1
+	low, high := U256ToFelts(value)
+	if low != "0x1" || high != "0x1" {
+		t.Fatalf("U256ToFelts = %s, %s", low, high)
+	}
+
+	joined, err := U256FromFelts(low, high)
+	if err != nil || joined.Cmp(value) != 0 {
+		t.Errorf("round trip = %v, %v", joined, err)
+	}
+}
@@ -0,0 +1,95 @@
+package starknet
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"strconv"
+)
+
+// Parameters of the Starknet Poseidon permutation (Hades): a state of three
+// felts, 8 full rounds split around 83 partial rounds, and x^3 as S-box
+const (
+	poseidonWidth         = 3
+	poseidonFullRounds    = 8
+	poseidonPartialRounds = 83
+)
+
+// poseidonRoundKeys are the constants added to the state at each round,
+// sha256("Hades<index>") reduced into the field as cairo-lang derives them
+var poseidonRoundKeys = func() [][poseidonWidth]*big.Int {
+	keys := make([][poseidonWidth]*big.Int, poseidonFullRounds+poseidonPartialRounds)
+	for round := range keys {
+		for i := 0; i < poseidonWidth; i++ {
+			digest := sha256.Sum256([]byte("Hades" + strconv.Itoa(round*poseidonWidth+i)))
+			keys[round][i] = new(big.Int).Mod(new(big.Int).SetBytes(digest[:]), Prime)
+		}
+	}
+	return keys
+}()
+
+// PoseidonHash hashes two felts
+func PoseidonHash(a, b *big.Int) *big.Int {
+	state := [poseidonWidth]*big.Int{new(big.Int).Set(a), new(big.Int).Set(b), big.NewInt(2)}
+	hadesPermutation(&state)
+	return state[0]
+}
+
+// PoseidonHashMany hashes a sequence of felts with the sponge construction
+// of poseidon_hash_many: the input is padded with 1 then zeros to an even
+// length and absorbed two felts at a time
+func PoseidonHashMany(values []*big.Int) *big.Int {
+	padded := append(append([]*big.Int{}, values...), big.NewInt(1))
+	if len(padded)%2 == 1 {
+		padded = append(padded, big.NewInt(0))
+	}
+
+	state := [poseidonWidth]*big.Int{big.NewInt(0), big.NewInt(0), big.NewInt(0)}
+	for i := 0; i < len(padded); i += 2 {
+		state[0] = addMod(state[0], padded[i])
+		state[1] = addMod(state[1], padded[i+1])
+		hadesPermutation(&state)
+	}
+	return state[0]
+}
+
+// hadesPermutation applies the rounds of the permutation in place. Full
+// rounds cube the whole state, partial rounds only its last felt.
+func hadesPermutation(state *[poseidonWidth]*big.Int) {
+	three := big.NewInt(3)
+	for round, keys := range poseidonRoundKeys {
+		for i := range state {
+			state[i] = addMod(state[i], keys[i])
+		}
+
+		full := round < poseidonFullRounds/2 || round >= poseidonFullRounds/2+poseidonPartialRounds
+		for i := range state {
+			if full || i == poseidonWidth-1 {
+				state[i] = new(big.Int).Exp(state[i], three, Prime)
+			}
+		}
+
+		mixLayer(state)
+	}
+}
+
+// mixLayer multiplies the state by the MDS matrix
+// [[3, 1, 1], [1, -1, 1], [1, 1, -2]]
+func mixLayer(state *[poseidonWidth]*big.Int) {
+	sum := new(big.Int).Add(state[0], state[1])
+	sum.Add(sum, state[2])
+
+	a := new(big.Int).Add(sum, new(big.Int).Lsh(state[0], 1))
+	b := new(big.Int).Sub(sum, new(big.Int).Lsh(state[1], 1))
+	c := new(big.Int).Sub(sum, new(big.Int).Mul(state[2], three))
+
+	state[0] = a.Mod(a, Prime)
+	state[1] = b.Mod(b, Prime)
+	state[2] = c.Mod(c, Prime)
+}
+
+var three = big.NewInt(3)
+
+func addMod(a, b *big.Int) *big.Int {
+	sum := new(big.Int).Add(a, b)
+	return sum.Mod(sum, Prime)
+}
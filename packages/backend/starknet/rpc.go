@@ -0,0 +1,374 @@
+package starknet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"aura-backend/logging"
+	"aura-backend/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("aura-backend/starknet")
+
+// Starknet JSON-RPC error codes the backend reacts to
+const (
+	ErrCodeFailedToReceive     = 1
+	ErrCodeBlockNotFound       = 24
+	ErrCodeTransactionNotFound = 29
+	ErrCodeInvalidNonce        = 52
+	ErrCodeInsufficientFee     = 53
+	ErrCodeUnexpected          = 63
+	ErrCodeInternal            = -32603
+)
+
+// RPCError is an error returned by the node in a JSON-RPC response
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("rpc error %d: %s (%s)", e.Code, e.Message, string(e.Data))
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err means the requested block or transaction does not exist
+func IsNotFound(err error) bool {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == ErrCodeTransactionNotFound || rpcErr.Code == ErrCodeBlockNotFound
+	}
+	return false
+}
+
+// IsTransient reports whether sending a transaction again may succeed after
+// err: the node could not be reached or failed, or the nonce or fee went
+// stale. Errors about the transaction itself, such as a failed execution or
+// validation, are not transient.
+func IsTransient(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err != nil
+	}
+	switch rpcErr.Code {
+	case ErrCodeFailedToReceive, ErrCodeInvalidNonce, ErrCodeInsufficientFee, ErrCodeUnexpected, ErrCodeInternal:
+		return true
+	}
+	return false
+}
+
+// Client is a minimal Starknet JSON-RPC client
+type Client struct {
+	url        string
+	httpClient *http.Client
+	nextID     atomic.Uint64
+}
+
+// NewClient creates a client for the node at the given RPC URL
+func NewClient(url string) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// Call invokes an RPC method and decodes its result into result
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ctx, span := tracer.Start(ctx, "starknet "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.RPCSystemKey.String("jsonrpc"), semconv.RPCMethod(method)),
+	)
+	err := c.call(ctx, method, params, result)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Drop the URL from the error, node URLs often embed an API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", method, resp.StatusCode)
+	}
+
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: could not decode response: %w", method, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// BlockID identifies a block either by number or by tag ("latest", "pending")
+type BlockID struct {
+	Number *uint64
+	Tag    string
+}
+
+// BlockNumberID returns a BlockID referring to a block by number
+func BlockNumberID(number uint64) *BlockID {
+	return &BlockID{Number: &number}
+}
+
+// LatestBlock refers to the latest accepted block
+var LatestBlock = &BlockID{Tag: "latest"}
+
+func (b BlockID) MarshalJSON() ([]byte, error) {
+	if b.Number != nil {
+		return json.Marshal(map[string]uint64{"block_number": *b.Number})
+	}
+	return json.Marshal(b.Tag)
+}
+
+// BlockNumber returns the number of the latest accepted block
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var number uint64
+	err := c.Call(ctx, "starknet_blockNumber", []interface{}{}, &number)
+	return number, err
+}
+
+// ChainID returns the chain id of the network the node is connected to
+func (c *Client) ChainID(ctx context.Context) (string, error) {
+	var chainID string
+	err := c.Call(ctx, "starknet_chainId", []interface{}{}, &chainID)
+	return chainID, err
+}
+
+// BlockHeader is the subset of a block header the backend uses
+type BlockHeader struct {
+	BlockHash   string `json:"block_hash"`
+	BlockNumber uint64 `json:"block_number"`
+	Timestamp   uint64 `json:"timestamp"`
+}
+
+// GetBlockHeader returns the header of an accepted block
+func (c *Client) GetBlockHeader(ctx context.Context, block *BlockID) (*BlockHeader, error) {
+	var header BlockHeader
+	err := c.Call(ctx, "starknet_getBlockWithTxHashes", map[string]interface{}{"block_id": block}, &header)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// EventFilter selects the events returned by GetEvents
+type EventFilter struct {
+	FromBlock         *BlockID   `json:"from_block,omitempty"`
+	ToBlock           *BlockID   `json:"to_block,omitempty"`
+	Address           string     `json:"address,omitempty"`
+	Keys              [][]string `json:"keys,omitempty"`
+	ChunkSize         int        `json:"chunk_size"`
+	ContinuationToken string     `json:"continuation_token,omitempty"`
+}
+
+// EmittedEvent is an event as returned by starknet_getEvents
+type EmittedEvent struct {
+	FromAddress     string   `json:"from_address"`
+	Keys            []string `json:"keys"`
+	Data            []string `json:"data"`
+	BlockHash       string   `json:"block_hash"`
+	BlockNumber     uint64   `json:"block_number"`
+	TransactionHash string   `json:"transaction_hash"`
+}
+
+// EventsPage is one chunk of events with the token to request the next one
+type EventsPage struct {
+	Events            []EmittedEvent `json:"events"`
+	ContinuationToken string         `json:"continuation_token,omitempty"`
+}
+
+// GetEvents returns a page of events matching the filter
+func (c *Client) GetEvents(ctx context.Context, filter EventFilter) (*EventsPage, error) {
+	var page EventsPage
+	err := c.Call(ctx, "starknet_getEvents", map[string]interface{}{"filter": filter}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// FunctionCall is a call to a contract entry point, read with starknet_call
+// or executed by an account in an INVOKE transaction
+type FunctionCall struct {
+	ContractAddress    string   `json:"contract_address"`
+	EntryPointSelector string   `json:"entry_point_selector"`
+	Calldata           []string `json:"calldata"`
+}
+
+// CallContract runs a view function at a block and returns its result felts
+func (c *Client) CallContract(ctx context.Context, call FunctionCall, block *BlockID) ([]string, error) {
+	if call.Calldata == nil {
+		call.Calldata = []string{}
+	}
+	var result []string
+	err := c.Call(ctx, "starknet_call", map[string]interface{}{"request": call, "block_id": block}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Sender submits INVOKE transactions from an account, such as the backend's
+// operator account, and returns the transaction hash
+type Sender interface {
+	Invoke(ctx context.Context, calls []FunctionCall) (string, error)
+}
+
+// Transaction execution and finality statuses
+const (
+	ExecutionSucceeded = "SUCCEEDED"
+	ExecutionReverted  = "REVERTED"
+	FinalityAcceptedL2 = "ACCEPTED_ON_L2"
+	FinalityAcceptedL1 = "ACCEPTED_ON_L1"
+)
+
+// Receipt is the subset of a transaction receipt the backend uses
+type Receipt struct {
+	TransactionHash string         `json:"transaction_hash"`
+	ExecutionStatus string         `json:"execution_status"`
+	FinalityStatus  string         `json:"finality_status"`
+	BlockHash       string         `json:"block_hash,omitempty"`
+	BlockNumber     uint64         `json:"block_number,omitempty"`
+	RevertReason    string         `json:"revert_reason,omitempty"`
+	ActualFee       *FeePayment    `json:"actual_fee,omitempty"`
+	Events          []ReceiptEvent `json:"events,omitempty"`
+}
+
+// FeePayment is the fee charged for a transaction, in FRI for version 3
+// transactions
+type FeePayment struct {
+	Amount string `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+// ReceiptEvent is an event emitted by a transaction, as embedded in its receipt
+type ReceiptEvent struct {
+	FromAddress string   `json:"from_address"`
+	Keys        []string `json:"keys"`
+	Data        []string `json:"data"`
+}
+
+// GetTransactionReceipt returns the receipt of a transaction
+func (c *Client) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt Receipt
+	err := c.Call(ctx, "starknet_getTransactionReceipt", map[string]string{"transaction_hash": txHash}, &receipt)
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// PendingBlock refers to the block being built, which includes the latest
+// accepted transactions
+var PendingBlock = &BlockID{Tag: "pending"}
+
+// GetNonce returns the nonce of an account at a block
+func (c *Client) GetNonce(ctx context.Context, block *BlockID, address string) (*big.Int, error) {
+	var nonce string
+	err := c.Call(ctx, "starknet_getNonce", map[string]interface{}{"block_id": block, "contract_address": address}, &nonce)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFelt(nonce)
+}
+
+// FeeEstimate is the estimated cost of a transaction. Amounts are hex
+// strings, in FRI for v3 transactions.
+type FeeEstimate struct {
+	GasConsumed     string `json:"gas_consumed"`
+	GasPrice        string `json:"gas_price"`
+	DataGasConsumed string `json:"data_gas_consumed"`
+	DataGasPrice    string `json:"data_gas_price"`
+	OverallFee      string `json:"overall_fee"`
+	Unit            string `json:"unit"`
+}
+
+// EstimateFee estimates the fee of a transaction against the pending block,
+// without running the account's validation so it needs no signature
+func (c *Client) EstimateFee(ctx context.Context, tx *InvokeTransaction) (*FeeEstimate, error) {
+	var estimates []FeeEstimate
+	err := c.Call(ctx, "starknet_estimateFee", map[string]interface{}{
+		"request":          []*InvokeTransaction{tx},
+		"simulation_flags": []string{"SKIP_VALIDATE"},
+		"block_id":         PendingBlock,
+	}, &estimates)
+	if err != nil {
+		return nil, err
+	}
+	if len(estimates) != 1 {
+		return nil, fmt.Errorf("starknet_estimateFee: got %d estimates for one transaction", len(estimates))
+	}
+	return &estimates[0], nil
+}
+
+// AddInvokeTransaction submits a signed INVOKE transaction and returns its hash
+func (c *Client) AddInvokeTransaction(ctx context.Context, tx *InvokeTransaction) (string, error) {
+	var result struct {
+		TransactionHash string `json:"transaction_hash"`
+	}
+	err := c.Call(ctx, "starknet_addInvokeTransaction", map[string]interface{}{"invoke_transaction": tx}, &result)
+	return result.TransactionHash, err
+}
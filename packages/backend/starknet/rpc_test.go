@@ -0,0 +1,135 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeNode answers JSON-RPC calls with canned results keyed by method name
+func fakeNode(t *testing.T, results map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     uint64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("invalid request: %v", err)
+		}
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		result, ok := results[request.Method]
+		if rpcErr, isErr := result.(*RPCError); isErr {
+			response["error"] = rpcErr
+		} else if ok {
+			response["result"] = result
+		} else {
+			response["error"] = &RPCError{Code: -32601, Message: "Method not found"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestClientGetEvents(t *testing.T) {
+	node := fakeNode(t, map[string]interface{}{
+		"starknet_blockNumber": 1234,
+		"starknet_getEvents": map[string]interface{}{
+			"events": []map[string]interface{}{{
+				"from_address":     "0x4718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d",
+				"keys":             []string{SelectorFromName("Transfer")},
+				"data":             []string{"0x1", "0x2", "0x64", "0x0"},
+				"block_number":     1200,
+				"block_hash":       "0xabc",
+				"transaction_hash": "0xdef",
+			}},
+			"continuation_token": "next",
+		},
+	})
+	defer node.Close()
+
+	client := NewClient(node.URL)
+
+	head, err := client.BlockNumber(context.Background())
+	if err != nil || head != 1234 {
+		t.Fatalf("BlockNumber() = %d, %v", head, err)
+	}
+
+	page, err := client.GetEvents(context.Background(), EventFilter{FromBlock: BlockNumberID(1), ToBlock: LatestBlock, ChunkSize: 10})
+	if err != nil {
+		t.Fatalf("GetEvents() error: %v", err)
+	}
+	if len(page.Events) != 1 || page.ContinuationToken != "next" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page.Events[0].BlockNumber != 1200 || page.Events[0].TransactionHash != "0xdef" {
+		t.Errorf("unexpected event: %+v", page.Events[0])
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	node := fakeNode(t, map[string]interface{}{
+		"starknet_getTransactionReceipt": &RPCError{Code: ErrCodeTransactionNotFound, Message: "Transaction hash not found"},
+	})
+	defer node.Close()
+
+	_, err := NewClient(node.URL).GetTransactionReceipt(context.Background(), "0x1")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestClientCallContract(t *testing.T) {
+	node := fakeNode(t, map[string]interface{}{
+		"starknet_call": []string{"0x2a", "0x0"},
+	})
+	defer node.Close()
+
+	result, err := NewClient(node.URL).CallContract(context.Background(), FunctionCall{
+		ContractAddress:    "0xa",
+		EntryPointSelector: SelectorFromName("balance_of"),
+		Calldata:           []string{"0x1"},
+	}, LatestBlock)
+	if err != nil || len(result) != 2 || result[0] != "0x2a" {
+		t.Fatalf("CallContract() = %v, %v", result, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), true},
+		{fmt.Errorf("could not get nonce: %w", &RPCError{Code: ErrCodeInvalidNonce}), true},
+		{&RPCError{Code: ErrCodeInternal, Message: "Internal error"}, true},
+		{&RPCError{Code: 41, Message: "Transaction execution error"}, false},
+		{&RPCError{Code: 55, Message: "Account validation failed"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorFromName(t *testing.T) {
+	tests := map[string]string{
+		"Transfer":    "0x99cd8bde557814842a3121e8ddfd433a539b8c9f14bf31ebf108d12e6196e9",
+		"__execute__": "0x15d40a3d6ca2ac30f4031e42be28da9b056fef9bb7357ac5e85627ee876e5ad",
+	}
+
+	for name, want := range tests {
+		if got := SelectorFromName(name); got != want {
+			t.Errorf("SelectorFromName(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package starknettest fakes the operator account and the Starknet node for
+// the tests of the workers sending transactions
+package starknettest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"aura-backend/starknet"
+)
+
+// codeContractNotFound answers the calls no result was set for
+const codeContractNotFound = 20
+
+// Sender records the calls it is asked to send. It fails with the queued
+// Errs first, then returns TxHash and Err.
+type Sender struct {
+	Calls  [][]starknet.FunctionCall
+	TxHash string
+	Err    error
+	Errs   []error
+}
+
+func (s *Sender) Invoke(ctx context.Context, calls []starknet.FunctionCall) (string, error) {
+	s.Calls = append(s.Calls, calls)
+	if len(s.Errs) > 0 {
+		err := s.Errs[0]
+		s.Errs = s.Errs[1:]
+		return "", err
+	}
+	return s.TxHash, s.Err
+}
+
+// Node is a JSON-RPC node answering starknet_getTransactionReceipt with the
+// receipts it was given, and with TXN_HASH_NOT_FOUND for other hashes, and
+// starknet_call with the result set for the entry point called
+type Node struct {
+	*starknet.Client
+
+	mu       sync.Mutex
+	receipts map[string]interface{}
+	results  map[string][]string // By entry point selector
+}
+
+// NewNode starts a node serving receipts, keyed by transaction hash, until
+// the test ends
+func NewNode(t testing.TB, receipts map[string]interface{}) *Node {
+	t.Helper()
+
+	node := &Node{receipts: map[string]interface{}{}, results: map[string][]string{}}
+	for hash, receipt := range receipts {
+		node.receipts[hash] = receipt
+	}
+	server := httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(server.Close)
+	node.Client = starknet.NewClient(server.URL)
+	return node
+}
+
+// SetReceipt sets the receipt of a transaction
+func (n *Node) SetReceipt(txHash string, receipt interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.receipts[txHash] = receipt
+}
+
+// SetResult sets the result of the calls of an entry point, by name
+func (n *Node) SetResult(entryPoint string, result ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results[starknet.SelectorFromName(entryPoint)] = result
+}
+
+func (n *Node) serve(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     uint64 `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			TransactionHash string                `json:"transaction_hash"`
+			Request         starknet.FunctionCall `json:"request"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	n.mu.Lock()
+	receipt, hasReceipt := n.receipts[request.Params.TransactionHash]
+	result, hasResult := n.results[request.Params.Request.EntryPointSelector]
+	n.mu.Unlock()
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch {
+	case request.Method == "starknet_getTransactionReceipt" && hasReceipt:
+		response["result"] = receipt
+	case request.Method == "starknet_call" && hasResult:
+		response["result"] = result
+	case request.Method == "starknet_call":
+		response["error"] = &starknet.RPCError{Code: codeContractNotFound, Message: "Contract not found"}
+	default:
+		response["error"] = &starknet.RPCError{Code: starknet.ErrCodeTransactionNotFound, Message: "Transaction hash not found"}
+	}
+	json.NewEncoder(w).Encode(response)
+}
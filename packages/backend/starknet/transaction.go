@@ -0,0 +1,170 @@
+package starknet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Prefixes and versions hashed into INVOKE transactions
+var (
+	invokePrefix = new(big.Int).SetBytes([]byte("invoke"))
+	l1GasName    = new(big.Int).SetBytes([]byte("L1_GAS"))
+	l2GasName    = new(big.Int).SetBytes([]byte("L2_GAS"))
+
+	// queryVersion is added to the version of transactions that are only
+	// estimated, so their signatures can never be replayed on-chain
+	queryVersion = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// ResourceBound caps the amount of a resource a transaction may use and the
+// price paid for each unit
+type ResourceBound struct {
+	MaxAmount       *big.Int
+	MaxPricePerUnit *big.Int
+}
+
+// ResourceBounds are the fee bounds of a v3 transaction. Fees are paid in STRK.
+type ResourceBounds struct {
+	L1Gas ResourceBound
+	L2Gas ResourceBound
+}
+
+func (b ResourceBound) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"max_amount":         FeltToHex(orZero(b.MaxAmount)),
+		"max_price_per_unit": FeltToHex(orZero(b.MaxPricePerUnit)),
+	})
+}
+
+func (b ResourceBounds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]ResourceBound{"l1_gas": b.L1Gas, "l2_gas": b.L2Gas})
+}
+
+// pack encodes a bound as hashed in transactions: the resource name, then
+// the 64-bit max amount and the 128-bit max price
+func (b ResourceBound) pack(name *big.Int) *big.Int {
+	packed := new(big.Int).Lsh(name, 192)
+	packed.Or(packed, new(big.Int).Lsh(orZero(b.MaxAmount), 128))
+	return packed.Or(packed, orZero(b.MaxPricePerUnit))
+}
+
+// InvokeTransaction is an INVOKE v3 transaction of an account. Tips,
+// paymasters and account deployment data are not used by the backend and
+// hash as zero and empty lists.
+type InvokeTransaction struct {
+	SenderAddress  string
+	Calldata       []string
+	Nonce          *big.Int
+	ResourceBounds ResourceBounds
+	Signature      []string
+
+	// Query marks a transaction built to estimate fees, which cannot be
+	// included in a block
+	Query bool
+}
+
+// version is 3, plus 2^128 for queries
+func (tx *InvokeTransaction) version() *big.Int {
+	if tx.Query {
+		return new(big.Int).Add(queryVersion, big.NewInt(3))
+	}
+	return big.NewInt(3)
+}
+
+// Hash computes the hash accounts sign, as defined by SNIP-8 for v3
+// transactions. The chain id is the hex encoding of its short string, as
+// starknet_chainId returns it.
+func (tx *InvokeTransaction) Hash(chainID string) (*big.Int, error) {
+	sender, err := ParseFelt(tx.SenderAddress)
+	if err != nil {
+		return nil, fmt.Errorf("sender address: %w", err)
+	}
+	chain, err := ParseFelt(chainID)
+	if err != nil {
+		return nil, fmt.Errorf("chain id: %w", err)
+	}
+	calldata := make([]*big.Int, len(tx.Calldata))
+	for i, felt := range tx.Calldata {
+		if calldata[i], err = ParseFelt(felt); err != nil {
+			return nil, fmt.Errorf("calldata %d: %w", i, err)
+		}
+	}
+
+	fees := PoseidonHashMany([]*big.Int{
+		big.NewInt(0), // Tip
+		tx.ResourceBounds.L1Gas.pack(l1GasName),
+		tx.ResourceBounds.L2Gas.pack(l2GasName),
+	})
+	// Both data availability modes are L1 (0): nonce mode << 32 | fee mode
+	daModes := big.NewInt(0)
+
+	return PoseidonHashMany([]*big.Int{
+		invokePrefix,
+		tx.version(),
+		sender,
+		fees,
+		PoseidonHashMany(nil), // Paymaster data
+		chain,
+		orZero(tx.Nonce),
+		daModes,
+		PoseidonHashMany(nil), // Account deployment data
+		PoseidonHashMany(calldata),
+	}), nil
+}
+
+// MarshalJSON encodes the transaction as a BROADCASTED_INVOKE_TXN
+func (tx *InvokeTransaction) MarshalJSON() ([]byte, error) {
+	signature := tx.Signature
+	if signature == nil {
+		signature = []string{}
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":                         "INVOKE",
+		"version":                      FeltToHex(tx.version()),
+		"sender_address":               NormalizeAddress(tx.SenderAddress),
+		"calldata":                     tx.Calldata,
+		"nonce":                        FeltToHex(orZero(tx.Nonce)),
+		"signature":                    signature,
+		"resource_bounds":              tx.ResourceBounds,
+		"tip":                          "0x0",
+		"paymaster_data":               []string{},
+		"account_deployment_data":      []string{},
+		"nonce_data_availability_mode": "L1",
+		"fee_data_availability_mode":   "L1",
+	})
+}
+
+// ExecuteCalldata composes several calls into the calldata of a Cairo 1
+// account's __execute__: the number of calls, then for each call its
+// contract, selector and length-prefixed calldata
+func ExecuteCalldata(calls []FunctionCall) ([]string, error) {
+	calldata := []string{FeltToHex(big.NewInt(int64(len(calls))))}
+	for i, call := range calls {
+		to, err := ParseFelt(call.ContractAddress)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: contract address: %w", i, err)
+		}
+		selector, err := ParseFelt(call.EntryPointSelector)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: selector: %w", i, err)
+		}
+
+		calldata = append(calldata, FeltToHex(to), FeltToHex(selector), FeltToHex(big.NewInt(int64(len(call.Calldata)))))
+		for j, felt := range call.Calldata {
+			value, err := ParseFelt(felt)
+			if err != nil {
+				return nil, fmt.Errorf("call %d: calldata %d: %w", i, j, err)
+			}
+			calldata = append(calldata, FeltToHex(value))
+		}
+	}
+	return calldata, nil
+}
+
+func orZero(value *big.Int) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	return value
+}
@@ -0,0 +1,1051 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a thread-safe in-memory Store, used by tests and local development
+type Memory struct {
+	mu             sync.RWMutex
+	users          map[string]User
+	habits         map[string]Habit
+	wallets        map[string]Wallet
+	subscriptions  []memorySubscription
+	achievements   map[string]Achievement
+	stakes         map[string]Stake
+	rewards        map[string]memoryReward
+	claims         map[string]RewardClaim
+	checkIns       map[checkInKey]CheckIn
+	attestations   map[string]Attestation   // Keyed by dayKey
+	attestedLeaves map[string][]CheckInLeaf // Keyed by dayKey
+	events         []ChainEvent             // In indexing order
+	lastEventID    int64
+	checkpoint     *EventCheckpoint
+	outbox         map[string]OutboxTransaction
+	security       map[string]WalletSecurity // Keyed by user ID
+	walletEvents   []WalletEvent             // In insertion order
+	rotations      map[string]KeyRotation
+}
+
+type checkInKey struct {
+	habitID string
+	day     string
+}
+
+// dayKey identifies a UTC date
+func dayKey(day time.Time) string {
+	return day.UTC().Format(time.DateOnly)
+}
+
+// memoryReward is a reward and the claim it is attached to, if any
+type memoryReward struct {
+	Reward
+	claimID string
+}
+
+type memorySubscription struct {
+	userID   string
+	plan     string
+	startsAt time.Time
+	endsAt   time.Time
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		users:          make(map[string]User),
+		habits:         make(map[string]Habit),
+		wallets:        make(map[string]Wallet),
+		achievements:   make(map[string]Achievement),
+		stakes:         make(map[string]Stake),
+		rewards:        make(map[string]memoryReward),
+		claims:         make(map[string]RewardClaim),
+		checkIns:       make(map[checkInKey]CheckIn),
+		attestations:   make(map[string]Attestation),
+		attestedLeaves: make(map[string][]CheckInLeaf),
+		outbox:         make(map[string]OutboxTransaction),
+		security:       make(map[string]WalletSecurity),
+		rotations:      make(map[string]KeyRotation),
+	}
+}
+
+func (m *Memory) GetUser(ctx context.Context, userID string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.ID]; ok {
+		return ErrConflict
+	}
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *Memory) UpdateUserProfile(ctx context.Context, userID, firstName, lastName, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+	if firstName != "" {
+		user.FirstName = firstName
+	}
+	if lastName != "" {
+		user.LastName = lastName
+	}
+	if email != "" {
+		user.Email = email
+	}
+	m.users[userID] = user
+	return nil
+}
+
+func (m *Memory) UpdateUserRole(ctx context.Context, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.Role = role
+		m.users[userID] = user
+	}
+	return nil
+}
+
+func (m *Memory) SetStripeCustomerID(ctx context.Context, userID, customerID string) error {
+	// Stripe customers are not part of the user model, nothing to keep
+	return nil
+}
+
+func (m *Memory) ListHabits(ctx context.Context, userID string) ([]Habit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	habits := []Habit{}
+	for _, h := range m.habits {
+		if h.UserID == userID {
+			habits = append(habits, h)
+		}
+	}
+	sort.Slice(habits, func(i, j int) bool { return habits[i].CreatedAt.After(habits[j].CreatedAt) })
+
+	return habits, nil
+}
+
+func (m *Memory) CountActiveHabits(ctx context.Context, userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, h := range m.habits {
+		if h.UserID == userID && !h.Completed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateHabit(ctx context.Context, habit *Habit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.habits[habit.ID]; ok {
+		return ErrConflict
+	}
+	m.habits[habit.ID] = *habit
+	return nil
+}
+
+func (m *Memory) GetHabit(ctx context.Context, userID, habitID string) (*Habit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	habit, ok := m.habits[habitID]
+	if !ok || habit.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &habit, nil
+}
+
+func (m *Memory) UpdateHabitProgress(ctx context.Context, habit *Habit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.habits[habit.ID]
+	if !ok {
+		return nil
+	}
+	stored.DaysCompleted = habit.DaysCompleted
+	stored.Completed = habit.Completed
+	stored.Streak = habit.Streak
+	stored.LastTrackedDate = habit.LastTrackedDate
+	m.habits[habit.ID] = stored
+	return nil
+}
+
+func (m *Memory) GetWallet(ctx context.Context, userID string) (*Wallet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wallet, ok := m.wallets[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &wallet, nil
+}
+
+func (m *Memory) CreateWallet(ctx context.Context, userID string, wallet *Wallet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.wallets[userID]; ok {
+		return ErrConflict
+	}
+	m.wallets[userID] = *wallet
+	return nil
+}
+
+func (m *Memory) ActivePlan(ctx context.Context, userID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var plan string
+	var latestEnd time.Time
+	for _, s := range m.subscriptions {
+		if s.userID == userID && !s.startsAt.After(now) && s.endsAt.After(now) && s.endsAt.After(latestEnd) {
+			plan, latestEnd = s.plan, s.endsAt
+		}
+	}
+	return plan, nil
+}
+
+// AddSubscription grants a plan to a user for a period, as the billing services do
+func (m *Memory) AddSubscription(userID, plan string, startsAt, endsAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscriptions = append(m.subscriptions, memorySubscription{
+		userID:   userID,
+		plan:     plan,
+		startsAt: startsAt,
+		endsAt:   endsAt,
+	})
+}
+
+func (m *Memory) CreateAchievement(ctx context.Context, achievement *Achievement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.achievements {
+		if stored.HabitID == achievement.HabitID {
+			return ErrConflict
+		}
+	}
+	m.achievements[achievement.ID] = *achievement
+	return nil
+}
+
+func (m *Memory) GetAchievement(ctx context.Context, achievementID string) (*Achievement, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	achievement, ok := m.achievements[achievementID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &achievement, nil
+}
+
+func (m *Memory) ListAchievements(ctx context.Context, userID string) ([]Achievement, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	achievements := []Achievement{}
+	for _, a := range m.achievements {
+		if a.UserID == userID {
+			achievements = append(achievements, a)
+		}
+	}
+	sort.Slice(achievements, func(i, j int) bool {
+		return achievements[i].CompletedAt.After(achievements[j].CompletedAt)
+	})
+	return achievements, nil
+}
+
+func (m *Memory) PendingAchievements(ctx context.Context, limit int) ([]Achievement, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pending := []Achievement{}
+	for _, a := range m.achievements {
+		if (a.Status == AchievementQueued || a.Status == AchievementSubmitted) && !m.inOutbox(OutboxAchievementMint, a.ID) {
+			pending = append(pending, a)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].UpdatedAt.Before(pending[j].UpdatedAt)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (m *Memory) UpdateAchievement(ctx context.Context, achievement *Achievement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.achievements[achievement.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = achievement.Status
+	stored.TransactionHash = achievement.TransactionHash
+	stored.TokenID = achievement.TokenID
+	stored.LastError = achievement.LastError
+	stored.Attempts = achievement.Attempts
+	stored.UpdatedAt = achievement.UpdatedAt
+	m.achievements[achievement.ID] = stored
+	return nil
+}
+
+func (m *Memory) CreateStake(ctx context.Context, stake *Stake) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.stakes {
+		if stored.HabitID == stake.HabitID || stored.DepositTransactionHash == stake.DepositTransactionHash {
+			return ErrConflict
+		}
+	}
+	m.stakes[stake.HabitID] = *stake
+	return nil
+}
+
+func (m *Memory) GetStake(ctx context.Context, userID, habitID string) (*Stake, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stake, ok := m.stakes[habitID]
+	if !ok || stake.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &stake, nil
+}
+
+func (m *Memory) OpenStakes(ctx context.Context, limit int) ([]Stake, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	open := []Stake{}
+	for _, s := range m.stakes {
+		if s.Status == StakePending || s.Status == StakeActive || s.Status == StakeResolving {
+			open = append(open, s)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].UpdatedAt.Before(open[j].UpdatedAt)
+	})
+	if len(open) > limit {
+		open = open[:limit]
+	}
+	return open, nil
+}
+
+func (m *Memory) UpdateStake(ctx context.Context, stake *Stake) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.stakes[stake.HabitID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Amount = stake.Amount
+	stored.Deadline = stake.Deadline
+	stored.Status = stake.Status
+	stored.Success = stake.Success
+	stored.ResolutionTransactionHash = stake.ResolutionTransactionHash
+	stored.LastError = stake.LastError
+	stored.Attempts = stake.Attempts
+	stored.UpdatedAt = stake.UpdatedAt
+	m.stakes[stake.HabitID] = stored
+	return nil
+}
+
+func (m *Memory) AddReward(ctx context.Context, reward *Reward) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.rewards {
+		if stored.HabitID == reward.HabitID && stored.Reason == reward.Reason && stored.Day == reward.Day {
+			return ErrConflict
+		}
+	}
+	m.rewards[reward.ID] = memoryReward{Reward: *reward}
+	return nil
+}
+
+// claimed reports whether a reward was minted by a confirmed claim
+func (m *Memory) claimed(reward memoryReward) bool {
+	return reward.claimID != "" && m.claims[reward.claimID].Status == ClaimConfirmed
+}
+
+func (m *Memory) ListRewards(ctx context.Context, userID string, limit int) ([]Reward, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rewards := []Reward{}
+	for _, r := range m.rewards {
+		if r.UserID == userID {
+			reward := r.Reward
+			reward.Claimed = m.claimed(r)
+			rewards = append(rewards, reward)
+		}
+	}
+	sort.Slice(rewards, func(i, j int) bool {
+		return rewards[i].CreatedAt.After(rewards[j].CreatedAt)
+	})
+	if len(rewards) > limit {
+		rewards = rewards[:limit]
+	}
+	return rewards, nil
+}
+
+func (m *Memory) RewardTotals(ctx context.Context, userID string) (*RewardTotals, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totals := &RewardTotals{}
+	for _, r := range m.rewards {
+		if r.UserID != userID {
+			continue
+		}
+		if m.claimed(r) {
+			totals.Claimed += r.Points
+		} else {
+			totals.Pending += r.Points
+		}
+	}
+	return totals, nil
+}
+
+func (m *Memory) CreateRewardClaim(ctx context.Context, claim *RewardClaim, maxRecipients int) ([]RewardBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Users owed the oldest rewards are paid first
+	owed := map[string]*RewardBalance{}
+	oldest := map[string]time.Time{}
+	for _, r := range m.rewards {
+		wallet, ok := m.wallets[r.UserID]
+		if r.claimID != "" || !ok {
+			continue
+		}
+		balance, ok := owed[r.UserID]
+		if !ok {
+			balance = &RewardBalance{UserID: r.UserID, WalletAddress: wallet.Address}
+			owed[r.UserID] = balance
+			oldest[r.UserID] = r.CreatedAt
+		}
+		balance.Points += r.Points
+		if r.CreatedAt.Before(oldest[r.UserID]) {
+			oldest[r.UserID] = r.CreatedAt
+		}
+	}
+	if len(owed) == 0 {
+		return nil, nil
+	}
+
+	balances := make([]RewardBalance, 0, len(owed))
+	for _, balance := range owed {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return oldest[balances[i].UserID].Before(oldest[balances[j].UserID])
+	})
+	if len(balances) > maxRecipients {
+		balances = balances[:maxRecipients]
+	}
+
+	claim.Recipients = len(balances)
+	claim.Points = 0
+	for _, balance := range balances {
+		claim.Points += balance.Points
+		for id, r := range m.rewards {
+			if r.UserID == balance.UserID && r.claimID == "" {
+				r.claimID = claim.ID
+				m.rewards[id] = r
+			}
+		}
+	}
+	m.claims[claim.ID] = *claim
+	return balances, nil
+}
+
+func (m *Memory) RewardClaimBalances(ctx context.Context, claimID string) ([]RewardBalance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	owed := map[string]int64{}
+	for _, r := range m.rewards {
+		if r.claimID == claimID {
+			owed[r.UserID] += r.Points
+		}
+	}
+
+	balances := []RewardBalance{}
+	for userID, points := range owed {
+		balances = append(balances, RewardBalance{UserID: userID, WalletAddress: m.wallets[userID].Address, Points: points})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].UserID < balances[j].UserID
+	})
+	return balances, nil
+}
+
+func (m *Memory) OpenRewardClaims(ctx context.Context) ([]RewardClaim, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	open := []RewardClaim{}
+	for _, c := range m.claims {
+		if c.Status == ClaimPending || c.Status == ClaimSubmitted {
+			open = append(open, c)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].CreatedAt.Before(open[j].CreatedAt)
+	})
+	return open, nil
+}
+
+func (m *Memory) UpdateRewardClaim(ctx context.Context, claim *RewardClaim) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.claims[claim.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = claim.Status
+	stored.TransactionHash = claim.TransactionHash
+	stored.LastError = claim.LastError
+	stored.Attempts = claim.Attempts
+	stored.UpdatedAt = claim.UpdatedAt
+	m.claims[claim.ID] = stored
+
+	if claim.Status == ClaimFailed {
+		for id, r := range m.rewards {
+			if r.claimID == claim.ID {
+				r.claimID = ""
+				m.rewards[id] = r
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RecordCheckIn(ctx context.Context, checkIn *CheckIn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := checkInKey{checkIn.HabitID, dayKey(checkIn.Day)}
+	if _, ok := m.checkIns[key]; ok {
+		return ErrConflict
+	}
+	m.checkIns[key] = *checkIn
+	return nil
+}
+
+func (m *Memory) CheckInLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	leaves := []CheckInLeaf{}
+	for key, c := range m.checkIns {
+		wallet, ok := m.wallets[c.UserID]
+		if key.day == dayKey(day) && ok {
+			leaves = append(leaves, CheckInLeaf{UserID: c.UserID, HabitID: c.HabitID, WalletAddress: wallet.Address})
+		}
+	}
+	return leaves, nil
+}
+
+func (m *Memory) UnattestedDays(ctx context.Context, before time.Time, limit int) ([]time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[string]bool{}
+	days := []time.Time{}
+	for key, c := range m.checkIns {
+		_, attested := m.attestations[key.day]
+		_, hasWallet := m.wallets[c.UserID]
+		if attested || !hasWallet || seen[key.day] || key.day >= dayKey(before) {
+			continue
+		}
+		seen[key.day] = true
+		year, month, day := c.Day.UTC().Date()
+		days = append(days, time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+	if len(days) > limit {
+		days = days[:limit]
+	}
+	return days, nil
+}
+
+func (m *Memory) CreateAttestation(ctx context.Context, attestation *Attestation, leaves []CheckInLeaf) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := dayKey(attestation.Day)
+	if _, ok := m.attestations[key]; ok {
+		return ErrConflict
+	}
+	m.attestations[key] = *attestation
+	m.attestedLeaves[key] = append([]CheckInLeaf(nil), leaves...)
+	return nil
+}
+
+func (m *Memory) AttestationLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]CheckInLeaf{}, m.attestedLeaves[dayKey(day)]...), nil
+}
+
+func (m *Memory) GetAttestation(ctx context.Context, day time.Time) (*Attestation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attestation, ok := m.attestations[dayKey(day)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attestation, nil
+}
+
+func (m *Memory) PendingAttestations(ctx context.Context) ([]Attestation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pending := []Attestation{}
+	for _, a := range m.attestations {
+		if a.Status == AttestationQueued || a.Status == AttestationSubmitted {
+			pending = append(pending, a)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Day.Before(pending[j].Day)
+	})
+	return pending, nil
+}
+
+func (m *Memory) UpdateAttestation(ctx context.Context, attestation *Attestation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := dayKey(attestation.Day)
+	stored, ok := m.attestations[key]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = attestation.Status
+	stored.TransactionHash = attestation.TransactionHash
+	stored.LastError = attestation.LastError
+	stored.Attempts = attestation.Attempts
+	stored.UpdatedAt = attestation.UpdatedAt
+	m.attestations[key] = stored
+	return nil
+}
+
+func (m *Memory) EventCheckpoint(ctx context.Context) (*EventCheckpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.checkpoint == nil {
+		return nil, ErrNotFound
+	}
+	checkpoint := *m.checkpoint
+	return &checkpoint, nil
+}
+
+func (m *Memory) SaveEvents(ctx context.Context, events []ChainEvent, checkpoint EventCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range events {
+		duplicate := false
+		for _, stored := range m.events {
+			if stored.TransactionHash == event.TransactionHash && stored.ContractAddress == event.ContractAddress && stored.EventIndex == event.EventIndex {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		m.lastEventID++
+		event.ID = m.lastEventID
+		m.events = append(m.events, event)
+	}
+	m.checkpoint = &checkpoint
+	return nil
+}
+
+func (m *Memory) RewindEvents(ctx context.Context, checkpoint EventCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.events[:0]
+	for _, event := range m.events {
+		if event.BlockNumber <= checkpoint.BlockNumber {
+			kept = append(kept, event)
+		}
+	}
+	m.events = kept
+	m.checkpoint = &checkpoint
+	return nil
+}
+
+func (m *Memory) ListEvents(ctx context.Context, query EventQuery) ([]ChainEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []ChainEvent{}
+	for i := len(m.events) - 1; i >= 0 && len(events) < query.Limit; i-- {
+		event := m.events[i]
+		if (query.Contract != "" && event.Contract != query.Contract) ||
+			(query.Name != "" && event.Name != query.Name) ||
+			(query.Before > 0 && event.ID >= query.Before) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (m *Memory) SaveHabitProgress(ctx context.Context, habit *Habit, achievement *Achievement, queued []OutboxTransaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.habits[habit.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.DaysCompleted = habit.DaysCompleted
+	stored.Completed = habit.Completed
+	stored.Streak = habit.Streak
+	stored.LastTrackedDate = habit.LastTrackedDate
+	m.habits[habit.ID] = stored
+
+	if achievement != nil {
+		for _, stored := range m.achievements {
+			if stored.HabitID == achievement.HabitID {
+				return nil
+			}
+		}
+		m.achievements[achievement.ID] = *achievement
+	}
+	for _, tx := range queued {
+		if !m.inOutbox(tx.Kind, tx.Reference) {
+			m.outbox[tx.ID] = tx
+		}
+	}
+	return nil
+}
+
+// inOutbox reports whether a transaction of the kind and reference exists.
+// The caller holds the lock.
+func (m *Memory) inOutbox(kind, reference string) bool {
+	for _, tx := range m.outbox {
+		if tx.Kind == kind && tx.Reference == reference {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) PendingOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pending := []OutboxTransaction{}
+	for _, tx := range m.outbox {
+		if tx.Status == OutboxSubmitted || (tx.Status == OutboxQueued && !tx.NextAttemptAt.After(now)) {
+			pending = append(pending, tx)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].UpdatedAt.Before(pending[j].UpdatedAt)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (m *Memory) UpdateOutbox(ctx context.Context, tx *OutboxTransaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.outbox[tx.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = tx.Status
+	stored.TransactionHash = tx.TransactionHash
+	stored.LastError = tx.LastError
+	stored.Attempts = tx.Attempts
+	stored.Fee = tx.Fee
+	stored.NextAttemptAt = tx.NextAttemptAt
+	stored.UpdatedAt = tx.UpdatedAt
+	m.outbox[tx.ID] = stored
+	return nil
+}
+
+func (m *Memory) ListOutbox(ctx context.Context, userID string, limit int) ([]OutboxTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []OutboxTransaction{}
+	for _, tx := range m.outbox {
+		if tx.UserID == userID {
+			list = append(list, tx)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (m *Memory) SponsoredFees(ctx context.Context, userID string, since time.Time) (*big.Int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total := new(big.Int)
+	for _, tx := range m.outbox {
+		if tx.UserID != userID || tx.Fee == "" || tx.CreatedAt.Before(since) {
+			continue
+		}
+		fee, ok := new(big.Int).SetString(tx.Fee, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid fee %q", tx.Fee)
+		}
+		total.Add(total, fee)
+	}
+	return total, nil
+}
+
+func (m *Memory) GetWalletSecurity(ctx context.Context, userID string) (*WalletSecurity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	security, ok := m.security[userID]
+	if !ok {
+		return &WalletSecurity{UserID: userID}, nil
+	}
+	return &security, nil
+}
+
+func (m *Memory) SetWalletPIN(ctx context.Context, userID, pinHash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.wallets[userID]; !ok {
+		return ErrNotFound
+	}
+	security := m.security[userID]
+	security.UserID = userID
+	security.PINHash = pinHash
+	security.UpdatedAt = at
+	m.security[userID] = security
+	return nil
+}
+
+func (m *Memory) RecordWalletPINFailure(ctx context.Context, userID string, maxAttempts int, lockedUntil, at time.Time) (*WalletSecurity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	security, ok := m.security[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	security.FailedAttempts++
+	if security.FailedAttempts >= maxAttempts {
+		security.FailedAttempts = 0
+		security.LockedUntil = &lockedUntil
+	}
+	security.UpdatedAt = at
+	m.security[userID] = security
+	return &security, nil
+}
+
+func (m *Memory) ResetWalletPINFailures(ctx context.Context, userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	security, ok := m.security[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	security.FailedAttempts = 0
+	security.LockedUntil = nil
+	security.UpdatedAt = at
+	m.security[userID] = security
+	return nil
+}
+
+func (m *Memory) MarkWalletExported(ctx context.Context, userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	security, ok := m.security[userID]
+	if !ok || security.ExportedAt != nil {
+		return ErrConflict
+	}
+	security.ExportedAt = &at
+	security.UpdatedAt = at
+	m.security[userID] = security
+	return nil
+}
+
+func (m *Memory) AddWalletEvent(ctx context.Context, event *WalletEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.walletEvents = append(m.walletEvents, *event)
+	return nil
+}
+
+func (m *Memory) ListWalletEvents(ctx context.Context, userID string, limit int) ([]WalletEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []WalletEvent{}
+	for i := len(m.walletEvents) - 1; i >= 0 && len(list) < limit; i-- {
+		if m.walletEvents[i].UserID == userID {
+			list = append(list, m.walletEvents[i])
+		}
+	}
+	return list, nil
+}
+
+func (m *Memory) CreateKeyRotation(ctx context.Context, rotation *KeyRotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.rotations {
+		if stored.UserID == rotation.UserID && (stored.Status == RotationPending || stored.Status == RotationSubmitted) {
+			return ErrConflict
+		}
+	}
+	m.rotations[rotation.ID] = *rotation
+	return nil
+}
+
+func (m *Memory) UpdateKeyRotation(ctx context.Context, rotation *KeyRotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.rotations[rotation.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = rotation.Status
+	stored.TransactionHash = rotation.TransactionHash
+	stored.LastError = rotation.LastError
+	stored.UpdatedAt = rotation.UpdatedAt
+	m.rotations[rotation.ID] = stored
+	return nil
+}
+
+func (m *Memory) CompleteKeyRotation(ctx context.Context, rotation *KeyRotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.rotations[rotation.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	wallet, ok := m.wallets[stored.UserID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.Status = RotationCompleted
+	stored.TransactionHash = rotation.TransactionHash
+	stored.LastError = ""
+	stored.UpdatedAt = rotation.UpdatedAt
+	m.rotations[rotation.ID] = stored
+
+	wallet.PublicKey = stored.NewPublicKey
+	wallet.EncryptedPrivateKey = stored.EncryptedPrivateKey
+	m.wallets[stored.UserID] = wallet
+
+	if security, ok := m.security[stored.UserID]; ok {
+		security.ExportedAt = nil
+		security.UpdatedAt = rotation.UpdatedAt
+		m.security[stored.UserID] = security
+	}
+	return nil
+}
+
+func (m *Memory) LatestKeyRotation(ctx context.Context, userID string) (*KeyRotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest *KeyRotation
+	for _, rotation := range m.rotations {
+		if rotation.UserID == userID && (latest == nil || rotation.CreatedAt.After(latest.CreatedAt)) {
+			rotation := rotation
+			latest = &rotation
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (m *Memory) OpenKeyRotations(ctx context.Context, limit int) ([]KeyRotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	open := []KeyRotation{}
+	for _, rotation := range m.rotations {
+		if rotation.Status == RotationPending || rotation.Status == RotationSubmitted {
+			open = append(open, rotation)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].CreatedAt.Before(open[j].CreatedAt)
+	})
+	if len(open) > limit {
+		open = open[:limit]
+	}
+	return open, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryWalletConflict(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if err := m.CreateWallet(ctx, "user-1", &Wallet{Address: "0x1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateWallet(ctx, "user-1", &Wallet{Address: "0x2"}); err != ErrConflict {
+		t.Fatalf("second CreateWallet() = %v, want ErrConflict", err)
+	}
+
+	wallet, err := m.GetWallet(ctx, "user-1")
+	if err != nil || wallet.Address != "0x1" {
+		t.Fatalf("GetWallet() = %+v, %v", wallet, err)
+	}
+	if _, err := m.GetWallet(ctx, "user-2"); err != ErrNotFound {
+		t.Fatalf("GetWallet() of unknown user = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryConcurrentHabits(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.CreateHabit(ctx, &Habit{ID: fmt.Sprintf("habit-%d", i), UserID: "user-1", CreatedAt: time.Now()})
+			m.CountActiveHabits(ctx, "user-1")
+		}(i)
+	}
+	wg.Wait()
+
+	count, _ := m.CountActiveHabits(ctx, "user-1")
+	if count != 50 {
+		t.Fatalf("CountActiveHabits() = %d, want 50", count)
+	}
+}
+
+func TestMemoryActivePlan(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+
+	m.AddSubscription("user-1", "pro", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	if plan, _ := m.ActivePlan(ctx, "user-1"); plan != "" {
+		t.Fatalf("expired subscription is active: %q", plan)
+	}
+
+	m.AddSubscription("user-1", "team", now.Add(-time.Hour), now.Add(time.Hour))
+	if plan, _ := m.ActivePlan(ctx, "user-1"); plan != "team" {
+		t.Fatalf("ActivePlan() = %q, want team", plan)
+	}
+}
@@ -0,0 +1,1052 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"aura-backend/billing"
+	database "aura-backend/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres implements Store on top of a PostgreSQL database
+type Postgres struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgres creates a store backed by the given connection pool
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db}
+}
+
+// DB returns the underlying pool, for services not yet behind a store
+func (p *Postgres) DB() *pgxpool.Pool {
+	return p.db
+}
+
+func (p *Postgres) GetUser(ctx context.Context, userID string) (*User, error) {
+	var email, role, firstName, lastName pgtype.Text
+	err := p.db.QueryRow(ctx,
+		"SELECT email, role, first_name, last_name FROM users_profiles WHERE id = $1",
+		userID,
+	).Scan(&email, &role, &firstName, &lastName)
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+
+	return &User{
+		ID:        userID,
+		Email:     email.String,
+		Role:      role.String,
+		FirstName: firstName.String,
+		LastName:  lastName.String,
+	}, nil
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, user *User) error {
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO users_profiles (id, email, role, first_name, last_name) VALUES ($1, $2, $3, $4, $5)",
+		user.ID, user.Email, user.Role, user.FirstName, user.LastName,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) UpdateUserProfile(ctx context.Context, userID, firstName, lastName, email string) error {
+	_, err := p.db.Exec(ctx,
+		"UPDATE users_profiles SET first_name = COALESCE($1, first_name), last_name = COALESCE($2, last_name), email = COALESCE($3, email) WHERE id = $4",
+		nullIfEmpty(firstName), nullIfEmpty(lastName), nullIfEmpty(email), userID,
+	)
+	return err
+}
+
+func (p *Postgres) UpdateUserRole(ctx context.Context, userID, role string) error {
+	_, err := p.db.Exec(ctx, "UPDATE users_profiles SET role = $1 WHERE id = $2", role, userID)
+	return err
+}
+
+func (p *Postgres) SetStripeCustomerID(ctx context.Context, userID, customerID string) error {
+	_, err := p.db.Exec(ctx, "UPDATE users_profiles SET stripe_customer_id = $1 WHERE id = $2", customerID, userID)
+	return err
+}
+
+func (p *Postgres) ListHabits(ctx context.Context, userID string) ([]Habit, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT id, user_id, name, days_completed, streak, goal_days, completed, created_at, last_tracked_date FROM habits WHERE user_id = $1 ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	habits := []Habit{}
+	for rows.Next() {
+		var h Habit
+		if err := rows.Scan(&h.ID, &h.UserID, &h.Name, &h.DaysCompleted, &h.Streak, &h.GoalDays, &h.Completed, &h.CreatedAt, &h.LastTrackedDate); err != nil {
+			return nil, err
+		}
+		habits = append(habits, h)
+	}
+
+	return habits, rows.Err()
+}
+
+func (p *Postgres) CountActiveHabits(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := p.db.QueryRow(ctx, "SELECT COUNT(*) FROM habits WHERE user_id = $1 AND completed = false", userID).Scan(&count)
+	return count, err
+}
+
+func (p *Postgres) CreateHabit(ctx context.Context, habit *Habit) error {
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO habits (id, user_id, name, days_completed, goal_days, completed, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		habit.ID, habit.UserID, habit.Name, habit.DaysCompleted, habit.GoalDays, habit.Completed, habit.CreatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) GetHabit(ctx context.Context, userID, habitID string) (*Habit, error) {
+	var h Habit
+	err := p.db.QueryRow(ctx,
+		"SELECT id, user_id, name, days_completed, streak, goal_days, completed, created_at, last_tracked_date FROM habits WHERE id = $1 AND user_id = $2",
+		habitID, userID,
+	).Scan(&h.ID, &h.UserID, &h.Name, &h.DaysCompleted, &h.Streak, &h.GoalDays, &h.Completed, &h.CreatedAt, &h.LastTrackedDate)
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+
+	return &h, nil
+}
+
+func (p *Postgres) UpdateHabitProgress(ctx context.Context, habit *Habit) error {
+	_, err := p.db.Exec(ctx,
+		"UPDATE habits SET days_completed = $1, streak = $2, completed = $3, last_tracked_date = $4 WHERE id = $5",
+		habit.DaysCompleted, habit.Streak, habit.Completed, habit.LastTrackedDate, habit.ID,
+	)
+	return err
+}
+
+func (p *Postgres) GetWallet(ctx context.Context, userID string) (*Wallet, error) {
+	var w Wallet
+	err := p.db.QueryRow(ctx,
+		"SELECT public_key, encrypted_private_key, address FROM wallets WHERE user_id = $1",
+		userID,
+	).Scan(&w.PublicKey, &w.EncryptedPrivateKey, &w.Address)
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+
+	return &w, nil
+}
+
+func (p *Postgres) CreateWallet(ctx context.Context, userID string, wallet *Wallet) error {
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO wallets (user_id, public_key, encrypted_private_key, address) VALUES ($1, $2, $3, $4)",
+		userID, wallet.PublicKey, wallet.EncryptedPrivateKey, wallet.Address,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) ActivePlan(ctx context.Context, userID string) (string, error) {
+	return billing.ActivePlan(ctx, p.db, userID)
+}
+
+// achievementColumns are scanned by scanAchievement, in order
+const achievementColumns = "id, user_id, habit_id, habit_name, goal_days, started_at, completed_at, wallet_address, status, transaction_hash, token_id, COALESCE(last_error, ''), attempts, created_at, updated_at"
+
+func scanAchievement(row pgx.Row) (Achievement, error) {
+	var a Achievement
+	err := row.Scan(&a.ID, &a.UserID, &a.HabitID, &a.HabitName, &a.GoalDays, &a.StartedAt, &a.CompletedAt, &a.WalletAddress,
+		&a.Status, &a.TransactionHash, &a.TokenID, &a.LastError, &a.Attempts, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+func (p *Postgres) queryAchievements(ctx context.Context, sql string, args ...interface{}) ([]Achievement, error) {
+	rows, err := p.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := []Achievement{}
+	for rows.Next() {
+		a, err := scanAchievement(rows)
+		if err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, a)
+	}
+	return achievements, rows.Err()
+}
+
+func (p *Postgres) CreateAchievement(ctx context.Context, a *Achievement) error {
+	_, err := p.db.Exec(ctx,
+		`INSERT INTO achievements (id, user_id, habit_id, habit_name, goal_days, started_at, completed_at, wallet_address, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		a.ID, a.UserID, a.HabitID, a.HabitName, a.GoalDays, a.StartedAt, a.CompletedAt, a.WalletAddress, a.Status, a.CreatedAt, a.UpdatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) GetAchievement(ctx context.Context, achievementID string) (*Achievement, error) {
+	a, err := scanAchievement(p.db.QueryRow(ctx, "SELECT "+achievementColumns+" FROM achievements WHERE id = $1", achievementID))
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	return &a, nil
+}
+
+func (p *Postgres) ListAchievements(ctx context.Context, userID string) ([]Achievement, error) {
+	return p.queryAchievements(ctx,
+		"SELECT "+achievementColumns+" FROM achievements WHERE user_id = $1 ORDER BY completed_at DESC",
+		userID,
+	)
+}
+
+func (p *Postgres) PendingAchievements(ctx context.Context, limit int) ([]Achievement, error) {
+	return p.queryAchievements(ctx,
+		`SELECT `+achievementColumns+` FROM achievements a
+		WHERE status IN ('queued', 'submitted')
+			AND NOT EXISTS (SELECT 1 FROM transaction_outbox o WHERE o.kind = $1 AND o.reference = a.id::text)
+		ORDER BY updated_at LIMIT $2`,
+		OutboxAchievementMint, limit,
+	)
+}
+
+func (p *Postgres) UpdateAchievement(ctx context.Context, a *Achievement) error {
+	tag, err := p.db.Exec(ctx,
+		"UPDATE achievements SET status = $1, transaction_hash = $2, token_id = $3, last_error = $4, attempts = $5, updated_at = $6 WHERE id = $7",
+		a.Status, a.TransactionHash, a.TokenID, nullIfEmpty(a.LastError), a.Attempts, a.UpdatedAt, a.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// stakeColumns are scanned by scanStake, in order
+const stakeColumns = "habit_id, user_id, staker_address, COALESCE(amount::text, ''), deadline, deposit_transaction_hash, status, success, resolution_transaction_hash, COALESCE(last_error, ''), attempts, created_at, updated_at"
+
+func scanStake(row pgx.Row) (Stake, error) {
+	var s Stake
+	err := row.Scan(&s.HabitID, &s.UserID, &s.StakerAddress, &s.Amount, &s.Deadline, &s.DepositTransactionHash,
+		&s.Status, &s.Success, &s.ResolutionTransactionHash, &s.LastError, &s.Attempts, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func (p *Postgres) CreateStake(ctx context.Context, s *Stake) error {
+	_, err := p.db.Exec(ctx,
+		`INSERT INTO habit_stakes (habit_id, user_id, staker_address, deposit_transaction_hash, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		s.HabitID, s.UserID, s.StakerAddress, s.DepositTransactionHash, s.Status, s.CreatedAt, s.UpdatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) GetStake(ctx context.Context, userID, habitID string) (*Stake, error) {
+	s, err := scanStake(p.db.QueryRow(ctx,
+		"SELECT "+stakeColumns+" FROM habit_stakes WHERE habit_id = $1 AND user_id = $2",
+		habitID, userID,
+	))
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	return &s, nil
+}
+
+func (p *Postgres) OpenStakes(ctx context.Context, limit int) ([]Stake, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT "+stakeColumns+" FROM habit_stakes WHERE status IN ('pending', 'active', 'resolving') ORDER BY updated_at LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stakes := []Stake{}
+	for rows.Next() {
+		s, err := scanStake(rows)
+		if err != nil {
+			return nil, err
+		}
+		stakes = append(stakes, s)
+	}
+	return stakes, rows.Err()
+}
+
+func (p *Postgres) UpdateStake(ctx context.Context, s *Stake) error {
+	tag, err := p.db.Exec(ctx,
+		`UPDATE habit_stakes SET amount = $1, deadline = $2, status = $3, success = $4, resolution_transaction_hash = $5,
+		last_error = $6, attempts = $7, updated_at = $8 WHERE habit_id = $9`,
+		nullIfEmpty(s.Amount), s.Deadline, s.Status, s.Success, s.ResolutionTransactionHash,
+		nullIfEmpty(s.LastError), s.Attempts, s.UpdatedAt, s.HabitID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) AddReward(ctx context.Context, r *Reward) error {
+	_, err := p.db.Exec(ctx,
+		`INSERT INTO rewards (id, user_id, habit_id, reason, day, points, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		r.ID, r.UserID, r.HabitID, r.Reason, r.Day, r.Points, r.CreatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) ListRewards(ctx context.Context, userID string, limit int) ([]Reward, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT r.id, r.user_id, r.habit_id, r.reason, r.day, r.points, COALESCE(c.status = 'confirmed', false), r.created_at
+		FROM rewards r LEFT JOIN reward_claims c ON c.id = r.claim_id
+		WHERE r.user_id = $1 ORDER BY r.created_at DESC LIMIT $2`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rewards := []Reward{}
+	for rows.Next() {
+		var r Reward
+		if err := rows.Scan(&r.ID, &r.UserID, &r.HabitID, &r.Reason, &r.Day, &r.Points, &r.Claimed, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, r)
+	}
+	return rewards, rows.Err()
+}
+
+func (p *Postgres) RewardTotals(ctx context.Context, userID string) (*RewardTotals, error) {
+	var totals RewardTotals
+	err := p.db.QueryRow(ctx,
+		`SELECT COALESCE(SUM(r.points) FILTER (WHERE c.status IS DISTINCT FROM 'confirmed'), 0),
+			COALESCE(SUM(r.points) FILTER (WHERE c.status = 'confirmed'), 0)
+		FROM rewards r LEFT JOIN reward_claims c ON c.id = r.claim_id
+		WHERE r.user_id = $1`,
+		userID,
+	).Scan(&totals.Pending, &totals.Claimed)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// errNothingToClaim rolls back a claim that attached no reward
+var errNothingToClaim = errors.New("no unclaimed rewards")
+
+func (p *Postgres) CreateRewardClaim(ctx context.Context, claim *RewardClaim, maxRecipients int) ([]RewardBalance, error) {
+	var balances []RewardBalance
+	err := database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		balances = nil
+		_, err := tx.Exec(ctx,
+			`INSERT INTO reward_claims (id, status, recipients, points, created_at, updated_at)
+			VALUES ($1, $2, 0, 0, $3, $4)`,
+			claim.ID, claim.Status, claim.CreatedAt, claim.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Users owed the oldest rewards are paid first. Rewards accrued or
+		// claimed concurrently are left for the next claim.
+		rows, err := tx.Query(ctx,
+			`WITH recipients AS (
+				SELECT r.user_id FROM rewards r JOIN wallets w ON w.user_id = r.user_id
+				WHERE r.claim_id IS NULL
+				GROUP BY r.user_id ORDER BY MIN(r.created_at) LIMIT $2
+			), attached AS (
+				UPDATE rewards SET claim_id = $1
+				WHERE claim_id IS NULL AND user_id IN (SELECT user_id FROM recipients)
+				RETURNING user_id, points
+			)
+			SELECT a.user_id, w.address, SUM(a.points)::BIGINT
+			FROM attached a JOIN wallets w ON w.user_id = a.user_id
+			GROUP BY a.user_id, w.address`,
+			claim.ID, maxRecipients,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var points int64
+		for rows.Next() {
+			var b RewardBalance
+			if err := rows.Scan(&b.UserID, &b.WalletAddress, &b.Points); err != nil {
+				return err
+			}
+			balances = append(balances, b)
+			points += b.Points
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(balances) == 0 {
+			return errNothingToClaim
+		}
+
+		claim.Recipients = len(balances)
+		claim.Points = points
+		_, err = tx.Exec(ctx,
+			"UPDATE reward_claims SET recipients = $1, points = $2 WHERE id = $3",
+			claim.Recipients, claim.Points, claim.ID,
+		)
+		return err
+	})
+	if errors.Is(err, errNothingToClaim) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+func (p *Postgres) RewardClaimBalances(ctx context.Context, claimID string) ([]RewardBalance, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT r.user_id, w.address, SUM(r.points)::BIGINT
+		FROM rewards r JOIN wallets w ON w.user_id = r.user_id
+		WHERE r.claim_id = $1
+		GROUP BY r.user_id, w.address ORDER BY r.user_id`,
+		claimID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []RewardBalance{}
+	for rows.Next() {
+		var b RewardBalance
+		if err := rows.Scan(&b.UserID, &b.WalletAddress, &b.Points); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+func (p *Postgres) OpenRewardClaims(ctx context.Context) ([]RewardClaim, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT id, status, transaction_hash, recipients, points, COALESCE(last_error, ''), attempts, created_at, updated_at
+		FROM reward_claims WHERE status IN ('pending', 'submitted') ORDER BY created_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []RewardClaim{}
+	for rows.Next() {
+		var c RewardClaim
+		err := rows.Scan(&c.ID, &c.Status, &c.TransactionHash, &c.Recipients, &c.Points, &c.LastError, &c.Attempts, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+func (p *Postgres) UpdateRewardClaim(ctx context.Context, c *RewardClaim) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			"UPDATE reward_claims SET status = $1, transaction_hash = $2, last_error = $3, attempts = $4, updated_at = $5 WHERE id = $6",
+			c.Status, c.TransactionHash, nullIfEmpty(c.LastError), c.Attempts, c.UpdatedAt, c.ID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		if c.Status == ClaimFailed {
+			_, err = tx.Exec(ctx, "UPDATE rewards SET claim_id = NULL WHERE claim_id = $1", c.ID)
+		}
+		return err
+	})
+}
+
+func (p *Postgres) RecordCheckIn(ctx context.Context, c *CheckIn) error {
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO check_ins (habit_id, day, user_id, created_at) VALUES ($1, $2, $3, $4)",
+		c.HabitID, c.Day, c.UserID, c.CreatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) CheckInLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT c.user_id, c.habit_id, w.address
+		FROM check_ins c JOIN wallets w ON w.user_id = c.user_id
+		WHERE c.day = $1`,
+		day,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaves := []CheckInLeaf{}
+	for rows.Next() {
+		var l CheckInLeaf
+		if err := rows.Scan(&l.UserID, &l.HabitID, &l.WalletAddress); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, l)
+	}
+	return leaves, rows.Err()
+}
+
+func (p *Postgres) UnattestedDays(ctx context.Context, before time.Time, limit int) ([]time.Time, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT DISTINCT c.day FROM check_ins c JOIN wallets w ON w.user_id = c.user_id
+		WHERE c.day < $1 AND NOT EXISTS (SELECT 1 FROM attestations a WHERE a.day = c.day)
+		ORDER BY c.day LIMIT $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []time.Time{}
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// attestationColumns are scanned by scanAttestation, in order
+const attestationColumns = "day, root, leaves, status, transaction_hash, COALESCE(last_error, ''), attempts, created_at, updated_at"
+
+func scanAttestation(row pgx.Row) (Attestation, error) {
+	var a Attestation
+	err := row.Scan(&a.Day, &a.Root, &a.Leaves, &a.Status, &a.TransactionHash, &a.LastError, &a.Attempts, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+func (p *Postgres) CreateAttestation(ctx context.Context, a *Attestation, leaves []CheckInLeaf) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO attestations (day, root, leaves, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			a.Day, a.Root, a.Leaves, a.Status, a.CreatedAt, a.UpdatedAt,
+		)
+		if err != nil {
+			return database.MapError(err)
+		}
+
+		batch := &pgx.Batch{}
+		for _, l := range leaves {
+			batch.Queue(
+				"INSERT INTO attestation_leaves (day, user_id, habit_id, wallet_address) VALUES ($1, $2, $3, $4)",
+				a.Day, l.UserID, l.HabitID, l.WalletAddress,
+			)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+func (p *Postgres) AttestationLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT user_id, habit_id, wallet_address FROM attestation_leaves WHERE day = $1",
+		day,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaves := []CheckInLeaf{}
+	for rows.Next() {
+		var l CheckInLeaf
+		if err := rows.Scan(&l.UserID, &l.HabitID, &l.WalletAddress); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, l)
+	}
+	return leaves, rows.Err()
+}
+
+func (p *Postgres) GetAttestation(ctx context.Context, day time.Time) (*Attestation, error) {
+	a, err := scanAttestation(p.db.QueryRow(ctx, "SELECT "+attestationColumns+" FROM attestations WHERE day = $1", day))
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	return &a, nil
+}
+
+func (p *Postgres) PendingAttestations(ctx context.Context) ([]Attestation, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT "+attestationColumns+" FROM attestations WHERE status IN ('queued', 'submitted') ORDER BY day",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attestations := []Attestation{}
+	for rows.Next() {
+		a, err := scanAttestation(rows)
+		if err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, a)
+	}
+	return attestations, rows.Err()
+}
+
+func (p *Postgres) UpdateAttestation(ctx context.Context, a *Attestation) error {
+	tag, err := p.db.Exec(ctx,
+		"UPDATE attestations SET status = $1, transaction_hash = $2, last_error = $3, attempts = $4, updated_at = $5 WHERE day = $6",
+		a.Status, a.TransactionHash, nullIfEmpty(a.LastError), a.Attempts, a.UpdatedAt, a.Day,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// chainEventColumns are scanned by scanChainEvent, in order
+const chainEventColumns = "id, contract, contract_address, COALESCE(name, ''), keys, data, fields, block_number, block_hash, transaction_hash, event_index, created_at"
+
+func scanChainEvent(row pgx.Row) (ChainEvent, error) {
+	var e ChainEvent
+	var fields []byte
+	var blockNumber int64
+	err := row.Scan(&e.ID, &e.Contract, &e.ContractAddress, &e.Name, &e.Keys, &e.Data, &fields, &blockNumber, &e.BlockHash, &e.TransactionHash, &e.EventIndex, &e.CreatedAt)
+	e.BlockNumber = uint64(blockNumber)
+	if fields != nil {
+		e.Fields = fields
+	}
+	return e, err
+}
+
+func (p *Postgres) EventCheckpoint(ctx context.Context) (*EventCheckpoint, error) {
+	var checkpoint EventCheckpoint
+	var blockNumber int64
+	err := p.db.QueryRow(ctx, "SELECT block_number, block_hash FROM event_checkpoint").Scan(&blockNumber, &checkpoint.BlockHash)
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	checkpoint.BlockNumber = uint64(blockNumber)
+	return &checkpoint, nil
+}
+
+func (p *Postgres) SaveEvents(ctx context.Context, events []ChainEvent, checkpoint EventCheckpoint) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, e := range events {
+			var fields interface{}
+			if len(e.Fields) > 0 {
+				fields = string(e.Fields)
+			}
+			batch.Queue(
+				`INSERT INTO chain_events (contract, contract_address, name, keys, data, fields, block_number, block_hash, transaction_hash, event_index, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $9, $10, $11)
+				ON CONFLICT (transaction_hash, contract_address, event_index) DO NOTHING`,
+				e.Contract, e.ContractAddress, nullIfEmpty(e.Name), e.Keys, e.Data, fields, int64(e.BlockNumber), e.BlockHash, e.TransactionHash, e.EventIndex, e.CreatedAt,
+			)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		return setEventCheckpoint(ctx, tx, checkpoint)
+	})
+}
+
+func (p *Postgres) RewindEvents(ctx context.Context, checkpoint EventCheckpoint) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM chain_events WHERE block_number > $1", int64(checkpoint.BlockNumber)); err != nil {
+			return err
+		}
+		return setEventCheckpoint(ctx, tx, checkpoint)
+	})
+}
+
+func setEventCheckpoint(ctx context.Context, tx pgx.Tx, checkpoint EventCheckpoint) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO event_checkpoint (id, block_number, block_hash, updated_at) VALUES (TRUE, $1, $2, NOW())
+		ON CONFLICT (id) DO UPDATE SET block_number = EXCLUDED.block_number, block_hash = EXCLUDED.block_hash, updated_at = EXCLUDED.updated_at`,
+		int64(checkpoint.BlockNumber), checkpoint.BlockHash,
+	)
+	return err
+}
+
+func (p *Postgres) ListEvents(ctx context.Context, query EventQuery) ([]ChainEvent, error) {
+	rows, err := p.db.Query(ctx,
+		`SELECT `+chainEventColumns+` FROM chain_events
+		WHERE ($1 = '' OR contract = $1) AND ($2 = '' OR name = $2) AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC LIMIT $4`,
+		query.Contract, query.Name, query.Before, query.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ChainEvent{}
+	for rows.Next() {
+		e, err := scanChainEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// outboxColumns are scanned by scanOutbox, in order
+const outboxColumns = "id, COALESCE(user_id::text, ''), kind, reference, calls, status, transaction_hash, COALESCE(last_error, ''), attempts, COALESCE(fee::text, ''), next_attempt_at, created_at, updated_at"
+
+func scanOutbox(row pgx.Row) (OutboxTransaction, error) {
+	var tx OutboxTransaction
+	var calls []byte
+	err := row.Scan(&tx.ID, &tx.UserID, &tx.Kind, &tx.Reference, &calls, &tx.Status, &tx.TransactionHash,
+		&tx.LastError, &tx.Attempts, &tx.Fee, &tx.NextAttemptAt, &tx.CreatedAt, &tx.UpdatedAt)
+	tx.Calls = calls
+	return tx, err
+}
+
+func (p *Postgres) queryOutbox(ctx context.Context, sql string, args ...interface{}) ([]OutboxTransaction, error) {
+	rows, err := p.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []OutboxTransaction{}
+	for rows.Next() {
+		tx, err := scanOutbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tx)
+	}
+	return list, rows.Err()
+}
+
+func (p *Postgres) SaveHabitProgress(ctx context.Context, habit *Habit, achievement *Achievement, queued []OutboxTransaction) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			"UPDATE habits SET days_completed = $1, streak = $2, completed = $3, last_tracked_date = $4 WHERE id = $5",
+			habit.DaysCompleted, habit.Streak, habit.Completed, habit.LastTrackedDate, habit.ID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		if a := achievement; a != nil {
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO achievements (id, user_id, habit_id, habit_name, goal_days, started_at, completed_at, wallet_address, status, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+				ON CONFLICT (habit_id) DO NOTHING`,
+				a.ID, a.UserID, a.HabitID, a.HabitName, a.GoalDays, a.StartedAt, a.CompletedAt, a.WalletAddress, a.Status, a.CreatedAt, a.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return nil
+			}
+		}
+
+		for _, o := range queued {
+			_, err := tx.Exec(ctx,
+				`INSERT INTO transaction_outbox (id, user_id, kind, reference, calls, status, attempts, next_attempt_at, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9, $10)
+				ON CONFLICT (kind, reference) DO NOTHING`,
+				o.ID, nullIfEmpty(o.UserID), o.Kind, o.Reference, string(o.Calls), o.Status, o.Attempts, o.NextAttemptAt, o.CreatedAt, o.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *Postgres) PendingOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxTransaction, error) {
+	return p.queryOutbox(ctx,
+		`SELECT `+outboxColumns+` FROM transaction_outbox
+		WHERE status = 'submitted' OR (status = 'queued' AND next_attempt_at <= $1)
+		ORDER BY updated_at LIMIT $2`,
+		now, limit,
+	)
+}
+
+func (p *Postgres) UpdateOutbox(ctx context.Context, o *OutboxTransaction) error {
+	tag, err := p.db.Exec(ctx,
+		`UPDATE transaction_outbox SET status = $1, transaction_hash = $2, last_error = $3, attempts = $4, fee = $5, next_attempt_at = $6, updated_at = $7
+		WHERE id = $8`,
+		o.Status, o.TransactionHash, nullIfEmpty(o.LastError), o.Attempts, nullIfEmpty(o.Fee), o.NextAttemptAt, o.UpdatedAt, o.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) ListOutbox(ctx context.Context, userID string, limit int) ([]OutboxTransaction, error) {
+	return p.queryOutbox(ctx,
+		"SELECT "+outboxColumns+" FROM transaction_outbox WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2",
+		userID, limit,
+	)
+}
+
+func (p *Postgres) SponsoredFees(ctx context.Context, userID string, since time.Time) (*big.Int, error) {
+	var sum string
+	err := p.db.QueryRow(ctx,
+		"SELECT COALESCE(SUM(fee), 0)::text FROM transaction_outbox WHERE user_id = $1 AND created_at >= $2",
+		userID, since,
+	).Scan(&sum)
+	if err != nil {
+		return nil, err
+	}
+	total, ok := new(big.Int).SetString(sum, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid fee sum %q", sum)
+	}
+	return total, nil
+}
+
+func (p *Postgres) GetWalletSecurity(ctx context.Context, userID string) (*WalletSecurity, error) {
+	s := WalletSecurity{UserID: userID}
+	err := p.db.QueryRow(ctx,
+		"SELECT pin_hash, failed_attempts, locked_until, exported_at, updated_at FROM wallet_security WHERE user_id = $1",
+		userID,
+	).Scan(&s.PINHash, &s.FailedAttempts, &s.LockedUntil, &s.ExportedAt, &s.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &WalletSecurity{UserID: userID}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *Postgres) SetWalletPIN(ctx context.Context, userID, pinHash string, at time.Time) error {
+	// Selecting from wallets inserts nothing for a user without a wallet
+	tag, err := p.db.Exec(ctx,
+		`INSERT INTO wallet_security (user_id, pin_hash, updated_at)
+		SELECT user_id, $2, $3 FROM wallets WHERE user_id = $1
+		ON CONFLICT (user_id) DO UPDATE SET pin_hash = $2, updated_at = $3`,
+		userID, pinHash, at,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) RecordWalletPINFailure(ctx context.Context, userID string, maxAttempts int, lockedUntil, at time.Time) (*WalletSecurity, error) {
+	// The right-hand sides read the row as it was before the update
+	s := WalletSecurity{UserID: userID}
+	err := p.db.QueryRow(ctx,
+		`UPDATE wallet_security SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END,
+			updated_at = $4
+		WHERE user_id = $1
+		RETURNING pin_hash, failed_attempts, locked_until, exported_at, updated_at`,
+		userID, maxAttempts, lockedUntil, at,
+	).Scan(&s.PINHash, &s.FailedAttempts, &s.LockedUntil, &s.ExportedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	return &s, nil
+}
+
+func (p *Postgres) ResetWalletPINFailures(ctx context.Context, userID string, at time.Time) error {
+	tag, err := p.db.Exec(ctx,
+		"UPDATE wallet_security SET failed_attempts = 0, locked_until = NULL, updated_at = $2 WHERE user_id = $1",
+		userID, at,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) MarkWalletExported(ctx context.Context, userID string, at time.Time) error {
+	tag, err := p.db.Exec(ctx,
+		"UPDATE wallet_security SET exported_at = $2, updated_at = $2 WHERE user_id = $1 AND exported_at IS NULL",
+		userID, at,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (p *Postgres) AddWalletEvent(ctx context.Context, e *WalletEvent) error {
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO wallet_events (id, user_id, kind, ip_address, created_at) VALUES ($1, $2, $3, $4, $5)",
+		e.ID, e.UserID, e.Kind, nullIfEmpty(e.IPAddress), e.CreatedAt,
+	)
+	return err
+}
+
+func (p *Postgres) ListWalletEvents(ctx context.Context, userID string, limit int) ([]WalletEvent, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT id, user_id, kind, COALESCE(ip_address, ''), created_at FROM wallet_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []WalletEvent{}
+	for rows.Next() {
+		var e WalletEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Kind, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// rotationColumns are scanned by scanRotation, in order
+const rotationColumns = "id, user_id, wallet_address, old_public_key, new_public_key, encrypted_private_key, status, transaction_hash, COALESCE(last_error, ''), created_at, updated_at"
+
+func scanRotation(row pgx.Row) (KeyRotation, error) {
+	var r KeyRotation
+	err := row.Scan(&r.ID, &r.UserID, &r.WalletAddress, &r.OldPublicKey, &r.NewPublicKey, &r.EncryptedPrivateKey,
+		&r.Status, &r.TransactionHash, &r.LastError, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+func (p *Postgres) CreateKeyRotation(ctx context.Context, r *KeyRotation) error {
+	_, err := p.db.Exec(ctx,
+		`INSERT INTO wallet_key_rotations (id, user_id, wallet_address, old_public_key, new_public_key, encrypted_private_key, status, transaction_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		r.ID, r.UserID, r.WalletAddress, r.OldPublicKey, r.NewPublicKey, r.EncryptedPrivateKey, r.Status, r.TransactionHash, r.CreatedAt, r.UpdatedAt,
+	)
+	return database.MapError(err)
+}
+
+func (p *Postgres) UpdateKeyRotation(ctx context.Context, r *KeyRotation) error {
+	tag, err := p.db.Exec(ctx,
+		"UPDATE wallet_key_rotations SET status = $1, transaction_hash = $2, last_error = $3, updated_at = $4 WHERE id = $5",
+		r.Status, r.TransactionHash, nullIfEmpty(r.LastError), r.UpdatedAt, r.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) CompleteKeyRotation(ctx context.Context, r *KeyRotation) error {
+	return database.RunInTx(ctx, p.db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var userID, publicKey, encryptedKey string
+		err := tx.QueryRow(ctx,
+			`UPDATE wallet_key_rotations SET status = 'completed', transaction_hash = $1, last_error = NULL, updated_at = $2
+			WHERE id = $3
+			RETURNING user_id, new_public_key, encrypted_private_key`,
+			r.TransactionHash, r.UpdatedAt, r.ID,
+		).Scan(&userID, &publicKey, &encryptedKey)
+		if err != nil {
+			return database.MapError(err)
+		}
+
+		tag, err := tx.Exec(ctx,
+			"UPDATE wallets SET public_key = $1, encrypted_private_key = $2 WHERE user_id = $3",
+			publicKey, encryptedKey, userID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		// The new key has never been exported
+		_, err = tx.Exec(ctx,
+			"UPDATE wallet_security SET exported_at = NULL, updated_at = $1 WHERE user_id = $2",
+			r.UpdatedAt, userID,
+		)
+		return err
+	})
+}
+
+func (p *Postgres) LatestKeyRotation(ctx context.Context, userID string) (*KeyRotation, error) {
+	r, err := scanRotation(p.db.QueryRow(ctx,
+		"SELECT "+rotationColumns+" FROM wallet_key_rotations WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1",
+		userID,
+	))
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	return &r, nil
+}
+
+func (p *Postgres) OpenKeyRotations(ctx context.Context, limit int) ([]KeyRotation, error) {
+	rows, err := p.db.Query(ctx,
+		"SELECT "+rotationColumns+" FROM wallet_key_rotations WHERE status IN ('pending', 'submitted') ORDER BY created_at LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []KeyRotation{}
+	for rows.Next() {
+		r, err := scanRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
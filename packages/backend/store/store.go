@@ -0,0 +1,509 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	database "aura-backend/db"
+)
+
+// Store errors are the database domain errors, so errors returned by the
+// Postgres store and the in-memory store can be compared with errors.Is
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = database.ErrNotFound
+	// ErrConflict is returned when a record with the same key already exists
+	ErrConflict = database.ErrConflict
+)
+
+type User struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type Habit struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"userId"`
+	Name            string     `json:"name"`
+	DaysCompleted   int        `json:"daysCompleted"`
+	Streak          int        `json:"streak"` // Consecutive days tracked up to the last check-in
+	GoalDays        int        `json:"goalDays"`
+	Completed       bool       `json:"completed"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastTrackedDate *time.Time `json:"lastTrackedDate,omitempty"` // New property
+}
+
+type Wallet struct {
+	PublicKey           string `json:"publicKey"`
+	EncryptedPrivateKey string `json:"-"` // Sealed by the custody keyring, only released by an export
+	Address             string `json:"address"`
+}
+
+// Statuses of an achievement NFT
+const (
+	AchievementQueued    = "queued"    // Waiting for the operator to submit the mint
+	AchievementSubmitted = "submitted" // Mint transaction sent, waiting for its receipt
+	AchievementMinted    = "minted"    // Token minted to the user's wallet
+	AchievementFailed    = "failed"    // Gave up after repeated failures or a revert
+)
+
+// Achievement is the NFT minted to a user's wallet when a habit is completed
+type Achievement struct {
+	ID              string    `json:"id"`
+	UserID          string    `json:"userId"`
+	HabitID         string    `json:"habitId"`
+	HabitName       string    `json:"habitName"`
+	GoalDays        int       `json:"goalDays"`
+	StartedAt       time.Time `json:"startedAt"`
+	CompletedAt     time.Time `json:"completedAt"`
+	WalletAddress   string    `json:"walletAddress"`
+	Status          string    `json:"status"`
+	TransactionHash *string   `json:"transactionHash,omitempty"`
+	TokenID         *string   `json:"tokenId,omitempty"`
+	LastError       string    `json:"-"` // Kept for operators, revert reasons are not shown to users
+	Attempts        int       `json:"-"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Statuses of a commitment stake
+const (
+	StakePending   = "pending"   // Deposit transaction not verified yet
+	StakeActive    = "active"    // Funds locked until the habit is completed or the streak breaks
+	StakeResolving = "resolving" // Oracle resolution sent, waiting for its receipt
+	StakeReturned  = "returned"  // Habit completed, funds returned to the staker
+	StakeForfeited = "forfeited" // Streak broken, funds sent to the beneficiary
+	StakeRejected  = "rejected"  // Deposit transaction missing, reverted or not matching the habit
+)
+
+// Stake links a habit to the STRK its owner locked in the escrow contract
+type Stake struct {
+	HabitID                   string     `json:"habitId"`
+	UserID                    string     `json:"userId"`
+	StakerAddress             string     `json:"stakerAddress"`
+	Amount                    string     `json:"amount,omitempty"` // In FRI, read from the deposit event
+	Deadline                  *time.Time `json:"deadline,omitempty"`
+	DepositTransactionHash    string     `json:"depositTransactionHash"`
+	Status                    string     `json:"status"`
+	Success                   *bool      `json:"success,omitempty"` // Outcome sent to the escrow
+	ResolutionTransactionHash *string    `json:"resolutionTransactionHash,omitempty"`
+	LastError                 string     `json:"-"`
+	Attempts                  int        `json:"-"`
+	CreatedAt                 time.Time  `json:"createdAt"`
+	UpdatedAt                 time.Time  `json:"updatedAt"`
+}
+
+// Reasons AURA points are accrued for
+const (
+	RewardCheckIn   = "check_in"  // Every check-in on a habit
+	RewardMilestone = "milestone" // Bonus when a habit's streak reaches a milestone
+)
+
+// Reward is an entry of the AURA points ledger. A point is one whole token.
+type Reward struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	HabitID   string    `json:"habitId"`
+	Reason    string    `json:"reason"`
+	Day       int       `json:"day"` // Days completed on the habit when the reward was accrued
+	Points    int64     `json:"points"`
+	Claimed   bool      `json:"claimed"` // Minted to the user's wallet by a confirmed claim
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RewardTotals sums a user's points by claim status
+type RewardTotals struct {
+	Pending int64 `json:"pending"` // Not minted yet, including points in a claim being sent
+	Claimed int64 `json:"claimed"`
+}
+
+// RewardBalance is what a claim owes one recipient
+type RewardBalance struct {
+	UserID        string
+	WalletAddress string
+	Points        int64
+}
+
+// Statuses of a reward claim
+const (
+	ClaimPending   = "pending"   // Rewards attached, mint transaction not sent yet
+	ClaimSubmitted = "submitted" // Mint transaction sent, waiting for its receipt
+	ClaimConfirmed = "confirmed" // Rewards minted to the recipients' wallets
+	ClaimFailed    = "failed"    // Reverted, the rewards went back to the next claim
+)
+
+// RewardClaim is a batch of rewards minted to their users' wallets in a
+// single transaction
+type RewardClaim struct {
+	ID              string
+	Status          string
+	TransactionHash *string
+	Recipients      int
+	Points          int64
+	LastError       string
+	Attempts        int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// CheckIn is a day a habit was tracked on. Days are UTC dates.
+type CheckIn struct {
+	UserID    string
+	HabitID   string
+	Day       time.Time
+	CreatedAt time.Time
+}
+
+// CheckInLeaf is a check-in of a user with a wallet, as attested on-chain
+type CheckInLeaf struct {
+	UserID        string
+	HabitID       string
+	WalletAddress string
+}
+
+// Statuses of a daily attestation
+const (
+	AttestationQueued    = "queued"    // Root computed, waiting for the operator to post it
+	AttestationSubmitted = "submitted" // Root transaction sent, waiting for its receipt
+	AttestationConfirmed = "confirmed" // Root stored in the registry contract
+	AttestationFailed    = "failed"    // Gave up after repeated failures or a revert
+)
+
+// Attestation is the Merkle root of a day's check-ins posted on-chain
+type Attestation struct {
+	Day             time.Time `json:"day"`
+	Root            string    `json:"root"`
+	Leaves          int       `json:"leaves"`
+	Status          string    `json:"status"`
+	TransactionHash *string   `json:"transactionHash,omitempty"`
+	LastError       string    `json:"-"`
+	Attempts        int       `json:"-"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// ChainEvent is an event emitted by one of our deployed contracts, as indexed
+type ChainEvent struct {
+	ID              int64           `json:"id"`
+	Contract        string          `json:"contract"` // Deployment name, e.g. AuraToken
+	ContractAddress string          `json:"contractAddress"`
+	Name            string          `json:"name,omitempty"` // Empty when the event is not in the ABI
+	Keys            []string        `json:"keys"`
+	Data            []string        `json:"data"`
+	Fields          json.RawMessage `json:"fields,omitempty"` // Members decoded with the ABI
+	BlockNumber     uint64          `json:"blockNumber"`
+	BlockHash       string          `json:"blockHash"`
+	TransactionHash string          `json:"transactionHash"`
+	EventIndex      int             `json:"eventIndex"` // Position among the contract's events in the transaction
+	CreatedAt       time.Time       `json:"createdAt"`
+}
+
+// EventCheckpoint is the last block the indexer has processed
+type EventCheckpoint struct {
+	BlockNumber uint64
+	BlockHash   string
+}
+
+// EventQuery filters indexed events. Empty fields match everything.
+type EventQuery struct {
+	Contract string
+	Name     string
+	Before   int64 // Only events with a lower ID, to page back from a previous result
+	Limit    int
+}
+
+// Kinds of outbox transactions
+const (
+	OutboxAchievementMint = "achievement_mint" // Mints the achievement named by the reference
+)
+
+// Statuses of an outbox transaction
+const (
+	OutboxQueued    = "queued"    // Waiting to be submitted at NextAttemptAt
+	OutboxSubmitted = "submitted" // Sent, waiting for its receipt
+	OutboxConfirmed = "confirmed" // Executed successfully
+	OutboxReverted  = "reverted"  // Included in a block but reverted
+	OutboxFailed    = "failed"    // Rejected by the node, or gave up after repeated errors
+)
+
+// OutboxTransaction is an on-chain transaction queued by a domain change and
+// sent by the outbox worker from the operator account
+type OutboxTransaction struct {
+	ID              string          `json:"id"`
+	UserID          string          `json:"-"` // Empty for transactions not made on behalf of a user
+	Kind            string          `json:"kind"`
+	Reference       string          `json:"reference"` // Record the transaction is for, unique per kind
+	Calls           json.RawMessage `json:"-"`         // The calls executed, as starknet.FunctionCall
+	Status          string          `json:"status"`
+	TransactionHash *string         `json:"transactionHash,omitempty"`
+	LastError       string          `json:"-"`
+	Attempts        int             `json:"attempts"`
+	Fee             string          `json:"fee,omitempty"` // Paid by the operator once included, in FRI
+	NextAttemptAt   time.Time       `json:"-"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+}
+
+// WalletSecurity guards the export and recovery of a wallet whose key the
+// backend holds
+type WalletSecurity struct {
+	UserID         string
+	PINHash        string     // Empty until the user sets a PIN
+	FailedAttempts int        // Wrong PINs since the last right one
+	LockedUntil    *time.Time // PINs are refused until then after too many wrong ones
+	ExportedAt     *time.Time // When the current key was exported, each key is exported once
+	UpdatedAt      time.Time
+}
+
+// Kinds of wallet security events
+const (
+	WalletPINSet          = "pin_set"
+	WalletPINFailed       = "pin_failed"
+	WalletPINLocked       = "pin_locked"
+	WalletKeyExported     = "key_exported"
+	WalletRecoveryStarted = "recovery_started"
+	WalletKeyRotated      = "key_rotated"
+	WalletRecoveryFailed  = "recovery_failed"
+)
+
+// WalletEvent is an entry of the security log of a user's wallet
+type WalletEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Kind      string    `json:"kind"`
+	IPAddress string    `json:"ipAddress,omitempty"` // Client that made the request, empty for background changes
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Statuses of a key rotation
+const (
+	RotationPending   = "pending"   // New key saved, set_public_key not sent yet
+	RotationSubmitted = "submitted" // set_public_key sent, waiting for the account to use the new key
+	RotationCompleted = "completed" // The account and the wallet use the new key
+	RotationFailed    = "failed"    // The account still uses the old key
+)
+
+// KeyRotation replaces the signing key of a wallet's account with a new key
+// generated by the backend
+type KeyRotation struct {
+	ID                  string    `json:"id"`
+	UserID              string    `json:"-"`
+	WalletAddress       string    `json:"walletAddress"`
+	OldPublicKey        string    `json:"oldPublicKey"`
+	NewPublicKey        string    `json:"newPublicKey"`
+	EncryptedPrivateKey string    `json:"-"` // The new key, sealed
+	Status              string    `json:"status"`
+	TransactionHash     *string   `json:"transactionHash,omitempty"`
+	LastError           string    `json:"-"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// UserStore persists user profiles
+type UserStore interface {
+	// GetUser returns the profile of a user, or ErrNotFound
+	GetUser(ctx context.Context, userID string) (*User, error)
+	// CreateUser creates a profile, or returns ErrConflict if it exists
+	CreateUser(ctx context.Context, user *User) error
+	// UpdateUserProfile overwrites the non-empty name and email fields
+	UpdateUserProfile(ctx context.Context, userID, firstName, lastName, email string) error
+	// UpdateUserRole sets the stored role of a user
+	UpdateUserRole(ctx context.Context, userID, role string) error
+	// SetStripeCustomerID links a user to their Stripe customer
+	SetStripeCustomerID(ctx context.Context, userID, customerID string) error
+}
+
+// HabitStore persists habits and their progress
+type HabitStore interface {
+	// ListHabits returns the user's habits, newest first
+	ListHabits(ctx context.Context, userID string) ([]Habit, error)
+	// CountActiveHabits counts the user's habits that are not completed
+	CountActiveHabits(ctx context.Context, userID string) (int, error)
+	// CreateHabit stores a new habit
+	CreateHabit(ctx context.Context, habit *Habit) error
+	// GetHabit returns a habit owned by the user, or ErrNotFound
+	GetHabit(ctx context.Context, userID, habitID string) (*Habit, error)
+	// UpdateHabitProgress saves the progress fields of a habit
+	UpdateHabitProgress(ctx context.Context, habit *Habit) error
+}
+
+// WalletStore persists the wallets generated for users
+type WalletStore interface {
+	// GetWallet returns the user's wallet, or ErrNotFound
+	GetWallet(ctx context.Context, userID string) (*Wallet, error)
+	// CreateWallet stores the user's wallet, or returns ErrConflict if one exists
+	CreateWallet(ctx context.Context, userID string, wallet *Wallet) error
+	// GetWalletSecurity returns the PIN and export state of the user's
+	// wallet, empty when none was saved
+	GetWalletSecurity(ctx context.Context, userID string) (*WalletSecurity, error)
+	// SetWalletPIN sets the PIN hash of the user's wallet, or returns
+	// ErrNotFound if the user has no wallet. The security state is changed
+	// field by field so that parallel requests do not undo each other.
+	SetWalletPIN(ctx context.Context, userID, pinHash string, at time.Time) error
+	// RecordWalletPINFailure counts a wrong PIN in one statement, so parallel
+	// attempts all count. The maxAttempts-th wrong PIN in a row locks the PIN
+	// until lockedUntil and starts the count again. It returns the updated
+	// state, or ErrNotFound if no PIN was set.
+	RecordWalletPINFailure(ctx context.Context, userID string, maxAttempts int, lockedUntil, at time.Time) (*WalletSecurity, error)
+	// ResetWalletPINFailures clears the count of wrong PINs and the lock
+	ResetWalletPINFailures(ctx context.Context, userID string, at time.Time) error
+	// MarkWalletExported records the export of the current key, or returns
+	// ErrConflict if it was already exported
+	MarkWalletExported(ctx context.Context, userID string, at time.Time) error
+	// AddWalletEvent appends an event to the security log
+	AddWalletEvent(ctx context.Context, event *WalletEvent) error
+	// ListWalletEvents returns up to limit of the user's events, newest first
+	ListWalletEvents(ctx context.Context, userID string, limit int) ([]WalletEvent, error)
+	// CreateKeyRotation stores a rotation, or returns ErrConflict while the
+	// user has a pending or submitted one
+	CreateKeyRotation(ctx context.Context, rotation *KeyRotation) error
+	// UpdateKeyRotation saves the progress fields of a rotation
+	UpdateKeyRotation(ctx context.Context, rotation *KeyRotation) error
+	// CompleteKeyRotation marks a rotation completed and gives its key to the
+	// wallet, which can then be exported again, in one transaction
+	CompleteKeyRotation(ctx context.Context, rotation *KeyRotation) error
+	// LatestKeyRotation returns the user's most recent rotation, or ErrNotFound
+	LatestKeyRotation(ctx context.Context, userID string) (*KeyRotation, error)
+	// OpenKeyRotations returns up to limit pending and submitted rotations,
+	// oldest first
+	OpenKeyRotations(ctx context.Context, limit int) ([]KeyRotation, error)
+}
+
+// SubscriptionStore reads the time-boxed plans granted to users
+type SubscriptionStore interface {
+	// ActivePlan returns the plan of the user's running subscription, or "" if none
+	ActivePlan(ctx context.Context, userID string) (string, error)
+}
+
+// AchievementStore persists achievement NFTs and their mint progress
+type AchievementStore interface {
+	// CreateAchievement queues an achievement, or returns ErrConflict if the
+	// habit already has one
+	CreateAchievement(ctx context.Context, achievement *Achievement) error
+	// GetAchievement returns an achievement by id, or ErrNotFound
+	GetAchievement(ctx context.Context, achievementID string) (*Achievement, error)
+	// ListAchievements returns the user's achievements, newest first
+	ListAchievements(ctx context.Context, userID string) ([]Achievement, error)
+	// PendingAchievements returns up to limit queued or submitted
+	// achievements, least recently updated first. Achievements minted
+	// through the outbox are left to it.
+	PendingAchievements(ctx context.Context, limit int) ([]Achievement, error)
+	// UpdateAchievement saves the mint progress fields of an achievement
+	UpdateAchievement(ctx context.Context, achievement *Achievement) error
+}
+
+// StakeStore persists the commitment stakes placed on habits
+type StakeStore interface {
+	// CreateStake links a stake to a habit, or returns ErrConflict if the
+	// habit already has one
+	CreateStake(ctx context.Context, stake *Stake) error
+	// GetStake returns the stake on a habit owned by the user, or ErrNotFound
+	GetStake(ctx context.Context, userID, habitID string) (*Stake, error)
+	// OpenStakes returns up to limit pending, active or resolving stakes,
+	// least recently updated first
+	OpenStakes(ctx context.Context, limit int) ([]Stake, error)
+	// UpdateStake saves the verification and resolution fields of a stake
+	UpdateStake(ctx context.Context, stake *Stake) error
+}
+
+// RewardStore persists the AURA points ledger and the claims minting it
+type RewardStore interface {
+	// AddReward records an accrued reward, or returns ErrConflict if the
+	// habit already earned it on that day
+	AddReward(ctx context.Context, reward *Reward) error
+	// ListRewards returns up to limit of the user's rewards, newest first
+	ListRewards(ctx context.Context, userID string, limit int) ([]Reward, error)
+	// RewardTotals sums the user's pending and claimed points
+	RewardTotals(ctx context.Context, userID string) (*RewardTotals, error)
+	// CreateRewardClaim attaches the unclaimed rewards of up to maxRecipients
+	// users with a wallet to a new pending claim, and returns what each of
+	// them is owed. No claim is created when there is nothing to claim.
+	CreateRewardClaim(ctx context.Context, claim *RewardClaim, maxRecipients int) ([]RewardBalance, error)
+	// RewardClaimBalances returns what each recipient of a claim is owed
+	RewardClaimBalances(ctx context.Context, claimID string) ([]RewardBalance, error)
+	// OpenRewardClaims returns the pending and submitted claims, oldest first
+	OpenRewardClaims(ctx context.Context) ([]RewardClaim, error)
+	// UpdateRewardClaim saves the progress of a claim. Saving a failed claim
+	// releases its rewards so the next claim includes them.
+	UpdateRewardClaim(ctx context.Context, claim *RewardClaim) error
+}
+
+// AttestationStore persists the check-in history and its daily attestations
+type AttestationStore interface {
+	// RecordCheckIn stores a check-in, or returns ErrConflict if the habit was
+	// already tracked that day
+	RecordCheckIn(ctx context.Context, checkIn *CheckIn) error
+	// CheckInLeaves returns the check-ins of a day made by users with a wallet
+	CheckInLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error)
+	// UnattestedDays returns up to limit days before the given one that have
+	// check-ins by users with a wallet but no attestation, oldest first
+	UnattestedDays(ctx context.Context, before time.Time, limit int) ([]time.Time, error)
+	// CreateAttestation queues the attestation of a day with the leaves its
+	// root was computed from, or returns ErrConflict if the day already has one
+	CreateAttestation(ctx context.Context, attestation *Attestation, leaves []CheckInLeaf) error
+	// GetAttestation returns the attestation of a day, or ErrNotFound
+	GetAttestation(ctx context.Context, day time.Time) (*Attestation, error)
+	// AttestationLeaves returns the leaves the attestation of a day was
+	// computed from. Proofs are built from them rather than from the
+	// check-ins, which users with a new wallet can add to.
+	AttestationLeaves(ctx context.Context, day time.Time) ([]CheckInLeaf, error)
+	// PendingAttestations returns the queued and submitted attestations,
+	// oldest day first
+	PendingAttestations(ctx context.Context) ([]Attestation, error)
+	// UpdateAttestation saves the posting progress of an attestation
+	UpdateAttestation(ctx context.Context, attestation *Attestation) error
+}
+
+// EventStore persists the events indexed from our contracts
+type EventStore interface {
+	// EventCheckpoint returns the last indexed block, or ErrNotFound before
+	// the first batch
+	EventCheckpoint(ctx context.Context) (*EventCheckpoint, error)
+	// SaveEvents stores the events of a block range and moves the checkpoint
+	// to its last block atomically. Events already stored are ignored.
+	SaveEvents(ctx context.Context, events []ChainEvent, checkpoint EventCheckpoint) error
+	// RewindEvents deletes the events above the checkpoint's block and moves
+	// the checkpoint back to it, after a reorg
+	RewindEvents(ctx context.Context, checkpoint EventCheckpoint) error
+	// ListEvents returns the indexed events matching the query, newest first
+	ListEvents(ctx context.Context, query EventQuery) ([]ChainEvent, error)
+}
+
+// OutboxStore persists the transactions queued with domain changes
+type OutboxStore interface {
+	// SaveHabitProgress saves the progress fields of a habit together with
+	// what they trigger, in one database transaction: the achievement of a
+	// completed habit and the transactions to send. When the habit already
+	// has an achievement only the progress is saved, and a transaction is
+	// skipped when one of the same kind and reference exists.
+	SaveHabitProgress(ctx context.Context, habit *Habit, achievement *Achievement, queued []OutboxTransaction) error
+	// PendingOutbox returns up to limit submitted transactions and queued
+	// ones due at now, least recently updated first
+	PendingOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxTransaction, error)
+	// UpdateOutbox saves the progress fields of a transaction
+	UpdateOutbox(ctx context.Context, tx *OutboxTransaction) error
+	// ListOutbox returns up to limit of the user's transactions, newest first
+	ListOutbox(ctx context.Context, userID string, limit int) ([]OutboxTransaction, error)
+	// SponsoredFees sums the fees, in FRI, of the user's transactions queued
+	// since the given time
+	SponsoredFees(ctx context.Context, userID string, since time.Time) (*big.Int, error)
+}
+
+// Store groups every store the API depends on
+type Store interface {
+	UserStore
+	HabitStore
+	WalletStore
+	SubscriptionStore
+	AchievementStore
+	StakeStore
+	RewardStore
+	AttestationStore
+	EventStore
+	OutboxStore
+}
@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing and the W3C trace context
+// propagation between the frontend, the API and the services it calls
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options configures the tracer provider
+type Options struct {
+	Enabled        bool    // Export spans, otherwise only trace context is propagated
+	Endpoint       string  // OTLP/HTTP collector base URL, e.g. http://localhost:4318
+	ServiceName    string  // Reported as service.name
+	ServiceVersion string  // Reported as service.version
+	SampleRatio    float64 // Share of traces recorded, see Sampler
+}
+
+// Setup installs the global propagator and, when enabled, a tracer provider
+// exporting to the collector. The returned function flushes pending spans and
+// must be called on shutdown.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	// Spans started by the frontend continue here even when exporting is off,
+	// so the trace ID still reaches the logs
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !options.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(options.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(options.ServiceName),
+			semconv.ServiceVersion(options.ServiceVersion),
+		),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("describing the service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(Sampler(options.SampleRatio)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Sampler records the given share of traces. Traces started by the browser
+// are sampled by their ID like new ones: the sampled flag of a client is not
+// trusted. Spans inside the service follow their parent.
+func Sampler(ratio float64) sdktrace.Sampler {
+	byID := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(byID,
+		sdktrace.WithRemoteParentSampled(byID),
+		sdktrace.WithRemoteParentNotSampled(byID),
+	)
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var handlerTraceID trace.TraceID
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/habits/{habitId}/progress", func(w http.ResponseWriter, r *http.Request) {
+		handlerTraceID = trace.SpanContextFromContext(r.Context()).TraceID()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/habits/42/progress", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	if handlerTraceID != span.SpanContext().TraceID() {
+		t.Error("the handler does not see the request span")
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span = %s, want the caller's", got)
+	}
+	if span.Name() != "PUT /api/habits/{habitId}/progress" {
+		t.Errorf("span name = %q, want the route pattern", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want an error for a 500", span.Status().Code)
+	}
+}
+
+func TestSamplerIgnoresClientFlag(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	for _, flags := range []trace.TraceFlags{0, trace.FlagsSampled} {
+		remote := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+
+		for ratio, want := range map[float64]sdktrace.SamplingDecision{0: sdktrace.Drop, 1: sdktrace.RecordAndSample} {
+			result := Sampler(ratio).ShouldSample(sdktrace.SamplingParameters{ParentContext: remote, TraceID: traceID, Name: "request"})
+			if result.Decision != want {
+				t.Errorf("ratio %v, client flags %v: decision = %v, want %v", ratio, flags, result.Decision, want)
+			}
+		}
+	}
+}
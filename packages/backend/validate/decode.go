@@ -0,0 +1,74 @@
+// Package validate decodes JSON request bodies strictly and checks them
+// against declarative rules in struct tags, for example:
+//
+//	Name string `json:"name" validate:"required,max=100,printable"`
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"aura-backend/apierror"
+)
+
+// MaxBodyBytes bounds the JSON bodies the API accepts
+const MaxBodyBytes = 64 << 10
+
+// DecodeJSON decodes the request body into dst, a pointer to a struct, then
+// normalizes and validates it. The body must be a single JSON object of at
+// most MaxBodyBytes without unknown fields. The returned error is an
+// *apierror.Error ready to be written.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return apierror.New(apierror.CodeInvalidRequest, "Request body must contain a single JSON object")
+	}
+
+	Normalize(dst)
+	return Struct(dst)
+}
+
+// decodeError describes a decoding failure without echoing the body back
+func decodeError(err error) *apierror.Error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return apierror.New(apierror.CodeInvalidRequest, "Request body is required")
+	case errors.As(err, &sizeErr):
+		return apierror.New(apierror.CodePayloadTooLarge, fmt.Sprintf("Request body must be at most %d bytes", sizeErr.Limit))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.New(apierror.CodeInvalidRequest, "Request body is not valid JSON")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return apierror.Invalid(map[string]string{typeErr.Field: "must be " + describeType(typeErr.Type.Kind().String())})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return apierror.Invalid(map[string]string{field: "is not a known field"})
+	}
+	return apierror.New(apierror.CodeInvalidRequest, "Request body must be a JSON object")
+}
+
+func describeType(kind string) string {
+	switch {
+	case kind == "string":
+		return "a string"
+	case kind == "bool":
+		return "a boolean"
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "a number"
+	}
+	return "of another type"
+}
@@ -0,0 +1,199 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"aura-backend/apierror"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize trims the string fields of the struct dst points to and puts
+// them in Unicode normalization form C, so that visually identical values,
+// such as promo codes typed on different keyboards, compare equal. Fields
+// with the raw rule, such as secrets, are left as sent.
+func Normalize(dst any) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if hasRule(v.Type().Field(i), "raw") {
+			continue
+		}
+		if field.Kind() == reflect.String && field.CanSet() {
+			field.SetString(strings.TrimSpace(norm.NFC.String(field.String())))
+		}
+	}
+}
+
+// Struct checks the fields of the struct dst points to against the rules of
+// their validate tags and returns an *apierror.Error listing every invalid
+// field, or nil. Rules are separated by commas:
+//
+//	required   the field is not empty
+//	min=N      strings have at least N characters, numbers are at least N
+//	max=N      strings have at most N characters, numbers are at most N
+//	oneof=a b  the value is one of the space separated values
+//	uuid       the value is a UUID
+//	email      the value is an email address
+//	printable  the value has no control or invisible formatting characters
+//	digits     the value only has the ASCII digits 0 to 9
+//	raw        the value is not trimmed or normalized, see Normalize
+//
+// Rules other than required are skipped for empty strings.
+func Struct(dst any) error {
+	v := reflect.Indirect(reflect.ValueOf(dst))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		rules, ok := t.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		if problem := check(v.Field(i), rules); problem != "" {
+			fields[jsonName(t.Field(i))] = problem
+		}
+	}
+
+	if len(fields) > 0 {
+		return apierror.Invalid(fields)
+	}
+	return nil
+}
+
+// check returns the first rule the value breaks, described for the client
+func check(value reflect.Value, rules string) string {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "raw" {
+			continue
+		}
+		if name == "required" {
+			if value.IsZero() {
+				return "is required"
+			}
+			continue
+		}
+		if value.Kind() == reflect.String && value.String() == "" {
+			continue
+		}
+
+		if problem := apply(name, arg, value); problem != "" {
+			return problem
+		}
+	}
+	return ""
+}
+
+func apply(rule, arg string, value reflect.Value) string {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid %s rule %q", rule, arg))
+		}
+		return checkBound(rule, limit, value)
+	case "oneof":
+		allowed := strings.Fields(arg)
+		for _, candidate := range allowed {
+			if fmt.Sprint(value.Interface()) == candidate {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(allowed, ", ")
+	case "uuid":
+		if !IsUUID(value.String()) {
+			return "must be a UUID"
+		}
+	case "email":
+		if address, err := mail.ParseAddress(value.String()); err != nil || address.Address != value.String() {
+			return "must be an email address"
+		}
+	case "printable":
+		for _, r := range value.String() {
+			if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+				return "must not contain control characters"
+			}
+		}
+	case "digits":
+		for _, r := range value.String() {
+			if r < '0' || r > '9' {
+				return "must only contain digits"
+			}
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+	return ""
+}
+
+func checkBound(rule string, limit float64, value reflect.Value) string {
+	var n float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		// Limits count characters, not bytes, so accented names are not penalized
+		n = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("validate: %s does not apply to %s", rule, value.Kind()))
+	}
+
+	bound := strconv.FormatFloat(limit, 'f', -1, 64)
+	if rule == "min" && n < limit {
+		return "must be at least " + bound + unit
+	}
+	if rule == "max" && n > limit {
+		return "must be at most " + bound + unit
+	}
+	return ""
+}
+
+// IsUUID reports whether s is a UUID in its canonical hyphenated form
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+// hasRule reports whether the validate tag of the field has the rule
+func hasRule(field reflect.StructField, rule string) bool {
+	for _, candidate := range strings.Split(field.Tag.Get("validate"), ",") {
+		if name, _, _ := strings.Cut(candidate, "="); name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,145 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"aura-backend/apierror"
+)
+
+type habitRequest struct {
+	Name     string `json:"name" validate:"required,max=5,printable"`
+	GoalDays int    `json:"goalDays" validate:"min=0,max=365"`
+	Plan     string `json:"plan" validate:"oneof=free pro"`
+	Email    string `json:"email" validate:"email"`
+	UserID   string `json:"userId" validate:"uuid"`
+	PIN      string `json:"pin" validate:"min=6,max=6,digits"`
+	Secret   string `json:"secret" validate:"raw,max=20"`
+}
+
+func decode(t *testing.T, body string) (habitRequest, *apierror.Error) {
+	t.Helper()
+
+	var request habitRequest
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	err := DecodeJSON(httptest.NewRecorder(), r, &request)
+	if err == nil {
+		return request, nil
+	}
+
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error %v is not an *apierror.Error", err)
+	}
+	return request, apiErr
+}
+
+func TestDecodeNormalizes(t *testing.T) {
+	// "e" followed by a combining acute accent becomes a single "é"
+	request, err := decode(t, `{"name":"  café ","plan":"pro"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request.Name != "café" {
+		t.Errorf("name = %q, want %q", request.Name, "café")
+	}
+
+	// Secrets are compared as typed: a passphrase is not changed by decoding
+	request, err = decode(t, `{"name":"a","secret":" café "}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request.Secret != " café " {
+		t.Errorf("raw secret = %q, want it unchanged", request.Secret)
+	}
+}
+
+func TestDecodeFieldErrors(t *testing.T) {
+	_, err := decode(t, `{"name":"abcdef","goalDays":400,"plan":"gold","email":"nope","userId":"42"}`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err.Code != apierror.CodeValidationFailed {
+		t.Fatalf("code = %s, want %s", err.Code, apierror.CodeValidationFailed)
+	}
+
+	want := map[string]string{
+		"name":     "must be at most 5 characters",
+		"goalDays": "must be at most 365",
+		"plan":     "must be one of free, pro",
+		"email":    "must be an email address",
+		"userId":   "must be a UUID",
+	}
+	if !reflect.DeepEqual(err.Fields, want) {
+		t.Errorf("fields = %v, want %v", err.Fields, want)
+	}
+}
+
+func TestDecodeRules(t *testing.T) {
+	tests := []struct {
+		body  string
+		field string
+		want  string
+	}{
+		{`{}`, "name", "is required"},
+		{`{"name":" \t "}`, "name", "is required"},
+		{`{"name":"a\u0000b"}`, "name", "must not contain control characters"},
+		{`{"name":"a​b"}`, "name", "must not contain control characters"},
+		{`{"name":"ok","goalDays":-1}`, "goalDays", "must be at least 0"},
+		{`{"name":"ok","goalDays":"7"}`, "goalDays", "must be a number"},
+		{`{"name":"ok","role":"admin"}`, "role", "is not a known field"},
+		{`{"name":"ok","pin":"12a456"}`, "pin", "must only contain digits"},
+		{`{"name":"ok","pin":"١٢٣٤٥٦"}`, "pin", "must only contain digits"},
+		{`{"name":"ok","pin":"12345"}`, "pin", "must be at least 6 characters"},
+		// Accented characters count once toward length limits
+		{`{"name":"ééééé"}`, "", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := decode(t, tt.body)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.body, err)
+			}
+			continue
+		}
+		if err == nil || err.Fields[tt.field] != tt.want {
+			t.Errorf("%s: error = %v, want %s %q", tt.body, err, tt.field, tt.want)
+		}
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		body string
+		code apierror.Code
+	}{
+		{"", apierror.CodeInvalidRequest},
+		{`{"name":`, apierror.CodeInvalidRequest},
+		{`[1]`, apierror.CodeInvalidRequest},
+		{`{"name":"ok"} {"name":"ok"}`, apierror.CodeInvalidRequest},
+		{`{"name":"` + strings.Repeat("a", MaxBodyBytes) + `"}`, apierror.CodePayloadTooLarge},
+	}
+
+	for _, tt := range tests {
+		_, err := decode(t, tt.body)
+		if err == nil || err.Code != tt.code {
+			t.Errorf("%.20s: error = %v, want %s", tt.body, err, tt.code)
+		}
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	if !IsUUID("6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f") {
+		t.Error("canonical UUID rejected")
+	}
+	for _, s := range []string{"", "habit-1", "6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f", "{6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f}"} {
+		if IsUUID(s) {
+			t.Errorf("IsUUID(%q) = true", s)
+		}
+	}
+}
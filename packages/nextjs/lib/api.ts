@@ -13,10 +13,189 @@ export interface Habit {
   userId: string;
   name: string;
   daysCompleted: number;
+  streak: number; // Consecutive days tracked up to the last check-in
   completed: boolean;
   createdAt: string;
 }
 
+// NFT minted to the user's wallet when a habit reaches its goal
+export interface Achievement {
+  id: string;
+  habitId: string;
+  habitName: string;
+  goalDays: number;
+  startedAt: string;
+  completedAt: string;
+  walletAddress: string;
+  status: 'queued' | 'submitted' | 'minted' | 'failed';
+  transactionHash?: string;
+  tokenId?: string;
+}
+
+// STRK locked in the staking escrow until the habit is completed (returned)
+// or its streak breaks (forfeited). The amount is in FRI.
+export interface Stake {
+  habitId: string;
+  stakerAddress: string;
+  amount?: string;
+  deadline?: string;
+  depositTransactionHash: string;
+  status: 'pending' | 'active' | 'resolving' | 'returned' | 'forfeited' | 'rejected';
+  success?: boolean;
+  resolutionTransactionHash?: string;
+}
+
+// AURA points accrued by a check-in or a milestone. Points are whole tokens,
+// minted to the user's wallet by the next claim.
+export interface Reward {
+  id: string;
+  habitId: string;
+  reason: 'check_in' | 'milestone';
+  day: number;
+  points: number;
+  claimed: boolean;
+  createdAt: string;
+}
+
+export interface Rewards {
+  pending: number;
+  claimed: number;
+  rewards: Reward[];
+}
+
+// Merkle proof that a check-in is part of the root posted on-chain for its day
+export interface AttestationProof {
+  habitId: string;
+  date: string;
+  day: number;
+  walletAddress: string;
+  contract?: string;
+  leaves: number;
+  status: 'queued' | 'submitted' | 'confirmed' | 'failed';
+  transactionHash?: string;
+  leaf: string;
+  proof: string[];
+  root: string;
+}
+
+// Event emitted by one of our contracts, indexed by the backend
+export interface ChainEvent {
+  id: number;
+  contract: string;
+  contractAddress: string;
+  name?: string;
+  keys: string[];
+  data: string[];
+  fields?: Record<string, unknown>;
+  blockNumber: number;
+  blockHash: string;
+  transactionHash: string;
+  eventIndex: number;
+  createdAt: string;
+}
+
+export interface ChainEvents {
+  events: ChainEvent[];
+  nextCursor?: number;
+}
+
+// On-chain transaction the backend sends for the user, such as an
+// achievement mint. reference is the id of the record it is for.
+export interface OutboxTransaction {
+  id: string;
+  kind: 'achievement_mint';
+  reference: string;
+  status: 'queued' | 'submitted' | 'confirmed' | 'reverted' | 'failed';
+  transactionHash?: string;
+  attempts: number;
+  createdAt: string;
+  updatedAt: string;
+}
+
+// Balance of a token in the user's wallet. balance is in the token's
+// smallest unit, formatted in tokens.
+export interface TokenBalance {
+  symbol: 'STRK' | 'ETH' | 'AURA';
+  tokenAddress: string;
+  decimals: number;
+  balance: string;
+  formatted: string;
+  priceUsd: number;
+  valueUsd: number;
+}
+
+export interface WalletBalances {
+  walletAddress: string;
+  tokens: TokenBalance[];
+  totalUsd: number;
+  updatedAt: string;
+}
+
+// Wallet key encrypted with the user's passphrase, returned once. key is
+// QR alphanumeric: the format, a colon and base32.
+export interface WalletExport {
+  address: string;
+  publicKey: string;
+  format: 'AURAKEY1';
+  key: string;
+  exportedAt: string;
+}
+
+// Replacement of the wallet's signing key through its account
+export interface KeyRotation {
+  id: string;
+  walletAddress: string;
+  oldPublicKey: string;
+  newPublicKey: string;
+  status: 'pending' | 'submitted' | 'completed' | 'failed';
+  transactionHash?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface WalletEvent {
+  id: string;
+  kind: 'pin_set' | 'pin_failed' | 'pin_locked' | 'key_exported' | 'recovery_started' | 'key_rotated' | 'recovery_failed';
+  ipAddress?: string;
+  createdAt: string;
+}
+
+export interface EventsQuery {
+  contract?: string;
+  event?: string;
+  limit?: number;
+  before?: number;
+}
+
+// Error returned by the backend in its JSON error envelope:
+// { "error": { "code": "HABIT_LIMIT_REACHED", "message": "...", "requestId": "..." } }
+export class ApiError extends Error {
+  constructor(
+    message: string,
+    public readonly status: number,
+    public readonly code: string,
+    public readonly requestId?: string,
+    public readonly fields?: Record<string, string>
+  ) {
+    super(message);
+    this.name = 'ApiError';
+  }
+}
+
+// Builds an ApiError from a failed response, falling back to the status line
+// when the body is not an error envelope
+const toApiError = async (response: Response, fallback: string): Promise<ApiError> => {
+  const body = await response.json().catch(() => null);
+  const error = body?.error;
+  return new ApiError(
+    error?.message || fallback || `Error ${response.status}: ${response.statusText}`,
+    response.status,
+    error?.code || 'UNKNOWN_ERROR',
+    error?.requestId || response.headers.get('X-Request-ID') || undefined,
+    error?.fields
+  );
+};
+
 // Cache system to reduce redundant API calls
 interface CacheItem<T> {
   data: T;
@@ -69,11 +248,24 @@ const getAuthToken = (): string | null => {
   return null;
 };
 
+// Random lowercase hex string of the given number of bytes
+const randomHex = (bytes: number): string => {
+  const values = new Uint8Array(bytes);
+  crypto.getRandomValues(values);
+  return Array.from(values, (value) => value.toString(16).padStart(2, '0')).join('');
+};
+
+// W3C trace context header starting a new trace, so the backend spans of each
+// call can be found from the browser's network tab. The browser records no
+// spans, so the trace is not flagged sampled: the backend samples it.
+const createTraceparent = (): string => `00-${randomHex(16)}-${randomHex(8)}-00`;
+
 const createAuthHeaders = (providedToken?: string) => {
   const token = providedToken || getAuthToken();
   return {
     'Authorization': token ? `Bearer ${token}` : '',
-    'Content-Type': 'application/json'
+    'Content-Type': 'application/json',
+    'traceparent': createTraceparent()
   };
 };
 
@@ -96,7 +288,7 @@ export const getUserRole = async (token?: string): Promise<User> => {
     });
     
     if (!response.ok) {
-      throw new Error('Failed to get user role');
+      throw await toApiError(response, 'Failed to get user role');
     }
     
     const userData = await response.json();
@@ -130,7 +322,7 @@ export const getHabits = async (token?: string): Promise<Habit[]> => {
     });
     
     if (!response.ok) {
-      throw new Error('Failed to get habits');
+      throw await toApiError(response, 'Failed to get habits');
     }
     
     const habitsData = await response.json();
@@ -145,6 +337,261 @@ export const getHabits = async (token?: string): Promise<Habit[]> => {
   }
 };
 
+export const getAchievements = async (token?: string): Promise<Achievement[]> => {
+  try {
+    const authToken = token || getAuthToken();
+    if (!authToken) throw new Error('No authentication token available');
+
+    const response = await fetch(`${API_URL}/api/achievements`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get achievements');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting achievements:', error);
+    throw error;
+  }
+};
+
+export const getRewards = async (token?: string): Promise<Rewards> => {
+  try {
+    const response = await fetch(`${API_URL}/api/rewards`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get rewards');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting rewards:', error);
+    throw error;
+  }
+};
+
+// date is a UTC day formatted as YYYY-MM-DD
+export const getAttestationProof = async (habitId: string, date: string, token?: string): Promise<AttestationProof> => {
+  try {
+    const response = await fetch(`${API_URL}/api/habits/${habitId}/attestations/${date}`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get attestation proof');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting attestation proof:', error);
+    throw error;
+  }
+};
+
+// Indexed contract events, newest first. Pass nextCursor as before to page back.
+export const getEvents = async (query: EventsQuery = {}, token?: string): Promise<ChainEvents> => {
+  try {
+    const params = new URLSearchParams();
+    Object.entries(query).forEach(([key, value]) => {
+      if (value !== undefined) params.set(key, String(value));
+    });
+
+    const response = await fetch(`${API_URL}/api/events?${params}`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get events');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting events:', error);
+    throw error;
+  }
+};
+
+// Transactions sent for the user, newest first
+export const getTransactions = async (token?: string): Promise<OutboxTransaction[]> => {
+  try {
+    const response = await fetch(`${API_URL}/api/transactions`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get transactions');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting transactions:', error);
+    throw error;
+  }
+};
+
+// Balances of the user's wallet, cached by the backend for a few seconds
+export const getWalletBalances = async (token?: string): Promise<WalletBalances> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/balances`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get wallet balances');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting wallet balances:', error);
+    throw error;
+  }
+};
+
+// Sets the 6-digit PIN guarding the wallet, currentPin is required to change
+// it. Needs a recent sign-in, REAUTHENTICATION_REQUIRED otherwise.
+export const setWalletPin = async (pin: string, currentPin?: string, token?: string): Promise<void> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/pin`, {
+      method: 'PUT',
+      headers: createAuthHeaders(token),
+      body: JSON.stringify({ pin, currentPin })
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to set wallet PIN');
+    }
+  } catch (error) {
+    console.error('Error setting wallet PIN:', error);
+    throw error;
+  }
+};
+
+// Exports the wallet key encrypted with the passphrase. Each key is exported
+// once; never cache the result.
+export const exportWallet = async (pin: string, passphrase: string, token?: string): Promise<WalletExport> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/export`, {
+      method: 'POST',
+      headers: createAuthHeaders(token),
+      body: JSON.stringify({ pin, passphrase })
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to export wallet');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error exporting wallet:', error);
+    throw error;
+  }
+};
+
+// Replaces the wallet's signing key, follow it with getWalletRecovery
+export const startWalletRecovery = async (pin: string, token?: string): Promise<KeyRotation> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/recovery`, {
+      method: 'POST',
+      headers: createAuthHeaders(token),
+      body: JSON.stringify({ pin })
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to start wallet recovery');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error starting wallet recovery:', error);
+    throw error;
+  }
+};
+
+export const getWalletRecovery = async (token?: string): Promise<KeyRotation> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/recovery`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get wallet recovery');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting wallet recovery:', error);
+    throw error;
+  }
+};
+
+// Security log of the wallet, newest first
+export const getWalletEvents = async (token?: string): Promise<WalletEvent[]> => {
+  try {
+    const response = await fetch(`${API_URL}/api/wallet/events`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get wallet events');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting wallet events:', error);
+    throw error;
+  }
+};
+
+// Links the transaction that staked STRK from the user's wallet to a habit
+export const createStake = async (habitId: string, transactionHash: string, token?: string): Promise<Stake> => {
+  try {
+    const response = await fetch(`${API_URL}/api/habits/${habitId}/stake`, {
+      method: 'POST',
+      headers: createAuthHeaders(token),
+      body: JSON.stringify({ transactionHash })
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to stake on habit');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error staking on habit:', error);
+    throw error;
+  }
+};
+
+export const getStake = async (habitId: string, token?: string): Promise<Stake> => {
+  try {
+    const response = await fetch(`${API_URL}/api/habits/${habitId}/stake`, {
+      method: 'GET',
+      headers: createAuthHeaders(token)
+    });
+
+    if (!response.ok) {
+      throw await toApiError(response, 'Failed to get stake');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error getting stake:', error);
+    throw error;
+  }
+};
+
 export const createHabit = async (name: string, token?: string): Promise<Habit> => {
   try {
     const response = await fetch(`${API_URL}/api/habits`, {
@@ -154,7 +601,7 @@ export const createHabit = async (name: string, token?: string): Promise<Habit>
     });
     
     if (!response.ok) {
-      throw new Error('Failed to create habit');
+      throw await toApiError(response, 'Failed to create habit');
     }
     
     const newHabit = await response.json();
@@ -177,7 +624,7 @@ export const updateHabitProgress = async (habitId: string, token?: string): Prom
     });
     
     if (!response.ok) {
-      throw new Error('Failed to update habit progress');
+      throw await toApiError(response, 'Failed to update habit progress');
     }
     
     const updatedHabit = await response.json();
@@ -221,8 +668,7 @@ export const createOrGetUserWallet = async (userId: string, email: string, acces
     });
 
     if (!response.ok) {
-      const errorData = await response.json().catch(() => ({ message: 'Failed to parse error' }));
-      throw new Error(errorData.message || `Error ${response.status}: ${response.statusText}`);
+      throw await toApiError(response, '');
     }
 
     const walletData = await response.json();
@@ -259,8 +705,7 @@ export const createPaymentIntent = async (email: string, customerId?: string) =>
     });
 
     if (!response.ok) {
-      const errorData = await response.json().catch(() => ({ message: 'Failed to parse error' }));
-      throw new Error(errorData.message || `Error ${response.status}: ${response.statusText}`);
+      throw await toApiError(response, '');
     }
 
     return await response.json();
@@ -293,8 +738,7 @@ export const confirmSubscription = async (customerId: string, email: string, pay
     });
 
     if (!response.ok) {
-      const errorData = await response.json().catch(() => ({ message: 'Failed to parse error' }));
-      throw new Error(errorData.message || `Error ${response.status}: ${response.statusText}`);
+      throw await toApiError(response, '');
     }
 
     const result = await response.json();
@@ -325,8 +769,7 @@ export const getPricing = async () => {
     });
 
     if (!response.ok) {
-      const errorData = await response.json().catch(() => ({ message: 'Failed to parse error' }));
-      throw new Error(errorData.message || `Error ${response.status}: ${response.statusText}`);
+      throw await toApiError(response, '');
     }
 
     return await response.json();
@@ -0,0 +1,50 @@
+// Prints the INVOKE v3 hashes of TestInvokeTransactionHash in
+// packages/backend/starknet/transaction_test.go, as computed by starknet.js.
+// Run from the repository root after `yarn install`:
+//
+//   yarn workspace @ss-2/nextjs node scripts/invokeTransactionHashVectors.mjs
+//
+// and copy its output to the Go test and to
+// utils/__tests__/invokeTransactionHash.test.ts.
+import { createRequire } from "node:module";
+import { constants, hash, transaction } from "starknet";
+
+const { version } = createRequire(import.meta.url)("starknet/package.json");
+
+const transfer = {
+  contractAddress:
+    "0x04718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d",
+  entrypoint: "transfer",
+  calldata: ["0x123", "1000", "0x0"],
+};
+
+const invoke = {
+  senderAddress:
+    "0x2fd23d9182193775423497fc0c472e156c57c69e4089a1967fb288a2d84e914",
+  compiledCalldata: transaction.getExecuteCalldata([transfer], "1"),
+  chainId: constants.StarknetChainId.SN_SEPOLIA,
+  nonce: 8,
+  accountDeploymentData: [],
+  nonceDataAvailabilityMode: 0, // L1
+  feeDataAvailabilityMode: 0, // L1
+  resourceBounds: {
+    l1_gas: { max_amount: "0x186a0", max_price_per_unit: "0x5af3107a4000" },
+    l2_gas: { max_amount: "0x0", max_price_per_unit: "0x0" },
+  },
+  tip: 0,
+  paymasterData: [],
+};
+
+const vectors = [
+  [false, constants.TRANSACTION_VERSION.V3],
+  [true, constants.TRANSACTION_VERSION.F3],
+];
+
+console.log(`// starknet.js ${version}`);
+for (const [query, txVersion] of vectors) {
+  const txHash = hash.calculateInvokeTransactionHash({
+    ...invoke,
+    version: txVersion,
+  });
+  console.log(`{${query}, "0x${BigInt(txHash).toString(16)}"},`);
+}
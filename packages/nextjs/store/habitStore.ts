@@ -6,6 +6,7 @@ export interface Habit {
   id: string;
   name: string;
   daysCompleted: number;
+  streak: number;
   completed: boolean;
   createdAt: string;
   lastTrackedDate?: string;
@@ -1,10 +1,9 @@
 interface WalletData {
   publicKey: string;
-  encryptedPrivateKey: string;
+  address: string;
 }
 
 interface TransferParams {
-  encryptKey: string;
   wallet: WalletData;
   contractAddress: string;
   recipient: string;
@@ -0,0 +1,55 @@
+import { describe, expect, it } from "vitest";
+import { constants, hash, transaction } from "starknet";
+
+// The backend signs its operator transactions with its own implementation of
+// the INVOKE v3 hash. These are the inputs and expected hashes of
+// TestInvokeTransactionHash in packages/backend/starknet/transaction_test.go:
+// starknet.js must agree with them. scripts/invokeTransactionHashVectors.mjs
+// prints the hashes starknet.js computes for these inputs.
+const transfer = {
+  contractAddress:
+    "0x04718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d",
+  entrypoint: "transfer",
+  calldata: ["0x123", "1000", "0x0"],
+};
+
+const invoke = {
+  senderAddress:
+    "0x2fd23d9182193775423497fc0c472e156c57c69e4089a1967fb288a2d84e914",
+  compiledCalldata: transaction.getExecuteCalldata([transfer], "1"),
+  chainId: constants.StarknetChainId.SN_SEPOLIA,
+  nonce: 8,
+  accountDeploymentData: [],
+  nonceDataAvailabilityMode: 0, // L1
+  feeDataAvailabilityMode: 0, // L1
+  resourceBounds: {
+    l1_gas: { max_amount: "0x186a0", max_price_per_unit: "0x5af3107a4000" },
+    l2_gas: { max_amount: "0x0", max_price_per_unit: "0x0" },
+  },
+  tip: 0,
+  paymasterData: [],
+};
+
+describe("backend INVOKE v3 transaction hash", () => {
+  it("matches starknet.js for a transaction", () => {
+    const txHash = hash.calculateInvokeTransactionHash({
+      ...invoke,
+      version: constants.TRANSACTION_VERSION.V3,
+    });
+    expect(BigInt(txHash)).toBe(
+      BigInt(
+        "0x14c0aa0958321aac14298575c4ac4db0d6a697c919404f36e819156519b3a8c",
+      ),
+    );
+  });
+
+  it("matches starknet.js for a fee estimate query", () => {
+    const txHash = hash.calculateInvokeTransactionHash({
+      ...invoke,
+      version: constants.TRANSACTION_VERSION.F3,
+    });
+    expect(BigInt(txHash)).toBe(
+      BigInt("0x6913d8dcd0794530452a33105e875ef07dd044d8a00258b8b79e0c480047d4"),
+    );
+  });
+});
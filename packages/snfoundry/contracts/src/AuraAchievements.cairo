@@ -0,0 +1,164 @@
+// Achievement NFTs minted by the backend when a user completes a habit
+#[derive(Drop, Serde, PartialEq, Debug, starknet::Store)]
+pub struct Achievement {
+    pub habit_id: felt252,
+    pub name: ByteArray,
+    pub goal_days: u32,
+    pub started_at: u64,
+    pub completed_at: u64,
+}
+
+#[starknet::interface]
+pub trait IAuraAchievements<TContractState> {
+    fn mint(
+        ref self: TContractState,
+        to: starknet::ContractAddress,
+        habit_id: felt252,
+        name: ByteArray,
+        goal_days: u32,
+        started_at: u64,
+        completed_at: u64,
+    ) -> u256;
+    fn achievement(self: @TContractState, token_id: u256) -> Achievement;
+    fn token_for_habit(self: @TContractState, habit_id: felt252) -> u256;
+    fn total_supply(self: @TContractState) -> u256;
+    fn minter(self: @TContractState) -> starknet::ContractAddress;
+    fn set_minter(ref self: TContractState, minter: starknet::ContractAddress);
+}
+
+#[starknet::contract]
+pub mod AuraAchievements {
+    use openzeppelin_access::ownable::OwnableComponent;
+    use openzeppelin_introspection::src5::SRC5Component;
+    use openzeppelin_token::erc721::{ERC721Component, ERC721HooksEmptyImpl};
+    use starknet::storage::{
+        Map, StorageMapReadAccess, StorageMapWriteAccess, StoragePointerReadAccess,
+        StoragePointerWriteAccess,
+    };
+    use starknet::{ContractAddress, get_caller_address};
+    use super::{Achievement, IAuraAchievements};
+
+    component!(path: ERC721Component, storage: erc721, event: ERC721Event);
+    component!(path: SRC5Component, storage: src5, event: SRC5Event);
+    component!(path: OwnableComponent, storage: ownable, event: OwnableEvent);
+
+    #[abi(embed_v0)]
+    impl ERC721MixinImpl = ERC721Component::ERC721MixinImpl<ContractState>;
+    impl ERC721InternalImpl = ERC721Component::InternalImpl<ContractState>;
+
+    #[abi(embed_v0)]
+    impl OwnableImpl = OwnableComponent::OwnableImpl<ContractState>;
+    impl OwnableInternalImpl = OwnableComponent::InternalImpl<ContractState>;
+
+    pub mod Errors {
+        pub const NOT_MINTER: felt252 = 'Caller is not the minter';
+        pub const ALREADY_MINTED: felt252 = 'Habit already minted';
+        pub const INVALID_HABIT: felt252 = 'Habit id is zero';
+        pub const UNKNOWN_TOKEN: felt252 = 'Unknown token';
+    }
+
+    #[event]
+    #[derive(Drop, starknet::Event)]
+    enum Event {
+        #[flat]
+        ERC721Event: ERC721Component::Event,
+        #[flat]
+        SRC5Event: SRC5Component::Event,
+        #[flat]
+        OwnableEvent: OwnableComponent::Event,
+        AchievementMinted: AchievementMinted,
+        MinterChanged: MinterChanged,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct AchievementMinted {
+        #[key]
+        pub to: ContractAddress,
+        #[key]
+        pub token_id: u256,
+        pub habit_id: felt252,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct MinterChanged {
+        pub minter: ContractAddress,
+    }
+
+    #[storage]
+    struct Storage {
+        minter: ContractAddress,
+        total_supply: u256,
+        achievements: Map<u256, Achievement>,
+        // Token minted for each habit, so retried mints cannot duplicate it
+        habit_tokens: Map<felt252, u256>,
+        #[substorage(v0)]
+        erc721: ERC721Component::Storage,
+        #[substorage(v0)]
+        src5: SRC5Component::Storage,
+        #[substorage(v0)]
+        ownable: OwnableComponent::Storage,
+    }
+
+    #[constructor]
+    fn constructor(
+        ref self: ContractState, owner: ContractAddress, minter: ContractAddress, base_uri: ByteArray,
+    ) {
+        self.erc721.initializer("Aura Achievements", "AURAACH", base_uri);
+        self.ownable.initializer(owner);
+        self.minter.write(minter);
+    }
+
+    #[abi(embed_v0)]
+    impl AuraAchievementsImpl of IAuraAchievements<ContractState> {
+        fn mint(
+            ref self: ContractState,
+            to: ContractAddress,
+            habit_id: felt252,
+            name: ByteArray,
+            goal_days: u32,
+            started_at: u64,
+            completed_at: u64,
+        ) -> u256 {
+            assert(get_caller_address() == self.minter.read(), Errors::NOT_MINTER);
+            assert(habit_id != 0, Errors::INVALID_HABIT);
+            assert(self.habit_tokens.read(habit_id) == 0, Errors::ALREADY_MINTED);
+
+            // Token ids start at 1, 0 marks habits without a token
+            let token_id = self.total_supply.read() + 1;
+            self.total_supply.write(token_id);
+            self.habit_tokens.write(habit_id, token_id);
+            self
+                .achievements
+                .write(token_id, Achievement { habit_id, name, goal_days, started_at, completed_at });
+
+            // Plain mint: account contracts do not all implement the receiver
+            // interface safe_mint requires
+            self.erc721.mint(to, token_id);
+            self.emit(AchievementMinted { to, token_id, habit_id });
+            token_id
+        }
+
+        fn achievement(self: @ContractState, token_id: u256) -> Achievement {
+            assert(self.erc721.exists(token_id), Errors::UNKNOWN_TOKEN);
+            self.achievements.read(token_id)
+        }
+
+        fn token_for_habit(self: @ContractState, habit_id: felt252) -> u256 {
+            self.habit_tokens.read(habit_id)
+        }
+
+        fn total_supply(self: @ContractState) -> u256 {
+            self.total_supply.read()
+        }
+
+        fn minter(self: @ContractState) -> ContractAddress {
+            self.minter.read()
+        }
+
+        fn set_minter(ref self: ContractState, minter: ContractAddress) {
+            self.ownable.assert_only_owner();
+            self.minter.write(minter);
+            self.emit(MinterChanged { minter });
+        }
+    }
+}
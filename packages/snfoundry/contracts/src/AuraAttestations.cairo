@@ -0,0 +1,118 @@
+// Registry of the daily Merkle roots of habit check-ins. Leaves are
+// keccak-256 hashes of (wallet, habit id, day), so only roots are public; a
+// user proves a check-in by handing out its leaf inputs and proof, verified
+// off-chain against root_of(day) with sorted-pair keccak-256 hashing.
+#[derive(Copy, Drop, Serde, PartialEq, Debug, starknet::Store)]
+pub struct Attestation {
+    pub root: u256,
+    pub leaves: u32,
+    pub posted_at: u64,
+}
+
+#[starknet::interface]
+pub trait IAuraAttestations<TContractState> {
+    fn post_root(ref self: TContractState, day: u32, root: u256, leaves: u32);
+    fn root_of(self: @TContractState, day: u32) -> u256;
+    fn attestation(self: @TContractState, day: u32) -> Attestation;
+    fn poster(self: @TContractState) -> starknet::ContractAddress;
+    fn set_poster(ref self: TContractState, poster: starknet::ContractAddress);
+}
+
+#[starknet::contract]
+pub mod AuraAttestations {
+    use openzeppelin_access::ownable::OwnableComponent;
+    use starknet::storage::{
+        Map, StorageMapReadAccess, StorageMapWriteAccess, StoragePointerReadAccess,
+        StoragePointerWriteAccess,
+    };
+    use starknet::{ContractAddress, get_block_timestamp, get_caller_address};
+    use super::{Attestation, IAuraAttestations};
+
+    component!(path: OwnableComponent, storage: ownable, event: OwnableEvent);
+
+    #[abi(embed_v0)]
+    impl OwnableImpl = OwnableComponent::OwnableImpl<ContractState>;
+    impl OwnableInternalImpl = OwnableComponent::InternalImpl<ContractState>;
+
+    pub mod Errors {
+        pub const NOT_POSTER: felt252 = 'Caller is not the poster';
+        pub const ZERO_ROOT: felt252 = 'Root is zero';
+        pub const ALREADY_ATTESTED: felt252 = 'Day already attested';
+    }
+
+    #[event]
+    #[derive(Drop, starknet::Event)]
+    enum Event {
+        #[flat]
+        OwnableEvent: OwnableComponent::Event,
+        RootPosted: RootPosted,
+        PosterChanged: PosterChanged,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct RootPosted {
+        #[key]
+        pub day: u32,
+        pub root: u256,
+        pub leaves: u32,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct PosterChanged {
+        pub poster: ContractAddress,
+    }
+
+    #[storage]
+    struct Storage {
+        poster: ContractAddress,
+        // Days are UTC dates written as yyyymmdd
+        attestations: Map<u32, Attestation>,
+        #[substorage(v0)]
+        ownable: OwnableComponent::Storage,
+    }
+
+    #[constructor]
+    fn constructor(ref self: ContractState, owner: ContractAddress, poster: ContractAddress) {
+        self.ownable.initializer(owner);
+        self.poster.write(poster);
+    }
+
+    #[abi(embed_v0)]
+    impl AuraAttestationsImpl of IAuraAttestations<ContractState> {
+        // Roots are final. Posting the same root again is a no-op, so a
+        // resubmitted transaction does not revert.
+        fn post_root(ref self: ContractState, day: u32, root: u256, leaves: u32) {
+            assert(get_caller_address() == self.poster.read(), Errors::NOT_POSTER);
+            assert(root != 0, Errors::ZERO_ROOT);
+
+            let existing = self.attestations.read(day);
+            if existing.root == root {
+                return;
+            }
+            assert(existing.root == 0, Errors::ALREADY_ATTESTED);
+
+            self
+                .attestations
+                .write(day, Attestation { root, leaves, posted_at: get_block_timestamp() });
+            self.emit(RootPosted { day, root, leaves });
+        }
+
+        fn root_of(self: @ContractState, day: u32) -> u256 {
+            self.attestations.read(day).root
+        }
+
+        fn attestation(self: @ContractState, day: u32) -> Attestation {
+            self.attestations.read(day)
+        }
+
+        fn poster(self: @ContractState) -> ContractAddress {
+            self.poster.read()
+        }
+
+        fn set_poster(ref self: ContractState, poster: ContractAddress) {
+            self.ownable.assert_only_owner();
+            self.poster.write(poster);
+            self.emit(PosterChanged { poster });
+        }
+    }
+}
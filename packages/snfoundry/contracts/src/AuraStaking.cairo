@@ -0,0 +1,210 @@
+// Commitment stakes: a user locks STRK on a habit, and the backend oracle
+// returns it when the habit is completed or sends it to the beneficiary
+// when the streak breaks
+#[derive(Copy, Drop, Serde, PartialEq, Debug, starknet::Store)]
+pub enum StakeStatus {
+    #[default]
+    None,
+    Active,
+    Returned,
+    Forfeited,
+}
+
+#[derive(Copy, Drop, Serde, PartialEq, Debug, starknet::Store)]
+pub struct Stake {
+    pub staker: starknet::ContractAddress,
+    pub amount: u256,
+    pub deadline: u64,
+    pub status: StakeStatus,
+}
+
+#[starknet::interface]
+pub trait IAuraStaking<TContractState> {
+    fn stake(ref self: TContractState, habit_id: felt252, amount: u256, deadline: u64);
+    fn resolve(ref self: TContractState, habit_id: felt252, success: bool);
+    fn reclaim(ref self: TContractState, habit_id: felt252);
+    fn stake_of(self: @TContractState, habit_id: felt252) -> Stake;
+    fn token(self: @TContractState) -> starknet::ContractAddress;
+    fn oracle(self: @TContractState) -> starknet::ContractAddress;
+    fn beneficiary(self: @TContractState) -> starknet::ContractAddress;
+    fn set_oracle(ref self: TContractState, oracle: starknet::ContractAddress);
+    fn set_beneficiary(ref self: TContractState, beneficiary: starknet::ContractAddress);
+}
+
+#[starknet::contract]
+pub mod AuraStaking {
+    use openzeppelin_access::ownable::OwnableComponent;
+    use openzeppelin_token::erc20::interface::{IERC20Dispatcher, IERC20DispatcherTrait};
+    use starknet::storage::{
+        Map, StorageMapReadAccess, StorageMapWriteAccess, StoragePointerReadAccess,
+        StoragePointerWriteAccess,
+    };
+    use starknet::{ContractAddress, get_block_timestamp, get_caller_address, get_contract_address};
+    use super::{IAuraStaking, Stake, StakeStatus};
+
+    component!(path: OwnableComponent, storage: ownable, event: OwnableEvent);
+
+    #[abi(embed_v0)]
+    impl OwnableImpl = OwnableComponent::OwnableImpl<ContractState>;
+    impl OwnableInternalImpl = OwnableComponent::InternalImpl<ContractState>;
+
+    // Stakers get their funds back if the oracle has not resolved a stake
+    // this long after its deadline
+    pub const RECLAIM_DELAY: u64 = 30 * 24 * 60 * 60;
+
+    pub mod Errors {
+        pub const NOT_ORACLE: felt252 = 'Caller is not the oracle';
+        pub const NOT_STAKER: felt252 = 'Caller is not the staker';
+        pub const ALREADY_STAKED: felt252 = 'Habit already staked';
+        pub const NOT_ACTIVE: felt252 = 'Stake not active';
+        pub const ZERO_AMOUNT: felt252 = 'Amount is zero';
+        pub const PAST_DEADLINE: felt252 = 'Deadline is in the past';
+        pub const TOO_EARLY: felt252 = 'Reclaim delay not over';
+        pub const TRANSFER_FAILED: felt252 = 'Token transfer failed';
+    }
+
+    #[event]
+    #[derive(Drop, starknet::Event)]
+    enum Event {
+        #[flat]
+        OwnableEvent: OwnableComponent::Event,
+        Staked: Staked,
+        StakeResolved: StakeResolved,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct Staked {
+        #[key]
+        pub habit_id: felt252,
+        #[key]
+        pub staker: ContractAddress,
+        pub amount: u256,
+        pub deadline: u64,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct StakeResolved {
+        #[key]
+        pub habit_id: felt252,
+        pub success: bool,
+        pub recipient: ContractAddress,
+        pub amount: u256,
+    }
+
+    #[storage]
+    struct Storage {
+        token: ContractAddress,
+        oracle: ContractAddress,
+        beneficiary: ContractAddress,
+        stakes: Map<felt252, Stake>,
+        #[substorage(v0)]
+        ownable: OwnableComponent::Storage,
+    }
+
+    #[constructor]
+    fn constructor(
+        ref self: ContractState,
+        owner: ContractAddress,
+        token: ContractAddress,
+        oracle: ContractAddress,
+        beneficiary: ContractAddress,
+    ) {
+        self.ownable.initializer(owner);
+        self.token.write(token);
+        self.oracle.write(oracle);
+        self.beneficiary.write(beneficiary);
+    }
+
+    #[abi(embed_v0)]
+    impl AuraStakingImpl of IAuraStaking<ContractState> {
+        // The staker approves the amount on the token first
+        fn stake(ref self: ContractState, habit_id: felt252, amount: u256, deadline: u64) {
+            assert(amount > 0, Errors::ZERO_AMOUNT);
+            assert(deadline > get_block_timestamp(), Errors::PAST_DEADLINE);
+            assert(self.stakes.read(habit_id).status == StakeStatus::None, Errors::ALREADY_STAKED);
+
+            let staker = get_caller_address();
+            self
+                .stakes
+                .write(habit_id, Stake { staker, amount, deadline, status: StakeStatus::Active });
+
+            let token = IERC20Dispatcher { contract_address: self.token.read() };
+            assert(
+                token.transfer_from(staker, get_contract_address(), amount),
+                Errors::TRANSFER_FAILED,
+            );
+            self.emit(Staked { habit_id, staker, amount, deadline });
+        }
+
+        fn resolve(ref self: ContractState, habit_id: felt252, success: bool) {
+            assert(get_caller_address() == self.oracle.read(), Errors::NOT_ORACLE);
+
+            let recipient = if success {
+                self.stakes.read(habit_id).staker
+            } else {
+                self.beneficiary.read()
+            };
+            let status = if success {
+                StakeStatus::Returned
+            } else {
+                StakeStatus::Forfeited
+            };
+            self.settle(habit_id, status, recipient, success);
+        }
+
+        fn reclaim(ref self: ContractState, habit_id: felt252) {
+            let stake = self.stakes.read(habit_id);
+            assert(get_caller_address() == stake.staker, Errors::NOT_STAKER);
+            assert(get_block_timestamp() > stake.deadline + RECLAIM_DELAY, Errors::TOO_EARLY);
+            self.settle(habit_id, StakeStatus::Returned, stake.staker, true);
+        }
+
+        fn stake_of(self: @ContractState, habit_id: felt252) -> Stake {
+            self.stakes.read(habit_id)
+        }
+
+        fn token(self: @ContractState) -> ContractAddress {
+            self.token.read()
+        }
+
+        fn oracle(self: @ContractState) -> ContractAddress {
+            self.oracle.read()
+        }
+
+        fn beneficiary(self: @ContractState) -> ContractAddress {
+            self.beneficiary.read()
+        }
+
+        fn set_oracle(ref self: ContractState, oracle: ContractAddress) {
+            self.ownable.assert_only_owner();
+            self.oracle.write(oracle);
+        }
+
+        fn set_beneficiary(ref self: ContractState, beneficiary: ContractAddress) {
+            self.ownable.assert_only_owner();
+            self.beneficiary.write(beneficiary);
+        }
+    }
+
+    #[generate_trait]
+    impl InternalImpl of InternalTrait {
+        // Closes an active stake and pays its amount to the recipient
+        fn settle(
+            ref self: ContractState,
+            habit_id: felt252,
+            status: StakeStatus,
+            recipient: ContractAddress,
+            success: bool,
+        ) {
+            let mut stake = self.stakes.read(habit_id);
+            assert(stake.status == StakeStatus::Active, Errors::NOT_ACTIVE);
+
+            stake.status = status;
+            self.stakes.write(habit_id, stake);
+
+            let token = IERC20Dispatcher { contract_address: self.token.read() };
+            assert(token.transfer(recipient, stake.amount), Errors::TRANSFER_FAILED);
+            self.emit(StakeResolved { habit_id, success, recipient, amount: stake.amount });
+        }
+    }
+}
@@ -0,0 +1,119 @@
+// AURA, the ERC-20 reward token minted by the backend when users claim the
+// points accrued by their check-ins
+#[starknet::interface]
+pub trait IAuraToken<TContractState> {
+    fn mint(
+        ref self: TContractState, claim_id: felt252, to: starknet::ContractAddress, amount: u256,
+    ) -> bool;
+    fn is_minted(self: @TContractState, claim_id: felt252, to: starknet::ContractAddress) -> bool;
+    fn minter(self: @TContractState) -> starknet::ContractAddress;
+    fn set_minter(ref self: TContractState, minter: starknet::ContractAddress);
+}
+
+#[starknet::contract]
+pub mod AuraToken {
+    use openzeppelin_access::ownable::OwnableComponent;
+    use openzeppelin_token::erc20::{DefaultConfig, ERC20Component, ERC20HooksEmptyImpl};
+    use starknet::storage::{
+        Map, StorageMapReadAccess, StorageMapWriteAccess, StoragePointerReadAccess,
+        StoragePointerWriteAccess,
+    };
+    use starknet::{ContractAddress, get_caller_address};
+    use super::IAuraToken;
+
+    component!(path: ERC20Component, storage: erc20, event: ERC20Event);
+    component!(path: OwnableComponent, storage: ownable, event: OwnableEvent);
+
+    #[abi(embed_v0)]
+    impl ERC20MixinImpl = ERC20Component::ERC20MixinImpl<ContractState>;
+    impl ERC20InternalImpl = ERC20Component::InternalImpl<ContractState>;
+
+    #[abi(embed_v0)]
+    impl OwnableImpl = OwnableComponent::OwnableImpl<ContractState>;
+    impl OwnableInternalImpl = OwnableComponent::InternalImpl<ContractState>;
+
+    pub mod Errors {
+        pub const NOT_MINTER: felt252 = 'Caller is not the minter';
+        pub const INVALID_CLAIM: felt252 = 'Claim id is zero';
+        pub const ZERO_AMOUNT: felt252 = 'Amount is zero';
+    }
+
+    #[event]
+    #[derive(Drop, starknet::Event)]
+    enum Event {
+        #[flat]
+        ERC20Event: ERC20Component::Event,
+        #[flat]
+        OwnableEvent: OwnableComponent::Event,
+        RewardMinted: RewardMinted,
+        MinterChanged: MinterChanged,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct RewardMinted {
+        #[key]
+        pub claim_id: felt252,
+        #[key]
+        pub to: ContractAddress,
+        pub amount: u256,
+    }
+
+    #[derive(Drop, starknet::Event)]
+    pub struct MinterChanged {
+        pub minter: ContractAddress,
+    }
+
+    #[storage]
+    struct Storage {
+        minter: ContractAddress,
+        // Recipients already paid by each claim, so a claim sent again after
+        // its transaction was dropped cannot mint twice
+        minted: Map<(felt252, ContractAddress), bool>,
+        #[substorage(v0)]
+        erc20: ERC20Component::Storage,
+        #[substorage(v0)]
+        ownable: OwnableComponent::Storage,
+    }
+
+    #[constructor]
+    fn constructor(ref self: ContractState, owner: ContractAddress, minter: ContractAddress) {
+        self.erc20.initializer("Aura", "AURA");
+        self.ownable.initializer(owner);
+        self.minter.write(minter);
+    }
+
+    #[abi(embed_v0)]
+    impl AuraTokenImpl of IAuraToken<ContractState> {
+        // Mints the amount a claim owes to a recipient. Returns false without
+        // minting when the claim already paid them.
+        fn mint(
+            ref self: ContractState, claim_id: felt252, to: ContractAddress, amount: u256,
+        ) -> bool {
+            assert(get_caller_address() == self.minter.read(), Errors::NOT_MINTER);
+            assert(claim_id != 0, Errors::INVALID_CLAIM);
+            assert(amount != 0, Errors::ZERO_AMOUNT);
+
+            if self.minted.read((claim_id, to)) {
+                return false;
+            }
+            self.minted.write((claim_id, to), true);
+            self.erc20.mint(to, amount);
+            self.emit(RewardMinted { claim_id, to, amount });
+            true
+        }
+
+        fn is_minted(self: @ContractState, claim_id: felt252, to: ContractAddress) -> bool {
+            self.minted.read((claim_id, to))
+        }
+
+        fn minter(self: @ContractState) -> ContractAddress {
+            self.minter.read()
+        }
+
+        fn set_minter(ref self: ContractState, minter: ContractAddress) {
+            self.ownable.assert_only_owner();
+            self.minter.write(minter);
+            self.emit(MinterChanged { minter });
+        }
+    }
+}
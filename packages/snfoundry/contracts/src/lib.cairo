@@ -1,2 +1,8 @@
+pub mod AuraAchievements;
+pub mod AuraAttestations;
+pub mod AuraStaking;
+pub mod AuraToken;
 pub mod YourContract;
-
+pub mod mocks {
+    pub mod MockToken;
+}
@@ -0,0 +1,32 @@
+// ERC-20 with a fixed supply minted to a recipient, used by the tests in
+// place of STRK
+#[starknet::contract]
+pub mod MockToken {
+    use openzeppelin_token::erc20::{DefaultConfig, ERC20Component, ERC20HooksEmptyImpl};
+    use starknet::ContractAddress;
+
+    component!(path: ERC20Component, storage: erc20, event: ERC20Event);
+
+    #[abi(embed_v0)]
+    impl ERC20MixinImpl = ERC20Component::ERC20MixinImpl<ContractState>;
+    impl ERC20InternalImpl = ERC20Component::InternalImpl<ContractState>;
+
+    #[event]
+    #[derive(Drop, starknet::Event)]
+    enum Event {
+        #[flat]
+        ERC20Event: ERC20Component::Event,
+    }
+
+    #[storage]
+    struct Storage {
+        #[substorage(v0)]
+        erc20: ERC20Component::Storage,
+    }
+
+    #[constructor]
+    fn constructor(ref self: ContractState, recipient: ContractAddress, supply: u256) {
+        self.erc20.initializer("Mock Token", "MOCK");
+        self.erc20.mint(recipient, supply);
+    }
+}
@@ -0,0 +1,90 @@
+use contracts::AuraAchievements::{
+    Achievement, IAuraAchievementsDispatcher, IAuraAchievementsDispatcherTrait,
+};
+use openzeppelin_token::erc721::interface::{IERC721Dispatcher, IERC721DispatcherTrait};
+use openzeppelin_utils::serde::SerializedAppend;
+use snforge_std::{CheatSpan, ContractClassTrait, DeclareResultTrait, cheat_caller_address, declare};
+use starknet::ContractAddress;
+
+const OWNER: felt252 = 0x111;
+const MINTER: felt252 = 0x222;
+const USER: felt252 = 0x333;
+const HABIT_ID: felt252 = 0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f;
+
+fn address(value: felt252) -> ContractAddress {
+    value.try_into().unwrap()
+}
+
+fn deploy() -> ContractAddress {
+    let contract_class = declare("AuraAchievements").unwrap().contract_class();
+    let mut calldata = array![];
+    calldata.append_serde(address(OWNER));
+    calldata.append_serde(address(MINTER));
+    let base_uri: ByteArray = "https://api.aura.example/achievements/";
+    calldata.append_serde(base_uri);
+    let (contract_address, _) = contract_class.deploy(@calldata).unwrap();
+    contract_address
+}
+
+fn mint(contract_address: ContractAddress, habit_id: felt252) -> u256 {
+    cheat_caller_address(contract_address, address(MINTER), CheatSpan::TargetCalls(1));
+    IAuraAchievementsDispatcher { contract_address }
+        .mint(address(USER), habit_id, "Read 10 pages", 7, 1735689600, 1736294400)
+}
+
+#[test]
+fn test_mint_records_achievement() {
+    let contract_address = deploy();
+    let achievements = IAuraAchievementsDispatcher { contract_address };
+
+    let token_id = mint(contract_address, HABIT_ID);
+    assert(token_id == 1, 'First token id should be 1');
+    assert(achievements.total_supply() == 1, 'Supply should be 1');
+    assert(achievements.token_for_habit(HABIT_ID) == 1, 'Habit should map to token');
+
+    let owner = IERC721Dispatcher { contract_address }.owner_of(token_id);
+    assert(owner == address(USER), 'User should own the token');
+
+    let expected = Achievement {
+        habit_id: HABIT_ID,
+        name: "Read 10 pages",
+        goal_days: 7,
+        started_at: 1735689600,
+        completed_at: 1736294400,
+    };
+    assert(achievements.achievement(token_id) == expected, 'Wrong achievement metadata');
+}
+
+#[test]
+#[should_panic(expected: 'Habit already minted')]
+fn test_mint_once_per_habit() {
+    let contract_address = deploy();
+    mint(contract_address, HABIT_ID);
+    mint(contract_address, HABIT_ID);
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the minter')]
+fn test_only_minter_mints() {
+    let contract_address = deploy();
+    IAuraAchievementsDispatcher { contract_address }
+        .mint(address(USER), HABIT_ID, "Read 10 pages", 7, 0, 0);
+}
+
+#[test]
+fn test_owner_changes_minter() {
+    let contract_address = deploy();
+    let achievements = IAuraAchievementsDispatcher { contract_address };
+
+    cheat_caller_address(contract_address, address(OWNER), CheatSpan::TargetCalls(1));
+    achievements.set_minter(address(USER));
+    assert(achievements.minter() == address(USER), 'Minter should change');
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the owner')]
+fn test_only_owner_changes_minter() {
+    let contract_address = deploy();
+    cheat_caller_address(contract_address, address(MINTER), CheatSpan::TargetCalls(1));
+    IAuraAchievementsDispatcher { contract_address }.set_minter(address(MINTER));
+}
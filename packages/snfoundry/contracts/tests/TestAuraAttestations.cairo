@@ -0,0 +1,77 @@
+use contracts::AuraAttestations::{IAuraAttestationsDispatcher, IAuraAttestationsDispatcherTrait};
+use openzeppelin_utils::serde::SerializedAppend;
+use snforge_std::{
+    CheatSpan, ContractClassTrait, DeclareResultTrait, cheat_caller_address, declare,
+    start_cheat_block_timestamp_global,
+};
+use starknet::ContractAddress;
+
+const OWNER: felt252 = 0x111;
+const POSTER: felt252 = 0x222;
+const DAY: u32 = 20250310;
+const ROOT: u256 = 0x1111111111111111111111111111111122222222222222222222222222222222;
+
+fn address(value: felt252) -> ContractAddress {
+    value.try_into().unwrap()
+}
+
+fn deploy() -> ContractAddress {
+    let contract_class = declare("AuraAttestations").unwrap().contract_class();
+    let mut calldata = array![];
+    calldata.append_serde(address(OWNER));
+    calldata.append_serde(address(POSTER));
+    let (contract_address, _) = contract_class.deploy(@calldata).unwrap();
+    contract_address
+}
+
+fn post(contract_address: ContractAddress, root: u256) {
+    cheat_caller_address(contract_address, address(POSTER), CheatSpan::TargetCalls(1));
+    IAuraAttestationsDispatcher { contract_address }.post_root(DAY, root, 3);
+}
+
+#[test]
+fn test_post_root() {
+    let contract_address = deploy();
+    let registry = IAuraAttestationsDispatcher { contract_address };
+
+    start_cheat_block_timestamp_global(1741651200);
+    post(contract_address, ROOT);
+
+    assert(registry.root_of(DAY) == ROOT, 'Root should be stored');
+    let attestation = registry.attestation(DAY);
+    assert(attestation.leaves == 3, 'Leaves should be stored');
+    assert(attestation.posted_at == 1741651200, 'Time should be stored');
+    assert(registry.root_of(DAY + 1) == 0, 'Other days should be empty');
+}
+
+#[test]
+fn test_same_root_is_a_noop() {
+    let contract_address = deploy();
+    post(contract_address, ROOT);
+    post(contract_address, ROOT);
+    let registry = IAuraAttestationsDispatcher { contract_address };
+    assert(registry.root_of(DAY) == ROOT, 'Root should stay');
+}
+
+#[test]
+#[should_panic(expected: 'Day already attested')]
+fn test_roots_are_final() {
+    let contract_address = deploy();
+    post(contract_address, ROOT);
+    post(contract_address, ROOT + 1);
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the poster')]
+fn test_only_poster_posts() {
+    let contract_address = deploy();
+    IAuraAttestationsDispatcher { contract_address }.post_root(DAY, ROOT, 3);
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the owner')]
+fn test_only_owner_changes_poster() {
+    let contract_address = deploy();
+    cheat_caller_address(contract_address, address(POSTER), CheatSpan::TargetCalls(1));
+    IAuraAttestationsDispatcher { contract_address }.set_poster(address(POSTER));
+}
@@ -0,0 +1,128 @@
+use contracts::AuraStaking::{
+    AuraStaking::RECLAIM_DELAY, IAuraStakingDispatcher, IAuraStakingDispatcherTrait, StakeStatus,
+};
+use openzeppelin_token::erc20::interface::{IERC20Dispatcher, IERC20DispatcherTrait};
+use openzeppelin_utils::serde::SerializedAppend;
+use snforge_std::{
+    CheatSpan, ContractClassTrait, DeclareResultTrait, cheat_caller_address, declare,
+    start_cheat_block_timestamp_global,
+};
+use starknet::ContractAddress;
+
+const OWNER: felt252 = 0x111;
+const ORACLE: felt252 = 0x222;
+const STAKER: felt252 = 0x333;
+const CHARITY: felt252 = 0x444;
+const HABIT_ID: felt252 = 0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f;
+const AMOUNT: u256 = 1000;
+const DEADLINE: u64 = 2000;
+
+fn address(value: felt252) -> ContractAddress {
+    value.try_into().unwrap()
+}
+
+// Deploys a token funding the staker and the escrow, and stakes AMOUNT on HABIT_ID
+fn setup() -> (IAuraStakingDispatcher, IERC20Dispatcher) {
+    let token_class = declare("MockToken").unwrap().contract_class();
+    let mut calldata = array![];
+    calldata.append_serde(address(STAKER));
+    calldata.append_serde(AMOUNT * 10);
+    let (token_address, _) = token_class.deploy(@calldata).unwrap();
+
+    let staking_class = declare("AuraStaking").unwrap().contract_class();
+    let mut calldata = array![];
+    calldata.append_serde(address(OWNER));
+    calldata.append_serde(token_address);
+    calldata.append_serde(address(ORACLE));
+    calldata.append_serde(address(CHARITY));
+    let (staking_address, _) = staking_class.deploy(@calldata).unwrap();
+
+    let staking = IAuraStakingDispatcher { contract_address: staking_address };
+    let token = IERC20Dispatcher { contract_address: token_address };
+
+    start_cheat_block_timestamp_global(1000);
+    cheat_caller_address(token_address, address(STAKER), CheatSpan::TargetCalls(1));
+    token.approve(staking_address, AMOUNT);
+    cheat_caller_address(staking_address, address(STAKER), CheatSpan::TargetCalls(1));
+    staking.stake(HABIT_ID, AMOUNT, DEADLINE);
+
+    (staking, token)
+}
+
+fn resolve(staking: IAuraStakingDispatcher, success: bool) {
+    cheat_caller_address(staking.contract_address, address(ORACLE), CheatSpan::TargetCalls(1));
+    staking.resolve(HABIT_ID, success);
+}
+
+#[test]
+fn test_stake_locks_funds() {
+    let (staking, token) = setup();
+
+    let stake = staking.stake_of(HABIT_ID);
+    assert(stake.staker == address(STAKER), 'Wrong staker');
+    assert(stake.amount == AMOUNT, 'Wrong amount');
+    assert(stake.status == StakeStatus::Active, 'Stake should be active');
+    assert(token.balance_of(staking.contract_address) == AMOUNT, 'Escrow should hold the stake');
+}
+
+#[test]
+fn test_success_returns_stake() {
+    let (staking, token) = setup();
+    resolve(staking, true);
+
+    assert(staking.stake_of(HABIT_ID).status == StakeStatus::Returned, 'Stake should be returned');
+    assert(token.balance_of(address(STAKER)) == AMOUNT * 10, 'Staker should be refunded');
+}
+
+#[test]
+fn test_failure_forfeits_stake() {
+    let (staking, token) = setup();
+    resolve(staking, false);
+
+    assert(staking.stake_of(HABIT_ID).status == StakeStatus::Forfeited, 'Stake should be forfeited');
+    assert(token.balance_of(address(CHARITY)) == AMOUNT, 'Charity should get the stake');
+}
+
+#[test]
+#[should_panic(expected: 'Stake not active')]
+fn test_resolve_once() {
+    let (staking, _) = setup();
+    resolve(staking, false);
+    resolve(staking, true);
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the oracle')]
+fn test_only_oracle_resolves() {
+    let (staking, _) = setup();
+    cheat_caller_address(staking.contract_address, address(STAKER), CheatSpan::TargetCalls(1));
+    staking.resolve(HABIT_ID, true);
+}
+
+#[test]
+#[should_panic(expected: 'Habit already staked')]
+fn test_stake_once_per_habit() {
+    let (staking, token) = setup();
+    cheat_caller_address(token.contract_address, address(STAKER), CheatSpan::TargetCalls(1));
+    token.approve(staking.contract_address, AMOUNT);
+    cheat_caller_address(staking.contract_address, address(STAKER), CheatSpan::TargetCalls(1));
+    staking.stake(HABIT_ID, AMOUNT, DEADLINE);
+}
+
+#[test]
+fn test_reclaim_after_delay() {
+    let (staking, token) = setup();
+
+    start_cheat_block_timestamp_global(DEADLINE + RECLAIM_DELAY + 1);
+    cheat_caller_address(staking.contract_address, address(STAKER), CheatSpan::TargetCalls(1));
+    staking.reclaim(HABIT_ID);
+    assert(token.balance_of(address(STAKER)) == AMOUNT * 10, 'Staker should be refunded');
+}
+
+#[test]
+#[should_panic(expected: 'Reclaim delay not over')]
+fn test_reclaim_too_early() {
+    let (staking, _) = setup();
+    cheat_caller_address(staking.contract_address, address(STAKER), CheatSpan::TargetCalls(1));
+    staking.reclaim(HABIT_ID);
+}
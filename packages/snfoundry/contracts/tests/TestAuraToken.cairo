@@ -0,0 +1,78 @@
+use contracts::AuraToken::{IAuraTokenDispatcher, IAuraTokenDispatcherTrait};
+use openzeppelin_token::erc20::interface::{IERC20Dispatcher, IERC20DispatcherTrait};
+use openzeppelin_utils::serde::SerializedAppend;
+use snforge_std::{CheatSpan, ContractClassTrait, DeclareResultTrait, cheat_caller_address, declare};
+use starknet::ContractAddress;
+
+const OWNER: felt252 = 0x111;
+const MINTER: felt252 = 0x222;
+const USER: felt252 = 0x333;
+const CLAIM_ID: felt252 = 0x6f1c2d3e4b5a4c6d8e7f9a0b1c2d3e4f;
+const AMOUNT: u256 = 25_000_000_000_000_000_000;
+
+fn address(value: felt252) -> ContractAddress {
+    value.try_into().unwrap()
+}
+
+fn deploy() -> ContractAddress {
+    let contract_class = declare("AuraToken").unwrap().contract_class();
+    let mut calldata = array![];
+    calldata.append_serde(address(OWNER));
+    calldata.append_serde(address(MINTER));
+    let (contract_address, _) = contract_class.deploy(@calldata).unwrap();
+    contract_address
+}
+
+fn mint(contract_address: ContractAddress, claim_id: felt252) -> bool {
+    cheat_caller_address(contract_address, address(MINTER), CheatSpan::TargetCalls(1));
+    IAuraTokenDispatcher { contract_address }.mint(claim_id, address(USER), AMOUNT)
+}
+
+#[test]
+fn test_mint_pays_claim() {
+    let contract_address = deploy();
+    let token = IERC20Dispatcher { contract_address };
+
+    assert(mint(contract_address, CLAIM_ID), 'Claim should mint');
+    assert(token.balance_of(address(USER)) == AMOUNT, 'User should hold the reward');
+    assert(token.total_supply() == AMOUNT, 'Supply should be the reward');
+    assert(
+        IAuraTokenDispatcher { contract_address }.is_minted(CLAIM_ID, address(USER)),
+        'Claim should be marked paid',
+    );
+}
+
+#[test]
+fn test_claim_mints_once() {
+    let contract_address = deploy();
+
+    mint(contract_address, CLAIM_ID);
+    assert(!mint(contract_address, CLAIM_ID), 'Resent claim should not mint');
+    assert(mint(contract_address, CLAIM_ID + 1), 'Next claim should mint');
+
+    let balance = IERC20Dispatcher { contract_address }.balance_of(address(USER));
+    assert(balance == AMOUNT * 2, 'User should be paid twice');
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the minter')]
+fn test_only_minter_mints() {
+    let contract_address = deploy();
+    IAuraTokenDispatcher { contract_address }.mint(CLAIM_ID, address(USER), AMOUNT);
+}
+
+#[test]
+#[should_panic(expected: 'Amount is zero')]
+fn test_mint_rejects_zero_amount() {
+    let contract_address = deploy();
+    cheat_caller_address(contract_address, address(MINTER), CheatSpan::TargetCalls(1));
+    IAuraTokenDispatcher { contract_address }.mint(CLAIM_ID, address(USER), 0);
+}
+
+#[test]
+#[should_panic(expected: 'Caller is not the owner')]
+fn test_only_owner_changes_minter() {
+    let contract_address = deploy();
+    cheat_caller_address(contract_address, address(MINTER), CheatSpan::TargetCalls(1));
+    IAuraTokenDispatcher { contract_address }.set_minter(address(MINTER));
+}
@@ -48,6 +48,48 @@ const deployScript = async (): Promise<void> => {
       owner: deployer.address,
     },
   });
+
+  // The backend operator account mints achievements, the deployer until one
+  // is set with set_minter
+  await deployContract({
+    contract: "AuraAchievements",
+    constructorArgs: {
+      owner: deployer.address,
+      minter: process.env.ACHIEVEMENTS_MINTER_ADDRESS || deployer.address,
+      base_uri: process.env.ACHIEVEMENTS_BASE_URI || "",
+    },
+  });
+
+  // Commitment stakes in STRK, resolved by the backend operator account
+  await deployContract({
+    contract: "AuraStaking",
+    constructorArgs: {
+      owner: deployer.address,
+      token:
+        process.env.STAKING_TOKEN_ADDRESS ||
+        "0x04718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d",
+      oracle: process.env.STAKING_ORACLE_ADDRESS || deployer.address,
+      beneficiary: process.env.STAKING_BENEFICIARY_ADDRESS || deployer.address,
+    },
+  });
+
+  // AURA rewards, minted by the backend operator account when points are claimed
+  await deployContract({
+    contract: "AuraToken",
+    constructorArgs: {
+      owner: deployer.address,
+      minter: process.env.REWARDS_MINTER_ADDRESS || deployer.address,
+    },
+  });
+
+  // Daily Merkle roots of check-ins, posted by the backend operator account
+  await deployContract({
+    contract: "AuraAttestations",
+    constructorArgs: {
+      owner: deployer.address,
+      poster: process.env.ATTESTATIONS_POSTER_ADDRESS || deployer.address,
+    },
+  });
 };
 
 const main = async (): Promise<void> => {